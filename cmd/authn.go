@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/repository"
+)
+
+// newAuthenticator builds the chain of authenticators AUTHENTICATORS
+// lists: local for the users table, otherwise the name of a directory in
+// LDAP_CONFIG_FILE.
+func newAuthenticator(config *app.Config, organizationRepo repository.OrganizationRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository, identityRepo repository.FederatedIdentityRepository) (authn.Authenticator, error) {
+	directories := make(map[string]*authn.Directory)
+	if config.LDAPConfigFile != "" {
+		loaded, err := authn.LoadDirectories(config.LDAPConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range loaded {
+			directories[d.Name] = d
+		}
+	}
+
+	var chain authn.Chain
+	for _, name := range config.Authenticators {
+		if name == "local" {
+			chain = append(chain, authn.NewLocalAuthenticator(userRepo))
+			continue
+		}
+		directory, ok := directories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown authenticator %q, expected local or a directory of %s", name, config.LDAPConfigFile)
+		}
+		chain = append(chain, authn.NewLDAPAuthenticator(directory, organizationRepo, userRepo, roleRepo, identityRepo))
+	}
+	log.Printf("Checking passwords with %v", config.Authenticators)
+	return chain, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/repository"
+)
+
+// newAuthorizer builds the authorizer selected by AUTHORIZER. CEL policies
+// are reloaded in the background until ctx is done.
+func newAuthorizer(ctx context.Context, config *app.Config, roleRightRepo repository.RoleRightRepository) (authz.Authorizer, error) {
+	if config.Authorizer != "cel" {
+		return authz.NewRoleRightsAuthorizer(roleRightRepo), nil
+	}
+
+	authorizer, err := authz.NewCELAuthorizer(config.PolicyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies from %s: %w", config.PolicyPath, err)
+	}
+	log.Printf("Authorizing requests with CEL policies from %s", config.PolicyPath)
+	if config.PolicyReloadInterval > 0 {
+		go authorizer.Watch(ctx, config.PolicyReloadInterval)
+	}
+	return authorizer, nil
+}
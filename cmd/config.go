@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"test-tablelink/src/app"
+)
+
+const configUsage = `usage: config print [-json]
+
+print shows every setting, where it came from (default, file, env or
+flag) and its value, with secrets redacted.`
+
+func runConfig(config *app.Config, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	settings := config.Settings()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(settings)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSOURCE\tVALUE")
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.Source, s.Value)
+	}
+	return w.Flush()
+}
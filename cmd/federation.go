@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/v1/federation"
+)
+
+// newIdentityProviders loads the upstream identity providers from
+// IDENTITY_PROVIDERS_FILE, none when it is unset.
+func newIdentityProviders(config *app.Config) ([]*federation.Provider, error) {
+	if config.IdentityProvidersFile == "" {
+		return nil, nil
+	}
+	providers, err := federation.LoadProviders(config.IdentityProvidersFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Federated login with %d identity providers from %s", len(providers), config.IdentityProvidersFile)
+	return providers, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/rand"
+	"log"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/mail"
+)
+
+func newMailer(config *app.Config) mail.Mailer {
+	if config.Mailer == "smtp" {
+		log.Printf("Sending emails through %s", config.SMTPAddr)
+		return mail.NewSMTPMailer(config.SMTPAddr, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	}
+	log.Printf("Writing emails to %s", config.MailDir)
+	return mail.NewFileMailer(config.MailDir, config.MailFrom)
+}
+
+// signingKey returns SIGNING_KEY, or a random key when it is not set:
+// links signed before a restart then stop working.
+func signingKey(config *app.Config) ([]byte, error) {
+	if config.SigningKey != "" {
+		return []byte(config.SigningKey), nil
+	}
+	log.Println("SIGNING_KEY is not set, signing links with a generated key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -16,7 +18,6 @@ import (
 	"test-tablelink/src/v1/middleware"
 	"test-tablelink/src/v1/service"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
@@ -24,11 +25,23 @@ import (
 
 func main() {
 	// Load configuration
-	config, err := app.LoadConfig()
+	config, args, err := app.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// config does not need the database
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfig(config, args[1:]); err != nil {
+			log.Fatalf("config failed: %v", err)
+		}
+		return
+	}
+	config.LogSummary()
+
 	// Initialize database connection
 	db, err := sqlx.Connect("postgres", config.DBConnURI)
 	if err != nil {
@@ -42,10 +55,30 @@ func main() {
 	db.SetConnMaxLifetime(config.DBMaxLifeTime)
 	db.SetConnMaxIdleTime(config.DBMaxIdleTime)
 
-	// Run database migrations
 	ctx := context.Background()
-	if err := migrations.RunMigrations(ctx, db); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+
+	// Run a subcommand instead of serving
+	if len(args) > 0 {
+		var err error
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(ctx, db, args[1:])
+		case "seed":
+			err = runSeed(ctx, db, config, args[1:])
+		default:
+			log.Fatalf("Unknown command %q (expected config, migrate or seed)", args[0])
+		}
+		if err != nil {
+			log.Fatalf("%s failed: %v", args[0], err)
+		}
+		return
+	}
+
+	// Run database migrations
+	if config.MigrateOnStart {
+		if err := migrations.RunMigrations(ctx, db); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
 	}
 
 	// Initialize Redis client
@@ -62,34 +95,104 @@ func main() {
 
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
 	roleRightRepo := repository.NewRoleRightRepository(db)
 	redisRepo := repository.NewRedisRepository(rdb)
+	roleGrantRepo := repository.NewRoleGrantRepository(db)
+	transactor := repository.NewTransactor(db)
+	sectionRepo := repository.NewSectionRepository(db)
+	organizationRepo := repository.NewOrganizationRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	oauthClientRepo := repository.NewOAuthClientRepository(db)
+	oidcClientRepo := repository.NewOIDCClientRepository(db)
+	federatedIdentityRepo := repository.NewFederatedIdentityRepository(db)
+	scimTokenRepo := repository.NewSCIMTokenRepository(db)
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, redisRepo)
+	authenticator, err := newAuthenticator(config, organizationRepo, userRepo, roleRepo, federatedIdentityRepo)
+	if err != nil {
+		log.Fatalf("Failed to initialize authenticators: %v", err)
+	}
+	authService := service.NewAuthService(userRepo, organizationRepo, groupRepo, redisRepo, authenticator)
 	userService := service.NewUserService(userRepo, redisRepo)
+	roleService := service.NewRoleService(roleRepo, roleRightRepo)
+	sectionService := service.NewSectionService(sectionRepo)
+	organizationService := service.NewOrganizationService(organizationRepo)
+	groupService := service.NewGroupService(groupRepo, userRepo, roleRepo)
+	apiTokenService := service.NewAPITokenService(apiTokenRepo, userRepo, groupRepo, config.APITokenMaxLifetime)
+	oauthService := service.NewOAuthService(oauthClientRepo, roleRepo, redisRepo, config.OAuthTokenLifetime)
+	signer, err := newSigner(config)
+	if err != nil {
+		log.Fatalf("Failed to load OIDC signing key: %v", err)
+	}
+	oidcService := service.NewOIDCService(oidcClientRepo, userRepo, groupRepo, redisRepo, authService, signer, config.OIDCIssuer, config.OIDCTokenLifetime)
+	introspectionService := service.NewIntrospectionService(oauthService, apiTokenService, oidcService, apiTokenRepo, userRepo, groupRepo, redisRepo)
+	identityProviders, err := newIdentityProviders(config)
+	if err != nil {
+		log.Fatalf("Failed to load identity providers: %v", err)
+	}
+	federationService := service.NewFederationService(identityProviders, federatedIdentityRepo, userRepo, roleRepo, organizationRepo, redisRepo, authService)
+	scimService := service.NewSCIMService(scimTokenRepo, transactor, userRepo, roleRepo, redisRepo)
+	grantService := service.NewGrantService(transactor, roleGrantRepo, userRepo, roleRepo, redisRepo, config.GrantMaxDuration)
+	impersonationService := service.NewImpersonationService(userRepo, groupRepo, redisRepo, config.ImpersonationLifetime)
+	key, err := signingKey(config)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+	magicLinkService := service.NewMagicLinkService(userRepo, organizationRepo, groupRepo, redisRepo, authService, newMailer(config), key, config.MagicLinkURL, config.MagicLinkLifetime)
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(authService)
 	userHandler := handler.NewUserHandler(userService)
+	roleHandler := handler.NewRoleHandler(roleService)
+	grantHandler := handler.NewGrantHandler(grantService)
+	sectionHandler := handler.NewSectionHandler(sectionService)
+	organizationHandler := handler.NewOrganizationHandler(organizationService)
+	groupHandler := handler.NewGroupHandler(groupService)
+	apiTokenHandler := handler.NewAPITokenHandler(apiTokenService)
+	oauthHandler := handler.NewOAuthHandler(oauthService)
+	oidcHandler := handler.NewOIDCHandler(oidcService)
+	introspectionHandler := handler.NewIntrospectionHandler(introspectionService)
+	federationHandler := handler.NewFederationHandler(federationService)
+	scimHandler := handler.NewSCIMHandler(scimService)
+	impersonationHandler := handler.NewImpersonationHandler(impersonationService)
+	magicLinkHandler := handler.NewMagicLinkHandler(magicLinkService)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService, roleRightRepo)
-
-	// Initialize router
-	r := chi.NewRouter()
-
-	// Public routes
-	r.Group(func(r chi.Router) {
-		authHandler.RegisterRoutes(r)
+	authorizer, err := newAuthorizer(ctx, config, roleRightRepo)
+	if err != nil {
+		log.Fatalf("Failed to initialize authorizer: %v", err)
+	}
+	authMiddleware := middleware.NewAuthMiddleware(authService, sectionService, organizationService, apiTokenService, oauthService, impersonationService, authorizer)
+	scimMiddleware := middleware.NewSCIMMiddleware(scimService)
+	authzService := service.NewAuthzService(authorizer, userRepo, roleRepo, groupRepo)
+
+	// Protected routes are served per section, see handler.NewRouter
+	r := handler.NewRouter(&handler.Handlers{
+		Auth:             authHandler,
+		User:             userHandler,
+		Role:             roleHandler,
+		Grant:            grantHandler,
+		Section:          sectionHandler,
+		Organization:     organizationHandler,
+		Group:            groupHandler,
+		APIToken:         apiTokenHandler,
+		OAuth:            oauthHandler,
+		OIDC:             oidcHandler,
+		Introspection:    introspectionHandler,
+		Federation:       federationHandler,
+		SCIM:             scimHandler,
+		Impersonation:    impersonationHandler,
+		MagicLink:        magicLinkHandler,
+		AuthzService:     authzService,
+		Authenticate:     authMiddleware.Authenticate,
+		Authorize:        authMiddleware.Authorize,
+		SCIMAuthenticate: scimMiddleware.Authenticate,
 	})
 
-	// Protected routes
-	r.Group(func(r chi.Router) {
-		r.Use(authMiddleware.Authenticate)
-		r.Use(authMiddleware.Authorize)
-		userHandler.RegisterRoutes(r)
-	})
+	// Remove temporary roles once their grant expires
+	go grantService.RunExpiry(ctx, config.GrantExpiryInterval)
 
 	// Start server
 	server := &http.Server{
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"test-tablelink/src/migrations"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N applied migrations (default 1)
+  status      list migrations and whether they are applied
+  goto V      apply or revert migrations until V is the latest applied
+  force V     mark migrations up to V as applied without running them`
+
+func runMigrate(ctx context.Context, db *sqlx.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid count %q: %w", args[1], err)
+			}
+		}
+		return m.Down(ctx, n)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(statuses)
+		return nil
+	case "goto":
+		if len(args) < 2 {
+			return errors.New("goto needs a version")
+		}
+		return m.Goto(ctx, args[1])
+	case "force":
+		if len(args) < 2 {
+			return errors.New("force needs a version")
+		}
+		return m.Force(ctx, args[1])
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+}
+
+func printMigrationStatus(statuses []migrations.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Missing:
+			state = "applied (file missing)"
+		case s.Drifted:
+			state = "applied (modified)"
+		case s.Applied:
+			state = "applied"
+		}
+		appliedAt := ""
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Version, state, appliedAt)
+	}
+}
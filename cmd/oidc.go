@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/jwt"
+)
+
+// newSigner loads the key OIDC tokens are signed with from
+// OIDC_SIGNING_KEY_FILE. Without one a key is generated, so tokens issued
+// before a restart no longer verify.
+func newSigner(config *app.Config) (*jwt.Signer, error) {
+	if config.OIDCSigningKeyFile != "" {
+		key, err := jwt.LoadKey(config.OIDCSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.NewSigner(key), nil
+	}
+
+	log.Println("OIDC_SIGNING_KEY_FILE is not set, signing OIDC tokens with a generated key")
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.NewSigner(key), nil
+}
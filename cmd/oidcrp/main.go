@@ -0,0 +1,215 @@
+// Command oidcrp is a stub relying party for trying the OpenID Connect
+// provider locally. It sends the browser through the authorization code
+// flow with PKCE, verifies the ID token against the published key set and
+// shows the ID token claims and the userinfo response.
+//
+//	go run ./cmd/oidcrp -client-id ID [-client-secret SECRET]
+//
+// Register the client first with redirect URI http://localhost:9090/callback
+// (POST /oidc/clients), then open http://localhost:9090.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"test-tablelink/src/jwt"
+	"test-tablelink/src/v1/contract"
+)
+
+type relyingParty struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	discovery    contract.OIDCDiscovery
+
+	mu sync.Mutex
+	// pending maps the state of each started login to its PKCE verifier
+	// and nonce
+	pending map[string][2]string
+}
+
+func main() {
+	issuer := flag.String("issuer", "http://localhost:8080", "provider base URL")
+	clientID := flag.String("client-id", "", "client ID from POST /oidc/clients")
+	clientSecret := flag.String("client-secret", "", "client secret, empty for a public client")
+	listen := flag.String("listen", "localhost:9090", "address to serve the relying party on")
+	flag.Parse()
+	if *clientID == "" {
+		log.Fatal("-client-id is required")
+	}
+
+	rp := &relyingParty{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		redirectURI:  "http://" + *listen + "/callback",
+		pending:      make(map[string][2]string),
+	}
+	if err := getJSON(rp.issuer+"/.well-known/openid-configuration", "", &rp.discovery); err != nil {
+		log.Fatalf("Failed to read discovery: %v", err)
+	}
+
+	http.HandleFunc("/", rp.login)
+	http.HandleFunc("/callback", rp.callback)
+	log.Printf("Open http://%s to log in through %s", *listen, rp.issuer)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+func (rp *relyingParty) login(w http.ResponseWriter, r *http.Request) {
+	state, verifier, nonce := random(), random()+random(), random()
+	rp.mu.Lock()
+	rp.pending[state] = [2]string{verifier, nonce}
+	rp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.clientID},
+		"redirect_uri":          {rp.redirectURI},
+		"scope":                 {"openid profile email roles"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, rp.discovery.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+func (rp *relyingParty) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		http.Error(w, e+": "+query.Get("error_description"), http.StatusForbidden)
+		return
+	}
+	rp.mu.Lock()
+	pending, ok := rp.pending[query.Get("state")]
+	delete(rp.pending, query.Get("state"))
+	rp.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown state", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := rp.exchange(query.Get("code"), pending[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	claims, err := rp.verify(tokens.IDToken)
+	if err != nil {
+		http.Error(w, "id token: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if claims["nonce"] != pending[1] || claims["aud"] != rp.clientID || claims["iss"] != rp.discovery.Issuer {
+		http.Error(w, "id token: wrong nonce, audience or issuer", http.StatusBadGateway)
+		return
+	}
+
+	var userInfo map[string]interface{}
+	if err := getJSON(rp.discovery.UserinfoEndpoint, tokens.AccessToken, &userInfo); err != nil {
+		http.Error(w, "userinfo: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]interface{}{"id_token": claims, "userinfo": userInfo})
+}
+
+func (rp *relyingParty) exchange(code, verifier string) (*contract.OIDCTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {rp.redirectURI},
+		"code_verifier": {verifier},
+		"client_id":     {rp.clientID},
+	}
+	if rp.clientSecret != "" {
+		form.Set("client_secret", rp.clientSecret)
+	}
+	res, err := http.PostForm(rp.discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e contract.OAuthError
+		json.NewDecoder(res.Body).Decode(&e)
+		return nil, fmt.Errorf("token endpoint: %d %s %s", res.StatusCode, e.Error, e.ErrorDescription)
+	}
+	var tokens contract.OIDCTokenResponse
+	return &tokens, json.NewDecoder(res.Body).Decode(&tokens)
+}
+
+// verify checks the ID token signature with the key from jwks_uri and
+// returns its claims.
+func (rp *relyingParty) verify(token string) (map[string]interface{}, error) {
+	var keys jwt.KeySet
+	if err := getJSON(rp.discovery.JWKSURI, "", &keys); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || len(keys.Keys) == 0 {
+		return nil, errors.New("malformed token or empty key set")
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(keys.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(keys.Keys[0].E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	return claims, json.Unmarshal(payload, &claims)
+}
+
+func getJSON(target, bearer string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func random() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/repository"
+	"test-tablelink/src/seed"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/term"
+)
+
+const seedUsage = `usage: seed [-env ENV | -file FILE]
+       seed bootstrap
+
+seed upserts the organizations, sections, roles, rights and users of the
+built-in fixture for ENV (defaults to the ENV setting) or of a YAML/JSON FILE.
+
+bootstrap creates the first admin of the default organization when no user
+there has the admin role yet. It reads BOOTSTRAP_ADMIN_EMAIL,
+BOOTSTRAP_ADMIN_PASSWORD, BOOTSTRAP_ADMIN_NAME and BOOTSTRAP_ADMIN_ROLE
+(default "admin"), prompting on stdin for a missing email or password.`
+
+func runSeed(ctx context.Context, db *sqlx.DB, config *app.Config, args []string) error {
+	seeder := seed.NewSeeder(
+		repository.NewUserRepository(db),
+		repository.NewRoleRepository(db),
+		repository.NewRoleRightRepository(db),
+		repository.NewSectionRepository(db),
+		repository.NewOrganizationRepository(db),
+		repository.NewTransactor(db),
+	)
+
+	if len(args) > 0 && args[0] == "bootstrap" {
+		return runBootstrap(ctx, seeder, os.Stdin)
+	}
+
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), seedUsage) }
+	env := fs.String("env", config.Env, "environment whose built-in fixture is seeded")
+	file := fs.String("file", "", "YAML or JSON fixture file to seed instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var fixture *seed.Fixture
+	var err error
+	if *file != "" {
+		fixture, err = seed.LoadFile(*file)
+	} else {
+		fixture, err = seed.LoadEnv(*env)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := seeder.Seed(ctx, fixture)
+	if err != nil {
+		return err
+	}
+	log.Printf("Seeded: %d organizations created, %d sections created, %d roles created, %d roles updated, %d rights created, %d rights updated, %d users created, %d users updated",
+		result.OrganizationsCreated, result.SectionsCreated, result.RolesCreated, result.RolesUpdated, result.RightsCreated, result.RightsUpdated, result.UsersCreated, result.UsersUpdated)
+	return nil
+}
+
+func runBootstrap(ctx context.Context, seeder *seed.Seeder, stdin io.Reader) error {
+	admin := seed.Admin{
+		Name:     os.Getenv("BOOTSTRAP_ADMIN_NAME"),
+		Email:    os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		Password: os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"),
+		Role:     os.Getenv("BOOTSTRAP_ADMIN_ROLE"),
+	}
+	if admin.Role == "" {
+		admin.Role = "admin"
+	}
+
+	reader := bufio.NewReader(stdin)
+	prompt := func(label string) (string, error) {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+		line, err := reader.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(label), err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	var err error
+	if admin.Email == "" {
+		if admin.Email, err = prompt("Admin email"); err != nil {
+			return err
+		}
+	}
+	if admin.Password == "" {
+		if admin.Password, err = promptPassword(stdin, prompt); err != nil {
+			return err
+		}
+	}
+
+	user, err := seeder.Bootstrap(ctx, admin)
+	if errors.Is(err, seed.ErrAdminExists) {
+		log.Println("Admin already exists, nothing to bootstrap")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Created admin %s (id %d)", user.Email, user.ID)
+	return nil
+}
+
+// promptPassword reads the password without echoing it when stdin is a
+// terminal, and falls back to prompt for piped input.
+func promptPassword(stdin io.Reader, prompt func(label string) (string, error)) (string, error) {
+	f, ok := stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return prompt("Admin password")
+	}
+	fmt.Fprint(os.Stderr, "Admin password: ")
+	password, err := term.ReadPassword(int(f.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read admin password: %w", err)
+	}
+	return strings.TrimSpace(string(password)), nil
+}
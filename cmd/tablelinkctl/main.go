@@ -0,0 +1,187 @@
+// Command tablelinkctl is the operator tool for users, roles, role rights
+// and sessions. It talks to Postgres and Redis directly using the same
+// configuration as the server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"test-tablelink/src/app"
+	"test-tablelink/src/repository"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+const usage = `usage: tablelinkctl [-o table|json] [-org SLUG] <command> [arguments]
+
+users:
+  user list
+  user create -name NAME -email EMAIL -role ROLE[,ROLE...] [-password PASSWORD]
+  user disable USER
+  user enable USER
+  user reset-password [-password PASSWORD] USER
+  user assign-role USER ROLE
+  user unassign-role USER ROLE
+
+roles and rights:
+  role list
+  right list [ROLE]
+  right grant ROLE SECTION ROUTE OPS [CONDITION]
+  right deny ROLE SECTION ROUTE OPS [CONDITION]
+  right revoke ROLE SECTION ROUTE [OPS]
+  matrix
+  matrix export [-file FILE]
+  matrix import [-dry-run] FILE
+
+sessions:
+  session list [-user USER]
+  session revoke ID
+  session revoke -user USER
+
+USER is a user ID or email. OPS is a subset of "crud" (create, read,
+update, delete); revoke without OPS removes the route from the role.
+ROUTE may end in /* to cover everything below it. A deny rule beats an
+allow rule that is no more specific. CONDITION limits the rule, e.g.
+"own" for the user's own record. A generated password is printed when
+-password is omitted. Sessions are listed by an ID derived from their
+token, never by the token itself; session revoke takes that ID.
+
+matrix export writes every role and right as canonical YAML. matrix import
+makes each role listed in FILE match it exactly, in one transaction; roles
+not in FILE are left alone.
+
+Commands work on the users, roles and sessions of one organization, the
+default organization unless -org names another. -org= (empty) spans every
+organization; matrix needs a single one since role names repeat across
+organizations.`
+
+type ctl struct {
+	users      *repository.UserRepository
+	roles      *repository.RoleRepository
+	roleRights *repository.RoleRightRepository
+	tx         *repository.Transactor
+	redis      *repository.RedisRepository
+	out        *printer
+}
+
+func main() {
+	global := flag.NewFlagSet("tablelinkctl", flag.ExitOnError)
+	global.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	format := global.String("o", "table", "output format: table or json")
+	org := global.String("org", "default", "slug of the organization to work on, empty for all")
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *format)
+		os.Exit(2)
+	}
+
+	config, err := app.LoadConfig()
+	if err != nil {
+		fail(fmt.Errorf("failed to load config: %w", err))
+	}
+
+	db, err := sqlx.Connect("postgres", config.DBConnURI)
+	if err != nil {
+		fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer db.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddr,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	defer rdb.Close()
+
+	c := &ctl{
+		users:      repository.NewUserRepository(db),
+		roles:      repository.NewRoleRepository(db),
+		roleRights: repository.NewRoleRightRepository(db),
+		tx:         repository.NewTransactor(db),
+		redis:      repository.NewRedisRepository(rdb),
+		out:        &printer{format: *format, w: os.Stdout},
+	}
+
+	// An empty -org spans every organization
+	ctx := tenant.All(context.Background())
+	if *org != "" {
+		organization, err := repository.NewOrganizationRepository(db).GetBySlug(ctx, *org)
+		if err != nil {
+			db.Close()
+			fail(fmt.Errorf("unknown organization %q: %w", *org, err))
+		}
+		ctx = tenant.WithOrganization(ctx, organization.ID)
+	}
+
+	if err := c.run(ctx, args); err != nil {
+		db.Close()
+		fail(err)
+	}
+}
+
+func (c *ctl) run(ctx context.Context, args []string) error {
+	if _, scoped := tenant.OrganizationID(ctx); len(args) > 0 && args[0] == "matrix" && !scoped {
+		return errors.New("matrix needs an organization, pass -org")
+	}
+	if len(args) == 1 && args[0] == "matrix" {
+		return c.matrix(ctx)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("missing subcommand\n\n%s", usage)
+	}
+
+	group, cmd, rest := args[0], args[1], args[2:]
+	switch group + " " + cmd {
+	case "user list":
+		return c.userList(ctx)
+	case "user create":
+		return c.userCreate(ctx, rest)
+	case "user disable":
+		return c.userSetDisabled(ctx, rest, true)
+	case "user enable":
+		return c.userSetDisabled(ctx, rest, false)
+	case "user reset-password":
+		return c.userResetPassword(ctx, rest)
+	case "user assign-role":
+		return c.userAssignRole(ctx, rest, true)
+	case "user unassign-role":
+		return c.userAssignRole(ctx, rest, false)
+	case "role list":
+		return c.roleList(ctx)
+	case "matrix export":
+		return c.matrixExport(ctx, rest)
+	case "matrix import":
+		return c.matrixImport(ctx, rest)
+	case "right list":
+		return c.rightList(ctx, rest)
+	case "right grant":
+		return c.rightGrant(ctx, rest, false)
+	case "right deny":
+		return c.rightGrant(ctx, rest, true)
+	case "right revoke":
+		return c.rightRevoke(ctx, rest)
+	case "session list":
+		return c.sessionList(ctx, rest)
+	case "session revoke":
+		return c.sessionRevoke(ctx, rest)
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", group+" "+cmd, usage)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"test-tablelink/src/matrix"
+)
+
+func (c *ctl) permissionMatrix() *matrix.Matrix {
+	return matrix.New(c.tx, c.roles, c.roleRights)
+}
+
+// matrixExport writes the canonical YAML document to stdout or -file.
+func (c *ctl) matrixExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("matrix export", flag.ContinueOnError)
+	file := fs.String("file", "", "write to FILE instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+
+	doc, err := c.permissionMatrix().Export(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := doc.Marshal()
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		_, err = c.out.w.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*file, data, 0o644); err != nil {
+		return err
+	}
+	return c.out.message("Exported %d roles to %s", len(doc.Roles), *file)
+}
+
+// matrixImport makes the roles listed in FILE match it, printing the
+// changes. With -dry-run only the changes are printed.
+func (c *ctl) matrixImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("matrix import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only show what would change")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected FILE")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	doc, err := matrix.Parse(data)
+	if err != nil {
+		return err
+	}
+	changes, err := c.permissionMatrix().Import(ctx, doc, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if c.out.format == "json" {
+		return c.out.print(changes, nil, nil)
+	}
+	fmt.Fprint(c.out.w, changes)
+	for _, name := range changes.Unmanaged {
+		fmt.Fprintf(c.out.w, "  role %s is not in the document, left unchanged\n", name)
+	}
+	switch {
+	case changes.Empty():
+		return c.out.message("Already up to date")
+	case *dryRun:
+		return c.out.message("Dry run: %d changes not applied", changes.Count())
+	}
+	return c.out.message("Applied %d changes", changes.Count())
+}
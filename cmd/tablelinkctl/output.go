@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+// print writes v as indented JSON, or the given rows as an aligned table.
+func (p *printer) print(v interface{}, headers []string, rows [][]string) error {
+	if p.format == "json" {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message prints a one line confirmation, as {"message": ...} in JSON mode.
+func (p *printer) message(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.format == "json" {
+		return p.print(map[string]string{"message": msg}, nil, nil)
+	}
+	_, err := fmt.Fprintln(p.w, msg)
+	return err
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
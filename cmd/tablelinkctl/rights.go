@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/seed"
+	"test-tablelink/src/v1/authz"
+)
+
+type ops struct {
+	create, read, update, delete bool
+}
+
+// parseOps reads a subset of "crud".
+func parseOps(s string) (ops, error) {
+	var o ops
+	if s == "" {
+		return o, errors.New("OPS must not be empty")
+	}
+	for _, ch := range strings.ToLower(s) {
+		switch ch {
+		case 'c':
+			o.create = true
+		case 'r':
+			o.read = true
+		case 'u':
+			o.update = true
+		case 'd':
+			o.delete = true
+		default:
+			return o, fmt.Errorf("invalid operation %q in %q, expected a subset of crud", ch, s)
+		}
+	}
+	return o, nil
+}
+
+func opsString(r *entity.RoleRight) string {
+	if r.Condition != "" {
+		return opsFlags(r) + " if " + r.Condition
+	}
+	return opsFlags(r)
+}
+
+func opsFlags(r *entity.RoleRight) string {
+	var b strings.Builder
+	if r.Deny {
+		b.WriteByte('!')
+	}
+	for _, op := range []struct {
+		set bool
+		ch  byte
+	}{{r.RCreate, 'c'}, {r.RRead, 'r'}, {r.RUpdate, 'u'}, {r.RDelete, 'd'}} {
+		if op.set {
+			b.WriteByte(op.ch)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+func (c *ctl) roleList(ctx context.Context) error {
+	roles, err := c.roles.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(roles))
+	for _, r := range roles {
+		rows = append(rows, []string{strconv.Itoa(r.ID), r.Name})
+	}
+	return c.out.print(roles, []string{"ID", "NAME"}, rows)
+}
+
+func (c *ctl) rightList(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("expected at most one ROLE")
+	}
+	if len(args) == 0 {
+		return c.matrix(ctx)
+	}
+
+	role, err := c.findRole(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	rights, err := c.roleRights.GetByRoleID(ctx, int64(role.ID))
+	if err != nil {
+		return err
+	}
+	return c.printRights(map[int]*entity.Role{role.ID: role}, rights)
+}
+
+// rightGrant adds OPS to the role's rule on the route. With deny the rule
+// forbids them instead. A rule switching between allow and deny keeps only
+// the new OPS, since one row cannot both grant and forbid. An optional
+// CONDITION replaces the rule's condition.
+func (c *ctl) rightGrant(ctx context.Context, args []string, deny bool) error {
+	if len(args) != 4 && len(args) != 5 {
+		return errors.New("expected ROLE SECTION ROUTE OPS [CONDITION]")
+	}
+	var condition string
+	if len(args) == 5 {
+		condition = args[4]
+		if !authz.KnownCondition(condition) {
+			return fmt.Errorf("unknown condition %q", condition)
+		}
+	}
+	role, err := c.findRole(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	section, route := args[1], args[2]
+	o, err := parseOps(args[3])
+	if err != nil {
+		return err
+	}
+
+	right, err := c.roleRights.GetByRoleIDAndRoute(ctx, int64(role.ID), section, route)
+	if errors.Is(err, sql.ErrNoRows) {
+		right = &entity.RoleRight{
+			RoleID:    int64(role.ID),
+			Section:   section,
+			Route:     route,
+			RCreate:   o.create,
+			RRead:     o.read,
+			RUpdate:   o.update,
+			RDelete:   o.delete,
+			Deny:      deny,
+			Condition: condition,
+		}
+		if err := c.roleRights.Create(ctx, right); err != nil {
+			return err
+		}
+		if deny {
+			return c.out.message("Denied %s on %s %s to %s", opsString(right), section, route, role.Name)
+		}
+		return c.out.message("Granted %s on %s %s to %s", opsString(right), section, route, role.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if right.Deny != deny {
+		right.Deny = deny
+		right.RCreate, right.RRead, right.RUpdate, right.RDelete = false, false, false, false
+	}
+	if len(args) == 5 {
+		right.Condition = condition
+	}
+	right.RCreate = right.RCreate || o.create
+	right.RRead = right.RRead || o.read
+	right.RUpdate = right.RUpdate || o.update
+	right.RDelete = right.RDelete || o.delete
+	if err := c.roleRights.Update(ctx, right); err != nil {
+		return err
+	}
+	return c.out.message("%s now has %s on %s %s", role.Name, opsString(right), section, route)
+}
+
+func (c *ctl) rightRevoke(ctx context.Context, args []string) error {
+	if len(args) != 3 && len(args) != 4 {
+		return errors.New("expected ROLE SECTION ROUTE [OPS]")
+	}
+	role, err := c.findRole(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	section, route := args[1], args[2]
+
+	right, err := c.roleRights.GetByRoleIDAndRoute(ctx, int64(role.ID), section, route)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s has no rights on %s %s", role.Name, section, route)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 3 {
+		if err := c.roleRights.Delete(ctx, right.ID); err != nil {
+			return err
+		}
+		return c.out.message("Removed %s %s from %s", section, route, role.Name)
+	}
+
+	o, err := parseOps(args[3])
+	if err != nil {
+		return err
+	}
+	right.RCreate = right.RCreate && !o.create
+	right.RRead = right.RRead && !o.read
+	right.RUpdate = right.RUpdate && !o.update
+	right.RDelete = right.RDelete && !o.delete
+	if err := c.roleRights.Update(ctx, right); err != nil {
+		return err
+	}
+	return c.out.message("%s now has %s on %s %s", role.Name, opsString(right), section, route)
+}
+
+// matrix exports every role with its rights. The JSON form is a seed
+// fixture, so it can be fed back to `seed -file`.
+func (c *ctl) matrix(ctx context.Context) error {
+	roles, err := c.roles.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	rights, err := c.roleRights.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int]*entity.Role, len(roles))
+	for _, r := range roles {
+		byID[r.ID] = r
+	}
+	return c.printRights(byID, rights)
+}
+
+func (c *ctl) printRights(roles map[int]*entity.Role, rights []*entity.RoleRight) error {
+	fixture := seed.Fixture{}
+	index := make(map[int]int)
+	ids := make([]int, 0, len(roles))
+	for id := range roles {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		index[id] = len(fixture.Roles)
+		role := seed.Role{Name: roles[id].Name, Rights: []seed.Right{}}
+		if p := roles[id].ParentID; p != nil {
+			if parent, ok := roles[*p]; ok {
+				role.Parent = parent.Name
+			}
+		}
+		fixture.Roles = append(fixture.Roles, role)
+	}
+
+	rows := make([][]string, 0, len(rights))
+	for _, r := range rights {
+		i, ok := index[int(r.RoleID)]
+		if !ok {
+			continue
+		}
+		fixture.Roles[i].Rights = append(fixture.Roles[i].Rights, seed.Right{
+			Section:   r.Section,
+			Route:     r.Route,
+			Create:    r.RCreate,
+			Read:      r.RRead,
+			Update:    r.RUpdate,
+			Delete:    r.RDelete,
+			Deny:      r.Deny,
+			Condition: r.Condition,
+		})
+		rows = append(rows, []string{
+			roles[int(r.RoleID)].Name,
+			r.Section,
+			r.Route,
+			yesNo(r.RCreate),
+			yesNo(r.RRead),
+			yesNo(r.RUpdate),
+			yesNo(r.RDelete),
+			effect(r),
+			r.Condition,
+		})
+	}
+	return c.out.print(fixture, []string{"ROLE", "SECTION", "ROUTE", "CREATE", "READ", "UPDATE", "DELETE", "EFFECT", "CONDITION"}, rows)
+}
+
+func effect(r *entity.RoleRight) string {
+	if r.Deny {
+		return "deny"
+	}
+	return "allow"
+}
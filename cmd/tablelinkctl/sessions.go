@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
+)
+
+// listedSession is a session as printed: the token is a bearer credential,
+// so it is named by sessionID instead.
+type listedSession struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// sessionID names a session without revealing its token: the first 12 hex
+// digits of the token's SHA-256.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func (c *ctl) sessionList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("session list", flag.ContinueOnError)
+	userRef := fs.String("user", "", "only list sessions of this user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sessions, err := c.sessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *userRef != "" {
+		user, err := c.findUser(ctx, *userRef)
+		if err != nil {
+			return err
+		}
+		filtered := make([]*entity.Session, 0)
+		for _, s := range sessions {
+			if s.UserID == user.ID {
+				filtered = append(filtered, s)
+			}
+		}
+		sessions = filtered
+	}
+
+	listed := make([]listedSession, 0, len(sessions))
+	rows := make([][]string, 0, len(sessions))
+	for _, s := range sessions {
+		id := sessionID(s.Token)
+		listed = append(listed, listedSession{ID: id, UserID: s.UserID, ExpiresAt: s.ExpiresAt})
+		rows = append(rows, []string{id, strconv.FormatInt(s.UserID, 10), s.ExpiresAt.Format(time.RFC3339)})
+	}
+	return c.out.print(listed, []string{"ID", "USER ID", "EXPIRES AT"}, rows)
+}
+
+func (c *ctl) sessionRevoke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("session revoke", flag.ContinueOnError)
+	userRef := fs.String("user", "", "revoke every session of this user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *userRef != "" {
+		user, err := c.findUser(ctx, *userRef)
+		if err != nil {
+			return err
+		}
+		revoked, err := c.revokeUserSessions(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return c.out.message("Revoked %d sessions of %s", revoked, user.Email)
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected ID or -user USER")
+	}
+	sessions, err := c.sessions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if sessionID(s.Token) == fs.Arg(0) {
+			if err := c.redis.DeleteToken(ctx, s.Token); err != nil {
+				return err
+			}
+			return c.out.message("Revoked session %s", fs.Arg(0))
+		}
+	}
+	return fmt.Errorf("session %s not found", fs.Arg(0))
+}
+
+// sessions returns the sessions of the users of the organization ctx is
+// limited to, or every session when it spans all of them.
+func (c *ctl) sessions(ctx context.Context) ([]*entity.Session, error) {
+	sessions, err := c.redis.ListSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, scoped := tenant.OrganizationID(ctx); !scoped {
+		return sessions, nil
+	}
+
+	users, err := c.users.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[int64]bool, len(users))
+	for _, u := range users {
+		members[u.ID] = true
+	}
+	filtered := make([]*entity.Session, 0, len(sessions))
+	for _, s := range sessions {
+		if members[s.UserID] {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered, nil
+}
+
+// revokeUserSessions deletes every token of the user and their cached
+// profile, which is what AuthService.Logout does for a single token.
+func (c *ctl) revokeUserSessions(ctx context.Context, userID int64) (int, error) {
+	sessions, err := c.redis.ListSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, s := range sessions {
+		if s.UserID != userID {
+			continue
+		}
+		if err := c.redis.DeleteToken(ctx, s.Token); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, c.redis.DeleteUser(ctx, userID)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+)
+
+// findUser resolves a user ID or email.
+func (c *ctl) findUser(ctx context.Context, ref string) (*entity.User, error) {
+	var user *entity.User
+	var err error
+	if id, convErr := strconv.ParseInt(ref, 10, 64); convErr == nil {
+		user, err = c.users.GetByID(ctx, id)
+	} else {
+		user, err = c.users.GetByEmail(ctx, ref)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %s not found", ref)
+	}
+	return user, err
+}
+
+func (c *ctl) findRole(ctx context.Context, name string) (*entity.Role, error) {
+	role, err := c.roles.GetByName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("role %s not found", name)
+	}
+	return role, err
+}
+
+func roleNames(u *entity.User) string {
+	names := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		names = append(names, r.Name)
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (c *ctl) userList(ctx context.Context) error {
+	users, err := c.users.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, []string{
+			strconv.FormatInt(u.ID, 10),
+			u.Email,
+			u.Name,
+			roleNames(u),
+			yesNo(u.DisabledAt != nil),
+			formatTime(u.LastAccess),
+		})
+	}
+	return c.out.print(users, []string{"ID", "EMAIL", "NAME", "ROLE", "DISABLED", "LAST ACCESS"}, rows)
+}
+
+func (c *ctl) userCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	name := fs.String("name", "", "display name")
+	email := fs.String("email", "", "email address")
+	roleList := fs.String("role", "", "comma separated role names")
+	pass := fs.String("password", "", "password (generated when empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *email == "" || *roleList == "" {
+		return errors.New("user create needs -name, -email and -role")
+	}
+
+	var roles []entity.Role
+	for _, roleName := range strings.Split(*roleList, ",") {
+		role, err := c.findRole(ctx, strings.TrimSpace(roleName))
+		if err != nil {
+			return err
+		}
+		roles = append(roles, *role)
+	}
+
+	var err error
+
+	generated := *pass == ""
+	if generated {
+		if *pass, err = generatePassword(); err != nil {
+			return err
+		}
+	}
+	hashed, err := password.Hash(*pass)
+	if err != nil {
+		return err
+	}
+
+	user := &entity.User{
+		Roles:    roles,
+		Name:     *name,
+		Email:    *email,
+		Password: hashed,
+	}
+	if err := c.users.Create(ctx, user); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if generated {
+		return c.out.message("Created user %s (id %d) with password %s", user.Email, user.ID, *pass)
+	}
+	return c.out.message("Created user %s (id %d)", user.Email, user.ID)
+}
+
+func (c *ctl) userSetDisabled(ctx context.Context, args []string, disabled bool) error {
+	if len(args) != 1 {
+		return errors.New("expected USER")
+	}
+	user, err := c.findUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if disabled {
+		now := time.Now()
+		user.DisabledAt = &now
+	} else {
+		user.DisabledAt = nil
+	}
+	if err := c.users.Update(ctx, user); err != nil {
+		return err
+	}
+
+	if !disabled {
+		return c.out.message("Enabled user %s", user.Email)
+	}
+	revoked, err := c.revokeUserSessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return c.out.message("Disabled user %s and revoked %d sessions", user.Email, revoked)
+}
+
+func (c *ctl) userResetPassword(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	pass := fs.String("password", "", "new password (generated when empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected USER")
+	}
+
+	user, err := c.findUser(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	generated := *pass == ""
+	if generated {
+		if *pass, err = generatePassword(); err != nil {
+			return err
+		}
+	}
+	if user.Password, err = password.Hash(*pass); err != nil {
+		return err
+	}
+	if err := c.users.Update(ctx, user); err != nil {
+		return err
+	}
+
+	revoked, err := c.revokeUserSessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if generated {
+		return c.out.message("Reset password of %s to %s and revoked %d sessions", user.Email, *pass, revoked)
+	}
+	return c.out.message("Reset password of %s and revoked %d sessions", user.Email, revoked)
+}
+
+func (c *ctl) userAssignRole(ctx context.Context, args []string, assign bool) error {
+	if len(args) != 2 {
+		return errors.New("expected USER ROLE")
+	}
+	user, err := c.findUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	role, err := c.findRole(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	if assign {
+		err = c.users.AssignRole(ctx, user.ID, role.ID)
+	} else {
+		err = c.users.UnassignRole(ctx, user.ID, role.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Sessions read the user from the Redis cache, refresh it so the role
+	// change applies to them right away
+	if _, err := c.redis.GetUser(ctx, user.ID); err == nil {
+		if user, err = c.users.GetByID(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := c.redis.SetUser(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	if assign {
+		return c.out.message("Assigned role %s to %s", role.Name, user.Email)
+	}
+	return c.out.message("Removed role %s from %s", role.Name, user.Email)
+}
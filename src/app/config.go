@@ -1,13 +1,20 @@
 package app
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
@@ -30,102 +37,496 @@ type Config struct {
 	DBMaxIdleTime        time.Duration
 	DBMaxLifeTime        time.Duration
 
+	// Migration Configuration
+	MigrateOnStart bool
+
 	// Server Configuration
 	BindAddress string
+
+	// Authorization Configuration
+	Authorizer           string
+	PolicyPath           string
+	PolicyReloadInterval time.Duration
+
+	// Role Grant Configuration
+	GrantMaxDuration    time.Duration
+	GrantExpiryInterval time.Duration
+
+	// API Token Configuration
+	APITokenMaxLifetime time.Duration
+
+	// OAuth Configuration
+	OAuthTokenLifetime time.Duration
+
+	// Impersonation Configuration
+	ImpersonationLifetime time.Duration
+
+	// OpenID Connect Provider Configuration
+	OIDCIssuer         string
+	OIDCSigningKeyFile string
+	OIDCTokenLifetime  time.Duration
+
+	// Authentication Configuration
+	Authenticators []string
+	LDAPConfigFile string
+
+	// Federated Login Configuration
+	IdentityProvidersFile string
+
+	// Magic Link Configuration
+	MagicLinkURL      string
+	MagicLinkLifetime time.Duration
+
+	// Mail Configuration
+	Mailer       string
+	MailDir      string
+	MailFrom     string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// Security Configuration
+	SigningKey string
+
+	values map[string]value
+}
+
+// Sources a setting can come from, from lowest to highest precedence.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// DefaultConfigFile is read when present and no other file is given.
+const DefaultConfigFile = "config.yaml"
+
+type value struct {
+	value  string
+	source string
+}
+
+// Setting is one resolved configuration value, as shown by `config print`.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
 }
 
 var cfg *Config
 
+// LoadConfig reads the configuration from the config file and the
+// environment, without command line flags.
 func LoadConfig() (*Config, error) {
-	if err := godotenv.Load(); err != nil {
-		return nil, fmt.Errorf("error loading .env file: %w", err)
-	}
+	config, _, err := Load(nil)
+	return config, err
+}
 
-	// Debug: Print all environment variables
-	log.Println("Loading environment variables...")
-	for _, env := range os.Environ() {
-		log.Println(env)
+// Load resolves the configuration from, in increasing precedence: defaults,
+// the YAML config file, the environment (including .env) and flags in args.
+// Secrets can also be given as a path through their *_FILE variant. It
+// returns the arguments left after the flags, e.g. a subcommand, and
+// flag.ErrHelp after printing the flag list for -h.
+func Load(args []string) (*Config, []string, error) {
+	// .env is optional, container deploys pass real environment variables
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("error loading .env file: %w", err)
 	}
 
-	// Parse numeric values
-	logLevel, err := strconv.Atoi(getEnv("LOG_LEVEL", "1"))
+	config, rest, err := load(args, os.LookupEnv, os.ReadFile)
 	if err != nil {
-		return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		return nil, nil, err
 	}
+	cfg = config
+	return config, rest, nil
+}
 
-	redisDB, err := strconv.Atoi(getEnv("REDIS_DB", "0"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid REDIS_DB: %w", err)
+func GetConfig() *Config {
+	return cfg
+}
+
+type lookupFunc func(key string) (string, bool)
+
+type readFileFunc func(path string) ([]byte, error)
+
+func load(args []string, lookupEnv lookupFunc, readFile readFileFunc) (*Config, []string, error) {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: [flags] [config|migrate|seed ...]")
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", "", "path to the YAML config file (env CONFIG_FILE)")
+	flagValues := make(map[string]*string)
+	for _, s := range settings {
+		flagValues[s.key] = fs.String(s.flagName(), "", s.usage)
+		if s.secret {
+			flagValues[s.key+"_FILE"] = fs.String(s.flagName()+"-file", "", "file containing "+s.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("invalid flags: %w", err)
 	}
 
-	maxPoolSize, err := strconv.Atoi(getEnv("PG_MAX_POOL_SZE", "10"))
+	setFlags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		setFlags[strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))] = f.Value.String()
+	})
+
+	fileValues, err := readConfigFile(*configFile, lookupEnv, readFile)
 	if err != nil {
-		return nil, fmt.Errorf("invalid PG_MAX_POOL_SZE: %w", err)
+		return nil, nil, err
 	}
 
-	maxIdleConnections, err := strconv.Atoi(getEnv("PG_MAX_IDLE_CONNECTIONS", "5"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid PG_MAX_IDLE_CONNECTIONS: %w", err)
+	// A misspelled file key would silently leave its setting at the default
+	errs := unknownFileKeys(fileValues)
+	values := make(map[string]value)
+	for _, s := range settings {
+		v := value{value: s.def, source: SourceDefault}
+		layers := []struct {
+			source string
+			lookup lookupFunc
+		}{
+			{SourceFile, func(k string) (string, bool) { val, ok := fileValues[k]; return val, ok }},
+			{SourceEnv, lookupEnv},
+			{SourceFlag, func(k string) (string, bool) { val, ok := setFlags[k]; return val, ok }},
+		}
+		for _, layer := range layers {
+			resolved, ok, err := s.resolve(layer.lookup, readFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (%s): %w", s.key, layer.source, err))
+				continue
+			}
+			if ok {
+				v = value{value: resolved, source: layer.source}
+			}
+		}
+		values[s.key] = v
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
 	}
 
-	maxIdleTime, err := time.ParseDuration(getEnv("PG_MAX_IDLE_TIME", "5m"))
+	config, err := build(values)
 	if err != nil {
-		return nil, fmt.Errorf("invalid PG_MAX_IDLE_TIME: %w", err)
+		return nil, nil, err
 	}
+	return config, fs.Args(), nil
+}
 
-	maxLifeTime, err := time.ParseDuration(getEnv("PG_MAX_LIFE_TIME", "1h"))
+// unknownFileKeys reports the config file keys that name no setting, its
+// deprecated aliases or the _FILE variant of a secret.
+func unknownFileKeys(fileValues map[string]string) []error {
+	known := make(map[string]bool)
+	for _, s := range settings {
+		known[s.key] = true
+		for _, alias := range s.aliases {
+			known[alias] = true
+		}
+		if s.secret {
+			known[s.key+"_FILE"] = true
+		}
+	}
+	var errs []error
+	for key := range fileValues {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("unknown setting %q in config file", strings.ToLower(key)))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// readConfigFile returns the file's settings keyed by their upper case
+// name. A missing default file is not an error, a missing explicit one is.
+func readConfigFile(path string, lookupEnv lookupFunc, readFile readFileFunc) (map[string]string, error) {
+	explicit := true
+	if path == "" {
+		path, explicit = lookupEnv("CONFIG_FILE")
+	}
+	if path == "" {
+		path = DefaultConfigFile
+	}
+
+	data, err := readFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid PG_MAX_LIFE_TIME: %w", err)
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
-	// Construct database connection URI from individual environment variables
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "test-tablelink")
-	dbSSLMode := getEnv("DB_SSL_MODE", "disable")
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
 
-	dbConnURI := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		dbUser, dbPassword, dbHost, dbPort, dbName, dbSSLMode)
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		values[strings.ToUpper(k)] = fmt.Sprint(v)
+	}
+	return values, nil
+}
 
-	cfg = &Config{
-		// Service Configuration
-		ServiceName: getEnv("SERVICE_NAME", "test-tablelink"),
-		Env:         getEnv("ENV", "development"),
-		LogLevel:    logLevel,
+func build(values map[string]value) (*Config, error) {
+	var errs []error
+	get := func(key string) string { return values[key].value }
+	atoi := func(key string) int {
+		n, err := strconv.Atoi(get(key))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %q is not a number", key, get(key)))
+		}
+		return n
+	}
+	duration := func(key string) time.Duration {
+		d, err := time.ParseDuration(get(key))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %q is not a duration", key, get(key)))
+		}
+		return d
+	}
+	list := func(key string) []string {
+		var items []string
+		for _, item := range strings.Split(get(key), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	boolean := func(key string) bool {
+		b, err := strconv.ParseBool(get(key))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %q is not a boolean", key, get(key)))
+		}
+		return b
+	}
 
-		// Database Configuration
-		DBConnURI: dbConnURI,
+	config := &Config{
+		// Service Configuration
+		ServiceName: get("SERVICE_NAME"),
+		Env:         get("ENV"),
+		LogLevel:    atoi("LOG_LEVEL"),
 
 		// Redis Configuration
-		RedisAddr:     getEnv("REDIS_HOST", "localhost:6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		RedisDB:       redisDB,
+		RedisAddr:     get("REDIS_HOST"),
+		RedisPassword: get("REDIS_PASSWORD"),
+		RedisDB:       atoi("REDIS_DB"),
 
 		// Connection Pool Configuration
-		DBMaxPoolSize:        maxPoolSize,
-		DBMaxIdleConnections: maxIdleConnections,
-		DBMaxIdleTime:        maxIdleTime,
-		DBMaxLifeTime:        maxLifeTime,
+		DBMaxPoolSize:        atoi("PG_MAX_POOL_SIZE"),
+		DBMaxIdleConnections: atoi("PG_MAX_IDLE_CONNECTIONS"),
+		DBMaxIdleTime:        duration("PG_MAX_IDLE_TIME"),
+		DBMaxLifeTime:        duration("PG_MAX_LIFE_TIME"),
+
+		// Migration Configuration
+		MigrateOnStart: boolean("MIGRATE_ON_START"),
 
 		// Server Configuration
-		BindAddress: getEnv("BIND_ADDRESS", ":8080"),
+		BindAddress: get("BIND_ADDRESS"),
+
+		// Authorization Configuration
+		Authorizer:           get("AUTHORIZER"),
+		PolicyPath:           get("POLICY_PATH"),
+		PolicyReloadInterval: duration("POLICY_RELOAD_INTERVAL"),
+
+		// Role Grant Configuration
+		GrantMaxDuration:    duration("GRANT_MAX_DURATION"),
+		GrantExpiryInterval: duration("GRANT_EXPIRY_INTERVAL"),
+
+		// API Token Configuration
+		APITokenMaxLifetime: duration("API_TOKEN_MAX_LIFETIME"),
+
+		// OAuth Configuration
+		OAuthTokenLifetime: duration("OAUTH_TOKEN_LIFETIME"),
+
+		// Impersonation Configuration
+		ImpersonationLifetime: duration("IMPERSONATION_LIFETIME"),
+
+		// OpenID Connect Provider Configuration
+		OIDCIssuer:         get("OIDC_ISSUER"),
+		OIDCSigningKeyFile: get("OIDC_SIGNING_KEY_FILE"),
+		OIDCTokenLifetime:  duration("OIDC_TOKEN_LIFETIME"),
+
+		// Authentication Configuration
+		Authenticators: list("AUTHENTICATORS"),
+		LDAPConfigFile: get("LDAP_CONFIG_FILE"),
+
+		// Federated Login Configuration
+		IdentityProvidersFile: get("IDENTITY_PROVIDERS_FILE"),
+
+		// Magic Link Configuration
+		MagicLinkURL:      get("MAGIC_LINK_URL"),
+		MagicLinkLifetime: duration("MAGIC_LINK_LIFETIME"),
+
+		// Mail Configuration
+		Mailer:       get("MAILER"),
+		MailDir:      get("MAIL_DIR"),
+		MailFrom:     get("MAIL_FROM"),
+		SMTPAddr:     get("SMTP_ADDR"),
+		SMTPUsername: get("SMTP_USERNAME"),
+		SMTPPassword: get("SMTP_PASSWORD"),
+
+		// Security Configuration
+		SigningKey: get("SIGNING_KEY"),
+
+		values: values,
 	}
 
-	// Debug: Print loaded configuration
-	log.Printf("Loaded configuration: %+v\n", cfg)
+	// Construct database connection URI from the individual settings
+	dbURI := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(get("DB_USER"), get("DB_PASSWORD")),
+		Host:     net.JoinHostPort(get("DB_HOST"), get("DB_PORT")),
+		Path:     "/" + get("DB_NAME"),
+		RawQuery: url.Values{"sslmode": {get("DB_SSL_MODE")}}.Encode(),
+	}
+	config.DBConnURI = dbURI.String()
 
-	return cfg, nil
+	errs = append(errs, config.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return config, nil
 }
 
-func GetConfig() *Config {
-	return cfg
+func (c *Config) validate() []error {
+	var errs []error
+	get := func(key string) string { return c.values[key].value }
+
+	if c.ServiceName == "" {
+		errs = append(errs, errors.New("SERVICE_NAME must not be empty"))
+	}
+	switch c.Env {
+	case "development", "test", "staging", "production":
+	default:
+		errs = append(errs, fmt.Errorf("invalid ENV: %q, expected development, test, staging or production", c.Env))
+	}
+	if get("DB_HOST") == "" || get("DB_USER") == "" || get("DB_NAME") == "" {
+		errs = append(errs, errors.New("DB_HOST, DB_USER and DB_NAME must not be empty"))
+	}
+	if port, err := strconv.Atoi(get("DB_PORT")); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid DB_PORT: %q", get("DB_PORT")))
+	}
+	switch get("DB_SSL_MODE") {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("invalid DB_SSL_MODE: %q", get("DB_SSL_MODE")))
+	}
+	if _, _, err := net.SplitHostPort(c.RedisAddr); err != nil {
+		errs = append(errs, fmt.Errorf("invalid REDIS_HOST: %q, expected host:port", c.RedisAddr))
+	}
+	if c.RedisDB < 0 {
+		errs = append(errs, fmt.Errorf("invalid REDIS_DB: %d must not be negative", c.RedisDB))
+	}
+	if c.DBMaxPoolSize < 1 {
+		errs = append(errs, fmt.Errorf("invalid PG_MAX_POOL_SIZE: %d must be at least 1", c.DBMaxPoolSize))
+	}
+	if c.DBMaxIdleConnections < 0 || c.DBMaxIdleConnections > c.DBMaxPoolSize {
+		errs = append(errs, fmt.Errorf("invalid PG_MAX_IDLE_CONNECTIONS: %d must be between 0 and PG_MAX_POOL_SIZE", c.DBMaxIdleConnections))
+	}
+	if c.DBMaxIdleTime < 0 || c.DBMaxLifeTime < 0 {
+		errs = append(errs, errors.New("PG_MAX_IDLE_TIME and PG_MAX_LIFE_TIME must not be negative"))
+	}
+	if _, _, err := net.SplitHostPort(c.BindAddress); err != nil {
+		errs = append(errs, fmt.Errorf("invalid BIND_ADDRESS: %q, expected [host]:port", c.BindAddress))
+	}
+	switch c.Authorizer {
+	case "role_rights":
+	case "cel":
+		if c.PolicyPath == "" {
+			errs = append(errs, errors.New("POLICY_PATH is required with AUTHORIZER=cel"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid AUTHORIZER: %q, expected role_rights or cel", c.Authorizer))
+	}
+	if c.PolicyReloadInterval < 0 {
+		errs = append(errs, errors.New("POLICY_RELOAD_INTERVAL must not be negative"))
+	}
+	if c.GrantMaxDuration <= 0 || c.GrantExpiryInterval <= 0 {
+		errs = append(errs, errors.New("GRANT_MAX_DURATION and GRANT_EXPIRY_INTERVAL must be positive"))
+	}
+	if c.APITokenMaxLifetime <= 0 {
+		errs = append(errs, errors.New("API_TOKEN_MAX_LIFETIME must be positive"))
+	}
+	if c.OAuthTokenLifetime <= 0 {
+		errs = append(errs, errors.New("OAUTH_TOKEN_LIFETIME must be positive"))
+	}
+	if c.ImpersonationLifetime <= 0 {
+		errs = append(errs, errors.New("IMPERSONATION_LIFETIME must be positive"))
+	}
+	if u, err := url.Parse(c.OIDCIssuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		errs = append(errs, fmt.Errorf("invalid OIDC_ISSUER: %q, expected an http(s) URL without query or fragment", c.OIDCIssuer))
+	}
+	if c.OIDCTokenLifetime <= 0 {
+		errs = append(errs, errors.New("OIDC_TOKEN_LIFETIME must be positive"))
+	}
+	if c.Env == "production" && c.OIDCSigningKeyFile == "" {
+		errs = append(errs, errors.New("OIDC_SIGNING_KEY_FILE is required in production"))
+	}
+	if len(c.Authenticators) == 0 {
+		errs = append(errs, errors.New("AUTHENTICATORS must name at least one authenticator"))
+	}
+	for _, name := range c.Authenticators {
+		if name != "local" && c.LDAPConfigFile == "" {
+			errs = append(errs, fmt.Errorf("LDAP_CONFIG_FILE is required for the %s authenticator", name))
+		}
+	}
+	if u, err := url.Parse(c.MagicLinkURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Fragment != "" {
+		errs = append(errs, fmt.Errorf("invalid MAGIC_LINK_URL: %q, expected an http(s) URL without fragment", c.MagicLinkURL))
+	}
+	if c.MagicLinkLifetime <= 0 {
+		errs = append(errs, errors.New("MAGIC_LINK_LIFETIME must be positive"))
+	}
+	switch c.Mailer {
+	case "file":
+		if c.Env == "production" {
+			errs = append(errs, errors.New("MAILER=file is for local use, set MAILER=smtp in production"))
+		}
+	case "smtp":
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid SMTP_ADDR: %q, expected host:port", c.SMTPAddr))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid MAILER: %q, expected file or smtp", c.Mailer))
+	}
+	if strings.ContainsAny(c.MailFrom, "\r\n") || !strings.Contains(c.MailFrom, "@") {
+		errs = append(errs, fmt.Errorf("invalid MAIL_FROM: %q", c.MailFrom))
+	}
+	if c.SigningKey != "" && len(c.SigningKey) < 32 {
+		errs = append(errs, errors.New("SIGNING_KEY must be at least 32 characters"))
+	}
+	if c.Env == "production" && c.SigningKey == "" {
+		errs = append(errs, errors.New("SIGNING_KEY is required in production"))
+	}
+	return errs
 }
 
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// Settings lists every resolved setting with its source. Secrets are
+// redacted.
+func (c *Config) Settings() []Setting {
+	out := make([]Setting, 0, len(c.values))
+	for _, s := range settings {
+		v := c.values[s.key]
+		shown := v.value
+		if s.secret && shown != "" {
+			shown = "<redacted>"
+		}
+		out = append(out, Setting{Key: s.key, Value: shown, Source: v.source})
 	}
-	return defaultValue
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// LogSummary logs the non secret settings at startup.
+func (c *Config) LogSummary() {
+	log.Printf("Loaded configuration: service=%s env=%s bind=%s db=%s redis=%s",
+		c.ServiceName, c.Env, c.BindAddress, c.values["DB_HOST"].value, c.RedisAddr)
 }
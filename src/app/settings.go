@@ -0,0 +1,115 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+type setting struct {
+	key     string
+	def     string
+	secret  bool
+	usage   string
+	aliases []string
+}
+
+// settings is every configuration key. The key is the environment variable
+// name; the config file uses it in lower case and the flag in lower kebab
+// case (DB_HOST, db_host, -db-host). Secrets also accept KEY_FILE.
+var settings = []setting{
+	{key: "SERVICE_NAME", def: "test-tablelink", usage: "service name"},
+	{key: "ENV", def: "development", usage: "environment: development, test, staging or production"},
+	{key: "LOG_LEVEL", def: "1", usage: "log level"},
+
+	{key: "DB_HOST", def: "localhost", usage: "Postgres host"},
+	{key: "DB_PORT", def: "5432", usage: "Postgres port"},
+	{key: "DB_USER", def: "postgres", usage: "Postgres user"},
+	{key: "DB_PASSWORD", def: "postgres", secret: true, usage: "Postgres password"},
+	{key: "DB_NAME", def: "test-tablelink", usage: "Postgres database"},
+	{key: "DB_SSL_MODE", def: "disable", usage: "Postgres sslmode"},
+
+	{key: "REDIS_HOST", def: "localhost:6379", usage: "Redis address (host:port)"},
+	{key: "REDIS_PASSWORD", def: "", secret: true, usage: "Redis password"},
+	{key: "REDIS_DB", def: "0", usage: "Redis database number"},
+
+	{key: "PG_MAX_POOL_SIZE", def: "10", usage: "maximum open Postgres connections", aliases: []string{"PG_MAX_POOL_SZE"}},
+	{key: "PG_MAX_IDLE_CONNECTIONS", def: "5", usage: "maximum idle Postgres connections"},
+	{key: "PG_MAX_IDLE_TIME", def: "5m", usage: "maximum idle time of a Postgres connection"},
+	{key: "PG_MAX_LIFE_TIME", def: "1h", usage: "maximum lifetime of a Postgres connection"},
+
+	{key: "MIGRATE_ON_START", def: "true", usage: "apply pending migrations when the server starts"},
+
+	{key: "BIND_ADDRESS", def: ":8080", usage: "HTTP listen address"},
+
+	{key: "AUTHORIZER", def: "role_rights", usage: "request authorizer: role_rights or cel"},
+	{key: "POLICY_PATH", def: "", usage: "CEL policy file or directory, required by the cel authorizer"},
+	{key: "POLICY_RELOAD_INTERVAL", def: "5s", usage: "how often CEL policy files are checked for changes, 0 disables reloading"},
+
+	{key: "GRANT_MAX_DURATION", def: "8h", usage: "longest time a temporary role grant can be requested for"},
+	{key: "GRANT_EXPIRY_INTERVAL", def: "1m", usage: "how often expired role grants are removed"},
+
+	{key: "API_TOKEN_MAX_LIFETIME", def: "2160h", usage: "longest lifetime of a personal access token"},
+
+	{key: "OAUTH_TOKEN_LIFETIME", def: "1h", usage: "lifetime of an OAuth client access token"},
+
+	{key: "IMPERSONATION_LIFETIME", def: "15m", usage: "lifetime of a token to act as another user"},
+
+	{key: "OIDC_ISSUER", def: "http://localhost:8080", usage: "public base URL of the OpenID Connect provider"},
+	{key: "OIDC_SIGNING_KEY_FILE", def: "", usage: "PEM RSA key ID tokens are signed with, generated at startup when empty"},
+	{key: "OIDC_TOKEN_LIFETIME", def: "1h", usage: "lifetime of OIDC ID and access tokens"},
+
+	{key: "AUTHENTICATORS", def: "local", usage: "comma separated order passwords are checked in: local (the users table) and LDAP directory names"},
+	{key: "LDAP_CONFIG_FILE", def: "", usage: "YAML file of LDAP directories, required when AUTHENTICATORS names one"},
+
+	{key: "IDENTITY_PROVIDERS_FILE", def: "", usage: "YAML file of upstream OIDC identity providers users can log in with, none when empty"},
+
+	{key: "MAGIC_LINK_URL", def: "http://localhost:3000/login/magic-link", usage: "page a magic login link opens, it posts the token to /auth/magic-link/verify"},
+	{key: "MAGIC_LINK_LIFETIME", def: "15m", usage: "how long a magic login link can be used"},
+
+	{key: "MAILER", def: "file", usage: "how emails are sent: file (written to MAIL_DIR, for local use) or smtp"},
+	{key: "MAIL_DIR", def: "mail", usage: "directory the file mailer writes emails to"},
+	{key: "MAIL_FROM", def: "no-reply@localhost", usage: "sender address of emails"},
+	{key: "SMTP_ADDR", def: "", usage: "SMTP server (host:port), required by the smtp mailer"},
+	{key: "SMTP_USERNAME", def: "", usage: "SMTP user, no authentication when empty"},
+	{key: "SMTP_PASSWORD", def: "", secret: true, usage: "SMTP password"},
+
+	{key: "SIGNING_KEY", def: "", secret: true, usage: "key used to sign tokens and links"},
+}
+
+func (s setting) flagName() string {
+	return strings.ToLower(strings.ReplaceAll(s.key, "_", "-"))
+}
+
+// resolve looks the setting up in one source: the key itself, its
+// deprecated aliases, or for secrets KEY_FILE pointing at a file whose
+// content (without the trailing newline) is the value.
+func (s setting) resolve(lookup lookupFunc, readFile readFileFunc) (string, bool, error) {
+	val, ok := lookup(s.key)
+	for _, alias := range s.aliases {
+		if ok {
+			break
+		}
+		if val, ok = lookup(alias); ok {
+			log.Printf("%s is deprecated, use %s", alias, s.key)
+		}
+	}
+
+	if !s.secret {
+		return val, ok, nil
+	}
+
+	path, fromFile := lookup(s.key + "_FILE")
+	if !fromFile {
+		return val, ok, nil
+	}
+	if ok {
+		return "", false, errors.New("set either the value or the _FILE variant, not both")
+	}
+	content, err := readFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
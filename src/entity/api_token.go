@@ -0,0 +1,57 @@
+package entity
+
+import "time"
+
+// APITokenPrefix starts every personal access token, which tells them apart
+// from session tokens and lets secret scanners recognize them.
+const APITokenPrefix = "tlk_"
+
+// APIToken is a named personal access token of a user. The token itself is
+// only shown once when it is created; Prefix is its public part and
+// TokenHash the SHA-256 of the whole token.
+type APIToken struct {
+	ID         int64        `db:"id" json:"id"`
+	UserID     int64        `db:"user_id" json:"user_id"`
+	Name       string       `db:"name" json:"name"`
+	Prefix     string       `db:"prefix" json:"prefix"`
+	TokenHash  string       `db:"token_hash" json:"-"`
+	Scopes     []TokenScope `db:"-" json:"scopes"`
+	ExpiresAt  time.Time    `db:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time   `db:"last_used_at" json:"last_used_at"`
+	RevokedAt  *time.Time   `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time    `db:"created_at" json:"created_at"`
+}
+
+// Active reports whether the token can still be used at now.
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// Rights returns the scopes as allow rules, so they can be evaluated like
+// role rights.
+func (t *APIToken) Rights() []*RoleRight {
+	rights := make([]*RoleRight, 0, len(t.Scopes))
+	for _, s := range t.Scopes {
+		rights = append(rights, &RoleRight{
+			Section: s.Section,
+			Route:   s.Route,
+			RCreate: s.Create,
+			RRead:   s.Read,
+			RUpdate: s.Update,
+			RDelete: s.Delete,
+		})
+	}
+	return rights
+}
+
+// TokenScope limits an API token to the flagged operations on a route of a
+// section. Route is matched like the route of a RoleRight.
+type TokenScope struct {
+	TokenID int64  `db:"token_id" json:"-"`
+	Section string `db:"section" json:"section"`
+	Route   string `db:"route" json:"route"`
+	Create  bool   `db:"r_create" json:"create"`
+	Read    bool   `db:"r_read" json:"read"`
+	Update  bool   `db:"r_update" json:"update"`
+	Delete  bool   `db:"r_delete" json:"delete"`
+}
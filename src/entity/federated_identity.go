@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+// FederatedIdentity links a local user to their account at an upstream
+// identity provider. Subject is the provider's "sub" claim; Email is the
+// address the provider sent when the identity was linked.
+type FederatedIdentity struct {
+	ID          int64      `db:"id" json:"id"`
+	UserID      int64      `db:"user_id" json:"user_id"`
+	Provider    string     `db:"provider" json:"provider"`
+	Subject     string     `db:"subject" json:"subject"`
+	Email       string     `db:"email" json:"email"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// FederatedLogin is a login started at an upstream identity provider,
+// waiting for the provider to send the user back with a code. It is
+// looked up by the OAuth state parameter and valid once until ExpiresAt.
+type FederatedLogin struct {
+	Provider     string    `json:"provider"`
+	CodeVerifier string    `json:"code_verifier"`
+	Nonce        string    `json:"nonce"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
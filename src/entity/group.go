@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrGroupCycle is returned when setting a parent would nest a group in
+// itself.
+var ErrGroupCycle = errors.New("group parent would create a nesting cycle")
+
+// Group collects users of one organization. Roles granted to a group apply
+// to its members and to the members of every group nested in it: ParentID
+// points at the group this one is nested in.
+type Group struct {
+	ID             int       `db:"id" json:"id"`
+	OrganizationID int64     `db:"organization_id" json:"organization_id"`
+	Name           string    `db:"name" json:"name"`
+	Description    string    `db:"description" json:"description"`
+	ParentID       *int      `db:"parent_id" json:"parent_id"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// GroupMember is a user's membership of a group.
+type GroupMember struct {
+	UserID  int64     `db:"user_id" json:"user_id"`
+	Name    string    `db:"name" json:"name"`
+	Email   string    `db:"email" json:"email"`
+	AddedAt time.Time `db:"created_at" json:"added_at"`
+}
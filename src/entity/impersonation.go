@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// ImpersonationTokenPrefix starts every impersonation token, which tells
+// them apart from session and API tokens.
+const ImpersonationTokenPrefix = "tli_"
+
+// Impersonation is a short-lived token with which an admin acts as another
+// user of their organization, e.g. to reproduce an issue. Requests made
+// with it are authorized as UserID and audited with ImpersonatorID.
+type Impersonation struct {
+	ImpersonatorID    int64     `json:"impersonator_id"`
+	ImpersonatorEmail string    `json:"impersonator_email"`
+	UserID            int64     `json:"user_id"`
+	OrganizationID    int64     `json:"organization_id"`
+	Reason            string    `json:"reason"`
+	StartedAt         time.Time `json:"started_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
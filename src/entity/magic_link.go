@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// MagicLink is a pending passwordless login sent to a user by email. It is
+// looked up by the ID of the signed link and valid once until ExpiresAt.
+type MagicLink struct {
+	UserID         int64     `json:"user_id"`
+	OrganizationID int64     `json:"organization_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
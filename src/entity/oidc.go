@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// OIDCClient is a relying party: an internal app whose users log in
+// through this service with OpenID Connect. A client without a secret is
+// public and authenticates the code exchange with PKCE alone.
+// RedirectURIs is space separated.
+type OIDCClient struct {
+	ID             int64     `db:"id" json:"id"`
+	OrganizationID int64     `db:"organization_id" json:"organization_id"`
+	ClientID       string    `db:"client_id" json:"client_id"`
+	Name           string    `db:"name" json:"name"`
+	SecretHash     string    `db:"secret_hash" json:"-"`
+	RedirectURIs   string    `db:"redirect_uris" json:"redirect_uris"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Public reports whether the client has no secret.
+func (c *OIDCClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// AllowsRedirect reports whether uri is one of the registered redirect
+// URIs, compared exactly.
+func (c *OIDCClient) AllowsRedirect(uri string) bool {
+	for _, allowed := range strings.Fields(c.RedirectURIs) {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// OIDCConsent records the scopes, space separated, a user agreed to share
+// with a client.
+type OIDCConsent struct {
+	UserID    int64     `db:"user_id" json:"user_id"`
+	ClientID  string    `db:"client_id" json:"client_id"`
+	Scope     string    `db:"scope" json:"scope"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Covers reports whether the consent includes every one of scopes.
+func (c *OIDCConsent) Covers(scopes []string) bool {
+	granted := strings.Fields(c.Scope)
+	for _, scope := range scopes {
+		found := false
+		for _, g := range granted {
+			found = found || g == scope
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizationCode is an OIDC authorization code, valid once until
+// ExpiresAt. CodeChallenge is the S256 PKCE challenge the code exchange
+// must answer.
+type AuthorizationCode struct {
+	ClientID      string    `json:"client_id"`
+	UserID        int64     `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	Nonce         string    `json:"nonce,omitempty"`
+	CodeChallenge string    `json:"code_challenge"`
+	AuthTime      time.Time `json:"auth_time"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
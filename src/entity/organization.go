@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultOrganizationID is the organization every row created before
+// tenancy, and every row created without one, belongs to. Super-admins
+// are members of it.
+const DefaultOrganizationID int64 = 1
+
+// SuperAdminRole is the role that lets members of the default organization
+// operate across all organizations.
+const SuperAdminRole = "super_admin"
+
+// ErrCrossOrganization is returned when a user or group would get a role,
+// a user a group, or a role or group a parent, of another organization.
+var ErrCrossOrganization = errors.New("users, groups and roles must belong to the same organization")
+
+// Organization is a tenant. Users and roles belong to exactly one, and
+// emails and role names are unique within it. Slug names it in the
+// X-Organization header and at login.
+type Organization struct {
+	ID        int64     `db:"id" json:"id"`
+	Slug      string    `db:"slug" json:"slug"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -1,10 +1,23 @@
 package entity
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
+// ErrRoleCycle is returned when setting a parent would make a role inherit
+// from itself.
+var ErrRoleCycle = errors.New("role parent would create an inheritance cycle")
+
+// Role belongs to one organization. ParentID must point at a role of the
+// same organization. MagicLink lets the role's users log in with a link
+// sent by email instead of a password; it is not inherited.
 type Role struct {
-	ID        int       `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	ID             int       `db:"id" json:"id"`
+	OrganizationID int64     `db:"organization_id" json:"organization_id"`
+	Name           string    `db:"name" json:"name"`
+	ParentID       *int      `db:"parent_id" json:"parent_id"`
+	MagicLink      bool      `db:"magic_link" json:"magic_link"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
 }
@@ -0,0 +1,43 @@
+package entity
+
+import "time"
+
+// Grant statuses. A grant is requested as pending and then rejected or
+// approved; an approved grant ends as expired or revoked.
+const (
+	GrantPending  = "pending"
+	GrantApproved = "approved"
+	GrantRejected = "rejected"
+	GrantExpired  = "expired"
+	GrantRevoked  = "revoked"
+)
+
+// RoleGrant is a request for a role for a limited time. The role is
+// assigned to the user when the grant is approved, for DurationSeconds from
+// then on, and removed again when it expires or is revoked.
+type RoleGrant struct {
+	ID              int64      `db:"id" json:"id"`
+	UserID          int64      `db:"user_id" json:"user_id"`
+	RoleID          int        `db:"role_id" json:"role_id"`
+	RequestedBy     int64      `db:"requested_by" json:"requested_by"`
+	DecidedBy       *int64     `db:"decided_by" json:"decided_by,omitempty"`
+	Justification   string     `db:"justification" json:"justification"`
+	DurationSeconds int64      `db:"duration_seconds" json:"duration_seconds"`
+	Status          string     `db:"status" json:"status"`
+	ExpiresAt       *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	DecidedAt       *time.Time `db:"decided_at" json:"decided_at,omitempty"`
+	EndedAt         *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// Duration is how long the role is held once the grant is approved.
+func (g *RoleGrant) Duration() time.Duration {
+	return time.Duration(g.DurationSeconds) * time.Second
+}
+
+// Open reports whether the grant is still waiting for a decision or in
+// effect.
+func (g *RoleGrant) Open() bool {
+	return g.Status == GrantPending || g.Status == GrantApproved
+}
@@ -1,5 +1,10 @@
 package entity
 
+// RoleRight grants the flagged operations on a route, or forbids them
+// when Deny is set. Route is a chi pattern such as /users/user/{user_id},
+// a concrete path, or a prefix ending in /* that covers everything below it.
+// A rule with a Condition, e.g. "own", only applies when the condition holds
+// for the user and the resource they act on.
 type RoleRight struct {
 	ID        int64  `db:"id"`
 	RoleID    int64  `db:"role_id"`
@@ -9,6 +14,8 @@ type RoleRight struct {
 	RRead     bool   `db:"r_read"`
 	RUpdate   bool   `db:"r_update"`
 	RDelete   bool   `db:"r_delete"`
+	Deny      bool   `db:"deny"`
+	Condition string `db:"condition"`
 	CreatedAt string `db:"created_at"`
 	UpdatedAt string `db:"updated_at"`
 }
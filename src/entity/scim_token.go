@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+// SCIMTokenPrefix starts every SCIM bearer token, which tells them apart
+// from the other tokens and lets secret scanners recognize them.
+const SCIMTokenPrefix = "tlsc_"
+
+// SCIMToken lets the SCIM client of an organization, usually its identity
+// provider, provision users and roles through /scim/v2 and nothing else.
+// The token itself is only shown once when it is created; Prefix is its
+// public part and TokenHash the SHA-256 of the whole token.
+type SCIMToken struct {
+	ID             int64      `db:"id" json:"id"`
+	OrganizationID int64      `db:"organization_id" json:"organization_id"`
+	Name           string     `db:"name" json:"name"`
+	Prefix         string     `db:"prefix" json:"prefix"`
+	TokenHash      string     `db:"token_hash" json:"-"`
+	LastUsedAt     *time.Time `db:"last_used_at" json:"last_used_at"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+}
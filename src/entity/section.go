@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// Section is a client of the API, e.g. "be" for the back office. Requests
+// name their section in the section header, and role rights apply to one
+// section only.
+type Section struct {
+	ID          int       `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,10 @@
+package entity
+
+import "time"
+
+// Session is an access token stored in Redis.
+type Session struct {
+	Token     string    `json:"token"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
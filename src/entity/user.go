@@ -3,13 +3,49 @@ package entity
 import "time"
 
 type User struct {
-	ID         int64      `db:"id" json:"id"`
-	RoleID     int64      `db:"role_id" json:"role_id"`
-	RoleName   string     `db:"role_name" json:"role_name"`
-	Name       string     `db:"name" json:"name"`
-	Email      string     `db:"email" json:"email"`
-	Password   string     `db:"password" json:"-"`
-	LastAccess *time.Time `db:"last_access" json:"last_access"`
-	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
-	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
+	ID             int64      `db:"id" json:"id"`
+	OrganizationID int64      `db:"organization_id" json:"organization_id"`
+	Roles          []Role     `db:"-" json:"roles"`
+	Name           string     `db:"name" json:"name"`
+	Email          string     `db:"email" json:"email"`
+	Password       string     `db:"password" json:"-"`
+	LastAccess     *time.Time `db:"last_access" json:"last_access"`
+	DisabledAt     *time.Time `db:"disabled_at" json:"disabled_at,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// RoleIDs returns the IDs of the user's roles.
+func (u *User) RoleIDs() []int64 {
+	ids := make([]int64, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		ids = append(ids, int64(r.ID))
+	}
+	return ids
+}
+
+// HasRole reports whether the user holds the named role.
+func (u *User) HasRole(name string) bool {
+	for _, r := range u.Roles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnerID makes a user the owner of their own record.
+func (u *User) OwnerID() int64 {
+	return u.ID
+}
+
+// OrganizationOf places a user in their organization.
+func (u *User) OrganizationOf() int64 {
+	return u.OrganizationID
+}
+
+// IsSuperAdmin reports whether the user may operate across organizations:
+// they hold SuperAdminRole in the default organization.
+func (u *User) IsSuperAdmin() bool {
+	return u.OrganizationID == DefaultOrganizationID && u.HasRole(SuperAdminRole)
 }
@@ -0,0 +1,204 @@
+// Package jwt signs and verifies RS256 JSON Web Tokens and publishes the
+// public key as a JSON Web Key Set.
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// ErrInvalidToken is returned for a token that is malformed, of another
+// type or not signed by the Signer's key.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Signer signs tokens with an RSA key, identified by its key ID.
+type Signer struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+func NewSigner(key *rsa.PrivateKey) *Signer {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	return &Signer{key: key, keyID: base64.RawURLEncoding.EncodeToString(sum[:8])}
+}
+
+// GenerateKey returns a new 2048 bit RSA key.
+func GenerateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// LoadKey reads a PEM encoded RSA private key, PKCS #1 or PKCS #8.
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA key", path)
+	}
+	return key, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Sign returns claims as a token of type typ, e.g. "JWT".
+func (s *Signer) Sign(typ string, claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Alg: "RS256", Typ: typ, Kid: s.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks that token is of type typ and signed by the Signer, and
+// decodes its claims. Checking expiry and audience is up to the caller.
+func (s *Signer) Verify(token, typ string, claims interface{}) error {
+	h, err := parseHeader(token)
+	if err != nil || h.Typ != typ || h.Kid != s.keyID {
+		return ErrInvalidToken
+	}
+	return verify(&s.key.PublicKey, token, claims)
+}
+
+func parseHeader(token string) (*header, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.SplitN(token, ".", 2)[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(raw, &h); err != nil || h.Alg != "RS256" {
+		return nil, ErrInvalidToken
+	}
+	return &h, nil
+}
+
+// verify checks the RS256 signature of token with key and decodes its
+// claims.
+func verify(key *rsa.PublicKey, token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+		return ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// JWK is the public part of an RSA key as a JSON Web Key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// KeySet is a JSON Web Key Set.
+type KeySet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet returns the key set relying parties verify tokens with.
+func (s *Signer) KeySet() KeySet {
+	pub := s.key.PublicKey
+	return KeySet{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: s.keyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
+
+// PublicKey returns the RSA key of an RSA JWK.
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("key %q: unsupported key type %q", k.Kid, k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// Verify checks that token is RS256 signed by the key of the set its kid
+// names, or by the only key when it names none, and decodes its claims.
+// This is how tokens of another issuer, such as an upstream identity
+// provider, are verified.
+func (s KeySet) Verify(token string, claims interface{}) error {
+	h, err := parseHeader(token)
+	if err != nil {
+		return err
+	}
+	for _, k := range s.Keys {
+		if k.Kid != h.Kid && (h.Kid != "" || len(s.Keys) != 1) {
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			return ErrInvalidToken
+		}
+		return verify(key, token, claims)
+	}
+	return ErrInvalidToken
+}
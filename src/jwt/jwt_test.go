@@ -0,0 +1,130 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type claims struct {
+	Subject string `json:"sub"`
+}
+
+func newSigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(key)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	s := newSigner(t)
+	token, err := s.Sign("JWT", claims{Subject: "7"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	var got claims
+	if err := s.Verify(token, "JWT", &got); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.Subject != "7" {
+		t.Errorf("sub = %q, want 7", got.Subject)
+	}
+
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1"}`)) + "." + parts[2]
+	tests := []struct {
+		name  string
+		token string
+		typ   string
+	}{
+		{"tampered", tampered, "JWT"},
+		{"other type", token, "at+jwt"},
+		{"malformed", "abc", "JWT"},
+		{"other key", mustSign(t, newSigner(t)), "JWT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Verify(tt.token, tt.typ, &got); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func mustSign(t *testing.T, s *Signer) string {
+	t.Helper()
+	token, err := s.Sign("JWT", claims{Subject: "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// A relying party only has the key set, check that it verifies tokens
+func TestKeySet(t *testing.T) {
+	s := newSigner(t)
+	token := mustSign(t, s)
+	set := s.KeySet()
+	if len(set.Keys) != 1 || set.Keys[0].Kid != s.keyID || set.Keys[0].Alg != "RS256" {
+		t.Fatalf("KeySet = %+v", set)
+	}
+
+	var got claims
+	if err := set.Verify(token, &got); err != nil || got.Subject != "7" {
+		t.Fatalf("Verify = %+v, %v", got, err)
+	}
+	if err := set.Verify(mustSign(t, newSigner(t)), &got); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of another key error = %v, want ErrInvalidToken", err)
+	}
+
+	// A rotating provider publishes several keys
+	other := newSigner(t).KeySet().Keys[0]
+	rotated := KeySet{Keys: []JWK{other, set.Keys[0]}}
+	if err := rotated.Verify(token, &got); err != nil {
+		t.Errorf("Verify with several keys: %v", err)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]*pem.Block{
+		"pkcs1.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		"pkcs8.pem": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	}
+	for name, block := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadKey(path)
+		if err != nil {
+			t.Fatalf("LoadKey(%s): %v", name, err)
+		}
+		if !loaded.Equal(key) {
+			t.Errorf("LoadKey(%s) returned another key", name)
+		}
+	}
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	os.WriteFile(garbage, []byte("not a key"), 0o600)
+	if _, err := LoadKey(garbage); err == nil {
+		t.Error("LoadKey accepted a file without a PEM block")
+	}
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer(dir, "no-reply@tablelink.local")
+
+	msg := Message{To: "jane@gmail.com", Subject: "Your login link", Body: "Open\nhttps://example.com/login?token=abc"}
+	for i := 0; i < 2; i++ {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files = %v, %v; want one per message", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From: no-reply@tablelink.local\r\n", "To: jane@gmail.com\r\n", "Subject: Your login link\r\n", "\r\n\r\nOpen\r\nhttps://example.com/login?token=abc"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message lacks %q:\n%s", want, data)
+		}
+	}
+
+	// A line break in a header would let the recipient add headers
+	if err := m.Send(context.Background(), Message{To: "jane@gmail.com\r\nBcc: eve@gmail.com", Subject: "hi"}); err == nil {
+		t.Error("Send accepted a header with a line break")
+	}
+}
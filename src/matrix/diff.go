@@ -0,0 +1,154 @@
+package matrix
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"test-tablelink/src/seed"
+)
+
+// Changes is the difference between a document and the current matrix.
+type Changes struct {
+	RolesAdded        []string          `json:"roles_added"`
+	ParentsChanged    []ParentChange    `json:"parents_changed"`
+	MagicLinksChanged []MagicLinkChange `json:"magic_links_changed"`
+	RightsAdded       []RightChange     `json:"rights_added"`
+	RightsRemoved     []RightChange     `json:"rights_removed"`
+	RightsChanged     []RightChange     `json:"rights_changed"`
+	// Unmanaged lists existing roles the document does not mention. They
+	// and their rights are left untouched.
+	Unmanaged []string `json:"unmanaged"`
+}
+
+type ParentChange struct {
+	Role string `json:"role"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// MagicLinkChange turns magic link login on or off for Role.
+type MagicLinkChange struct {
+	Role string `json:"role"`
+	New  bool   `json:"new"`
+}
+
+// RightChange is one right of Role. Old is nil for an added right, New for
+// a removed one.
+type RightChange struct {
+	Role string      `json:"role"`
+	Old  *seed.Right `json:"old,omitempty"`
+	New  *seed.Right `json:"new,omitempty"`
+}
+
+// Empty reports whether applying the document changes nothing.
+func (c *Changes) Empty() bool {
+	return len(c.RolesAdded) == 0 && len(c.ParentsChanged) == 0 && len(c.MagicLinksChanged) == 0 &&
+		len(c.RightsAdded) == 0 && len(c.RightsRemoved) == 0 && len(c.RightsChanged) == 0
+}
+
+// Count is the number of changes.
+func (c *Changes) Count() int {
+	return len(c.RolesAdded) + len(c.ParentsChanged) + len(c.MagicLinksChanged) +
+		len(c.RightsAdded) + len(c.RightsRemoved) + len(c.RightsChanged)
+}
+
+// String renders the changes one per line, "+" added, "-" removed and "~"
+// changed.
+func (c *Changes) String() string {
+	var b strings.Builder
+	for _, name := range c.RolesAdded {
+		fmt.Fprintf(&b, "+ role %s\n", name)
+	}
+	for _, p := range c.ParentsChanged {
+		fmt.Fprintf(&b, "~ role %s parent %s -> %s\n", p.Role, orNone(p.Old), orNone(p.New))
+	}
+	for _, m := range c.MagicLinksChanged {
+		fmt.Fprintf(&b, "~ role %s magic_link %t -> %t\n", m.Role, !m.New, m.New)
+	}
+	for _, r := range c.RightsAdded {
+		fmt.Fprintf(&b, "+ %s %s %s %s\n", r.Role, r.New.Section, r.New.Route, format(*r.New))
+	}
+	for _, r := range c.RightsRemoved {
+		fmt.Fprintf(&b, "- %s %s %s %s\n", r.Role, r.Old.Section, r.Old.Route, format(*r.Old))
+	}
+	for _, r := range c.RightsChanged {
+		fmt.Fprintf(&b, "~ %s %s %s %s -> %s\n", r.Role, r.New.Section, r.New.Route, format(*r.Old), format(*r.New))
+	}
+	return b.String()
+}
+
+func orNone(name string) string {
+	if name == "" {
+		return "(none)"
+	}
+	return name
+}
+
+func diff(st *state, doc *Document) (*Changes, error) {
+	c := &Changes{}
+	listed := make(map[string]bool, len(doc.Roles))
+	for _, r := range doc.Roles {
+		listed[r.Name] = true
+	}
+
+	for _, r := range doc.Roles {
+		role, exists := st.roles[r.Name]
+		if !exists {
+			c.RolesAdded = append(c.RolesAdded, r.Name)
+		}
+		if r.Parent != "" && !listed[r.Parent] && st.roles[r.Parent] == nil {
+			return nil, fmt.Errorf("role %s: unknown parent %s", r.Name, r.Parent)
+		}
+		var current string
+		if exists {
+			current = st.parentName(role)
+		}
+		if current != r.Parent {
+			c.ParentsChanged = append(c.ParentsChanged, ParentChange{Role: r.Name, Old: current, New: r.Parent})
+		}
+		if (exists && role.MagicLink != r.MagicLink) || (!exists && r.MagicLink) {
+			c.MagicLinksChanged = append(c.MagicLinksChanged, MagicLinkChange{Role: r.Name, New: r.MagicLink})
+		}
+
+		existing := st.rights[r.Name]
+		wanted := make(map[[2]string]bool, len(r.Rights))
+		for i := range r.Rights {
+			right := r.Rights[i]
+			key := [2]string{right.Section, right.Route}
+			wanted[key] = true
+			old, ok := existing[key]
+			if !ok {
+				c.RightsAdded = append(c.RightsAdded, RightChange{Role: r.Name, New: &right})
+				continue
+			}
+			if was := fromEntity(old); was != right {
+				c.RightsChanged = append(c.RightsChanged, RightChange{Role: r.Name, Old: &was, New: &right})
+			}
+		}
+		for key, old := range existing {
+			if !wanted[key] {
+				was := fromEntity(old)
+				c.RightsRemoved = append(c.RightsRemoved, RightChange{Role: r.Name, Old: &was})
+			}
+		}
+	}
+
+	for name := range st.roles {
+		if !listed[name] {
+			c.Unmanaged = append(c.Unmanaged, name)
+		}
+	}
+	sort.Strings(c.Unmanaged)
+	sort.Slice(c.RightsRemoved, func(i, j int) bool {
+		a, b := c.RightsRemoved[i], c.RightsRemoved[j]
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		if a.Old.Section != b.Old.Section {
+			return a.Old.Section < b.Old.Section
+		}
+		return a.Old.Route < b.Old.Route
+	})
+	return c, nil
+}
@@ -0,0 +1,315 @@
+// Package matrix exports roles and role rights as a canonical YAML
+// document and imports such a document back, so the permission matrix can
+// be kept in git. Import makes every role listed in the document match it
+// exactly: missing roles are created, parents and magic links set, and
+// rights added, changed or removed. Roles the document does not list are left alone.
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/seed"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/repository"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document uses the role and right format of seed fixtures, without users.
+type Document struct {
+	Roles []seed.Role `yaml:"roles" json:"roles"`
+}
+
+// Parse decodes and validates a YAML (or JSON) document.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse matrix: %w", err)
+	}
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+	doc.canonicalize()
+	return &doc, nil
+}
+
+// Marshal renders the document in canonical form: roles by name, rights
+// by section and route.
+func (d *Document) Marshal() ([]byte, error) {
+	d.canonicalize()
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+func (d *Document) canonicalize() {
+	sort.Slice(d.Roles, func(i, j int) bool { return d.Roles[i].Name < d.Roles[j].Name })
+	for _, r := range d.Roles {
+		sort.Slice(r.Rights, func(i, j int) bool {
+			a, b := r.Rights[i], r.Rights[j]
+			if a.Section != b.Section {
+				return a.Section < b.Section
+			}
+			return a.Route < b.Route
+		})
+	}
+}
+
+func (d *Document) validate() error {
+	var errs []error
+	names := make(map[string]bool, len(d.Roles))
+	for _, r := range d.Roles {
+		if r.Name == "" {
+			errs = append(errs, errors.New("role without a name"))
+			continue
+		}
+		if names[r.Name] {
+			errs = append(errs, fmt.Errorf("role %s is listed twice", r.Name))
+		}
+		names[r.Name] = true
+		if r.Parent == r.Name {
+			errs = append(errs, fmt.Errorf("role %s is its own parent", r.Name))
+		}
+
+		routes := make(map[[2]string]bool, len(r.Rights))
+		for _, right := range r.Rights {
+			key := [2]string{right.Section, right.Route}
+			switch {
+			case right.Section == "" || right.Route == "":
+				errs = append(errs, fmt.Errorf("role %s: right without section or route", r.Name))
+			case routes[key]:
+				errs = append(errs, fmt.Errorf("role %s: %s %s is listed twice", r.Name, right.Section, right.Route))
+			}
+			routes[key] = true
+			if right.Condition != "" && !authz.KnownCondition(right.Condition) {
+				errs = append(errs, fmt.Errorf("role %s: unknown condition %q on %s %s", r.Name, right.Condition, right.Section, right.Route))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type Matrix struct {
+	transactor    repository.Transactor
+	roleRepo      repository.RoleRepository
+	roleRightRepo repository.RoleRightRepository
+}
+
+func New(transactor repository.Transactor, roleRepo repository.RoleRepository, roleRightRepo repository.RoleRightRepository) *Matrix {
+	return &Matrix{
+		transactor:    transactor,
+		roleRepo:      roleRepo,
+		roleRightRepo: roleRightRepo,
+	}
+}
+
+// state is the current matrix keyed by role name.
+type state struct {
+	roles  map[string]*entity.Role
+	byID   map[int]*entity.Role
+	rights map[string]map[[2]string]*entity.RoleRight
+}
+
+func (m *Matrix) load(ctx context.Context) (*state, error) {
+	roles, err := m.roleRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := m.roleRightRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &state{
+		roles:  make(map[string]*entity.Role, len(roles)),
+		byID:   make(map[int]*entity.Role, len(roles)),
+		rights: make(map[string]map[[2]string]*entity.RoleRight, len(roles)),
+	}
+	for _, r := range roles {
+		st.roles[r.Name] = r
+		st.byID[r.ID] = r
+		st.rights[r.Name] = make(map[[2]string]*entity.RoleRight)
+	}
+	for _, r := range rights {
+		role, ok := st.byID[int(r.RoleID)]
+		if !ok {
+			continue
+		}
+		st.rights[role.Name][[2]string{r.Section, r.Route}] = r
+	}
+	return st, nil
+}
+
+func (st *state) parentName(role *entity.Role) string {
+	if role.ParentID == nil {
+		return ""
+	}
+	if parent, ok := st.byID[*role.ParentID]; ok {
+		return parent.Name
+	}
+	return ""
+}
+
+// Export returns every role with its rights.
+func (m *Matrix) Export(ctx context.Context) (*Document, error) {
+	st, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Roles: []seed.Role{}}
+	for name, role := range st.roles {
+		r := seed.Role{Name: name, Parent: st.parentName(role), MagicLink: role.MagicLink, Rights: []seed.Right{}}
+		for _, right := range st.rights[name] {
+			r.Rights = append(r.Rights, fromEntity(right))
+		}
+		doc.Roles = append(doc.Roles, r)
+	}
+	doc.canonicalize()
+	return doc, nil
+}
+
+// Diff compares the document with the current matrix.
+func (m *Matrix) Diff(ctx context.Context, doc *Document) (*Changes, error) {
+	st, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return diff(st, doc)
+}
+
+// Import applies the document in one transaction and returns what
+// changed. With dryRun nothing is written.
+func (m *Matrix) Import(ctx context.Context, doc *Document, dryRun bool) (*Changes, error) {
+	if dryRun {
+		return m.Diff(ctx, doc)
+	}
+
+	var changes *Changes
+	err := m.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		st, err := m.load(ctx)
+		if err != nil {
+			return err
+		}
+		if changes, err = diff(st, doc); err != nil {
+			return err
+		}
+		return m.apply(ctx, st, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (m *Matrix) apply(ctx context.Context, st *state, c *Changes) error {
+	for _, name := range c.RolesAdded {
+		role := &entity.Role{Name: name}
+		if err := m.roleRepo.Create(ctx, role); err != nil {
+			return fmt.Errorf("failed to create role %s: %w", name, err)
+		}
+		st.roles[name] = role
+	}
+
+	for _, p := range c.ParentsChanged {
+		role := st.roles[p.Role]
+		role.ParentID = nil
+		if p.New != "" {
+			role.ParentID = &st.roles[p.New].ID
+		}
+		if err := m.roleRepo.Update(ctx, role); err != nil {
+			return fmt.Errorf("failed to set parent of role %s: %w", p.Role, err)
+		}
+	}
+	for _, ml := range c.MagicLinksChanged {
+		role := st.roles[ml.Role]
+		role.MagicLink = ml.New
+		if err := m.roleRepo.Update(ctx, role); err != nil {
+			return fmt.Errorf("failed to set magic_link of role %s: %w", ml.Role, err)
+		}
+	}
+
+	for _, r := range c.RightsRemoved {
+		existing := st.rights[r.Role][[2]string{r.Old.Section, r.Old.Route}]
+		if err := m.roleRightRepo.Delete(ctx, existing.ID); err != nil {
+			return fmt.Errorf("failed to remove %s %s from role %s: %w", r.Old.Section, r.Old.Route, r.Role, err)
+		}
+	}
+	for _, r := range c.RightsChanged {
+		existing := st.rights[r.Role][[2]string{r.New.Section, r.New.Route}]
+		updated := toEntity(*r.New, existing.RoleID)
+		updated.ID = existing.ID
+		if err := m.roleRightRepo.Update(ctx, updated); err != nil {
+			return fmt.Errorf("failed to update %s %s of role %s: %w", r.New.Section, r.New.Route, r.Role, err)
+		}
+	}
+	for _, r := range c.RightsAdded {
+		right := toEntity(*r.New, int64(st.roles[r.Role].ID))
+		if err := m.roleRightRepo.Create(ctx, right); err != nil {
+			return fmt.Errorf("failed to add %s %s to role %s: %w", r.New.Section, r.New.Route, r.Role, err)
+		}
+	}
+	return nil
+}
+
+func fromEntity(r *entity.RoleRight) seed.Right {
+	return seed.Right{
+		Section:   r.Section,
+		Route:     r.Route,
+		Create:    r.RCreate,
+		Read:      r.RRead,
+		Update:    r.RUpdate,
+		Delete:    r.RDelete,
+		Deny:      r.Deny,
+		Condition: r.Condition,
+	}
+}
+
+func toEntity(r seed.Right, roleID int64) *entity.RoleRight {
+	return &entity.RoleRight{
+		RoleID:    roleID,
+		Section:   r.Section,
+		Route:     r.Route,
+		RCreate:   r.Create,
+		RRead:     r.Read,
+		RUpdate:   r.Update,
+		RDelete:   r.Delete,
+		Deny:      r.Deny,
+		Condition: r.Condition,
+	}
+}
+
+// format renders a right's effect as in tablelinkctl: "crud" with "-" for
+// unset operations, "!" for deny and the condition last.
+func format(r seed.Right) string {
+	var b strings.Builder
+	if r.Deny {
+		b.WriteByte('!')
+	}
+	for _, op := range []struct {
+		set bool
+		ch  byte
+	}{{r.Create, 'c'}, {r.Read, 'r'}, {r.Update, 'u'}, {r.Delete, 'd'}} {
+		if op.set {
+			b.WriteByte(op.ch)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	if r.Condition != "" {
+		b.WriteString(" if " + r.Condition)
+	}
+	return b.String()
+}
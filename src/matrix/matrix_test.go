@@ -0,0 +1,206 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/tenant"
+)
+
+func newTestMatrix(t *testing.T) (*Matrix, *memory.RoleRepository, *memory.RoleRightRepository) {
+	t.Helper()
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	store := memory.NewStore()
+	roles := memory.NewRoleRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+
+	user := &entity.Role{Name: "user"}
+	roles.Create(ctx, user)
+	admin := &entity.Role{Name: "admin", ParentID: &user.ID}
+	roles.Create(ctx, admin)
+	legacy := &entity.Role{Name: "legacy"}
+	roles.Create(ctx, legacy)
+	rights := []entity.RoleRight{
+		{RoleID: int64(user.ID), Section: "be", Route: "/users/user", RRead: true},
+		{RoleID: int64(admin.ID), Section: "be", Route: "/users/user", RCreate: true, RRead: true, RUpdate: true, RDelete: true},
+		{RoleID: int64(admin.ID), Section: "be", Route: "/old", RRead: true},
+		{RoleID: int64(legacy.ID), Section: "be", Route: "/legacy", RRead: true},
+	}
+	for i := range rights {
+		if err := roleRights.Create(ctx, &rights[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(store, roles, roleRights), roles, roleRights
+}
+
+const wanted = `
+roles:
+  - name: user
+    magic_link: true
+    rights:
+      - section: be
+        route: /users/user
+        read: true
+      - section: be
+        route: /users/user/{user_id}
+        read: true
+        update: true
+        condition: own
+  - name: admin
+    parent: editor
+    rights:
+      - section: be
+        route: /users/user
+        read: true
+        deny: true
+  - name: editor
+    parent: user
+    rights: []
+`
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	m, _, _ := newTestMatrix(t)
+
+	doc, err := m.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := doc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), "roles:\n  - name: admin\n    parent: user\n") {
+		t.Errorf("export is not canonical:\n%s", out)
+	}
+	if strings.Contains(string(out), "false") {
+		t.Errorf("export lists unset operations:\n%s", out)
+	}
+
+	parsed, err := Parse(out)
+	if err != nil {
+		t.Fatalf("Parse(export): %v", err)
+	}
+	changes, err := m.Diff(ctx, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.Empty() {
+		t.Errorf("re-importing the export changes:\n%s", changes)
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	m, roles, roleRights := newTestMatrix(t)
+	doc, err := Parse([]byte(wanted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dry, err := m.Import(ctx, doc, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	want := `+ role editor
+~ role admin parent user -> editor
+~ role editor parent (none) -> user
+~ role user magic_link false -> true
++ user be /users/user/{user_id} -ru- if own
+- admin be /old -r--
+~ admin be /users/user crud -> !-r--
+`
+	if dry.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", dry, want)
+	}
+	if len(dry.Unmanaged) != 1 || dry.Unmanaged[0] != "legacy" {
+		t.Errorf("unmanaged = %v", dry.Unmanaged)
+	}
+	if _, err := roles.GetByName(ctx, "editor"); err == nil {
+		t.Fatal("dry run created a role")
+	}
+
+	applied, err := m.Import(ctx, doc, false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if applied.String() != want {
+		t.Errorf("applied =\n%s\nwant\n%s", applied, want)
+	}
+
+	again, err := m.Diff(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Empty() {
+		t.Errorf("import did not converge:\n%s", again)
+	}
+	if user, _ := roles.GetByName(ctx, "user"); !user.MagicLink {
+		t.Error("import did not allow magic links for user")
+	}
+	legacy, _ := roles.GetByName(ctx, "legacy")
+	if rights, _ := roleRights.GetByRoleID(ctx, int64(legacy.ID)); len(rights) != 1 {
+		t.Errorf("unmanaged role rights = %d, want untouched", len(rights))
+	}
+}
+
+func TestImportIsTransactional(t *testing.T) {
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	m, roles, roleRights := newTestMatrix(t)
+	before, _ := roleRights.GetAll(ctx)
+
+	// user -> admin while admin -> user closes a cycle, which is only
+	// detected after the new role was created
+	doc, err := Parse([]byte(`
+roles:
+  - name: admin
+    parent: user
+    rights: []
+  - name: newcomer
+    rights:
+      - {section: be, route: /x, read: true}
+  - name: user
+    parent: admin
+    rights: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Import(ctx, doc, false); !errors.Is(err, entity.ErrRoleCycle) {
+		t.Fatalf("Import error = %v, want ErrRoleCycle", err)
+	}
+
+	if _, err := roles.GetByName(ctx, "newcomer"); err == nil {
+		t.Error("failed import left a new role behind")
+	}
+	if after, _ := roleRights.GetAll(ctx); len(after) != len(before) {
+		t.Errorf("failed import changed rights: %d before, %d after", len(before), len(after))
+	}
+}
+
+func TestParseValidates(t *testing.T) {
+	tests := map[string]string{
+		"duplicate role":    "roles: [{name: a}, {name: a}]",
+		"self parent":       "roles: [{name: a, parent: a}]",
+		"duplicate right":   "roles: [{name: a, rights: [{section: be, route: /x}, {section: be, route: /x}]}]",
+		"missing route":     "roles: [{name: a, rights: [{section: be}]}]",
+		"unknown condition": "roles: [{name: a, rights: [{section: be, route: /x, read: true, condition: mine}]}]",
+		"unknown field":     "roles: [{name: a, colour: red}]",
+	}
+	for name, doc := range tests {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("%s: Parse accepted %s", name, doc)
+		}
+	}
+
+	m, _, _ := newTestMatrix(t)
+	doc, _ := Parse([]byte("roles: [{name: a, parent: ghost}]"))
+	if _, err := m.Diff(tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID), doc); err == nil || !strings.Contains(err.Error(), "unknown parent") {
+		t.Errorf("Diff error = %v, want unknown parent", err)
+	}
+}
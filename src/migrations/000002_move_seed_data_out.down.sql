@@ -0,0 +1,2 @@
+-- The default admin is not restored, reseed with `seed -env development`
+SELECT 1;
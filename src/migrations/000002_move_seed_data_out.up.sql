@@ -0,0 +1,7 @@
+-- Seed data now lives in the seed fixtures (see the seed command). Remove
+-- the default admin inserted by 000001: its password is public, so it must
+-- not survive in a shared environment. Use `seed bootstrap` to create the
+-- first admin, or `seed -env development` locally.
+DELETE FROM users
+WHERE email = 'admin@gmail.com'
+AND password = 'adminadmin';
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN role_id INTEGER REFERENCES roles(id);
+
+-- Users with several roles keep the oldest one
+UPDATE users u SET role_id = (
+    SELECT ur.role_id FROM user_roles ur
+    WHERE ur.user_id = u.id
+    ORDER BY ur.created_at, ur.role_id
+    LIMIT 1
+);
+
+DROP TABLE IF EXISTS user_roles;
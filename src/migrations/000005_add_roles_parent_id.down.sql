@@ -0,0 +1,2 @@
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_parent_id_not_self;
+ALTER TABLE roles DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,3 @@
+-- A role inherits the rights of its parent, e.g. admin -> editor -> viewer
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES roles(id) ON DELETE SET NULL;
+ALTER TABLE roles ADD CONSTRAINT roles_parent_id_not_self CHECK (parent_id <> id);
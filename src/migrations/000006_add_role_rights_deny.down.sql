@@ -0,0 +1,2 @@
+DELETE FROM role_rights WHERE deny;
+ALTER TABLE role_rights DROP COLUMN IF EXISTS deny;
@@ -0,0 +1,2 @@
+-- A deny row forbids the operations it flags instead of granting them
+ALTER TABLE role_rights ADD COLUMN IF NOT EXISTS deny BOOLEAN NOT NULL DEFAULT FALSE;
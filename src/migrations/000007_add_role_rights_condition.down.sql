@@ -0,0 +1,2 @@
+DELETE FROM role_rights WHERE condition <> '';
+ALTER TABLE role_rights DROP COLUMN IF EXISTS condition;
@@ -0,0 +1,3 @@
+-- Name of a condition such as 'own' that must hold for the rule to apply,
+-- empty for unconditional rules
+ALTER TABLE role_rights ADD COLUMN IF NOT EXISTS condition VARCHAR(50) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS role_grants;
+DELETE FROM user_roles WHERE expires_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_user_roles_expires_at;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS expires_at;
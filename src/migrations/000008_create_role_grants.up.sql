@@ -0,0 +1,25 @@
+-- Temporary role assignments end at expires_at, permanent ones have none
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_user_roles_expires_at ON user_roles(expires_at) WHERE expires_at IS NOT NULL;
+
+-- Requests for a role for a limited time and their approval. Rows are kept
+-- as the audit trail of every grant, so requester and approver are not
+-- foreign keys and survive the deletion of those users.
+CREATE TABLE IF NOT EXISTS role_grants (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id),
+    requested_by INTEGER NOT NULL,
+    decided_by INTEGER,
+    justification TEXT NOT NULL,
+    duration_seconds INTEGER NOT NULL CHECK (duration_seconds > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_grants_user_id ON role_grants(user_id);
+CREATE INDEX IF NOT EXISTS idx_role_grants_status ON role_grants(status, expires_at);
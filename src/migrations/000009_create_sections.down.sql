@@ -0,0 +1,2 @@
+ALTER TABLE role_rights DROP CONSTRAINT IF EXISTS role_rights_section_fkey;
+DROP TABLE IF EXISTS sections;
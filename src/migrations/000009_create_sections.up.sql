@@ -0,0 +1,20 @@
+-- Clients such as be (back office), fe or mobile. Role rights are granted
+-- per section and requests name theirs in the section header.
+CREATE TABLE IF NOT EXISTS sections (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO sections (name, description) VALUES ('be', 'back office')
+ON CONFLICT (name) DO NOTHING;
+
+-- Register every section rights were already granted in
+INSERT INTO sections (name)
+SELECT DISTINCT section FROM role_rights
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE role_rights ADD CONSTRAINT role_rights_section_fkey
+    FOREIGN KEY (section) REFERENCES sections(name) ON UPDATE CASCADE;
@@ -0,0 +1,9 @@
+-- Only safe while every row still belongs to the default organization
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_organization_id_name_key;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_organization_id_email_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE roles DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
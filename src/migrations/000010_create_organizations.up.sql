@@ -0,0 +1,27 @@
+-- Tenants. Everything that existed before belongs to the default
+-- organization, whose members can be super-admins.
+CREATE TABLE IF NOT EXISTS organizations (
+    id BIGSERIAL PRIMARY KEY,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO organizations (id, slug, name) VALUES (1, 'default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), GREATEST((SELECT MAX(id) FROM organizations), 1));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE users ALTER COLUMN organization_id DROP DEFAULT;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE roles ALTER COLUMN organization_id DROP DEFAULT;
+
+-- Emails and role names are unique per organization
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_organization_id_email_key UNIQUE (organization_id, email);
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_name_key;
+ALTER TABLE roles ADD CONSTRAINT roles_organization_id_name_key UNIQUE (organization_id, name);
+
+CREATE INDEX IF NOT EXISTS idx_users_organization_id ON users(organization_id);
+CREATE INDEX IF NOT EXISTS idx_roles_organization_id ON roles(organization_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS api_token_scopes;
+DROP TABLE IF EXISTS api_tokens;
@@ -0,0 +1,31 @@
+-- Personal access tokens for scripts and other machine clients. Only a
+-- SHA-256 hash of the token is stored; prefix is the public part of the
+-- token it is looked up by. Revoked tokens are kept for the audit trail.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT api_tokens_prefix_key UNIQUE (prefix)
+);
+
+-- What a token may be used for, in the same shape as role_rights. A
+-- request made with the token needs both a scope and a right of its owner.
+CREATE TABLE IF NOT EXISTS api_token_scopes (
+    id SERIAL PRIMARY KEY,
+    token_id INTEGER NOT NULL REFERENCES api_tokens(id) ON DELETE CASCADE,
+    section VARCHAR(50) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    r_create BOOLEAN NOT NULL DEFAULT FALSE,
+    r_read BOOLEAN NOT NULL DEFAULT FALSE,
+    r_update BOOLEAN NOT NULL DEFAULT FALSE,
+    r_delete BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_token_scopes_token_id ON api_token_scopes(token_id);
@@ -0,0 +1,19 @@
+-- OAuth clients for service-to-service calls with the client_credentials
+-- grant. A client acts with the rights of its role, limited to the scopes
+-- (space separated "operation:route" entries) it is allowed. Only a hash of
+-- the secret is stored.
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id SERIAL PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations(id),
+    client_id VARCHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    secret_hash VARCHAR(255) NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles(id),
+    scope TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT oauth_clients_client_id_key UNIQUE (client_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_organization_id ON oauth_clients(organization_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_role_id ON oauth_clients(role_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS oidc_consents;
+DROP TABLE IF EXISTS oidc_clients;
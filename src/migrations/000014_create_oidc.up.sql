@@ -0,0 +1,28 @@
+-- Relying parties of the OpenID Connect provider, the internal apps that
+-- log users in through this service. Public clients (single page and
+-- native apps) have no secret and rely on PKCE alone. redirect_uris is
+-- space separated; a redirect must match one exactly.
+CREATE TABLE IF NOT EXISTS oidc_clients (
+    id SERIAL PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations(id),
+    client_id VARCHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    secret_hash VARCHAR(255) NOT NULL DEFAULT '',
+    redirect_uris TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT oidc_clients_client_id_key UNIQUE (client_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_clients_organization_id ON oidc_clients(organization_id);
+
+-- The scopes a user agreed to share with a relying party, asked for again
+-- only when the app requests more.
+CREATE TABLE IF NOT EXISTS oidc_consents (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oidc_clients(client_id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,16 @@
+-- Accounts at upstream identity providers (corporate OIDC IdPs) linked to
+-- local users. subject is the provider's "sub" claim, which identifies the
+-- account at the provider; email is what the provider sent at the last
+-- login, for reference only.
+CREATE TABLE IF NOT EXISTS federated_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT federated_identities_provider_subject_key UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities(user_id);
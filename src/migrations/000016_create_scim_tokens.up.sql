@@ -0,0 +1,16 @@
+-- Bearer tokens of SCIM clients, the identity providers (Okta, Azure AD)
+-- that provision the users and roles of an organization through
+-- /scim/v2. Like api_tokens only a SHA-256 hash of the token is stored and
+-- prefix is the public part it is looked up by.
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id SERIAL PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations(id),
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT scim_tokens_prefix_key UNIQUE (prefix)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_tokens_organization_id ON scim_tokens(organization_id);
@@ -0,0 +1,2 @@
+-- Users holding a role with magic_link may log in with a link sent by email
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS magic_link BOOLEAN NOT NULL DEFAULT FALSE;
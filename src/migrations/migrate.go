@@ -2,115 +2,409 @@ package migrations
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-//go:embed *.up.sql
+//go:embed *.sql
 var migrationFiles embed.FS
 
+// lockKey identifies the advisory lock held while migrating, so replicas
+// booting at the same time apply migrations one after the other.
+const lockKey int64 = 7270736901
+
+// ErrDrift is returned when an applied migration file was edited after it
+// ran. Use Force to accept the current file contents.
+var ErrDrift = errors.New("applied migrations were modified")
+
 type Migration struct {
-	Version string
-	UpSQL   string
+	Version  string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
 }
 
-func RunMigrations(ctx context.Context, db *sqlx.DB) error {
-	// Create migrations table if it doesn't exist
-	_, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS migrations (
-			version VARCHAR(255) PRIMARY KEY,
-			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+type Status struct {
+	Version   string
+	Applied   bool
+	AppliedAt *time.Time
+	// Drifted is set when the stored checksum differs from the file
+	Drifted bool
+	// Missing is set when the version is recorded but has no file
+	Missing bool
+}
+
+type appliedMigration struct {
+	Version   string         `db:"version"`
+	Checksum  sql.NullString `db:"checksum"`
+	AppliedAt time.Time      `db:"applied_at"`
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
 	if err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
+		return nil, err
 	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
 
-	// Get applied migrations
-	var appliedMigrations []string
-	err = db.SelectContext(ctx, &appliedMigrations, "SELECT version FROM migrations")
+// RunMigrations applies every pending migration.
+func RunMigrations(ctx context.Context, db *sqlx.DB) error {
+	m, err := NewMigrator(db)
 	if err != nil {
-		return fmt.Errorf("failed to get applied migrations: %w", err)
+		return err
 	}
+	return m.Up(ctx)
+}
 
-	// Read migration files
-	migrations := make(map[string]Migration)
-	err = fs.WalkDir(migrationFiles, ".", func(path string, d fs.DirEntry, err error) error {
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	byVersion := make(map[string]*Migration)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() || !strings.HasSuffix(path, ".up.sql") {
+		if d.IsDir() {
+			return nil
+		}
+
+		name := filepath.Base(path)
+		var version string
+		var up bool
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			version, up = strings.TrimSuffix(name, ".up.sql"), true
+		case strings.HasSuffix(name, ".down.sql"):
+			version = strings.TrimSuffix(name, ".down.sql")
+		default:
 			return nil
 		}
 
-		version := strings.TrimSuffix(filepath.Base(path), ".up.sql")
-		content, err := migrationFiles.ReadFile(path)
+		content, err := fs.ReadFile(fsys, path)
 		if err != nil {
 			return fmt.Errorf("failed to read migration file %s: %w", path, err)
 		}
 
-		migrations[version] = Migration{
-			Version: version,
-			UpSQL:   string(content),
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		if up {
+			m.UpSQL = string(content)
+			m.Checksum = checksum(m.UpSQL)
+		} else {
+			m.DownSQL = string(content)
 		}
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to read migration files: %w", err)
+		return nil, fmt.Errorf("failed to read migration files: %w", err)
 	}
 
-	// Sort migrations by version
-	var versions []string
-	for version := range migrations {
-		versions = append(versions, version)
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %s has a down file but no up file", version)
+		}
+		migrations = append(migrations, *m)
 	}
-	sort.Strings(versions)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
 
-	// Apply pending migrations
-	for _, version := range versions {
-		// Skip if already applied
-		alreadyApplied := false
-		for _, applied := range appliedMigrations {
-			if applied == version {
-				alreadyApplied = true
-				break
-			}
+// resolve accepts either the full version ("000001_init_schema") or its
+// numeric prefix ("000001" or "1"). "0" resolves to the empty version,
+// meaning before the first migration.
+func (m *Migrator) resolve(version string) (string, error) {
+	if strings.Trim(version, "0") == "" && version != "" {
+		return "", nil
+	}
+	for _, mig := range m.migrations {
+		prefix, _, _ := strings.Cut(mig.Version, "_")
+		if mig.Version == version || prefix == version || strings.TrimLeft(prefix, "0") == version {
+			return mig.Version, nil
 		}
-		if alreadyApplied {
+	}
+	return "", fmt.Errorf("unknown migration version %q", version)
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock. The migrations table is created first so fn can always read it.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	_, err = conn.ExecContext(ctx, "ALTER TABLE migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR(64)")
+	if err != nil {
+		return fmt.Errorf("failed to add checksum column: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sqlx.Conn) (map[string]appliedMigration, error) {
+	var rows []appliedMigration
+	err := conn.SelectContext(ctx, &rows, "SELECT version, checksum, applied_at FROM migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	applied := make(map[string]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// verify fails on checksum drift. Rows recorded before checksums existed
+// are backfilled with the current file checksum.
+func (m *Migrator) verify(ctx context.Context, conn *sqlx.Conn, applied map[string]appliedMigration) error {
+	var drifted []string
+	for _, mig := range m.migrations {
+		row, ok := applied[mig.Version]
+		if !ok {
 			continue
 		}
+		if !row.Checksum.Valid {
+			_, err := conn.ExecContext(ctx, "UPDATE migrations SET checksum = $1 WHERE version = $2", mig.Checksum, mig.Version)
+			if err != nil {
+				return fmt.Errorf("failed to backfill checksum for %s: %w", mig.Version, err)
+			}
+			continue
+		}
+		if row.Checksum.String != mig.Checksum {
+			drifted = append(drifted, mig.Version)
+		}
+	}
+	if len(drifted) > 0 {
+		return fmt.Errorf("%w: %s", ErrDrift, strings.Join(drifted, ", "))
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, mig Migration) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction for migration %s: %w", mig.Version, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, mig.UpSQL); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to apply migration %s: %w", mig.Version, err)
+	}
 
-		// Start transaction
-		tx, err := db.BeginTxx(ctx, nil)
+	_, err = tx.ExecContext(ctx, "INSERT INTO migrations (version, checksum) VALUES ($1, $2)", mig.Version, mig.Checksum)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %s: %w", mig.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", mig.Version, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sqlx.Conn, mig Migration) error {
+	if mig.DownSQL == "" {
+		return fmt.Errorf("migration %s has no down file", mig.Version)
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction for migration %s: %w", mig.Version, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, mig.DownSQL); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to revert migration %s: %w", mig.Version, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM migrations WHERE version = $1", mig.Version); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to unrecord migration %s: %w", mig.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit revert of %s: %w", mig.Version, err)
+	}
+	return nil
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.migrateTo(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the n most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("down needs a positive count, got %d", n)
+	}
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
 		if err != nil {
-			return fmt.Errorf("failed to start transaction for migration %s: %w", version, err)
+			return err
+		}
+		if err := m.verify(ctx, conn, applied); err != nil {
+			return err
 		}
 
-		// Apply migration
-		_, err = tx.ExecContext(ctx, migrations[version].UpSQL)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		for i := len(m.migrations) - 1; i >= 0 && n > 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			n--
 		}
+		return nil
+	})
+}
 
-		// Record migration
-		_, err = tx.ExecContext(ctx, "INSERT INTO migrations (version) VALUES ($1)", version)
+// Goto applies or reverts migrations until exactly the migrations up to and
+// including version are applied.
+func (m *Migrator) Goto(ctx context.Context, version string) error {
+	target, err := m.resolve(version)
+	if err != nil {
+		return err
+	}
+	return m.migrateTo(ctx, target)
+}
+
+func (m *Migrator) migrateTo(ctx context.Context, target string) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to record migration %s: %w", version, err)
+			return err
+		}
+		if err := m.verify(ctx, conn, applied); err != nil {
+			return err
 		}
 
-		// Commit transaction
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit migration %s: %w", version, err)
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > target {
+				if err := m.revert(ctx, conn, mig); err != nil {
+					return err
+				}
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= target {
+				if err := m.apply(ctx, conn, mig); err != nil {
+					return err
+				}
+			}
 		}
+		return nil
+	})
+}
+
+// Force records the migrations up to version as applied and the later ones
+// as not applied, without running any SQL. Recorded checksums are reset to
+// the current files, which is how drift is acknowledged.
+func (m *Migrator) Force(ctx context.Context, version string) error {
+	target, err := m.resolve(version)
+	if err != nil {
+		return err
 	}
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start transaction: %w", err)
+		}
+		defer tx.Rollback()
 
-	return nil
+		if _, err := tx.ExecContext(ctx, "DELETE FROM migrations WHERE version > $1", target); err != nil {
+			return fmt.Errorf("failed to unrecord migrations: %w", err)
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > target {
+				break
+			}
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO migrations (version, checksum) VALUES ($1, $2)
+				ON CONFLICT (version) DO UPDATE SET checksum = EXCLUDED.checksum`,
+				mig.Version, mig.Checksum)
+			if err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", mig.Version, err)
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// Status lists every known migration, plus recorded versions whose file
+// no longer exists.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			s := Status{Version: mig.Version}
+			if row, ok := applied[mig.Version]; ok {
+				appliedAt := row.AppliedAt
+				s.Applied = true
+				s.AppliedAt = &appliedAt
+				s.Drifted = row.Checksum.Valid && row.Checksum.String != mig.Checksum
+				delete(applied, mig.Version)
+			}
+			statuses = append(statuses, s)
+		}
+		for version, row := range applied {
+			appliedAt := row.AppliedAt
+			statuses = append(statuses, Status{Version: version, Applied: true, AppliedAt: &appliedAt, Missing: true})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
 }
@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_add_x.up.sql":   {Data: []byte("ALTER TABLE t ADD x INT;")},
+		"000002_add_x.down.sql": {Data: []byte("ALTER TABLE t DROP x;")},
+		"000001_init.up.sql":    {Data: []byte("CREATE TABLE t ();")},
+		"README.md":             {Data: []byte("ignored")},
+	}
+
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].Version != "000001_init" || migrations[1].Version != "000002_add_x" {
+		t.Errorf("migrations are not sorted: %s, %s", migrations[0].Version, migrations[1].Version)
+	}
+	if migrations[0].DownSQL != "" {
+		t.Errorf("000001 should have no down SQL, got %q", migrations[0].DownSQL)
+	}
+	if migrations[1].DownSQL != "ALTER TABLE t DROP x;" {
+		t.Errorf("000002 down SQL = %q", migrations[1].DownSQL)
+	}
+	if migrations[1].Checksum != checksum("ALTER TABLE t ADD x INT;") {
+		t.Errorf("checksum is not computed from the up SQL")
+	}
+}
+
+func TestLoadMigrationsDownWithoutUp(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+	if _, err := loadMigrations(fsys); err == nil {
+		t.Fatal("expected an error for a down file without an up file")
+	}
+}
+
+func TestEmbeddedMigrationsHaveDownFiles(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	for _, m := range migrations {
+		if m.DownSQL == "" {
+			t.Errorf("migration %s has no down file", m.Version)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: "000001_init_schema"},
+		{Version: "000002_add_x"},
+	}}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"000001_init_schema", "000001_init_schema", false},
+		{"000002", "000002_add_x", false},
+		{"2", "000002_add_x", false},
+		{"0", "", false},
+		{"000000", "", false},
+		{"3", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := m.resolve(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolve(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package password
+
+import "testing"
+
+func TestHashAndCompare(t *testing.T) {
+	hashed, err := Hash("adminadmin")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !IsHashed(hashed) {
+		t.Fatalf("IsHashed(%q) = false", hashed)
+	}
+	if !Compare(hashed, "adminadmin") {
+		t.Error("Compare rejected the right password")
+	}
+	if Compare(hashed, "wrong") {
+		t.Error("Compare accepted a wrong password")
+	}
+}
+
+func TestCompareLegacyPlainText(t *testing.T) {
+	if IsHashed("adminadmin") {
+		t.Fatal("plain text reported as hashed")
+	}
+	if !Compare("adminadmin", "adminadmin") {
+		t.Error("Compare rejected a matching legacy password")
+	}
+	if Compare("adminadmin", "admin") {
+		t.Error("Compare accepted a wrong legacy password")
+	}
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"test-tablelink/src/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const apiTokenColumns = `id, user_id, name, prefix, token_hash, expires_at, last_used_at, revoked_at, created_at`
+
+type APITokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPITokenRepository(db *sqlx.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// loadScopes fills in the scopes of tokens.
+func (r *APITokenRepository) loadScopes(ctx context.Context, tokens ...*entity.APIToken) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(tokens))
+	byID := make(map[int64]*entity.APIToken, len(tokens))
+	for _, t := range tokens {
+		t.Scopes = []entity.TokenScope{}
+		ids = append(ids, t.ID)
+		byID[t.ID] = t
+	}
+
+	var scopes []entity.TokenScope
+	query := `
+		SELECT token_id, section, route, r_create, r_read, r_update, r_delete
+		FROM api_token_scopes
+		WHERE token_id = ANY($1)
+		ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &scopes, query, pq.Array(ids)); err != nil {
+		return err
+	}
+	for _, s := range scopes {
+		t := byID[s.TokenID]
+		t.Scopes = append(t.Scopes, s)
+	}
+	return nil
+}
+
+// GetByPrefix runs across organizations, whatever the scope of ctx: the
+// token decides which user, and so which organization, a request is for.
+func (r *APITokenRepository) GetByPrefix(ctx context.Context, prefix string) (*entity.APIToken, error) {
+	var token entity.APIToken
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE prefix = $1`
+	if err := conn(ctx, r.db).GetContext(ctx, &token, query, prefix); err != nil {
+		return nil, err
+	}
+	if err := r.loadScopes(ctx, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *APITokenRepository) GetByUserID(ctx context.Context, userID int64) ([]*entity.APIToken, error) {
+	tokens := []*entity.APIToken{}
+	filter, args, err := userScope(ctx, []interface{}{userID})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = $1` + filter + ` ORDER BY id DESC`
+	if err := conn(ctx, r.db).SelectContext(ctx, &tokens, query, args...); err != nil {
+		return nil, err
+	}
+	if err := r.loadScopes(ctx, tokens...); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *APITokenRepository) Create(ctx context.Context, token *entity.APIToken) error {
+	return NewTransactor(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+		query := `
+			INSERT INTO api_tokens (user_id, name, prefix, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`
+		err := tx.QueryRowContext(ctx, query, token.UserID, token.Name, token.Prefix, token.TokenHash, token.ExpiresAt).
+			Scan(&token.ID, &token.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for i := range token.Scopes {
+			s := &token.Scopes[i]
+			s.TokenID = token.ID
+			query := `
+				INSERT INTO api_token_scopes (token_id, section, route, r_create, r_read, r_update, r_delete)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`
+			if _, err := tx.ExecContext(ctx, query, s.TokenID, s.Section, s.Route, s.Create, s.Read, s.Update, s.Delete); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *APITokenRepository) Revoke(ctx context.Context, userID, id int64, at time.Time) error {
+	filter, args, err := userScope(ctx, []interface{}{at, id, userID})
+	if err != nil {
+		return err
+	}
+	query := `UPDATE api_tokens SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL` + filter
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *APITokenRepository) UpdateLastUsed(ctx context.Context, id int64, at time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
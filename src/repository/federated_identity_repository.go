@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"test-tablelink/src/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const federatedIdentityColumns = `id, user_id, provider, subject, email, last_login_at, created_at`
+
+type FederatedIdentityRepository struct {
+	db *sqlx.DB
+}
+
+func NewFederatedIdentityRepository(db *sqlx.DB) *FederatedIdentityRepository {
+	return &FederatedIdentityRepository{db: db}
+}
+
+func (r *FederatedIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*entity.FederatedIdentity, error) {
+	var identity entity.FederatedIdentity
+	query := `SELECT ` + federatedIdentityColumns + ` FROM federated_identities WHERE provider = $1 AND subject = $2`
+	if err := conn(ctx, r.db).GetContext(ctx, &identity, query, provider, subject); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *FederatedIdentityRepository) Create(ctx context.Context, identity *entity.FederatedIdentity) error {
+	query := `
+		INSERT INTO federated_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+}
+
+func (r *FederatedIdentityRepository) UpdateLastLogin(ctx context.Context, id int64) error {
+	query := `UPDATE federated_identities SET last_login_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
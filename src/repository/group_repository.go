@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const groupColumns = `id, organization_id, name, description, parent_id, created_at, updated_at`
+
+type GroupRepository struct {
+	db *sqlx.DB
+}
+
+func NewGroupRepository(db *sqlx.DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+func (r *GroupRepository) GetAll(ctx context.Context) ([]*entity.Group, error) {
+	var groups []*entity.Group
+	filter, args, err := scope(ctx, "organization_id", nil)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE TRUE` + filter + ` ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &groups, query, args...); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *GroupRepository) GetByID(ctx context.Context, id int) (*entity.Group, error) {
+	var group entity.Group
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE id = $1` + filter
+	if err := conn(ctx, r.db).GetContext(ctx, &group, query, args...); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Create inserts the group into the organization of ctx, or into
+// group.OrganizationID when ctx is marked with tenant.All.
+func (r *GroupRepository) Create(ctx context.Context, group *entity.Group) error {
+	organizationID, err := tenant.For(ctx, group.OrganizationID)
+	if err != nil {
+		return err
+	}
+	group.OrganizationID = organizationID
+	if err := r.checkParent(ctx, group.OrganizationID, group.ID, group.ParentID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO groups (organization_id, name, description, parent_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, group.OrganizationID, group.Name, group.Description, group.ParentID).
+		Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+}
+
+// checkParent refuses a parent of another organization, and for an
+// existing group a parent that is already nested in it.
+func (r *GroupRepository) checkParent(ctx context.Context, organizationID int64, groupID int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	var parentOrganizationID int64
+	err := conn(ctx, r.db).GetContext(ctx, &parentOrganizationID, `SELECT organization_id FROM groups WHERE id = $1`, *parentID)
+	if err == sql.ErrNoRows {
+		// let the foreign key report it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if parentOrganizationID != organizationID {
+		return entity.ErrCrossOrganization
+	}
+	if groupID == 0 {
+		return nil
+	}
+
+	var cycle bool
+	query := `
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT $1::integer
+			UNION
+			SELECT g.parent_id FROM groups g JOIN ancestors a ON g.id = a.id
+			WHERE g.parent_id IS NOT NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+	if err := conn(ctx, r.db).GetContext(ctx, &cycle, query, *parentID, groupID); err != nil {
+		return err
+	}
+	if cycle {
+		return entity.ErrGroupCycle
+	}
+	return nil
+}
+
+// Update saves the group and refuses a parent that is nested in it or
+// belongs to another organization.
+func (r *GroupRepository) Update(ctx context.Context, group *entity.Group) error {
+	return NewTransactor(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		var organizationID int64
+		filter, args, err := scope(ctx, "organization_id", []interface{}{group.ID})
+		if err != nil {
+			return err
+		}
+		err = tx.GetContext(ctx, &organizationID, `SELECT organization_id FROM groups WHERE id = $1`+filter, args...)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if group.ParentID != nil {
+			// Serialize parent changes so two updates cannot close a cycle
+			if _, err := tx.ExecContext(ctx, `LOCK TABLE groups IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+		}
+		if err := r.checkParent(ctx, organizationID, group.ID, group.ParentID); err != nil {
+			return err
+		}
+
+		query := `UPDATE groups SET name = $1, description = $2, parent_id = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4`
+		_, err = tx.ExecContext(ctx, query, group.Name, group.Description, group.ParentID, group.ID)
+		return err
+	})
+}
+
+func (r *GroupRepository) Delete(ctx context.Context, id int) error {
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM groups WHERE id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+// groupScope limits rows with a group_id to the groups of the organization
+// of ctx.
+func groupScope(ctx context.Context, args []interface{}) (string, []interface{}, error) {
+	filter, args, err := scope(ctx, "organization_id", args)
+	if filter == "" {
+		return "", args, err
+	}
+	return ` AND group_id IN (SELECT id FROM groups WHERE TRUE` + filter + `)`, args, nil
+}
+
+func (r *GroupRepository) GetMembers(ctx context.Context, groupID int) ([]*entity.GroupMember, error) {
+	var members []*entity.GroupMember
+	filter, args, err := groupScope(ctx, []interface{}{groupID})
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT gm.user_id, u.name, u.email, gm.created_at
+		FROM group_members gm
+		JOIN users u ON gm.user_id = u.id
+		WHERE gm.group_id = $1` + filter + `
+		ORDER BY gm.user_id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &members, query, args...); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// sameGroupOrganization returns ErrCrossOrganization when the group is
+// outside the organization of ctx or the row of table belongs to another
+// organization than the group. Missing rows are left to the foreign keys
+// to report.
+func (r *GroupRepository) sameGroupOrganization(ctx context.Context, groupID int, table string, id interface{}) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	var groupOrganizationID, organizationID int64
+	err := conn(ctx, r.db).GetContext(ctx, &groupOrganizationID, `SELECT organization_id FROM groups WHERE id = $1`, groupID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !tenant.Contains(ctx, groupOrganizationID) {
+		return entity.ErrCrossOrganization
+	}
+	err = conn(ctx, r.db).GetContext(ctx, &organizationID, `SELECT organization_id FROM `+table+` WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if organizationID != groupOrganizationID {
+		return entity.ErrCrossOrganization
+	}
+	return nil
+}
+
+func (r *GroupRepository) AddMember(ctx context.Context, groupID int, userID int64) error {
+	if err := r.sameGroupOrganization(ctx, groupID, "users", userID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO group_members (group_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (group_id, user_id) DO NOTHING`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, groupID, userID)
+	return err
+}
+
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID int, userID int64) error {
+	filter, args, err := groupScope(ctx, []interface{}{groupID, userID})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *GroupRepository) GetRoles(ctx context.Context, groupID int) ([]entity.Role, error) {
+	roles := []entity.Role{}
+	filter, args, err := groupScope(ctx, []interface{}{groupID})
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT r.id, r.organization_id, r.name, r.parent_id, r.magic_link, r.created_at, r.updated_at
+		FROM group_roles gr
+		JOIN roles r ON gr.role_id = r.id
+		WHERE gr.group_id = $1` + filter + `
+		ORDER BY r.id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &roles, query, args...); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *GroupRepository) AssignRole(ctx context.Context, groupID int, roleID int) error {
+	if err := r.sameGroupOrganization(ctx, groupID, "roles", roleID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO group_roles (group_id, role_id)
+		VALUES ($1, $2)
+		ON CONFLICT (group_id, role_id) DO NOTHING`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, groupID, roleID)
+	return err
+}
+
+func (r *GroupRepository) UnassignRole(ctx context.Context, groupID int, roleID int) error {
+	filter, args, err := groupScope(ctx, []interface{}{groupID, roleID})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM group_roles WHERE group_id = $1 AND role_id = $2` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *GroupRepository) GetRolesByUserID(ctx context.Context, userID int64) ([]entity.Role, error) {
+	roles := []entity.Role{}
+	query := `
+		WITH RECURSIVE user_groups(id) AS (
+			SELECT group_id FROM group_members WHERE user_id = $1
+			UNION
+			SELECT g.parent_id FROM groups g JOIN user_groups ug ON g.id = ug.id
+			WHERE g.parent_id IS NOT NULL
+		)
+		SELECT DISTINCT r.id, r.organization_id, r.name, r.parent_id, r.magic_link, r.created_at, r.updated_at
+		FROM group_roles gr
+		JOIN roles r ON gr.role_id = r.id
+		WHERE gr.group_id IN (SELECT id FROM user_groups)
+		ORDER BY r.id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &roles, query, userID); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.APITokenRepository = (*APITokenRepository)(nil)
+
+type APITokenRepository struct {
+	store *Store
+}
+
+func NewAPITokenRepository(store *Store) *APITokenRepository {
+	return &APITokenRepository{store: store}
+}
+
+// copyToken returns a copy of the row that does not share its scopes.
+func copyToken(row entity.APIToken) *entity.APIToken {
+	token := row
+	token.Scopes = append([]entity.TokenScope{}, row.Scopes...)
+	return &token
+}
+
+func (r *APITokenRepository) GetByPrefix(ctx context.Context, prefix string) (*entity.APIToken, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, row := range r.store.apiTokens {
+		if row.Prefix == prefix {
+			return copyToken(row), nil
+		}
+	}
+	return nil, notFound()
+}
+
+func (r *APITokenRepository) GetByUserID(ctx context.Context, userID int64) ([]*entity.APIToken, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	tokens := make([]*entity.APIToken, 0)
+	if !r.store.userVisible(ctx, userID) {
+		return tokens, nil
+	}
+	for _, row := range r.store.apiTokens {
+		if row.UserID == userID {
+			tokens = append(tokens, copyToken(row))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (r *APITokenRepository) Create(ctx context.Context, token *entity.APIToken) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[token.UserID]; !ok {
+		return foreignKeyViolation("api_tokens_user_id_fkey")
+	}
+	for _, row := range r.store.apiTokens {
+		if row.Prefix == token.Prefix {
+			return uniqueViolation("api_tokens_prefix_key")
+		}
+	}
+
+	r.store.nextAPITokenID++
+	token.ID = r.store.nextAPITokenID
+	token.CreatedAt = r.store.now()
+	for i := range token.Scopes {
+		token.Scopes[i].TokenID = token.ID
+	}
+	r.store.apiTokens[token.ID] = *copyToken(*token)
+	return nil
+}
+
+func (r *APITokenRepository) Revoke(ctx context.Context, userID, id int64, at time.Time) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.store.apiTokens[id]
+	if !ok || row.UserID != userID || row.RevokedAt != nil || !r.store.userVisible(ctx, userID) {
+		return notFound()
+	}
+	row.RevokedAt = &at
+	r.store.apiTokens[id] = row
+	return nil
+}
+
+func (r *APITokenRepository) UpdateLastUsed(ctx context.Context, id int64, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row, ok := r.store.apiTokens[id]; ok {
+		row.LastUsedAt = &at
+		r.store.apiTokens[id] = row
+	}
+	return nil
+}
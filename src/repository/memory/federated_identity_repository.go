@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+)
+
+var _ repository.FederatedIdentityRepository = (*FederatedIdentityRepository)(nil)
+
+type FederatedIdentityRepository struct {
+	store *Store
+}
+
+func NewFederatedIdentityRepository(store *Store) *FederatedIdentityRepository {
+	return &FederatedIdentityRepository{store: store}
+}
+
+func (r *FederatedIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*entity.FederatedIdentity, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, identity := range r.store.federatedIdentities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, notFound()
+}
+
+func (r *FederatedIdentityRepository) Create(ctx context.Context, identity *entity.FederatedIdentity) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[identity.UserID]; !ok {
+		return foreignKeyViolation("federated_identities_user_id_fkey")
+	}
+	for _, existing := range r.store.federatedIdentities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return uniqueViolation("federated_identities_provider_subject_key")
+		}
+	}
+
+	r.store.nextFederatedIdentityID++
+	row := *identity
+	row.ID = r.store.nextFederatedIdentityID
+	row.LastLoginAt = nil
+	row.CreatedAt = r.store.now()
+	r.store.federatedIdentities[row.ID] = row
+
+	identity.ID, identity.LastLoginAt, identity.CreatedAt = row.ID, nil, row.CreatedAt
+	return nil
+}
+
+func (r *FederatedIdentityRepository) UpdateLastLogin(ctx context.Context, id int64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.store.federatedIdentities[id]
+	if !ok {
+		return nil
+	}
+	now := r.store.now()
+	row.LastLoginAt = &now
+	r.store.federatedIdentities[id] = row
+	return nil
+}
@@ -0,0 +1,317 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.GroupRepository = (*GroupRepository)(nil)
+
+type GroupRepository struct {
+	store *Store
+}
+
+func NewGroupRepository(store *Store) *GroupRepository {
+	return &GroupRepository{store: store}
+}
+
+// group returns the group when it is visible in the organization of ctx.
+func (r *GroupRepository) group(ctx context.Context, id int) (entity.Group, bool) {
+	group, ok := r.store.groups[id]
+	return group, ok && tenant.Contains(ctx, group.OrganizationID)
+}
+
+func (r *GroupRepository) checkName(organizationID int64, name string, exceptID int) error {
+	for id, group := range r.store.groups {
+		if id != exceptID && group.OrganizationID == organizationID && group.Name == name {
+			return uniqueViolation("groups_organization_id_name_key")
+		}
+	}
+	return nil
+}
+
+// checkParent mirrors the Postgres checks on parent_id: it must exist,
+// belong to the same organization and not be nested in the group.
+func (r *GroupRepository) checkParent(organizationID int64, groupID int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	parent, ok := r.store.groups[*parentID]
+	if !ok {
+		return foreignKeyViolation("groups_parent_id_fkey")
+	}
+	if parent.OrganizationID != organizationID {
+		return entity.ErrCrossOrganization
+	}
+	for _, id := range r.store.groupLineage(*parentID) {
+		if id == groupID {
+			return entity.ErrGroupCycle
+		}
+	}
+	return nil
+}
+
+func (r *GroupRepository) GetAll(ctx context.Context) ([]*entity.Group, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	groups := make([]*entity.Group, 0, len(r.store.groups))
+	for _, row := range r.store.groups {
+		if !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		group := row
+		groups = append(groups, &group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (r *GroupRepository) GetByID(ctx context.Context, id int) (*entity.Group, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	group, ok := r.group(ctx, id)
+	if !ok {
+		return nil, notFound()
+	}
+	return &group, nil
+}
+
+func (r *GroupRepository) Create(ctx context.Context, group *entity.Group) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	organizationID, err := tenant.For(ctx, group.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.store.organizations[organizationID]; !ok {
+		return foreignKeyViolation("groups_organization_id_fkey")
+	}
+	if err := r.checkName(organizationID, group.Name, 0); err != nil {
+		return err
+	}
+	if err := r.checkParent(organizationID, 0, group.ParentID); err != nil {
+		return err
+	}
+
+	r.store.nextGroupID++
+	now := r.store.now()
+	row := *group
+	row.ID = r.store.nextGroupID
+	row.OrganizationID = organizationID
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	r.store.groups[row.ID] = row
+
+	group.ID, group.OrganizationID = row.ID, organizationID
+	group.CreatedAt, group.UpdatedAt = now, now
+	return nil
+}
+
+func (r *GroupRepository) Update(ctx context.Context, group *entity.Group) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.group(ctx, group.ID)
+	if !ok {
+		return nil
+	}
+	if err := r.checkName(row.OrganizationID, group.Name, group.ID); err != nil {
+		return err
+	}
+	if err := r.checkParent(row.OrganizationID, group.ID, group.ParentID); err != nil {
+		return err
+	}
+
+	row.Name = group.Name
+	row.Description = group.Description
+	row.ParentID = group.ParentID
+	row.UpdatedAt = r.store.now()
+	r.store.groups[group.ID] = row
+	return nil
+}
+
+func (r *GroupRepository) Delete(ctx context.Context, id int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.group(ctx, id); !ok {
+		return nil
+	}
+	delete(r.store.groups, id)
+	// group_members and group_roles rows cascade, parent_id is ON DELETE
+	// SET NULL
+	delete(r.store.groupMembers, id)
+	delete(r.store.groupRoles, id)
+	for childID, child := range r.store.groups {
+		if child.ParentID != nil && *child.ParentID == id {
+			child.ParentID = nil
+			r.store.groups[childID] = child
+		}
+	}
+	return nil
+}
+
+func (r *GroupRepository) GetMembers(ctx context.Context, groupID int) ([]*entity.GroupMember, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	members := make([]*entity.GroupMember, 0)
+	if _, ok := r.group(ctx, groupID); !ok {
+		return members, nil
+	}
+	for userID, at := range r.store.groupMembers[groupID] {
+		user := r.store.users[userID]
+		members = append(members, &entity.GroupMember{UserID: userID, Name: user.Name, Email: user.Email, AddedAt: at})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return members, nil
+}
+
+// sameOrganization reports a missing group as the foreign key does, and
+// returns ErrCrossOrganization when the group is outside the organization
+// of ctx or organizationID is another organization.
+func (r *GroupRepository) sameOrganization(ctx context.Context, groupID int, organizationID int64) error {
+	group, ok := r.store.groups[groupID]
+	if !ok {
+		return foreignKeyViolation("group_members_group_id_fkey")
+	}
+	if !tenant.Contains(ctx, group.OrganizationID) || group.OrganizationID != organizationID {
+		return entity.ErrCrossOrganization
+	}
+	return nil
+}
+
+func (r *GroupRepository) AddMember(ctx context.Context, groupID int, userID int64) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok {
+		return foreignKeyViolation("group_members_user_id_fkey")
+	}
+	if err := r.sameOrganization(ctx, groupID, user.OrganizationID); err != nil {
+		return err
+	}
+	if r.store.groupMembers[groupID] == nil {
+		r.store.groupMembers[groupID] = make(map[int64]time.Time)
+	}
+	if _, member := r.store.groupMembers[groupID][userID]; !member {
+		r.store.groupMembers[groupID][userID] = r.store.now()
+	}
+	return nil
+}
+
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID int, userID int64) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.group(ctx, groupID); ok {
+		delete(r.store.groupMembers[groupID], userID)
+	}
+	return nil
+}
+
+func (r *GroupRepository) GetRoles(ctx context.Context, groupID int) ([]entity.Role, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	roles := []entity.Role{}
+	if _, ok := r.group(ctx, groupID); !ok {
+		return roles, nil
+	}
+	for roleID := range r.store.groupRoles[groupID] {
+		roles = append(roles, r.store.roles[roleID])
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (r *GroupRepository) AssignRole(ctx context.Context, groupID int, roleID int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	role, ok := r.store.roles[roleID]
+	if !ok {
+		return foreignKeyViolation("group_roles_role_id_fkey")
+	}
+	if err := r.sameOrganization(ctx, groupID, role.OrganizationID); err != nil {
+		return err
+	}
+	if r.store.groupRoles[groupID] == nil {
+		r.store.groupRoles[groupID] = make(map[int]bool)
+	}
+	r.store.groupRoles[groupID][roleID] = true
+	return nil
+}
+
+func (r *GroupRepository) UnassignRole(ctx context.Context, groupID int, roleID int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.group(ctx, groupID); ok {
+		delete(r.store.groupRoles[groupID], roleID)
+	}
+	return nil
+}
+
+func (r *GroupRepository) GetRolesByUserID(ctx context.Context, userID int64) ([]entity.Role, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	roleIDs := make(map[int]bool)
+	for groupID, members := range r.store.groupMembers {
+		if _, member := members[userID]; !member {
+			continue
+		}
+		for _, id := range r.store.groupLineage(groupID) {
+			for roleID := range r.store.groupRoles[id] {
+				roleIDs[roleID] = true
+			}
+		}
+	}
+
+	roles := make([]entity.Role, 0, len(roleIDs))
+	for roleID := range roleIDs {
+		roles = append(roles, r.store.roles[roleID])
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.OAuthClientRepository = (*OAuthClientRepository)(nil)
+
+type OAuthClientRepository struct {
+	store *Store
+}
+
+func NewOAuthClientRepository(store *Store) *OAuthClientRepository {
+	return &OAuthClientRepository{store: store}
+}
+
+func (r *OAuthClientRepository) GetAll(ctx context.Context) ([]*entity.OAuthClient, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	clients := make([]*entity.OAuthClient, 0, len(r.store.oauthClients))
+	for _, row := range r.store.oauthClients {
+		if !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		client := row
+		clients = append(clients, &client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+func (r *OAuthClientRepository) GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	client, ok := r.store.oauthClients[clientID]
+	if !ok || !tenant.Contains(ctx, client.OrganizationID) {
+		return nil, notFound()
+	}
+	return &client, nil
+}
+
+func (r *OAuthClientRepository) Create(ctx context.Context, client *entity.OAuthClient) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	organizationID, err := tenant.For(ctx, client.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.store.organizations[organizationID]; !ok {
+		return foreignKeyViolation("oauth_clients_organization_id_fkey")
+	}
+	role, ok := r.store.roles[client.RoleID]
+	if !ok {
+		return foreignKeyViolation("oauth_clients_role_id_fkey")
+	}
+	if role.OrganizationID != organizationID {
+		return entity.ErrCrossOrganization
+	}
+	if _, exists := r.store.oauthClients[client.ClientID]; exists {
+		return uniqueViolation("oauth_clients_client_id_key")
+	}
+
+	r.store.nextOAuthClientID++
+	now := r.store.now()
+	row := *client
+	row.ID = r.store.nextOAuthClientID
+	row.OrganizationID = organizationID
+	row.Role = nil
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	r.store.oauthClients[row.ClientID] = row
+
+	client.ID, client.OrganizationID = row.ID, organizationID
+	client.CreatedAt, client.UpdatedAt = now, now
+	return nil
+}
+
+func (r *OAuthClientRepository) Delete(ctx context.Context, clientID string) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if client, ok := r.store.oauthClients[clientID]; ok && tenant.Contains(ctx, client.OrganizationID) {
+		delete(r.store.oauthClients, clientID)
+	}
+	return nil
+}
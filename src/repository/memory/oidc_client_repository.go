@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.OIDCClientRepository = (*OIDCClientRepository)(nil)
+
+type OIDCClientRepository struct {
+	store *Store
+}
+
+func NewOIDCClientRepository(store *Store) *OIDCClientRepository {
+	return &OIDCClientRepository{store: store}
+}
+
+func (r *OIDCClientRepository) GetAll(ctx context.Context) ([]*entity.OIDCClient, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	clients := make([]*entity.OIDCClient, 0, len(r.store.oidcClients))
+	for _, row := range r.store.oidcClients {
+		if !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		client := row
+		clients = append(clients, &client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+func (r *OIDCClientRepository) GetByClientID(ctx context.Context, clientID string) (*entity.OIDCClient, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	client, ok := r.store.oidcClients[clientID]
+	if !ok || !tenant.Contains(ctx, client.OrganizationID) {
+		return nil, notFound()
+	}
+	return &client, nil
+}
+
+func (r *OIDCClientRepository) Create(ctx context.Context, client *entity.OIDCClient) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	organizationID, err := tenant.For(ctx, client.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.store.organizations[organizationID]; !ok {
+		return foreignKeyViolation("oidc_clients_organization_id_fkey")
+	}
+	if _, exists := r.store.oidcClients[client.ClientID]; exists {
+		return uniqueViolation("oidc_clients_client_id_key")
+	}
+
+	r.store.nextOIDCClientID++
+	now := r.store.now()
+	row := *client
+	row.ID = r.store.nextOIDCClientID
+	row.OrganizationID = organizationID
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	r.store.oidcClients[row.ClientID] = row
+
+	client.ID, client.OrganizationID = row.ID, organizationID
+	client.CreatedAt, client.UpdatedAt = now, now
+	return nil
+}
+
+func (r *OIDCClientRepository) Delete(ctx context.Context, clientID string) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	client, ok := r.store.oidcClients[clientID]
+	if !ok || !tenant.Contains(ctx, client.OrganizationID) {
+		return nil
+	}
+	delete(r.store.oidcClients, clientID)
+	// oidc_consents rows cascade
+	for _, consents := range r.store.oidcConsents {
+		delete(consents, clientID)
+	}
+	return nil
+}
+
+func (r *OIDCClientRepository) GetConsent(ctx context.Context, userID int64, clientID string) (*entity.OIDCConsent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	consent, ok := r.store.oidcConsents[userID][clientID]
+	if !ok {
+		return nil, notFound()
+	}
+	return &consent, nil
+}
+
+// SaveConsent inserts the consent or replaces the scope of an existing
+// one.
+func (r *OIDCClientRepository) SaveConsent(ctx context.Context, consent *entity.OIDCConsent) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[consent.UserID]; !ok {
+		return foreignKeyViolation("oidc_consents_user_id_fkey")
+	}
+	if _, ok := r.store.oidcClients[consent.ClientID]; !ok {
+		return foreignKeyViolation("oidc_consents_client_id_fkey")
+	}
+
+	now := r.store.now()
+	row, ok := r.store.oidcConsents[consent.UserID][consent.ClientID]
+	if !ok {
+		row = entity.OIDCConsent{UserID: consent.UserID, ClientID: consent.ClientID, CreatedAt: now}
+	}
+	row.Scope = consent.Scope
+	row.UpdatedAt = now
+	if r.store.oidcConsents[consent.UserID] == nil {
+		r.store.oidcConsents[consent.UserID] = make(map[string]entity.OIDCConsent)
+	}
+	r.store.oidcConsents[consent.UserID][consent.ClientID] = row
+
+	consent.CreatedAt, consent.UpdatedAt = row.CreatedAt, row.UpdatedAt
+	return nil
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+)
+
+var _ repository.OrganizationRepository = (*OrganizationRepository)(nil)
+
+type OrganizationRepository struct {
+	store *Store
+}
+
+func NewOrganizationRepository(store *Store) *OrganizationRepository {
+	return &OrganizationRepository{store: store}
+}
+
+func (r *OrganizationRepository) GetAll(ctx context.Context) ([]*entity.Organization, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	organizations := make([]*entity.Organization, 0, len(r.store.organizations))
+	for _, row := range r.store.organizations {
+		organization := row
+		organizations = append(organizations, &organization)
+	}
+	sort.Slice(organizations, func(i, j int) bool { return organizations[i].ID < organizations[j].ID })
+	return organizations, nil
+}
+
+func (r *OrganizationRepository) GetByID(ctx context.Context, id int64) (*entity.Organization, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	organization, ok := r.store.organizations[id]
+	if !ok {
+		return nil, notFound()
+	}
+	return &organization, nil
+}
+
+func (r *OrganizationRepository) GetBySlug(ctx context.Context, slug string) (*entity.Organization, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, organization := range r.store.organizations {
+		if organization.Slug == slug {
+			return &organization, nil
+		}
+	}
+	return nil, notFound()
+}
+
+func (r *OrganizationRepository) Create(ctx context.Context, organization *entity.Organization) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, row := range r.store.organizations {
+		if row.Slug == organization.Slug {
+			return uniqueViolation("organizations_slug_key")
+		}
+	}
+	r.store.createOrganization(organization)
+	return nil
+}
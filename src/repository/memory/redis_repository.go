@@ -0,0 +1,286 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+var _ repository.RedisRepository = (*RedisRepository)(nil)
+
+type redisEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// RedisRepository stores values with the same keys, JSON encoding and 24h
+// TTL as the real one, and reports missing or expired keys as redis.Nil.
+type RedisRepository struct {
+	mu   sync.Mutex
+	data map[string]redisEntry
+	now  func() time.Time
+}
+
+func NewRedisRepository() *RedisRepository {
+	return &RedisRepository{
+		data: make(map[string]redisEntry),
+		now:  time.Now,
+	}
+}
+
+func (r *RedisRepository) set(key string, value []byte, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = redisEntry{value: value, expiresAt: r.now().Add(ttl)}
+}
+
+func (r *RedisRepository) get(key string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.data[key]
+	if !ok {
+		return nil, goRedis.Nil
+	}
+	if !r.now().Before(entry.expiresAt) {
+		delete(r.data, key)
+		return nil, goRedis.Nil
+	}
+	return entry.value, nil
+}
+
+// take returns and removes a key, as GETDEL does.
+func (r *RedisRepository) take(key string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.data[key]
+	if !ok {
+		return nil, goRedis.Nil
+	}
+	delete(r.data, key)
+	if !r.now().Before(entry.expiresAt) {
+		return nil, goRedis.Nil
+	}
+	return entry.value, nil
+}
+
+func (r *RedisRepository) del(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.data, key)
+}
+
+func userKey(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+func (r *RedisRepository) SetUser(ctx context.Context, user *entity.User) error {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	r.set(userKey(user.ID), value, 24*time.Hour)
+	return nil
+}
+
+func (r *RedisRepository) GetUser(ctx context.Context, id int64) (*entity.User, error) {
+	value, err := r.get(userKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var user entity.User
+	if err := json.Unmarshal(value, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *RedisRepository) DeleteUser(ctx context.Context, id int64) error {
+	r.del(userKey(id))
+	return nil
+}
+
+func (r *RedisRepository) SetToken(ctx context.Context, token string, userID int64) error {
+	r.set("token:"+token, []byte(strconv.FormatInt(userID, 10)), 24*time.Hour)
+	return nil
+}
+
+func (r *RedisRepository) GetUserIDByToken(ctx context.Context, token string) (int64, error) {
+	value, err := r.get("token:" + token)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+func (r *RedisRepository) GetSession(ctx context.Context, token string) (*entity.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.data["token:"+token]
+	if !ok || !r.now().Before(entry.expiresAt) {
+		return nil, goRedis.Nil
+	}
+	userID, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Session{Token: token, UserID: userID, ExpiresAt: entry.expiresAt}, nil
+}
+
+func (r *RedisRepository) DeleteToken(ctx context.Context, token string) error {
+	r.del("token:" + token)
+	return nil
+}
+
+func (r *RedisRepository) ListSessions(ctx context.Context) ([]*entity.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var sessions []*entity.Session
+	for key, entry := range r.data {
+		token, ok := strings.CutPrefix(key, "token:")
+		if !ok || !now.Before(entry.expiresAt) {
+			continue
+		}
+		userID, err := strconv.ParseInt(string(entry.value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &entity.Session{Token: token, UserID: userID, ExpiresAt: entry.expiresAt})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ExpiresAt.Before(sessions[j].ExpiresAt) })
+	return sessions, nil
+}
+
+func (r *RedisRepository) SetClientToken(ctx context.Context, token string, clientToken *entity.ClientToken) error {
+	value, err := json.Marshal(clientToken)
+	if err != nil {
+		return err
+	}
+	r.set("client_token:"+token, value, clientToken.ExpiresAt.Sub(r.now()))
+	return nil
+}
+
+func (r *RedisRepository) GetClientToken(ctx context.Context, token string) (*entity.ClientToken, error) {
+	value, err := r.get("client_token:" + token)
+	if err != nil {
+		return nil, err
+	}
+
+	var clientToken entity.ClientToken
+	if err := json.Unmarshal(value, &clientToken); err != nil {
+		return nil, err
+	}
+	return &clientToken, nil
+}
+
+func (r *RedisRepository) DeleteClientToken(ctx context.Context, token string) error {
+	r.del("client_token:" + token)
+	return nil
+}
+
+func (r *RedisRepository) SetImpersonation(ctx context.Context, token string, impersonation *entity.Impersonation) error {
+	value, err := json.Marshal(impersonation)
+	if err != nil {
+		return err
+	}
+	r.set("impersonation:"+token, value, impersonation.ExpiresAt.Sub(r.now()))
+	return nil
+}
+
+func (r *RedisRepository) GetImpersonation(ctx context.Context, token string) (*entity.Impersonation, error) {
+	value, err := r.get("impersonation:" + token)
+	if err != nil {
+		return nil, err
+	}
+
+	var impersonation entity.Impersonation
+	if err := json.Unmarshal(value, &impersonation); err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *RedisRepository) DeleteImpersonation(ctx context.Context, token string) error {
+	r.del("impersonation:" + token)
+	return nil
+}
+
+func (r *RedisRepository) SetAuthorizationCode(ctx context.Context, code string, authCode *entity.AuthorizationCode) error {
+	value, err := json.Marshal(authCode)
+	if err != nil {
+		return err
+	}
+	r.set("authorization_code:"+code, value, authCode.ExpiresAt.Sub(r.now()))
+	return nil
+}
+
+func (r *RedisRepository) TakeAuthorizationCode(ctx context.Context, code string) (*entity.AuthorizationCode, error) {
+	value, err := r.take("authorization_code:" + code)
+	if err != nil {
+		return nil, err
+	}
+
+	var authCode entity.AuthorizationCode
+	if err := json.Unmarshal(value, &authCode); err != nil {
+		return nil, err
+	}
+	return &authCode, nil
+}
+
+func (r *RedisRepository) SetFederatedLogin(ctx context.Context, state string, login *entity.FederatedLogin) error {
+	value, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+	r.set("federated_login:"+state, value, login.ExpiresAt.Sub(r.now()))
+	return nil
+}
+
+func (r *RedisRepository) TakeFederatedLogin(ctx context.Context, state string) (*entity.FederatedLogin, error) {
+	value, err := r.take("federated_login:" + state)
+	if err != nil {
+		return nil, err
+	}
+
+	var login entity.FederatedLogin
+	if err := json.Unmarshal(value, &login); err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (r *RedisRepository) SetMagicLink(ctx context.Context, id string, link *entity.MagicLink) error {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	r.set("magic_link:"+id, value, link.ExpiresAt.Sub(r.now()))
+	return nil
+}
+
+func (r *RedisRepository) TakeMagicLink(ctx context.Context, id string) (*entity.MagicLink, error) {
+	value, err := r.take("magic_link:" + id)
+	if err != nil {
+		return nil, err
+	}
+
+	var link entity.MagicLink
+	if err := json.Unmarshal(value, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
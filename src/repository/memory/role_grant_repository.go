@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.RoleGrantRepository = (*RoleGrantRepository)(nil)
+
+type RoleGrantRepository struct {
+	store *Store
+}
+
+func NewRoleGrantRepository(store *Store) *RoleGrantRepository {
+	return &RoleGrantRepository{store: store}
+}
+
+// filter returns the matching grants, newest first.
+func (r *RoleGrantRepository) filter(keep func(entity.RoleGrant) bool) []*entity.RoleGrant {
+	grants := make([]*entity.RoleGrant, 0)
+	for _, row := range r.store.roleGrants {
+		if keep(row) {
+			grant := row
+			grants = append(grants, &grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].ID > grants[j].ID })
+	return grants
+}
+
+func (r *RoleGrantRepository) GetByID(ctx context.Context, id int64) (*entity.RoleGrant, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	grant, ok := r.store.roleGrants[id]
+	if !ok || !r.store.userVisible(ctx, grant.UserID) {
+		return nil, notFound()
+	}
+	return &grant, nil
+}
+
+func (r *RoleGrantRepository) GetAll(ctx context.Context, status string) ([]*entity.RoleGrant, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.filter(func(g entity.RoleGrant) bool {
+		return (status == "" || g.Status == status) && r.store.userVisible(ctx, g.UserID)
+	}), nil
+}
+
+func (r *RoleGrantRepository) GetByUserID(ctx context.Context, userID int64) ([]*entity.RoleGrant, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.filter(func(g entity.RoleGrant) bool { return g.UserID == userID && r.store.userVisible(ctx, g.UserID) }), nil
+}
+
+// GetDue runs across organizations, whatever the scope of ctx.
+func (r *RoleGrantRepository) GetDue(ctx context.Context, now time.Time) ([]*entity.RoleGrant, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	grants := r.filter(func(g entity.RoleGrant) bool {
+		return g.Status == entity.GrantApproved && g.ExpiresAt != nil && !g.ExpiresAt.After(now)
+	})
+	sort.SliceStable(grants, func(i, j int) bool { return grants[i].ExpiresAt.Before(*grants[j].ExpiresAt) })
+	return grants, nil
+}
+
+func (r *RoleGrantRepository) Create(ctx context.Context, grant *entity.RoleGrant) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[grant.UserID]; !ok {
+		return foreignKeyViolation("role_grants_user_id_fkey")
+	}
+	if _, ok := r.store.roles[grant.RoleID]; !ok {
+		return foreignKeyViolation("role_grants_role_id_fkey")
+	}
+
+	r.store.nextRoleGrantID++
+	now := r.store.now()
+	row := *grant
+	row.ID = r.store.nextRoleGrantID
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	r.store.roleGrants[row.ID] = row
+
+	grant.ID, grant.CreatedAt, grant.UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+	return nil
+}
+
+func (r *RoleGrantRepository) Update(ctx context.Context, grant *entity.RoleGrant) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.store.roleGrants[grant.ID]
+	if !ok || !r.store.userVisible(ctx, row.UserID) {
+		return nil
+	}
+	row.Status = grant.Status
+	row.DecidedBy = grant.DecidedBy
+	row.ExpiresAt = grant.ExpiresAt
+	row.DecidedAt = grant.DecidedAt
+	row.EndedAt = grant.EndedAt
+	row.UpdatedAt = r.store.now()
+	r.store.roleGrants[grant.ID] = row
+	return nil
+}
@@ -0,0 +1,224 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.RoleRepository = (*RoleRepository)(nil)
+
+type RoleRepository struct {
+	store *Store
+}
+
+func NewRoleRepository(store *Store) *RoleRepository {
+	return &RoleRepository{store: store}
+}
+
+// role returns the role when it is visible in the organization of ctx.
+func (r *RoleRepository) role(ctx context.Context, id int) (entity.Role, bool) {
+	role, ok := r.store.roles[id]
+	return role, ok && tenant.Contains(ctx, role.OrganizationID)
+}
+
+func (r *RoleRepository) checkName(organizationID int64, name string, exceptID int) error {
+	for id, role := range r.store.roles {
+		if id != exceptID && role.OrganizationID == organizationID && role.Name == name {
+			return uniqueViolation("roles_organization_id_name_key")
+		}
+	}
+	return nil
+}
+
+func (r *RoleRepository) checkParent(organizationID int64, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	parent, ok := r.store.roles[*parentID]
+	if !ok {
+		return foreignKeyViolation("roles_parent_id_fkey")
+	}
+	if parent.OrganizationID != organizationID {
+		return entity.ErrCrossOrganization
+	}
+	return nil
+}
+
+func (r *RoleRepository) GetByID(ctx context.Context, id int) (*entity.Role, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	role, ok := r.role(ctx, id)
+	if !ok {
+		return nil, notFound()
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) GetAll(ctx context.Context) ([]*entity.Role, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	roles := make([]*entity.Role, 0, len(r.store.roles))
+	for _, row := range r.store.roles {
+		if !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		role := row
+		roles = append(roles, &role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*entity.Role, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	// prefer the lowest organization like the Postgres query does when ctx
+	// is unscoped
+	var found *entity.Role
+	for _, row := range r.store.roles {
+		if row.Name != name || !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		if found == nil || row.OrganizationID < found.OrganizationID ||
+			(row.OrganizationID == found.OrganizationID && row.ID < found.ID) {
+			role := row
+			found = &role
+		}
+	}
+	if found == nil {
+		return nil, notFound()
+	}
+	return found, nil
+}
+
+func (r *RoleRepository) Create(ctx context.Context, role *entity.Role) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	organizationID, err := tenant.For(ctx, role.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.store.organizations[organizationID]; !ok {
+		return foreignKeyViolation("roles_organization_id_fkey")
+	}
+	if err := r.checkName(organizationID, role.Name, 0); err != nil {
+		return err
+	}
+	if err := r.checkParent(organizationID, role.ParentID); err != nil {
+		return err
+	}
+
+	r.store.nextRoleID++
+	now := r.store.now()
+	row := entity.Role{
+		ID:             r.store.nextRoleID,
+		OrganizationID: organizationID,
+		Name:           role.Name,
+		ParentID:       role.ParentID,
+		MagicLink:      role.MagicLink,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	r.store.roles[row.ID] = row
+
+	role.ID = row.ID
+	role.OrganizationID = organizationID
+	return nil
+}
+
+func (r *RoleRepository) Update(ctx context.Context, role *entity.Role) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.role(ctx, role.ID)
+	if !ok {
+		return nil
+	}
+	if err := r.checkName(row.OrganizationID, role.Name, role.ID); err != nil {
+		return err
+	}
+	if err := r.checkParent(row.OrganizationID, role.ParentID); err != nil {
+		return err
+	}
+	if role.ParentID != nil {
+		for _, id := range r.store.lineage(*role.ParentID) {
+			if id == role.ID {
+				return entity.ErrRoleCycle
+			}
+		}
+	}
+
+	row.Name = role.Name
+	row.ParentID = role.ParentID
+	row.MagicLink = role.MagicLink
+	row.UpdatedAt = r.store.now()
+	r.store.roles[role.ID] = row
+	return nil
+}
+
+func (r *RoleRepository) Delete(ctx context.Context, id int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.role(ctx, id); !ok {
+		return nil
+	}
+	for _, roles := range r.store.userRoles {
+		if roles[id] {
+			return foreignKeyViolation("user_roles_role_id_fkey")
+		}
+	}
+	for _, right := range r.store.roleRights {
+		if right.RoleID == int64(id) {
+			return foreignKeyViolation("role_rights_role_id_fkey")
+		}
+	}
+	for _, g := range r.store.roleGrants {
+		if g.RoleID == id {
+			return foreignKeyViolation("role_grants_role_id_fkey")
+		}
+	}
+	for _, roles := range r.store.groupRoles {
+		if roles[id] {
+			return foreignKeyViolation("group_roles_role_id_fkey")
+		}
+	}
+	for _, client := range r.store.oauthClients {
+		if client.RoleID == id {
+			return foreignKeyViolation("oauth_clients_role_id_fkey")
+		}
+	}
+
+	delete(r.store.roles, id)
+	// parent_id is ON DELETE SET NULL
+	for childID, child := range r.store.roles {
+		if child.ParentID != nil && *child.ParentID == id {
+			child.ParentID = nil
+			r.store.roles[childID] = child
+		}
+	}
+	return nil
+}
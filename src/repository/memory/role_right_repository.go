@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.RoleRightRepository = (*RoleRightRepository)(nil)
+
+type RoleRightRepository struct {
+	store *Store
+}
+
+func NewRoleRightRepository(store *Store) *RoleRightRepository {
+	return &RoleRightRepository{store: store}
+}
+
+func (r *RoleRightRepository) find(roleID int64, section, route string) (entity.RoleRight, bool) {
+	for _, right := range r.store.roleRights {
+		if right.RoleID == roleID && right.Section == section && right.Route == route {
+			return right, true
+		}
+	}
+	return entity.RoleRight{}, false
+}
+
+func (r *RoleRightRepository) GetByRoleIDAndRoute(ctx context.Context, roleID int64, section, route string) (*entity.RoleRight, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	right, ok := r.find(roleID, section, route)
+	if !ok || !r.store.roleVisible(ctx, roleID) {
+		return nil, notFound()
+	}
+	return &right, nil
+}
+
+func (r *RoleRightRepository) filter(keep func(entity.RoleRight) bool) []*entity.RoleRight {
+	rights := make([]*entity.RoleRight, 0)
+	for _, row := range r.store.roleRights {
+		if keep(row) {
+			right := row
+			rights = append(rights, &right)
+		}
+	}
+	sort.Slice(rights, func(i, j int) bool {
+		a, b := rights[i], rights[j]
+		if a.RoleID != b.RoleID {
+			return a.RoleID < b.RoleID
+		}
+		if a.Section != b.Section {
+			return a.Section < b.Section
+		}
+		return a.Route < b.Route
+	})
+	return rights
+}
+
+func (r *RoleRightRepository) GetByRoleID(ctx context.Context, roleID int64) ([]*entity.RoleRight, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.filter(func(right entity.RoleRight) bool {
+		return right.RoleID == roleID && r.store.roleVisible(ctx, right.RoleID)
+	}), nil
+}
+
+func (r *RoleRightRepository) GetAll(ctx context.Context) ([]*entity.RoleRight, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.filter(func(right entity.RoleRight) bool { return r.store.roleVisible(ctx, right.RoleID) }), nil
+}
+
+// GetEffective is not limited to the organization of ctx, like the
+// Postgres query.
+func (r *RoleRightRepository) GetEffective(ctx context.Context, roleIDs []int64, section string) ([]*entity.RoleRight, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	effective := make(map[int64]bool)
+	for _, roleID := range roleIDs {
+		for _, id := range r.store.lineage(int(roleID)) {
+			effective[int64(id)] = true
+		}
+	}
+
+	return r.filter(func(right entity.RoleRight) bool {
+		return effective[right.RoleID] && right.Section == section
+	}), nil
+}
+
+func (r *RoleRightRepository) Create(ctx context.Context, roleRight *entity.RoleRight) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.roles[int(roleRight.RoleID)]; !ok {
+		return foreignKeyViolation("role_rights_role_id_fkey")
+	}
+	if !r.store.roleVisible(ctx, roleRight.RoleID) {
+		return notFound()
+	}
+	if _, ok := r.store.sections[roleRight.Section]; !ok {
+		return foreignKeyViolation("role_rights_section_fkey")
+	}
+	if _, ok := r.find(roleRight.RoleID, roleRight.Section, roleRight.Route); ok {
+		return uniqueViolation("role_rights_role_id_section_route_key")
+	}
+
+	r.store.nextRoleRightID++
+	row := *roleRight
+	row.ID = r.store.nextRoleRightID
+	r.store.roleRights[row.ID] = row
+
+	roleRight.ID = row.ID
+	return nil
+}
+
+func (r *RoleRightRepository) Update(ctx context.Context, roleRight *entity.RoleRight) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.store.roleRights[roleRight.ID]
+	if !ok || !r.store.roleVisible(ctx, row.RoleID) {
+		return nil
+	}
+
+	row.RCreate = roleRight.RCreate
+	row.RRead = roleRight.RRead
+	row.RUpdate = roleRight.RUpdate
+	row.RDelete = roleRight.RDelete
+	row.Deny = roleRight.Deny
+	row.Condition = roleRight.Condition
+	r.store.roleRights[roleRight.ID] = row
+	return nil
+}
+
+func (r *RoleRightRepository) Delete(ctx context.Context, id int64) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row, ok := r.store.roleRights[id]; ok && r.store.roleVisible(ctx, row.RoleID) {
+		delete(r.store.roleRights, id)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.SCIMTokenRepository = (*SCIMTokenRepository)(nil)
+
+type SCIMTokenRepository struct {
+	store *Store
+}
+
+func NewSCIMTokenRepository(store *Store) *SCIMTokenRepository {
+	return &SCIMTokenRepository{store: store}
+}
+
+func (r *SCIMTokenRepository) GetAll(ctx context.Context) ([]*entity.SCIMToken, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	tokens := make([]*entity.SCIMToken, 0)
+	for _, row := range r.store.scimTokens {
+		if !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		token := row
+		tokens = append(tokens, &token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+func (r *SCIMTokenRepository) GetByPrefix(ctx context.Context, prefix string) (*entity.SCIMToken, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, row := range r.store.scimTokens {
+		if row.Prefix == prefix {
+			token := row
+			return &token, nil
+		}
+	}
+	return nil, notFound()
+}
+
+func (r *SCIMTokenRepository) Create(ctx context.Context, token *entity.SCIMToken) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	organizationID, err := tenant.For(ctx, token.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.store.organizations[organizationID]; !ok {
+		return foreignKeyViolation("scim_tokens_organization_id_fkey")
+	}
+	for _, row := range r.store.scimTokens {
+		if row.Prefix == token.Prefix {
+			return uniqueViolation("scim_tokens_prefix_key")
+		}
+	}
+
+	r.store.nextSCIMTokenID++
+	row := *token
+	row.ID = r.store.nextSCIMTokenID
+	row.OrganizationID = organizationID
+	row.LastUsedAt = nil
+	row.CreatedAt = r.store.now()
+	r.store.scimTokens[row.ID] = row
+
+	token.ID, token.OrganizationID, token.CreatedAt = row.ID, organizationID, row.CreatedAt
+	return nil
+}
+
+func (r *SCIMTokenRepository) Delete(ctx context.Context, id int64) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	token, ok := r.store.scimTokens[id]
+	if !ok || !tenant.Contains(ctx, token.OrganizationID) {
+		return notFound()
+	}
+	delete(r.store.scimTokens, id)
+	return nil
+}
+
+func (r *SCIMTokenRepository) UpdateLastUsed(ctx context.Context, id int64, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if token, ok := r.store.scimTokens[id]; ok {
+		token.LastUsedAt = &at
+		r.store.scimTokens[id] = token
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+)
+
+var _ repository.SectionRepository = (*SectionRepository)(nil)
+
+type SectionRepository struct {
+	store *Store
+}
+
+func NewSectionRepository(store *Store) *SectionRepository {
+	return &SectionRepository{store: store}
+}
+
+func (r *SectionRepository) GetAll(ctx context.Context) ([]*entity.Section, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	sections := make([]*entity.Section, 0, len(r.store.sections))
+	for _, row := range r.store.sections {
+		section := row
+		sections = append(sections, &section)
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Name < sections[j].Name })
+	return sections, nil
+}
+
+func (r *SectionRepository) GetByName(ctx context.Context, name string) (*entity.Section, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	section, ok := r.store.sections[name]
+	if !ok {
+		return nil, notFound()
+	}
+	return &section, nil
+}
+
+func (r *SectionRepository) Create(ctx context.Context, section *entity.Section) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.sections[section.Name]; ok {
+		return uniqueViolation("sections_name_key")
+	}
+	r.store.createSection(section)
+	return nil
+}
+
+func (r *SectionRepository) Delete(ctx context.Context, name string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, right := range r.store.roleRights {
+		if right.Section == name {
+			return foreignKeyViolation("role_rights_section_fkey")
+		}
+	}
+	delete(r.store.sections, name)
+	return nil
+}
@@ -0,0 +1,379 @@
+// Package memory provides in-memory implementations of the v1 repository
+// interfaces. They keep the same uniqueness and foreign key rules as the
+// Postgres schema and report violations with the same pq error codes, so
+// services can be exercised without a database or Redis.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/lib/pq"
+)
+
+// Store is the shared state behind the repositories. Repositories built on
+// the same Store see each other's rows, which is what makes the foreign
+// key checks between organizations, users, roles, sections and role_rights
+// possible.
+type Store struct {
+	mu sync.RWMutex
+
+	organizations map[int64]entity.Organization
+	users         map[int64]entity.User
+	roles         map[int]entity.Role
+	roleRights    map[int64]entity.RoleRight
+	userRoles     map[int64]map[int]bool
+	// roleExpiry holds expires_at of the temporary user_roles rows
+	roleExpiry map[int64]map[int]time.Time
+	roleGrants map[int64]entity.RoleGrant
+	sections   map[string]entity.Section
+	groups     map[int]entity.Group
+	// groupMembers holds the created_at of each group_members row
+	groupMembers map[int]map[int64]time.Time
+	groupRoles   map[int]map[int]bool
+	apiTokens    map[int64]entity.APIToken
+	oauthClients map[string]entity.OAuthClient
+	oidcClients  map[string]entity.OIDCClient
+	// oidcConsents is keyed by user ID, then client ID
+	oidcConsents        map[int64]map[string]entity.OIDCConsent
+	federatedIdentities map[int64]entity.FederatedIdentity
+	scimTokens          map[int64]entity.SCIMToken
+
+	nextOrganizationID      int64
+	nextUserID              int64
+	nextRoleID              int
+	nextRoleRightID         int64
+	nextRoleGrantID         int64
+	nextSectionID           int
+	nextGroupID             int
+	nextAPITokenID          int64
+	nextOAuthClientID       int64
+	nextOIDCClientID        int64
+	nextFederatedIdentityID int64
+	nextSCIMTokenID         int64
+
+	// locks are the advisory locks, each held by at most one WithinTx
+	locksMu sync.Mutex
+	locks   map[int64]*sync.Mutex
+
+	now func() time.Time
+}
+
+// heldLocks are the advisory locks taken in one WithinTx.
+type heldLocks struct {
+	keys []int64
+}
+
+type heldLocksKey struct{}
+
+var _ repository.Transactor = (*Store)(nil)
+
+// NewStore returns an empty store with the default organization and the
+// "be" section, which the migrations create as well.
+func NewStore() *Store {
+	s := &Store{
+		organizations:       make(map[int64]entity.Organization),
+		users:               make(map[int64]entity.User),
+		roles:               make(map[int]entity.Role),
+		roleRights:          make(map[int64]entity.RoleRight),
+		userRoles:           make(map[int64]map[int]bool),
+		roleExpiry:          make(map[int64]map[int]time.Time),
+		roleGrants:          make(map[int64]entity.RoleGrant),
+		sections:            make(map[string]entity.Section),
+		groups:              make(map[int]entity.Group),
+		groupMembers:        make(map[int]map[int64]time.Time),
+		groupRoles:          make(map[int]map[int]bool),
+		apiTokens:           make(map[int64]entity.APIToken),
+		oauthClients:        make(map[string]entity.OAuthClient),
+		oidcClients:         make(map[string]entity.OIDCClient),
+		oidcConsents:        make(map[int64]map[string]entity.OIDCConsent),
+		federatedIdentities: make(map[int64]entity.FederatedIdentity),
+		scimTokens:          make(map[int64]entity.SCIMToken),
+		locks:               make(map[int64]*sync.Mutex),
+		now:                 time.Now,
+	}
+	s.createOrganization(&entity.Organization{Slug: "default", Name: "Default"})
+	s.createSection(&entity.Section{Name: "be", Description: "back office"})
+	return s
+}
+
+// createOrganization inserts an organization, the caller holds the write
+// lock.
+func (s *Store) createOrganization(organization *entity.Organization) {
+	s.nextOrganizationID++
+	now := s.now()
+	organization.ID = s.nextOrganizationID
+	organization.CreatedAt = now
+	organization.UpdatedAt = now
+	s.organizations[organization.ID] = *organization
+}
+
+// createSection inserts a section, the caller holds the write lock.
+func (s *Store) createSection(section *entity.Section) {
+	s.nextSectionID++
+	now := s.now()
+	section.ID = s.nextSectionID
+	section.CreatedAt = now
+	section.UpdatedAt = now
+	s.sections[section.Name] = *section
+}
+
+// WithinTx runs fn and puts every row back the way it was when fn fails.
+// Unlike a Postgres transaction it does not isolate fn from concurrent
+// writers, which is enough for tests.
+func (s *Store) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(heldLocksKey{}).(*heldLocks); !ok {
+		held := &heldLocks{}
+		ctx = context.WithValue(ctx, heldLocksKey{}, held)
+		defer s.unlock(held)
+	}
+
+	s.mu.RLock()
+	saved := s.clone()
+	s.mu.RUnlock()
+
+	if err := fn(ctx); err != nil {
+		s.mu.Lock()
+		s.organizations, s.users, s.roles, s.roleRights = saved.organizations, saved.users, saved.roles, saved.roleRights
+		s.userRoles, s.roleExpiry, s.roleGrants, s.sections = saved.userRoles, saved.roleExpiry, saved.roleGrants, saved.sections
+		s.nextOrganizationID, s.nextUserID, s.nextRoleID = saved.nextOrganizationID, saved.nextUserID, saved.nextRoleID
+		s.nextRoleRightID, s.nextRoleGrantID, s.nextSectionID = saved.nextRoleRightID, saved.nextRoleGrantID, saved.nextSectionID
+		s.groups, s.groupMembers, s.groupRoles, s.nextGroupID = saved.groups, saved.groupMembers, saved.groupRoles, saved.nextGroupID
+		s.apiTokens, s.nextAPITokenID = saved.apiTokens, saved.nextAPITokenID
+		s.oauthClients, s.nextOAuthClientID = saved.oauthClients, saved.nextOAuthClientID
+		s.oidcClients, s.oidcConsents, s.nextOIDCClientID = saved.oidcClients, saved.oidcConsents, saved.nextOIDCClientID
+		s.federatedIdentities, s.nextFederatedIdentityID = saved.federatedIdentities, saved.nextFederatedIdentityID
+		s.scimTokens, s.nextSCIMTokenID = saved.scimTokens, saved.nextSCIMTokenID
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Lock takes the advisory lock key until the outermost WithinTx of ctx
+// returns.
+func (s *Store) Lock(ctx context.Context, key int64) error {
+	_, err := s.lock(ctx, key, func(l *sync.Mutex) bool { l.Lock(); return true })
+	return err
+}
+
+func (s *Store) TryLock(ctx context.Context, key int64) (bool, error) {
+	return s.lock(ctx, key, (*sync.Mutex).TryLock)
+}
+
+// lock takes key with take for the WithinTx of ctx, unless it already
+// holds it.
+func (s *Store) lock(ctx context.Context, key int64, take func(l *sync.Mutex) bool) (bool, error) {
+	held, ok := ctx.Value(heldLocksKey{}).(*heldLocks)
+	if !ok {
+		return false, errors.New("advisory lock taken outside of a transaction")
+	}
+	for _, k := range held.keys {
+		if k == key {
+			return true, nil
+		}
+	}
+
+	s.locksMu.Lock()
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[key] = lock
+	}
+	s.locksMu.Unlock()
+
+	if !take(lock) {
+		return false, nil
+	}
+	held.keys = append(held.keys, key)
+	return true, nil
+}
+
+func (s *Store) unlock(held *heldLocks) {
+	s.locksMu.Lock()
+	defer s.locksMu.Unlock()
+	for _, key := range held.keys {
+		s.locks[key].Unlock()
+	}
+}
+
+// clone copies the rows, the caller holds at least the read lock.
+func (s *Store) clone() *Store {
+	c := &Store{
+		organizations:           make(map[int64]entity.Organization, len(s.organizations)),
+		users:                   make(map[int64]entity.User, len(s.users)),
+		roles:                   make(map[int]entity.Role, len(s.roles)),
+		roleRights:              make(map[int64]entity.RoleRight, len(s.roleRights)),
+		userRoles:               make(map[int64]map[int]bool, len(s.userRoles)),
+		roleExpiry:              make(map[int64]map[int]time.Time, len(s.roleExpiry)),
+		roleGrants:              make(map[int64]entity.RoleGrant, len(s.roleGrants)),
+		sections:                make(map[string]entity.Section, len(s.sections)),
+		groups:                  make(map[int]entity.Group, len(s.groups)),
+		groupMembers:            make(map[int]map[int64]time.Time, len(s.groupMembers)),
+		groupRoles:              make(map[int]map[int]bool, len(s.groupRoles)),
+		apiTokens:               make(map[int64]entity.APIToken, len(s.apiTokens)),
+		oauthClients:            make(map[string]entity.OAuthClient, len(s.oauthClients)),
+		oidcClients:             make(map[string]entity.OIDCClient, len(s.oidcClients)),
+		oidcConsents:            make(map[int64]map[string]entity.OIDCConsent, len(s.oidcConsents)),
+		federatedIdentities:     make(map[int64]entity.FederatedIdentity, len(s.federatedIdentities)),
+		scimTokens:              make(map[int64]entity.SCIMToken, len(s.scimTokens)),
+		nextOrganizationID:      s.nextOrganizationID,
+		nextUserID:              s.nextUserID,
+		nextRoleID:              s.nextRoleID,
+		nextRoleRightID:         s.nextRoleRightID,
+		nextRoleGrantID:         s.nextRoleGrantID,
+		nextSectionID:           s.nextSectionID,
+		nextGroupID:             s.nextGroupID,
+		nextAPITokenID:          s.nextAPITokenID,
+		nextOAuthClientID:       s.nextOAuthClientID,
+		nextOIDCClientID:        s.nextOIDCClientID,
+		nextFederatedIdentityID: s.nextFederatedIdentityID,
+		nextSCIMTokenID:         s.nextSCIMTokenID,
+	}
+	for id, o := range s.organizations {
+		c.organizations[id] = o
+	}
+	for id, u := range s.users {
+		c.users[id] = u
+	}
+	for id, r := range s.roles {
+		c.roles[id] = r
+	}
+	for id, r := range s.roleRights {
+		c.roleRights[id] = r
+	}
+	for id, roles := range s.userRoles {
+		c.userRoles[id] = make(map[int]bool, len(roles))
+		for roleID := range roles {
+			c.userRoles[id][roleID] = true
+		}
+	}
+	for id, expiry := range s.roleExpiry {
+		c.roleExpiry[id] = make(map[int]time.Time, len(expiry))
+		for roleID, at := range expiry {
+			c.roleExpiry[id][roleID] = at
+		}
+	}
+	for id, g := range s.roleGrants {
+		c.roleGrants[id] = g
+	}
+	for name, section := range s.sections {
+		c.sections[name] = section
+	}
+	for id, g := range s.groups {
+		c.groups[id] = g
+	}
+	for id, members := range s.groupMembers {
+		c.groupMembers[id] = make(map[int64]time.Time, len(members))
+		for userID, at := range members {
+			c.groupMembers[id][userID] = at
+		}
+	}
+	for id, roles := range s.groupRoles {
+		c.groupRoles[id] = make(map[int]bool, len(roles))
+		for roleID := range roles {
+			c.groupRoles[id][roleID] = true
+		}
+	}
+	for id, t := range s.apiTokens {
+		c.apiTokens[id] = t
+	}
+	for clientID, client := range s.oauthClients {
+		c.oauthClients[clientID] = client
+	}
+	for clientID, client := range s.oidcClients {
+		c.oidcClients[clientID] = client
+	}
+	for userID, consents := range s.oidcConsents {
+		c.oidcConsents[userID] = make(map[string]entity.OIDCConsent, len(consents))
+		for clientID, consent := range consents {
+			c.oidcConsents[userID][clientID] = consent
+		}
+	}
+	for id, identity := range s.federatedIdentities {
+		c.federatedIdentities[id] = identity
+	}
+	for id, token := range s.scimTokens {
+		c.scimTokens[id] = token
+	}
+	return c
+}
+
+// roleVisible reports whether the role belongs to the organization of ctx,
+// the caller holds at least the read lock.
+func (s *Store) roleVisible(ctx context.Context, roleID int64) bool {
+	role, ok := s.roles[int(roleID)]
+	return ok && tenant.Contains(ctx, role.OrganizationID)
+}
+
+// userVisible reports whether the user belongs to the organization of ctx,
+// the caller holds at least the read lock.
+func (s *Store) userVisible(ctx context.Context, userID int64) bool {
+	user, ok := s.users[userID]
+	return ok && tenant.Contains(ctx, user.OrganizationID)
+}
+
+// lineage returns roleID followed by its ancestors, closest first.
+func (s *Store) lineage(roleID int) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for id, ok := roleID, true; ok && !seen[id]; {
+		role, exists := s.roles[id]
+		if !exists {
+			break
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if ok = role.ParentID != nil; ok {
+			id = *role.ParentID
+		}
+	}
+	return ids
+}
+
+// groupLineage returns groupID followed by the groups it is nested in,
+// closest first.
+func (s *Store) groupLineage(groupID int) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for id, ok := groupID, true; ok && !seen[id]; {
+		group, exists := s.groups[id]
+		if !exists {
+			break
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if ok = group.ParentID != nil; ok {
+			id = *group.ParentID
+		}
+	}
+	return ids
+}
+
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Constraint: constraint,
+	}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    fmt.Sprintf("insert or update on table violates foreign key constraint %q", constraint),
+		Constraint: constraint,
+	}
+}
+
+func notFound() error {
+	return sql.ErrNoRows
+}
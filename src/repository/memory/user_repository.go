@@ -0,0 +1,359 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var _ repository.UserRepository = (*UserRepository)(nil)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{store: store}
+}
+
+// withRole attaches the user's roles from user_roles, ordered by ID, and
+// leaves out expired temporary roles.
+func (r *UserRepository) withRole(user entity.User) *entity.User {
+	user.Roles = []entity.Role{}
+	now := r.store.now()
+	for roleID := range r.store.userRoles[user.ID] {
+		if at, ok := r.store.roleExpiry[user.ID][roleID]; ok && !at.After(now) {
+			continue
+		}
+		user.Roles = append(user.Roles, r.store.roles[roleID])
+	}
+	sort.Slice(user.Roles, func(i, j int) bool { return user.Roles[i].ID < user.Roles[j].ID })
+	return &user
+}
+
+// user returns the user when it is visible in the organization of ctx.
+func (r *UserRepository) user(ctx context.Context, id int64) (entity.User, bool) {
+	user, ok := r.store.users[id]
+	return user, ok && tenant.Contains(ctx, user.OrganizationID)
+}
+
+// sameOrganization reports a missing user or role as the foreign keys do,
+// and returns ErrCrossOrganization when the user is outside the
+// organization of ctx or the role belongs to another organization.
+func (r *UserRepository) sameOrganization(ctx context.Context, userID int64, roleID int) error {
+	user, ok := r.store.users[userID]
+	if !ok {
+		return foreignKeyViolation("user_roles_user_id_fkey")
+	}
+	if !tenant.Contains(ctx, user.OrganizationID) {
+		return entity.ErrCrossOrganization
+	}
+	role, ok := r.store.roles[roleID]
+	if !ok {
+		return foreignKeyViolation("user_roles_role_id_fkey")
+	}
+	if role.OrganizationID != user.OrganizationID {
+		return entity.ErrCrossOrganization
+	}
+	return nil
+}
+
+func (r *UserRepository) checkEmail(organizationID int64, email string, exceptID int64) error {
+	for id, u := range r.store.users {
+		if id != exceptID && u.OrganizationID == organizationID && u.Email == email {
+			return uniqueViolation("users_organization_id_email_key")
+		}
+	}
+	return nil
+}
+
+// find returns the first visible user matching, preferring the lowest
+// organization like the Postgres query does when ctx is unscoped.
+func (r *UserRepository) find(ctx context.Context, match func(entity.User) bool) (*entity.User, error) {
+	var found *entity.User
+	for _, user := range r.store.users {
+		if !tenant.Contains(ctx, user.OrganizationID) || !match(user) {
+			continue
+		}
+		if found == nil || user.OrganizationID < found.OrganizationID ||
+			(user.OrganizationID == found.OrganizationID && user.ID < found.ID) {
+			found = r.withRole(user)
+		}
+	}
+	if found == nil {
+		return nil, notFound()
+	}
+	return found, nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id int64) (*entity.User, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.user(ctx, id)
+	if !ok {
+		return nil, notFound()
+	}
+	return r.withRole(user), nil
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.find(ctx, func(user entity.User) bool { return user.Email == email })
+}
+
+func (r *UserRepository) GetByEmailAndPassword(ctx context.Context, email, password string) (*entity.User, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.find(ctx, func(user entity.User) bool { return user.Email == email && user.Password == password })
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *entity.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	organizationID, err := tenant.For(ctx, user.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.store.organizations[organizationID]; !ok {
+		return foreignKeyViolation("users_organization_id_fkey")
+	}
+	for _, role := range user.Roles {
+		row, ok := r.store.roles[role.ID]
+		if !ok {
+			return foreignKeyViolation("user_roles_role_id_fkey")
+		}
+		if row.OrganizationID != organizationID {
+			return entity.ErrCrossOrganization
+		}
+	}
+	if err := r.checkEmail(organizationID, user.Email, 0); err != nil {
+		return err
+	}
+
+	user.OrganizationID = organizationID
+	r.store.nextUserID++
+	now := r.store.now()
+	row := *user
+	row.ID = r.store.nextUserID
+	row.Roles = nil
+	row.LastAccess = nil
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	r.store.users[row.ID] = row
+
+	r.store.userRoles[row.ID] = make(map[int]bool)
+	for _, role := range user.Roles {
+		r.store.userRoles[row.ID][role.ID] = true
+	}
+
+	user.ID = row.ID
+	return nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *entity.User) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.user(ctx, user.ID)
+	if !ok {
+		return nil
+	}
+	if err := r.checkEmail(row.OrganizationID, user.Email, user.ID); err != nil {
+		return err
+	}
+
+	row.Name = user.Name
+	row.Email = user.Email
+	row.Password = user.Password
+	row.DisabledAt = user.DisabledAt
+	row.UpdatedAt = r.store.now()
+	r.store.users[user.ID] = row
+	return nil
+}
+
+func (r *UserRepository) AssignRole(ctx context.Context, userID int64, roleID int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if err := r.sameOrganization(ctx, userID, roleID); err != nil {
+		return err
+	}
+	r.store.userRoles[userID][roleID] = true
+	delete(r.store.roleExpiry[userID], roleID)
+	return nil
+}
+
+func (r *UserRepository) UnassignRole(ctx context.Context, userID int64, roleID int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.user(ctx, userID); !ok {
+		return nil
+	}
+	delete(r.store.userRoles[userID], roleID)
+	delete(r.store.roleExpiry[userID], roleID)
+	return nil
+}
+
+func (r *UserRepository) AssignRoleUntil(ctx context.Context, userID int64, roleID int, until time.Time) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if err := r.sameOrganization(ctx, userID, roleID); err != nil {
+		return err
+	}
+	at, temporary := r.store.roleExpiry[userID][roleID]
+	if r.store.userRoles[userID][roleID] && (!temporary || at.After(until)) {
+		return nil
+	}
+	r.store.userRoles[userID][roleID] = true
+	if r.store.roleExpiry[userID] == nil {
+		r.store.roleExpiry[userID] = make(map[int]time.Time)
+	}
+	r.store.roleExpiry[userID][roleID] = until
+	return nil
+}
+
+func (r *UserRepository) UnassignTemporaryRole(ctx context.Context, userID int64, roleID int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.user(ctx, userID); !ok {
+		return nil
+	}
+	if _, temporary := r.store.roleExpiry[userID][roleID]; temporary {
+		delete(r.store.userRoles[userID], roleID)
+		delete(r.store.roleExpiry[userID], roleID)
+	}
+	return nil
+}
+
+func (r *UserRepository) RemoveExpiredRoles(ctx context.Context, now time.Time) ([]int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	userIDs := make([]int64, 0)
+	for userID, expiry := range r.store.roleExpiry {
+		removed := false
+		for roleID, at := range expiry {
+			if !at.After(now) {
+				delete(r.store.userRoles[userID], roleID)
+				delete(expiry, roleID)
+				removed = true
+			}
+		}
+		if removed {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	return userIDs, nil
+}
+
+func (r *UserRepository) UpdateLastAccess(ctx context.Context, id int64) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row, ok := r.user(ctx, id)
+	if !ok {
+		return nil
+	}
+	now := r.store.now()
+	row.LastAccess = &now
+	r.store.users[id] = row
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.user(ctx, id); !ok {
+		return nil
+	}
+	delete(r.store.users, id)
+	// user_roles, role_grants, group_members, api_tokens, oidc_consents and
+	// federated_identities rows cascade
+	delete(r.store.userRoles, id)
+	delete(r.store.roleExpiry, id)
+	delete(r.store.oidcConsents, id)
+	for grantID, g := range r.store.roleGrants {
+		if g.UserID == id {
+			delete(r.store.roleGrants, grantID)
+		}
+	}
+	for tokenID, t := range r.store.apiTokens {
+		if t.UserID == id {
+			delete(r.store.apiTokens, tokenID)
+		}
+	}
+	for _, members := range r.store.groupMembers {
+		delete(members, id)
+	}
+	for identityID, identity := range r.store.federatedIdentities {
+		if identity.UserID == id {
+			delete(r.store.federatedIdentities, identityID)
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	if err := tenant.Check(ctx); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	users := make([]*entity.User, 0, len(r.store.users))
+	for _, row := range r.store.users {
+		if !tenant.Contains(ctx, row.OrganizationID) {
+			continue
+		}
+		user := r.withRole(row)
+		// The list query does not select the password column
+		user.Password = ""
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const oauthClientColumns = `id, organization_id, client_id, name, secret_hash, role_id, scope, created_at, updated_at`
+
+type OAuthClientRepository struct {
+	db *sqlx.DB
+}
+
+func NewOAuthClientRepository(db *sqlx.DB) *OAuthClientRepository {
+	return &OAuthClientRepository{db: db}
+}
+
+func (r *OAuthClientRepository) GetAll(ctx context.Context) ([]*entity.OAuthClient, error) {
+	var clients []*entity.OAuthClient
+	filter, args, err := scope(ctx, "organization_id", nil)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE TRUE` + filter + ` ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &clients, query, args...); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *OAuthClientRepository) GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	filter, args, err := scope(ctx, "organization_id", []interface{}{clientID})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = $1` + filter
+	if err := conn(ctx, r.db).GetContext(ctx, &client, query, args...); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Create inserts the client into the organization of ctx, or into
+// client.OrganizationID when ctx is marked with tenant.All, and refuses a
+// role of another organization.
+func (r *OAuthClientRepository) Create(ctx context.Context, client *entity.OAuthClient) error {
+	organizationID, err := tenant.For(ctx, client.OrganizationID)
+	if err != nil {
+		return err
+	}
+	client.OrganizationID = organizationID
+
+	var roleOrganizationID int64
+	err = conn(ctx, r.db).GetContext(ctx, &roleOrganizationID, `SELECT organization_id FROM roles WHERE id = $1`, client.RoleID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	// a missing role is left to the foreign key
+	if err == nil && roleOrganizationID != client.OrganizationID {
+		return entity.ErrCrossOrganization
+	}
+
+	query := `
+		INSERT INTO oauth_clients (organization_id, client_id, name, secret_hash, role_id, scope)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, client.OrganizationID, client.ClientID, client.Name, client.SecretHash, client.RoleID, client.Scope).
+		Scan(&client.ID, &client.CreatedAt, &client.UpdatedAt)
+}
+
+func (r *OAuthClientRepository) Delete(ctx context.Context, clientID string) error {
+	filter, args, err := scope(ctx, "organization_id", []interface{}{clientID})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM oauth_clients WHERE client_id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const oidcClientColumns = `id, organization_id, client_id, name, secret_hash, redirect_uris, created_at, updated_at`
+
+type OIDCClientRepository struct {
+	db *sqlx.DB
+}
+
+func NewOIDCClientRepository(db *sqlx.DB) *OIDCClientRepository {
+	return &OIDCClientRepository{db: db}
+}
+
+func (r *OIDCClientRepository) GetAll(ctx context.Context) ([]*entity.OIDCClient, error) {
+	var clients []*entity.OIDCClient
+	filter, args, err := scope(ctx, "organization_id", nil)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + oidcClientColumns + ` FROM oidc_clients WHERE TRUE` + filter + ` ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &clients, query, args...); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *OIDCClientRepository) GetByClientID(ctx context.Context, clientID string) (*entity.OIDCClient, error) {
+	var client entity.OIDCClient
+	filter, args, err := scope(ctx, "organization_id", []interface{}{clientID})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + oidcClientColumns + ` FROM oidc_clients WHERE client_id = $1` + filter
+	if err := conn(ctx, r.db).GetContext(ctx, &client, query, args...); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Create inserts the client into the organization of ctx, or into
+// client.OrganizationID when ctx is marked with tenant.All.
+func (r *OIDCClientRepository) Create(ctx context.Context, client *entity.OIDCClient) error {
+	organizationID, err := tenant.For(ctx, client.OrganizationID)
+	if err != nil {
+		return err
+	}
+	client.OrganizationID = organizationID
+	query := `
+		INSERT INTO oidc_clients (organization_id, client_id, name, secret_hash, redirect_uris)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, client.OrganizationID, client.ClientID, client.Name, client.SecretHash, client.RedirectURIs).
+		Scan(&client.ID, &client.CreatedAt, &client.UpdatedAt)
+}
+
+func (r *OIDCClientRepository) Delete(ctx context.Context, clientID string) error {
+	filter, args, err := scope(ctx, "organization_id", []interface{}{clientID})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM oidc_clients WHERE client_id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *OIDCClientRepository) GetConsent(ctx context.Context, userID int64, clientID string) (*entity.OIDCConsent, error) {
+	var consent entity.OIDCConsent
+	query := `SELECT user_id, client_id, scope, created_at, updated_at FROM oidc_consents WHERE user_id = $1 AND client_id = $2`
+	if err := conn(ctx, r.db).GetContext(ctx, &consent, query, userID, clientID); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// SaveConsent inserts the consent or replaces the scope of an existing
+// one.
+func (r *OIDCClientRepository) SaveConsent(ctx context.Context, consent *entity.OIDCConsent) error {
+	query := `
+		INSERT INTO oidc_consents (user_id, client_id, scope)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scope = EXCLUDED.scope, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, consent.UserID, consent.ClientID, consent.Scope).
+		Scan(&consent.CreatedAt, &consent.UpdatedAt)
+}
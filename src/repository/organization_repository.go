@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"test-tablelink/src/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type OrganizationRepository struct {
+	db *sqlx.DB
+}
+
+func NewOrganizationRepository(db *sqlx.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+func (r *OrganizationRepository) GetAll(ctx context.Context) ([]*entity.Organization, error) {
+	var organizations []*entity.Organization
+	query := `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &organizations, query); err != nil {
+		return nil, err
+	}
+	return organizations, nil
+}
+
+func (r *OrganizationRepository) GetByID(ctx context.Context, id int64) (*entity.Organization, error) {
+	var organization entity.Organization
+	query := `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		WHERE id = $1`
+	if err := conn(ctx, r.db).GetContext(ctx, &organization, query, id); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (r *OrganizationRepository) GetBySlug(ctx context.Context, slug string) (*entity.Organization, error) {
+	var organization entity.Organization
+	query := `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		WHERE slug = $1`
+	if err := conn(ctx, r.db).GetContext(ctx, &organization, query, slug); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (r *OrganizationRepository) Create(ctx context.Context, organization *entity.Organization) error {
+	query := `
+		INSERT INTO organizations (slug, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, organization.Slug, organization.Name).
+		Scan(&organization.ID, &organization.CreatedAt, &organization.UpdatedAt)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"strconv"
+	"strings"
 	"time"
 
 	"test-tablelink/src/entity"
@@ -63,7 +64,181 @@ func (r *RedisRepository) GetUserIDByToken(ctx context.Context, token string) (i
 	return userID, nil
 }
 
+func (r *RedisRepository) GetSession(ctx context.Context, token string) (*entity.Session, error) {
+	key := "token:" + token
+	userID, err := r.client.Get(ctx, key).Int64()
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Session{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
 func (r *RedisRepository) DeleteToken(ctx context.Context, token string) error {
 	key := "token:" + token
 	return r.client.Del(ctx, key).Err()
 }
+
+func (r *RedisRepository) ListSessions(ctx context.Context) ([]*entity.Session, error) {
+	var sessions []*entity.Session
+	iter := r.client.Scan(ctx, 0, "token:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		userID, err := r.client.Get(ctx, key).Int64()
+		if err == goRedis.Nil {
+			// expired between SCAN and GET
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := r.client.TTL(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &entity.Session{
+			Token:     strings.TrimPrefix(key, "token:"),
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *RedisRepository) SetClientToken(ctx context.Context, token string, clientToken *entity.ClientToken) error {
+	key := "client_token:" + token
+	value, err := json.Marshal(clientToken)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, value, time.Until(clientToken.ExpiresAt)).Err()
+}
+
+func (r *RedisRepository) GetClientToken(ctx context.Context, token string) (*entity.ClientToken, error) {
+	key := "client_token:" + token
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var clientToken entity.ClientToken
+	if err := json.Unmarshal(value, &clientToken); err != nil {
+		return nil, err
+	}
+	return &clientToken, nil
+}
+
+func (r *RedisRepository) DeleteClientToken(ctx context.Context, token string) error {
+	key := "client_token:" + token
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *RedisRepository) SetImpersonation(ctx context.Context, token string, impersonation *entity.Impersonation) error {
+	key := "impersonation:" + token
+	value, err := json.Marshal(impersonation)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, value, time.Until(impersonation.ExpiresAt)).Err()
+}
+
+func (r *RedisRepository) GetImpersonation(ctx context.Context, token string) (*entity.Impersonation, error) {
+	key := "impersonation:" + token
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var impersonation entity.Impersonation
+	if err := json.Unmarshal(value, &impersonation); err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *RedisRepository) DeleteImpersonation(ctx context.Context, token string) error {
+	key := "impersonation:" + token
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *RedisRepository) SetAuthorizationCode(ctx context.Context, code string, authCode *entity.AuthorizationCode) error {
+	key := "authorization_code:" + code
+	value, err := json.Marshal(authCode)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, value, time.Until(authCode.ExpiresAt)).Err()
+}
+
+// TakeAuthorizationCode uses GETDEL so a code is only ever redeemed once.
+func (r *RedisRepository) TakeAuthorizationCode(ctx context.Context, code string) (*entity.AuthorizationCode, error) {
+	key := "authorization_code:" + code
+	value, err := r.client.GetDel(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var authCode entity.AuthorizationCode
+	if err := json.Unmarshal(value, &authCode); err != nil {
+		return nil, err
+	}
+	return &authCode, nil
+}
+
+func (r *RedisRepository) SetFederatedLogin(ctx context.Context, state string, login *entity.FederatedLogin) error {
+	key := "federated_login:" + state
+	value, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, value, time.Until(login.ExpiresAt)).Err()
+}
+
+// TakeFederatedLogin uses GETDEL so a state is only ever completed once.
+func (r *RedisRepository) TakeFederatedLogin(ctx context.Context, state string) (*entity.FederatedLogin, error) {
+	key := "federated_login:" + state
+	value, err := r.client.GetDel(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var login entity.FederatedLogin
+	if err := json.Unmarshal(value, &login); err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (r *RedisRepository) SetMagicLink(ctx context.Context, id string, link *entity.MagicLink) error {
+	key := "magic_link:" + id
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, value, time.Until(link.ExpiresAt)).Err()
+}
+
+// TakeMagicLink uses GETDEL so a link only ever logs in once.
+func (r *RedisRepository) TakeMagicLink(ctx context.Context, id string) (*entity.MagicLink, error) {
+	key := "magic_link:" + id
+	value, err := r.client.GetDel(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var link entity.MagicLink
+	if err := json.Unmarshal(value, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
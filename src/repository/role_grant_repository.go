@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"test-tablelink/src/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const roleGrantColumns = `id, user_id, role_id, requested_by, decided_by, justification, duration_seconds,
+		status, expires_at, decided_at, ended_at, created_at, updated_at`
+
+type RoleGrantRepository struct {
+	db *sqlx.DB
+}
+
+func NewRoleGrantRepository(db *sqlx.DB) *RoleGrantRepository {
+	return &RoleGrantRepository{db: db}
+}
+
+// userScope limits role_grants to the users of the organization of ctx.
+func userScope(ctx context.Context, args []interface{}) (string, []interface{}, error) {
+	filter, args, err := scope(ctx, "organization_id", args)
+	if filter == "" {
+		return "", args, err
+	}
+	return ` AND user_id IN (SELECT id FROM users WHERE TRUE` + filter + `)`, args, nil
+}
+
+func (r *RoleGrantRepository) GetByID(ctx context.Context, id int64) (*entity.RoleGrant, error) {
+	var grant entity.RoleGrant
+	filter, args, err := userScope(ctx, []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + roleGrantColumns + ` FROM role_grants WHERE id = $1` + filter
+	if err := conn(ctx, r.db).GetContext(ctx, &grant, query, args...); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *RoleGrantRepository) GetAll(ctx context.Context, status string) ([]*entity.RoleGrant, error) {
+	var grants []*entity.RoleGrant
+	query := `
+		SELECT ` + roleGrantColumns + `
+		FROM role_grants
+		WHERE ($1 = '' OR status = $1)`
+	filter, args, err := userScope(ctx, []interface{}{status})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn(ctx, r.db).SelectContext(ctx, &grants, query+filter+` ORDER BY id DESC`, args...); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (r *RoleGrantRepository) GetByUserID(ctx context.Context, userID int64) ([]*entity.RoleGrant, error) {
+	var grants []*entity.RoleGrant
+	query := `
+		SELECT ` + roleGrantColumns + `
+		FROM role_grants
+		WHERE user_id = $1`
+	filter, args, err := userScope(ctx, []interface{}{userID})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn(ctx, r.db).SelectContext(ctx, &grants, query+filter+` ORDER BY id DESC`, args...); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// GetDue runs across organizations, whatever the scope of ctx.
+func (r *RoleGrantRepository) GetDue(ctx context.Context, now time.Time) ([]*entity.RoleGrant, error) {
+	var grants []*entity.RoleGrant
+	query := `
+		SELECT ` + roleGrantColumns + `
+		FROM role_grants
+		WHERE status = 'approved' AND expires_at <= $1
+		ORDER BY expires_at, id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &grants, query, now); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (r *RoleGrantRepository) Create(ctx context.Context, grant *entity.RoleGrant) error {
+	query := `
+		INSERT INTO role_grants (user_id, role_id, requested_by, justification, duration_seconds, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query,
+		grant.UserID,
+		grant.RoleID,
+		grant.RequestedBy,
+		grant.Justification,
+		grant.DurationSeconds,
+		grant.Status,
+	).Scan(&grant.ID, &grant.CreatedAt, &grant.UpdatedAt)
+}
+
+func (r *RoleGrantRepository) Update(ctx context.Context, grant *entity.RoleGrant) error {
+	query := `
+		UPDATE role_grants
+		SET status = $1, decided_by = $2, expires_at = $3, decided_at = $4, ended_at = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6`
+	filter, args, err := userScope(ctx, []interface{}{
+		grant.Status,
+		grant.DecidedBy,
+		grant.ExpiresAt,
+		grant.DecidedAt,
+		grant.EndedAt,
+		grant.ID,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, query+filter, args...)
+	return err
+}
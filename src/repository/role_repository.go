@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -15,39 +17,143 @@ func NewRoleRepository(db *sqlx.DB) *RoleRepository {
 	return &RoleRepository{db: db}
 }
 
+const roleColumns = `id, organization_id, name, parent_id, magic_link, created_at, updated_at`
+
 func (r *RoleRepository) GetByID(ctx context.Context, id int) (*entity.Role, error) {
 	var role entity.Role
-	query := `SELECT id, name, created_at, updated_at FROM roles WHERE id = $1`
-	err := r.db.GetContext(ctx, &role, query, id)
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE id = $1` + filter
+	err = conn(ctx, r.db).GetContext(ctx, &role, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	return &role, nil
 }
 
+func (r *RoleRepository) GetAll(ctx context.Context) ([]*entity.Role, error) {
+	var roles []*entity.Role
+	filter, args, err := scope(ctx, "organization_id", nil)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE TRUE` + filter + ` ORDER BY id`
+	err = conn(ctx, r.db).SelectContext(ctx, &roles, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
 func (r *RoleRepository) GetByName(ctx context.Context, name string) (*entity.Role, error) {
 	var role entity.Role
-	query := `SELECT id, name, created_at, updated_at FROM roles WHERE name = $1`
-	err := r.db.GetContext(ctx, &role, query, name)
+	filter, args, err := scope(ctx, "organization_id", []interface{}{name})
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE name = $1` + filter + ` ORDER BY organization_id, id LIMIT 1`
+	err = conn(ctx, r.db).GetContext(ctx, &role, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	return &role, nil
 }
 
+// Create inserts the role into the organization of ctx, or into
+// role.OrganizationID when ctx is marked with tenant.All.
 func (r *RoleRepository) Create(ctx context.Context, role *entity.Role) error {
-	query := `INSERT INTO roles (name) VALUES ($1) RETURNING id`
-	return r.db.QueryRowContext(ctx, query, role.Name).Scan(&role.ID)
+	organizationID, err := tenant.For(ctx, role.OrganizationID)
+	if err != nil {
+		return err
+	}
+	role.OrganizationID = organizationID
+	if err := r.sameOrganization(ctx, role.OrganizationID, role.ParentID); err != nil {
+		return err
+	}
+	query := `INSERT INTO roles (organization_id, name, parent_id, magic_link) VALUES ($1, $2, $3, $4) RETURNING id`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, role.OrganizationID, role.Name, role.ParentID, role.MagicLink).Scan(&role.ID)
+}
+
+// sameOrganization returns ErrCrossOrganization when parentID is a role of
+// an organization other than organizationID.
+func (r *RoleRepository) sameOrganization(ctx context.Context, organizationID int64, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	var parentOrganizationID int64
+	err := conn(ctx, r.db).GetContext(ctx, &parentOrganizationID, `SELECT organization_id FROM roles WHERE id = $1`, *parentID)
+	if err == sql.ErrNoRows {
+		// let the foreign key report it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if parentOrganizationID != organizationID {
+		return entity.ErrCrossOrganization
+	}
+	return nil
 }
 
+// Update saves the role and refuses a parent that already inherits from it
+// or that belongs to another organization.
 func (r *RoleRepository) Update(ctx context.Context, role *entity.Role) error {
-	query := `UPDATE roles SET name = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err := r.db.ExecContext(ctx, query, role.Name, role.ID)
-	return err
+	return NewTransactor(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		var organizationID int64
+		filter, args, err := scope(ctx, "organization_id", []interface{}{role.ID})
+		if err != nil {
+			return err
+		}
+		err = tx.GetContext(ctx, &organizationID, `SELECT organization_id FROM roles WHERE id = $1`+filter, args...)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.sameOrganization(ctx, organizationID, role.ParentID); err != nil {
+			return err
+		}
+
+		if role.ParentID != nil {
+			// Serialize parent changes so two updates cannot close a cycle
+			if _, err := tx.ExecContext(ctx, `LOCK TABLE roles IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+
+			var cycle bool
+			query := `
+				WITH RECURSIVE ancestors(id) AS (
+					SELECT $1::integer
+					UNION
+					SELECT r.parent_id FROM roles r JOIN ancestors a ON r.id = a.id
+					WHERE r.parent_id IS NOT NULL
+				)
+				SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+			if err := tx.GetContext(ctx, &cycle, query, *role.ParentID, role.ID); err != nil {
+				return err
+			}
+			if cycle {
+				return entity.ErrRoleCycle
+			}
+		}
+
+		query := `UPDATE roles SET name = $1, parent_id = $2, magic_link = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4`
+		_, err = tx.ExecContext(ctx, query, role.Name, role.ParentID, role.MagicLink, role.ID)
+		return err
+	})
 }
 
 func (r *RoleRepository) Delete(ctx context.Context, id int) error {
-	query := `DELETE FROM roles WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM roles WHERE id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
 	return err
 }
@@ -6,6 +6,7 @@ import (
 	"test-tablelink/src/entity"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type RoleRightRepository struct {
@@ -16,14 +17,26 @@ func NewRoleRightRepository(db *sqlx.DB) *RoleRightRepository {
 	return &RoleRightRepository{db: db}
 }
 
+// roleScope limits role_rights to the roles of the organization of ctx.
+func roleScope(ctx context.Context, args []interface{}) (string, []interface{}, error) {
+	filter, args, err := scope(ctx, "organization_id", args)
+	if filter == "" {
+		return "", args, err
+	}
+	return ` AND role_id IN (SELECT id FROM roles WHERE TRUE` + filter + `)`, args, nil
+}
+
 func (r *RoleRightRepository) GetByRoleIDAndRoute(ctx context.Context, roleID int64, section, route string) (*entity.RoleRight, error) {
 	var roleRight entity.RoleRight
 	query := `
-		SELECT id, role_id, section, route, r_create, r_read, r_update, r_delete
+		SELECT id, role_id, section, route, r_create, r_read, r_update, r_delete, deny, condition
 		FROM role_rights
-		WHERE role_id = $1 AND section = $2 AND route = $3
-	`
-	err := r.db.GetContext(ctx, &roleRight, query, roleID, section, route)
+		WHERE role_id = $1 AND section = $2 AND route = $3`
+	filter, args, err := roleScope(ctx, []interface{}{roleID, section, route})
+	if err != nil {
+		return nil, err
+	}
+	err = conn(ctx, r.db).GetContext(ctx, &roleRight, query+filter, args...)
 	if err != nil {
 		log.Printf("Error getting role right: %v", err)
 		return nil, err
@@ -31,37 +44,71 @@ func (r *RoleRightRepository) GetByRoleIDAndRoute(ctx context.Context, roleID in
 	return &roleRight, nil
 }
 
-func (r *RoleRightRepository) CheckPermission(ctx context.Context, roleID int64, section, route, method string) (bool, error) {
-	var count int
+func (r *RoleRightRepository) GetByRoleID(ctx context.Context, roleID int64) ([]*entity.RoleRight, error) {
+	var roleRights []*entity.RoleRight
+	query := `
+		SELECT id, role_id, section, route, r_create, r_read, r_update, r_delete, deny, condition
+		FROM role_rights
+		WHERE role_id = $1`
+	filter, args, err := roleScope(ctx, []interface{}{roleID})
+	if err != nil {
+		return nil, err
+	}
+	err = conn(ctx, r.db).SelectContext(ctx, &roleRights, query+filter+` ORDER BY section, route`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return roleRights, nil
+}
+
+func (r *RoleRightRepository) GetAll(ctx context.Context) ([]*entity.RoleRight, error) {
+	var roleRights []*entity.RoleRight
 	query := `
-		SELECT COUNT(*)
+		SELECT id, role_id, section, route, r_create, r_read, r_update, r_delete, deny, condition
 		FROM role_rights
-		WHERE role_id = $1 
-		AND section = $2 
-		AND route = $3
-		AND (
-			($4 = 'POST' AND r_create = true) OR
-			($4 = 'GET' AND r_read = true) OR
-			($4 = 'PUT' AND r_update = true) OR
-			($4 = 'DELETE' AND r_delete = true)
+		WHERE TRUE`
+	filter, args, err := roleScope(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = conn(ctx, r.db).SelectContext(ctx, &roleRights, query+filter+` ORDER BY role_id, section, route`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return roleRights, nil
+}
+
+// GetEffective is not limited to the organization of ctx: roleIDs are the
+// roles of the user being authorized, which a super-admin keeps while
+// operating in another organization.
+func (r *RoleRightRepository) GetEffective(ctx context.Context, roleIDs []int64, section string) ([]*entity.RoleRight, error) {
+	var roleRights []*entity.RoleRight
+	query := `
+		WITH RECURSIVE effective_roles(id) AS (
+			SELECT id FROM roles WHERE id = ANY($1)
+			UNION
+			SELECT r.parent_id FROM roles r JOIN effective_roles e ON r.id = e.id
+			WHERE r.parent_id IS NOT NULL
 		)
+		SELECT id, role_id, section, route, r_create, r_read, r_update, r_delete, deny, condition
+		FROM role_rights
+		WHERE role_id IN (SELECT id FROM effective_roles)
+		AND section = $2
+		ORDER BY role_id, route
 	`
-	log.Printf("Executing permission check query with params: roleID=%d, section=%s, route=%s, method=%s", roleID, section, route, method)
-	err := r.db.GetContext(ctx, &count, query, roleID, section, route, method)
+	err := conn(ctx, r.db).SelectContext(ctx, &roleRights, query, pq.Array(roleIDs), section)
 	if err != nil {
-		log.Printf("Error executing permission check query: %v", err)
-		return false, err
+		log.Printf("Error getting effective role rights: %v", err)
+		return nil, err
 	}
-	log.Printf("Permission check result: count=%d", count)
-	return count > 0, nil
+	return roleRights, nil
 }
 
 func (r *RoleRightRepository) Create(ctx context.Context, roleRight *entity.RoleRight) error {
 	query := `
-		INSERT INTO role_rights (role_id, section, route, r_create, r_read, r_update, r_delete)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id`
-	return r.db.QueryRowContext(ctx, query,
+		INSERT INTO role_rights (role_id, section, route, r_create, r_read, r_update, r_delete, deny, condition)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8, $9 FROM roles WHERE id = $1`
+	filter, args, err := scope(ctx, "organization_id", []interface{}{
 		roleRight.RoleID,
 		roleRight.Section,
 		roleRight.Route,
@@ -69,26 +116,44 @@ func (r *RoleRightRepository) Create(ctx context.Context, roleRight *entity.Role
 		roleRight.RRead,
 		roleRight.RUpdate,
 		roleRight.RDelete,
-	).Scan(&roleRight.ID)
+		roleRight.Deny,
+		roleRight.Condition,
+	})
+	if err != nil {
+		return err
+	}
+	// a role outside the organization inserts nothing and reports
+	// sql.ErrNoRows
+	return conn(ctx, r.db).QueryRowContext(ctx, query+filter+` RETURNING id`, args...).Scan(&roleRight.ID)
 }
 
 func (r *RoleRightRepository) Update(ctx context.Context, roleRight *entity.RoleRight) error {
 	query := `
 		UPDATE role_rights 
-		SET r_create = $1, r_read = $2, r_update = $3, r_delete = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5`
-	_, err := r.db.ExecContext(ctx, query,
+		SET r_create = $1, r_read = $2, r_update = $3, r_delete = $4, deny = $5, condition = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7`
+	filter, args, err := roleScope(ctx, []interface{}{
 		roleRight.RCreate,
 		roleRight.RRead,
 		roleRight.RUpdate,
 		roleRight.RDelete,
+		roleRight.Deny,
+		roleRight.Condition,
 		roleRight.ID,
-	)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, query+filter, args...)
 	return err
 }
 
 func (r *RoleRightRepository) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM role_rights WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	filter, args, err := roleScope(ctx, []interface{}{id})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM role_rights WHERE id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
 	return err
 }
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const scimTokenColumns = `id, organization_id, name, prefix, token_hash, last_used_at, created_at`
+
+type SCIMTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewSCIMTokenRepository(db *sqlx.DB) *SCIMTokenRepository {
+	return &SCIMTokenRepository{db: db}
+}
+
+func (r *SCIMTokenRepository) GetAll(ctx context.Context) ([]*entity.SCIMToken, error) {
+	tokens := []*entity.SCIMToken{}
+	filter, args, err := scope(ctx, "organization_id", nil)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + scimTokenColumns + ` FROM scim_tokens WHERE TRUE` + filter + ` ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &tokens, query, args...); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// GetByPrefix runs across organizations, whatever the scope of ctx: the
+// token decides which organization a request is for.
+func (r *SCIMTokenRepository) GetByPrefix(ctx context.Context, prefix string) (*entity.SCIMToken, error) {
+	var token entity.SCIMToken
+	query := `SELECT ` + scimTokenColumns + ` FROM scim_tokens WHERE prefix = $1`
+	if err := conn(ctx, r.db).GetContext(ctx, &token, query, prefix); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Create inserts the token into the organization of ctx, or into
+// token.OrganizationID when ctx is marked with tenant.All.
+func (r *SCIMTokenRepository) Create(ctx context.Context, token *entity.SCIMToken) error {
+	organizationID, err := tenant.For(ctx, token.OrganizationID)
+	if err != nil {
+		return err
+	}
+	token.OrganizationID = organizationID
+	query := `
+		INSERT INTO scim_tokens (organization_id, name, prefix, token_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, token.OrganizationID, token.Name, token.Prefix, token.TokenHash).
+		Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *SCIMTokenRepository) Delete(ctx context.Context, id int64) error {
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return err
+	}
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM scim_tokens WHERE id = $1`+filter, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *SCIMTokenRepository) UpdateLastUsed(ctx context.Context, id int64, at time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE scim_tokens SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"test-tablelink/src/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type SectionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSectionRepository(db *sqlx.DB) *SectionRepository {
+	return &SectionRepository{db: db}
+}
+
+func (r *SectionRepository) GetAll(ctx context.Context) ([]*entity.Section, error) {
+	var sections []*entity.Section
+	query := `
+		SELECT id, name, description, created_at, updated_at
+		FROM sections
+		ORDER BY name`
+	if err := conn(ctx, r.db).SelectContext(ctx, &sections, query); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+func (r *SectionRepository) GetByName(ctx context.Context, name string) (*entity.Section, error) {
+	var section entity.Section
+	query := `
+		SELECT id, name, description, created_at, updated_at
+		FROM sections
+		WHERE name = $1`
+	if err := conn(ctx, r.db).GetContext(ctx, &section, query, name); err != nil {
+		return nil, err
+	}
+	return &section, nil
+}
+
+func (r *SectionRepository) Create(ctx context.Context, section *entity.Section) error {
+	query := `
+		INSERT INTO sections (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, section.Name, section.Description).
+		Scan(&section.ID, &section.CreatedAt, &section.UpdatedAt)
+}
+
+func (r *SectionRepository) Delete(ctx context.Context, name string) error {
+	query := `DELETE FROM sections WHERE name = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, name)
+	return err
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"test-tablelink/src/v1/tenant"
+)
+
+// scope returns the " AND column = $n" filter limiting a query to the
+// organization of ctx, with its argument appended to args. Contexts marked
+// with tenant.All get no filter, unscoped ones tenant.ErrUnscoped.
+func scope(ctx context.Context, column string, args []interface{}) (string, []interface{}, error) {
+	id, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return "", args, tenant.Check(ctx)
+	}
+	args = append(args, id)
+	return fmt.Sprintf(" AND %s = $%d", column, len(args)), args, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type txKey struct{}
+
+// querier is what *sqlx.DB and *sqlx.Tx have in common.
+type querier interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction in ctx, or db outside of one.
+func conn(ctx context.Context, db *sqlx.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+type Transactor struct {
+	db *sqlx.DB
+}
+
+func NewTransactor(db *sqlx.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *Transactor) Lock(ctx context.Context, key int64) error {
+	tx, err := lockTx(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", key)
+	return err
+}
+
+func (t *Transactor) TryLock(ctx context.Context, key int64) (bool, error) {
+	tx, err := lockTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	var locked bool
+	err = tx.GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock($1)", key)
+	return locked, err
+}
+
+// lockTx returns the transaction in ctx, which a transaction level advisory
+// lock needs.
+func lockTx(ctx context.Context) (*sqlx.Tx, error) {
+	tx, ok := ctx.Value(txKey{}).(*sqlx.Tx)
+	if !ok {
+		return nil, errors.New("advisory lock taken outside of a transaction")
+	}
+	return tx, nil
+}
@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/tenant"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type UserRepository struct {
@@ -15,101 +19,269 @@ func NewUserRepository(db *sqlx.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id int64) (*entity.User, error) {
-	var user entity.User
+type userRole struct {
+	UserID int64 `db:"user_id"`
+	entity.Role
+}
+
+// loadRoles fills in the roles of the given users, leaving out temporary
+// roles that expired but were not removed yet.
+func (r *UserRepository) loadRoles(ctx context.Context, users ...*entity.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(users))
+	byID := make(map[int64]*entity.User, len(users))
+	for _, u := range users {
+		u.Roles = []entity.Role{}
+		ids = append(ids, u.ID)
+		byID[u.ID] = u
+	}
+
+	var rows []userRole
 	query := `
-		SELECT u.id, u.role_id, u.name, u.email, u.password, u.last_access, u.created_at, u.updated_at,
-		       r.name as role_name
-		FROM users u
-		LEFT JOIN roles r ON u.role_id = r.id
-		WHERE u.id = $1`
-	err := r.db.GetContext(ctx, &user, query, id)
-	if err != nil {
-		return nil, err
+		SELECT ur.user_id, r.id, r.organization_id, r.name, r.magic_link, r.created_at, r.updated_at
+		FROM user_roles ur
+		JOIN roles r ON ur.role_id = r.id
+		WHERE ur.user_id = ANY($1)
+		AND (ur.expires_at IS NULL OR ur.expires_at > CURRENT_TIMESTAMP)
+		ORDER BY r.id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, pq.Array(ids)); err != nil {
+		return err
 	}
-	return &user, nil
+	for _, row := range rows {
+		u := byID[row.UserID]
+		u.Roles = append(u.Roles, row.Role)
+	}
+	return nil
 }
 
-func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+// get returns the user matching where within the organization of ctx.
+func (r *UserRepository) get(ctx context.Context, where string, args ...interface{}) (*entity.User, error) {
 	var user entity.User
-	query := `
-		SELECT u.id, u.role_id, u.name, u.email, u.password, u.last_access, u.created_at, u.updated_at,
-		       r.name as role_name
-		FROM users u
-		LEFT JOIN roles r ON u.role_id = r.id
-		WHERE u.email = $1`
-	err := r.db.GetContext(ctx, &user, query, email)
+	filter, args, err := scope(ctx, "organization_id", args)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
-}
-
-func (r *UserRepository) GetByEmailAndPassword(ctx context.Context, email, password string) (*entity.User, error) {
-	var user entity.User
 	query := `
-		SELECT u.id, u.role_id, u.name, u.email, u.password, u.last_access, u.created_at, u.updated_at,
-		       r.name as role_name
-		FROM users u
-		LEFT JOIN roles r ON u.role_id = r.id
-		WHERE u.email = $1 AND u.password = $2`
-	err := r.db.GetContext(ctx, &user, query, email, password)
+		SELECT id, organization_id, name, email, password, last_access, disabled_at, created_at, updated_at
+		FROM users
+		WHERE ` + where + filter + `
+		ORDER BY organization_id, id
+		LIMIT 1`
+	err = conn(ctx, r.db).GetContext(ctx, &user, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.loadRoles(ctx, &user); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
+func (r *UserRepository) GetByID(ctx context.Context, id int64) (*entity.User, error) {
+	return r.get(ctx, "id = $1", id)
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	return r.get(ctx, "email = $1", email)
+}
+
+func (r *UserRepository) GetByEmailAndPassword(ctx context.Context, email, password string) (*entity.User, error) {
+	return r.get(ctx, "email = $1 AND password = $2", email, password)
+}
+
+// Create inserts the user into the organization of ctx, or into
+// user.OrganizationID when ctx is marked with tenant.All, together with
+// its roles. The roles must belong to the same organization.
 func (r *UserRepository) Create(ctx context.Context, user *entity.User) error {
-	query := `
-		INSERT INTO users (role_id, name, email, password)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id`
-	return r.db.QueryRowContext(ctx, query,
-		user.RoleID,
-		user.Name,
-		user.Email,
-		user.Password,
-	).Scan(&user.ID)
+	return NewTransactor(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+		organizationID, err := tenant.For(ctx, user.OrganizationID)
+		if err != nil {
+			return err
+		}
+		user.OrganizationID = organizationID
+		query := `
+			INSERT INTO users (organization_id, name, email, password)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`
+		err = tx.QueryRowContext(ctx, query,
+			user.OrganizationID,
+			user.Name,
+			user.Email,
+			user.Password,
+		).Scan(&user.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, role := range user.Roles {
+			if err := sameOrganization(ctx, tx, user.ID, role.ID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)`, user.ID, role.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sameOrganization returns ErrCrossOrganization when the user is outside
+// the organization of ctx or the role belongs to another organization than
+// the user. Missing rows are left to the foreign keys to report.
+func sameOrganization(ctx context.Context, q querier, userID int64, roleID int) error {
+	if err := tenant.Check(ctx); err != nil {
+		return err
+	}
+	var userOrganizationID, roleOrganizationID int64
+	err := q.GetContext(ctx, &userOrganizationID, `SELECT organization_id FROM users WHERE id = $1`, userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !tenant.Contains(ctx, userOrganizationID) {
+		return entity.ErrCrossOrganization
+	}
+	err = q.GetContext(ctx, &roleOrganizationID, `SELECT organization_id FROM roles WHERE id = $1`, roleID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if roleOrganizationID != userOrganizationID {
+		return entity.ErrCrossOrganization
+	}
+	return nil
 }
 
+// Update saves the user's own columns. Roles are changed with AssignRole
+// and UnassignRole.
 func (r *UserRepository) Update(ctx context.Context, user *entity.User) error {
 	query := `
 		UPDATE users 
-		SET role_id = $1, name = $2, email = $3, password = $4, updated_at = CURRENT_TIMESTAMP
+		SET name = $1, email = $2, password = $3, disabled_at = $4, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $5`
-	_, err := r.db.ExecContext(ctx, query,
-		user.RoleID,
+	filter, args, err := scope(ctx, "organization_id", []interface{}{
 		user.Name,
 		user.Email,
 		user.Password,
+		user.DisabledAt,
 		user.ID,
-	)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, query+filter, args...)
+	return err
+}
+
+func (r *UserRepository) AssignRole(ctx context.Context, userID int64, roleID int) error {
+	if err := sameOrganization(ctx, conn(ctx, r.db), userID, roleID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO user_roles (user_id, role_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, role_id) DO UPDATE SET expires_at = NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, roleID)
+	return err
+}
+
+func (r *UserRepository) AssignRoleUntil(ctx context.Context, userID int64, roleID int, until time.Time) error {
+	if err := sameOrganization(ctx, conn(ctx, r.db), userID, roleID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO user_roles (user_id, role_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role_id) DO UPDATE SET expires_at = GREATEST(user_roles.expires_at, EXCLUDED.expires_at)
+		WHERE user_roles.expires_at IS NOT NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, roleID, until)
+	return err
+}
+
+func (r *UserRepository) UnassignTemporaryRole(ctx context.Context, userID int64, roleID int) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2 AND expires_at IS NOT NULL`
+	return r.unassign(ctx, query, userID, roleID)
+}
+
+// RemoveExpiredRoles runs across organizations, whatever the scope of ctx.
+func (r *UserRepository) RemoveExpiredRoles(ctx context.Context, now time.Time) ([]int64, error) {
+	var userIDs []int64
+	query := `
+		WITH removed AS (
+			DELETE FROM user_roles WHERE expires_at <= $1 RETURNING user_id
+		)
+		SELECT DISTINCT user_id FROM removed ORDER BY user_id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &userIDs, query, now); err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+func (r *UserRepository) UnassignRole(ctx context.Context, userID int64, roleID int) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`
+	return r.unassign(ctx, query, userID, roleID)
+}
+
+// unassign runs a user_roles delete, limited to users of the organization
+// of ctx.
+func (r *UserRepository) unassign(ctx context.Context, query string, userID int64, roleID int) error {
+	filter, args, err := scope(ctx, "u.organization_id", []interface{}{userID, roleID})
+	if err != nil {
+		return err
+	}
+	if filter != "" {
+		query += ` AND EXISTS (SELECT 1 FROM users u WHERE u.id = user_roles.user_id` + filter + `)`
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
 	return err
 }
 
 func (r *UserRepository) UpdateLastAccess(ctx context.Context, id int64) error {
-	query := `UPDATE users SET last_access = CURRENT_TIMESTAMP WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return err
+	}
+	query := `UPDATE users SET last_access = CURRENT_TIMESTAMP WHERE id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
 	return err
 }
 
 func (r *UserRepository) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	filter, args, err := scope(ctx, "organization_id", []interface{}{id})
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM users WHERE id = $1` + filter
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
 	return err
 }
 
 func (r *UserRepository) GetAll(ctx context.Context) ([]*entity.User, error) {
 	var users []*entity.User
+	filter, args, err := scope(ctx, "organization_id", nil)
+	if err != nil {
+		return nil, err
+	}
 	query := `
-		SELECT u.id, u.role_id, u.name, u.email, u.last_access, u.created_at, u.updated_at,
-		       r.name as role_name
-		FROM users u
-		LEFT JOIN roles r ON u.role_id = r.id`
-	err := r.db.SelectContext(ctx, &users, query)
+		SELECT id, organization_id, name, email, last_access, disabled_at, created_at, updated_at
+		FROM users
+		WHERE TRUE` + filter + `
+		ORDER BY id`
+	err = conn(ctx, r.db).SelectContext(ctx, &users, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.loadRoles(ctx, users...); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
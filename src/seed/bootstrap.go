@@ -0,0 +1,104 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/tenant"
+)
+
+// MinPasswordLength is the shortest password Bootstrap accepts.
+const MinPasswordLength = 8
+
+// ErrAdminExists is returned by Bootstrap when the admin role already has
+// at least one user.
+var ErrAdminExists = errors.New("an admin user already exists")
+
+type Admin struct {
+	Name     string
+	Email    string
+	Password string
+	Role     string
+}
+
+func (a Admin) validate() error {
+	var problems []string
+	if strings.TrimSpace(a.Email) == "" {
+		problems = append(problems, "email is required")
+	}
+	if len(a.Password) < MinPasswordLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters", MinPasswordLength))
+	}
+	if a.Role == "" {
+		problems = append(problems, "role is required")
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// bootstrapLockKey identifies the advisory lock Bootstrap holds, so
+// replicas bootstrapping at the same time create a single admin.
+const bootstrapLockKey int64 = 7270736902
+
+// Bootstrap creates the first admin of the default organization. It
+// refuses to run once any user there holds the admin role, so it is safe to
+// call on every deploy. The check and the insert run in one transaction
+// holding an advisory lock.
+func (s *Seeder) Bootstrap(ctx context.Context, admin Admin) (*entity.User, error) {
+	if err := admin.validate(); err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithOrganization(ctx, entity.DefaultOrganizationID)
+
+	hashed, err := password.Hash(admin.Password)
+	if err != nil {
+		return nil, err
+	}
+	name := admin.Name
+	if name == "" {
+		name = "Administrator"
+	}
+
+	var user *entity.User
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.transactor.Lock(ctx, bootstrapLockKey); err != nil {
+			return fmt.Errorf("failed to acquire bootstrap lock: %w", err)
+		}
+
+		role, err := s.roleRepo.GetByName(ctx, admin.Role)
+		if err != nil {
+			return fmt.Errorf("failed to get role %s (run seed first): %w", admin.Role, err)
+		}
+
+		users, err := s.userRepo.GetAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+		for _, u := range users {
+			if u.HasRole(role.Name) {
+				return ErrAdminExists
+			}
+		}
+
+		user = &entity.User{
+			Roles:    []entity.Role{*role},
+			Name:     name,
+			Email:    admin.Email,
+			Password: hashed,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create admin %s: %w", admin.Email, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
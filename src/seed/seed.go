@@ -0,0 +1,501 @@
+// Package seed upserts fixture data through the repositories.
+//
+// Fixtures are YAML or JSON files of organizations, sections, roles,
+// rights and users. Seeding is kept out of the schema migrations so each
+// environment decides which data it gets.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed fixtures/*.yaml
+var fixtureFiles embed.FS
+
+type Organization struct {
+	Slug string `yaml:"slug" json:"slug"`
+	Name string `yaml:"name" json:"name"`
+}
+
+type Section struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+type Right struct {
+	Section string `yaml:"section" json:"section"`
+	Route   string `yaml:"route" json:"route"`
+	Create  bool   `yaml:"create,omitempty" json:"create"`
+	Read    bool   `yaml:"read,omitempty" json:"read"`
+	Update  bool   `yaml:"update,omitempty" json:"update"`
+	Delete  bool   `yaml:"delete,omitempty" json:"delete"`
+	// Deny forbids the flagged operations instead of granting them
+	Deny bool `yaml:"deny,omitempty" json:"deny,omitempty"`
+	// Condition limits the rule, e.g. "own" for the user's own record
+	Condition string `yaml:"condition,omitempty" json:"condition,omitempty"`
+}
+
+type Role struct {
+	// Organization is the slug of the role's organization, the default
+	// organization when empty
+	Organization string `yaml:"organization,omitempty" json:"organization,omitempty"`
+	Name         string `yaml:"name" json:"name"`
+	// Parent names the role this one inherits rights from
+	Parent string `yaml:"parent,omitempty" json:"parent,omitempty"`
+	// MagicLink lets the role's users log in with a link sent by email
+	MagicLink bool    `yaml:"magic_link,omitempty" json:"magic_link,omitempty"`
+	Rights    []Right `yaml:"rights" json:"rights"`
+}
+
+// roleKey identifies a fixture role, the same name can exist in several
+// organizations.
+type roleKey struct {
+	organization, name string
+}
+
+type User struct {
+	// Organization is the slug of the user's organization, the default
+	// organization when empty. Its roles are looked up there.
+	Organization string   `yaml:"organization,omitempty" json:"organization,omitempty"`
+	Name         string   `yaml:"name" json:"name"`
+	Email        string   `yaml:"email" json:"email"`
+	Password     string   `yaml:"password" json:"password"`
+	Roles        []string `yaml:"roles" json:"roles"`
+	// Role is the single role form of Roles
+	Role string `yaml:"role,omitempty" json:"role,omitempty"`
+}
+
+func (u User) roleNames() []string {
+	if u.Role == "" {
+		return u.Roles
+	}
+	return append([]string{u.Role}, u.Roles...)
+}
+
+type Fixture struct {
+	// Organizations are created before the roles and users in them.
+	// Organizations that already exist are left as they are.
+	Organizations []Organization `yaml:"organizations" json:"organizations"`
+	// Sections are created before the rights granted in them. Sections
+	// that already exist are left as they are.
+	Sections []Section `yaml:"sections" json:"sections"`
+	Roles    []Role    `yaml:"roles" json:"roles"`
+	Users    []User    `yaml:"users" json:"users"`
+}
+
+// Result counts what a Seed run changed. Rows already matching the
+// fixture are left untouched and not counted.
+type Result struct {
+	OrganizationsCreated int
+	SectionsCreated      int
+	RolesCreated         int
+	RolesUpdated         int
+	RightsCreated        int
+	RightsUpdated        int
+	UsersCreated         int
+	UsersUpdated         int
+}
+
+// Parse decodes a fixture. format is "yaml" or "json".
+func Parse(data []byte, format string) (*Fixture, error) {
+	var f Fixture
+	var err error
+	switch format {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &f)
+	case "json":
+		err = json.Unmarshal(data, &f)
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixture: %w", err)
+	}
+	return &f, nil
+}
+
+// LoadFile reads a fixture file, picking the format from its extension.
+func LoadFile(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// baseFixture holds what every environment is seeded with.
+const baseFixture = "base"
+
+// LoadEnv returns the built-in fixture for an environment such as
+// "development", "staging" or "production": base.yaml extended by the
+// environment's own file.
+func LoadEnv(env string) (*Fixture, error) {
+	if env == baseFixture {
+		return nil, fmt.Errorf("no seed fixture for environment %q", env)
+	}
+	data, err := fixtureFiles.ReadFile("fixtures/" + env + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("no seed fixture for environment %q", env)
+	}
+	own, err := Parse(data, "yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = fixtureFiles.ReadFile("fixtures/" + baseFixture + ".yaml")
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(data, "yaml")
+	if err != nil {
+		return nil, err
+	}
+	f.extend(own)
+	return f, nil
+}
+
+// extend adds the organizations, sections, roles and users of o to f. A
+// role f already has is changed instead: the rights of o are added to it,
+// and its parent and magic link are set when o sets them.
+func (f *Fixture) extend(o *Fixture) {
+	f.Organizations = append(f.Organizations, o.Organizations...)
+	f.Sections = append(f.Sections, o.Sections...)
+	f.Users = append(f.Users, o.Users...)
+
+	for _, r := range o.Roles {
+		role := f.role(r.Organization, r.Name)
+		if role == nil {
+			f.Roles = append(f.Roles, r)
+			continue
+		}
+		role.Rights = append(role.Rights, r.Rights...)
+		if r.Parent != "" {
+			role.Parent = r.Parent
+		}
+		role.MagicLink = role.MagicLink || r.MagicLink
+	}
+}
+
+// role returns the role named name of organization, nil when f has none.
+func (f *Fixture) role(organization, name string) *Role {
+	for i := range f.Roles {
+		if f.Roles[i].Organization == organization && f.Roles[i].Name == name {
+			return &f.Roles[i]
+		}
+	}
+	return nil
+}
+
+type Seeder struct {
+	userRepo         repository.UserRepository
+	roleRepo         repository.RoleRepository
+	roleRightRepo    repository.RoleRightRepository
+	sectionRepo      repository.SectionRepository
+	organizationRepo repository.OrganizationRepository
+	transactor       repository.Transactor
+}
+
+func NewSeeder(userRepo repository.UserRepository, roleRepo repository.RoleRepository, roleRightRepo repository.RoleRightRepository,
+	sectionRepo repository.SectionRepository, organizationRepo repository.OrganizationRepository, transactor repository.Transactor) *Seeder {
+	return &Seeder{
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		roleRightRepo:    roleRightRepo,
+		sectionRepo:      sectionRepo,
+		organizationRepo: organizationRepo,
+		transactor:       transactor,
+	}
+}
+
+// Seed upserts the fixture. Running it twice is a no-op the second time:
+// passwords are only rehashed when they no longer match the fixture.
+func (s *Seeder) Seed(ctx context.Context, f *Fixture) (*Result, error) {
+	result := &Result{}
+
+	for _, org := range f.Organizations {
+		created, err := s.ensureOrganization(ctx, org)
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.OrganizationsCreated++
+		}
+	}
+
+	for _, sec := range f.Sections {
+		created, err := s.ensureSection(ctx, sec)
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.SectionsCreated++
+		}
+	}
+
+	roles := make(map[roleKey]*entity.Role, len(f.Roles))
+	createdRoles := make(map[roleKey]bool, len(f.Roles))
+	for _, r := range f.Roles {
+		ctx, err := s.within(ctx, r.Organization)
+		if err != nil {
+			return result, err
+		}
+		key := roleKey{organization: r.Organization, name: r.Name}
+		role, created, err := s.upsertRole(ctx, r.Name)
+		if err != nil {
+			return result, err
+		}
+		roles[key] = role
+		if created {
+			createdRoles[key] = true
+			result.RolesCreated++
+		}
+
+		for _, right := range r.Rights {
+			created, updated, err := s.upsertRight(ctx, role, right)
+			if err != nil {
+				return result, err
+			}
+			if created {
+				result.RightsCreated++
+			}
+			if updated {
+				result.RightsUpdated++
+			}
+		}
+	}
+
+	// Parents are linked once every role exists, so a fixture can list a
+	// role before the one it inherits from
+	for _, r := range f.Roles {
+		ctx, err := s.within(ctx, r.Organization)
+		if err != nil {
+			return result, err
+		}
+		key := roleKey{organization: r.Organization, name: r.Name}
+		updated, err := s.linkParent(ctx, roles[key], r.Parent, r.MagicLink)
+		if err != nil {
+			return result, err
+		}
+		if updated && !createdRoles[key] {
+			result.RolesUpdated++
+		}
+	}
+
+	for _, u := range f.Users {
+		ctx, err := s.within(ctx, u.Organization)
+		if err != nil {
+			return result, err
+		}
+		created, updated, err := s.upsertUser(ctx, u)
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.UsersCreated++
+		}
+		if updated {
+			result.UsersUpdated++
+		}
+	}
+
+	return result, nil
+}
+
+// within limits ctx to the organization named by slug, the default
+// organization when empty.
+func (s *Seeder) within(ctx context.Context, slug string) (context.Context, error) {
+	if slug == "" {
+		return tenant.WithOrganization(ctx, entity.DefaultOrganizationID), nil
+	}
+	org, err := s.organizationRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization %s: %w", slug, err)
+	}
+	return tenant.WithOrganization(ctx, org.ID), nil
+}
+
+func (s *Seeder) ensureOrganization(ctx context.Context, org Organization) (bool, error) {
+	_, err := s.organizationRepo.GetBySlug(ctx, org.Slug)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to get organization %s: %w", org.Slug, err)
+	}
+	if err := s.organizationRepo.Create(ctx, &entity.Organization{Slug: org.Slug, Name: org.Name}); err != nil {
+		return false, fmt.Errorf("failed to create organization %s: %w", org.Slug, err)
+	}
+	return true, nil
+}
+
+func (s *Seeder) ensureSection(ctx context.Context, sec Section) (bool, error) {
+	_, err := s.sectionRepo.GetByName(ctx, sec.Name)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to get section %s: %w", sec.Name, err)
+	}
+	if err := s.sectionRepo.Create(ctx, &entity.Section{Name: sec.Name, Description: sec.Description}); err != nil {
+		return false, fmt.Errorf("failed to create section %s: %w", sec.Name, err)
+	}
+	return true, nil
+}
+
+func (s *Seeder) upsertRole(ctx context.Context, name string) (*entity.Role, bool, error) {
+	role, err := s.roleRepo.GetByName(ctx, name)
+	if err == nil {
+		return role, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to get role %s: %w", name, err)
+	}
+
+	role = &entity.Role{Name: name}
+	if err := s.roleRepo.Create(ctx, role); err != nil {
+		return nil, false, fmt.Errorf("failed to create role %s: %w", name, err)
+	}
+	return role, true, nil
+}
+
+// linkParent points role at the named parent, or detaches it when parent
+// is empty, and sets whether it allows magic links.
+func (s *Seeder) linkParent(ctx context.Context, role *entity.Role, parent string, magicLink bool) (bool, error) {
+	var parentID *int
+	if parent != "" {
+		p, err := s.roleRepo.GetByName(ctx, parent)
+		if err != nil {
+			return false, fmt.Errorf("failed to get parent role %s for role %s: %w", parent, role.Name, err)
+		}
+		parentID = &p.ID
+	}
+
+	sameParent := (role.ParentID == nil && parentID == nil) || (role.ParentID != nil && parentID != nil && *role.ParentID == *parentID)
+	if sameParent && role.MagicLink == magicLink {
+		return false, nil
+	}
+	role.ParentID = parentID
+	role.MagicLink = magicLink
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return false, fmt.Errorf("failed to update role %s: %w", role.Name, err)
+	}
+	return true, nil
+}
+
+func (s *Seeder) upsertRight(ctx context.Context, role *entity.Role, r Right) (bool, bool, error) {
+	if r.Condition != "" && !authz.KnownCondition(r.Condition) {
+		return false, false, fmt.Errorf("unknown condition %q on %s %s for role %s", r.Condition, r.Section, r.Route, role.Name)
+	}
+
+	existing, err := s.roleRightRepo.GetByRoleIDAndRoute(ctx, int64(role.ID), r.Section, r.Route)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, false, fmt.Errorf("failed to get right %s %s for role %s: %w", r.Section, r.Route, role.Name, err)
+	}
+
+	if existing == nil {
+		right := &entity.RoleRight{
+			RoleID:    int64(role.ID),
+			Section:   r.Section,
+			Route:     r.Route,
+			RCreate:   r.Create,
+			RRead:     r.Read,
+			RUpdate:   r.Update,
+			RDelete:   r.Delete,
+			Deny:      r.Deny,
+			Condition: r.Condition,
+		}
+		if err := s.roleRightRepo.Create(ctx, right); err != nil {
+			return false, false, fmt.Errorf("failed to create right %s %s for role %s: %w", r.Section, r.Route, role.Name, err)
+		}
+		return true, false, nil
+	}
+
+	if existing.RCreate == r.Create && existing.RRead == r.Read && existing.RUpdate == r.Update && existing.RDelete == r.Delete &&
+		existing.Deny == r.Deny && existing.Condition == r.Condition {
+		return false, false, nil
+	}
+	existing.RCreate, existing.RRead, existing.RUpdate, existing.RDelete = r.Create, r.Read, r.Update, r.Delete
+	existing.Deny, existing.Condition = r.Deny, r.Condition
+	if err := s.roleRightRepo.Update(ctx, existing); err != nil {
+		return false, false, fmt.Errorf("failed to update right %s %s for role %s: %w", r.Section, r.Route, role.Name, err)
+	}
+	return false, true, nil
+}
+
+// upsertUser creates the user or brings an existing one in line with the
+// fixture. Roles are only added: roles granted outside the fixture stay.
+func (s *Seeder) upsertUser(ctx context.Context, u User) (bool, bool, error) {
+	var roles []entity.Role
+	for _, name := range u.roleNames() {
+		role, err := s.roleRepo.GetByName(ctx, name)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to get role %s for user %s: %w", name, u.Email, err)
+		}
+		roles = append(roles, *role)
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, u.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, false, fmt.Errorf("failed to get user %s: %w", u.Email, err)
+	}
+
+	if existing == nil {
+		hashed, err := password.Hash(u.Password)
+		if err != nil {
+			return false, false, err
+		}
+		user := &entity.User{
+			Roles:    roles,
+			Name:     u.Name,
+			Email:    u.Email,
+			Password: hashed,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return false, false, fmt.Errorf("failed to create user %s: %w", u.Email, err)
+		}
+		return true, false, nil
+	}
+
+	changed := false
+	for _, role := range roles {
+		if existing.HasRole(role.Name) {
+			continue
+		}
+		if err := s.userRepo.AssignRole(ctx, existing.ID, role.ID); err != nil {
+			return false, false, fmt.Errorf("failed to assign role %s to user %s: %w", role.Name, u.Email, err)
+		}
+		changed = true
+	}
+
+	if existing.Name == u.Name && password.IsHashed(existing.Password) && password.Compare(existing.Password, u.Password) {
+		return false, changed, nil
+	}
+	existing.Name = u.Name
+	if !password.IsHashed(existing.Password) || !password.Compare(existing.Password, u.Password) {
+		hashed, err := password.Hash(u.Password)
+		if err != nil {
+			return false, false, err
+		}
+		existing.Password = hashed
+	}
+	if err := s.userRepo.Update(ctx, existing); err != nil {
+		return false, false, fmt.Errorf("failed to update user %s: %w", u.Email, err)
+	}
+	return false, true, nil
+}
@@ -0,0 +1,272 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/tenant"
+)
+
+func newTestSeeder() (*Seeder, *memory.UserRepository, *memory.RoleRightRepository) {
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+	return NewSeeder(users, memory.NewRoleRepository(store), roleRights, memory.NewSectionRepository(store), memory.NewOrganizationRepository(store), store), users, roleRights
+}
+
+func TestParse(t *testing.T) {
+	yamlDoc := []byte(`
+roles:
+  - name: admin
+    rights:
+      - {section: be, route: /users/user, read: true}
+users:
+  - {name: A, email: a@gmail.com, password: secret, role: admin}
+`)
+	jsonDoc := []byte(`{"roles":[{"name":"admin","rights":[{"section":"be","route":"/users/user","read":true}]}],
+		"users":[{"name":"A","email":"a@gmail.com","password":"secret","role":"admin"}]}`)
+
+	for format, doc := range map[string][]byte{"yaml": yamlDoc, "json": jsonDoc} {
+		f, err := Parse(doc, format)
+		if err != nil {
+			t.Fatalf("Parse %s: %v", format, err)
+		}
+		if len(f.Roles) != 1 || len(f.Roles[0].Rights) != 1 || !f.Roles[0].Rights[0].Read || f.Roles[0].Rights[0].Create {
+			t.Errorf("%s roles = %+v", format, f.Roles)
+		}
+		if len(f.Users) != 1 || f.Users[0].Role != "admin" {
+			t.Errorf("%s users = %+v", format, f.Users)
+		}
+	}
+
+	if _, err := Parse(yamlDoc, "toml"); err == nil {
+		t.Error("Parse accepted an unknown format")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	for _, env := range []string{"development", "staging", "production"} {
+		f, err := LoadEnv(env)
+		if err != nil {
+			t.Fatalf("LoadEnv(%s): %v", env, err)
+		}
+		if len(f.Roles) == 0 {
+			t.Errorf("%s fixture has no roles", env)
+		}
+		if env != "development" && len(f.Users) != 0 {
+			t.Errorf("%s fixture must not contain users", env)
+		}
+	}
+	for _, env := range []string{"nope", baseFixture} {
+		if _, err := LoadEnv(env); err == nil {
+			t.Errorf("LoadEnv accepted environment %q", env)
+		}
+	}
+
+	// development extends the user role of the base fixture
+	f, _ := LoadEnv("development")
+	base, _ := LoadEnv("production")
+	user, baseUser := f.role("", "user"), base.role("", "user")
+	if user == nil || baseUser == nil || !user.MagicLink || baseUser.MagicLink || len(user.Rights) != len(baseUser.Rights) {
+		t.Errorf("development user role = %+v, want the base rights with magic_link", user)
+	}
+	if len(f.Roles) != len(base.Roles) {
+		t.Errorf("development has %d roles, want the %d of the base fixture", len(f.Roles), len(base.Roles))
+	}
+}
+
+func TestSeedIsIdempotent(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	seeder, users, _ := newTestSeeder()
+	f, err := LoadEnv("development")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := seeder.Seed(ctx, f)
+	if err != nil {
+		t.Fatalf("first Seed: %v", err)
+	}
+	if first.OrganizationsCreated != 0 || first.SectionsCreated != 0 || first.RolesCreated != 3 || first.RightsCreated != 35 || first.UsersCreated != 2 {
+		t.Errorf("first Seed result = %+v", first)
+	}
+
+	admin, err := users.GetByEmail(ctx, "admin@gmail.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !password.IsHashed(admin.Password) || !password.Compare(admin.Password, "adminadmin") {
+		t.Error("seeded password is not a hash of the fixture password")
+	}
+	hash := admin.Password
+
+	second, err := seeder.Seed(ctx, f)
+	if err != nil {
+		t.Fatalf("second Seed: %v", err)
+	}
+	if *second != (Result{}) {
+		t.Errorf("second Seed changed rows: %+v", second)
+	}
+	if again, _ := users.GetByEmail(ctx, "admin@gmail.com"); again.Password != hash {
+		t.Error("second Seed rehashed an unchanged password")
+	}
+}
+
+func TestSeedUpdatesChangedRows(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	seeder, users, roleRights := newTestSeeder()
+	f, _ := LoadEnv("development")
+	if _, err := seeder.Seed(ctx, f); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Roles[1].Rights[0].Update = true
+	f.Users[1].Password = "changed-password"
+	f.Users[1].Roles = append(f.Users[1].Roles, "admin")
+
+	result, err := seeder.Seed(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RightsUpdated != 1 || result.UsersUpdated != 1 {
+		t.Errorf("Seed result = %+v, want one right and one user updated", result)
+	}
+
+	right, _ := roleRights.GetByRoleIDAndRoute(ctx, 2, "be", "/users/user")
+	if !right.RUpdate {
+		t.Error("right was not updated")
+	}
+	user, _ := users.GetByEmail(ctx, "user@gmail.com")
+	if !user.HasRole("admin") || !user.HasRole("user") || !password.Compare(user.Password, "changed-password") {
+		t.Errorf("user was not updated: roles %+v", user.Roles)
+	}
+}
+
+func TestSeedUnknownRole(t *testing.T) {
+	seeder, _, _ := newTestSeeder()
+	f := &Fixture{Users: []User{{Name: "A", Email: "a@gmail.com", Password: "secret", Roles: []string{"ghost"}}}}
+	if _, err := seeder.Seed(context.Background(), f); err == nil {
+		t.Fatal("Seed accepted a user with an unknown role")
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	seeder, users, _ := newTestSeeder()
+	f, _ := LoadEnv("production")
+	if _, err := seeder.Seed(ctx, f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := seeder.Bootstrap(ctx, Admin{Email: "root@corp.com", Password: "short", Role: "admin"}); err == nil {
+		t.Error("Bootstrap accepted a short password")
+	}
+	if _, err := seeder.Bootstrap(ctx, Admin{Email: "root@corp.com", Password: "long-enough", Role: "missing"}); err == nil {
+		t.Error("Bootstrap accepted an unknown role")
+	}
+
+	user, err := seeder.Bootstrap(ctx, Admin{Email: "root@corp.com", Password: "long-enough", Role: "admin"})
+	if err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	stored, _ := users.GetByID(ctx, user.ID)
+	if !stored.HasRole("admin") || stored.Name != "Administrator" || !password.Compare(stored.Password, "long-enough") {
+		t.Errorf("bootstrapped admin = %+v", stored)
+	}
+
+	_, err = seeder.Bootstrap(ctx, Admin{Email: "second@corp.com", Password: "long-enough", Role: "admin"})
+	if !errors.Is(err, ErrAdminExists) {
+		t.Errorf("second Bootstrap error = %v, want ErrAdminExists", err)
+	}
+}
+
+// TestBootstrapWaitsForLock holds the bootstrap lock while creating an
+// admin, as a replica bootstrapping at the same time would.
+func TestBootstrapWaitsForLock(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	seeder := NewSeeder(users, roles, memory.NewRoleRightRepository(store), memory.NewSectionRepository(store), memory.NewOrganizationRepository(store), store)
+	f, _ := LoadEnv("production")
+	if _, err := seeder.Seed(ctx, f); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := roles.GetByName(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	err = store.WithinTx(ctx, func(txCtx context.Context) error {
+		if err := store.Lock(txCtx, bootstrapLockKey); err != nil {
+			return err
+		}
+		go func() {
+			_, err := seeder.Bootstrap(ctx, Admin{Email: "second@corp.com", Password: "long-enough", Role: "admin"})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return fmt.Errorf("Bootstrap did not wait for the lock: %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+		return users.Create(txCtx, &entity.User{Roles: []entity.Role{*admin}, Name: "Root", Email: "root@corp.com", Password: "secret"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrAdminExists) {
+		t.Errorf("Bootstrap error = %v, want ErrAdminExists", err)
+	}
+}
+
+func TestSeedLinksParents(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	seeder, _, _ := newTestSeeder()
+	roles := seeder.roleRepo
+	f := &Fixture{Roles: []Role{
+		{Name: "editor", Parent: "viewer"},
+		{Name: "viewer"},
+	}}
+
+	result, err := seeder.Seed(ctx, f)
+	if err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	if result.RolesCreated != 2 || result.RolesUpdated != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	editor, _ := roles.GetByName(ctx, "editor")
+	viewer, _ := roles.GetByName(ctx, "viewer")
+	if editor.ParentID == nil || *editor.ParentID != viewer.ID {
+		t.Fatalf("editor parent = %v, want %d", editor.ParentID, viewer.ID)
+	}
+
+	f.Roles[0].Parent = ""
+	result, err = seeder.Seed(ctx, f)
+	if err != nil {
+		t.Fatalf("second Seed: %v", err)
+	}
+	if result.RolesUpdated != 1 {
+		t.Errorf("second result = %+v, want the parent removed", result)
+	}
+	if editor, _ = roles.GetByName(ctx, "editor"); editor.ParentID != nil {
+		t.Errorf("editor parent = %d, want none", *editor.ParentID)
+	}
+}
+
+func TestSeedRejectsUnknownCondition(t *testing.T) {
+	seeder, _, _ := newTestSeeder()
+	f := &Fixture{Roles: []Role{{Name: "user", Rights: []Right{{Section: "be", Route: "/users/user/{user_id}", Read: true, Condition: "owner"}}}}}
+	if _, err := seeder.Seed(context.Background(), f); err == nil || !strings.Contains(err.Error(), "unknown condition") {
+		t.Errorf("Seed error = %v, want unknown condition", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Package authn verifies login credentials. Each credential store, the
+// users table or an LDAP directory, is an Authenticator; a Chain asks them
+// in the order AUTHENTICATORS lists them until one accepts the password.
+package authn
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"test-tablelink/src/entity"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown login or a wrong
+	// password, without telling which.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrUserDisabled is returned when a disabled user logs in or uses a
+	// token issued before they were disabled.
+	ErrUserDisabled = errors.New("user is disabled")
+	// ErrAccountConflict is returned when a directory user's email
+	// belongs to a local account that is not linked to the directory.
+	ErrAccountConflict = errors.New("a local account not linked to the directory has this email")
+)
+
+// Authenticator checks a login and password against one credential store
+// and returns the local user they belong to, in the organization of ctx.
+// It returns ErrInvalidCredentials when the store does not know the login
+// or the password is wrong, so that a Chain asks the next one.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, login, password string) (*entity.User, error)
+}
+
+// Chain asks its authenticators in order and returns the first user one
+// of them accepts. A store that cannot be reached is logged and skipped,
+// so an LDAP outage does not lock out local users.
+type Chain []Authenticator
+
+func (c Chain) Name() string {
+	return "chain"
+}
+
+func (c Chain) Authenticate(ctx context.Context, login, password string) (*entity.User, error) {
+	for _, a := range c {
+		user, err := a.Authenticate(ctx, login, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+		default:
+			log.Printf("authenticator %s failed: %v", a.Name(), err)
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,529 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-ldap/ldap/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// directoryName leaves room for the "ldap:" prefix of the directory's
+// provider in federated_identities.
+var directoryName = regexp.MustCompile(`^[a-z0-9-]{1,45}$`)
+
+const ldapTimeout = 10 * time.Second
+
+// DirectoryFile is the layout of LDAP_CONFIG_FILE.
+type DirectoryFile struct {
+	Directories []*Directory `yaml:"directories"`
+}
+
+// Directory is an LDAP or Active Directory server users of one
+// organization log in against. The user entry is found with a search as
+// BindDN, then the password is checked by binding as the entry.
+type Directory struct {
+	// Name identifies the directory in AUTHENTICATORS
+	Name string `yaml:"name"`
+	// Organization is the slug of the organization the directory's users
+	// belong to, the default organization when empty
+	Organization string `yaml:"organization"`
+	// URL is ldap://host:389 or ldaps://host:636
+	URL      string `yaml:"url"`
+	StartTLS bool   `yaml:"start_tls"`
+	// BindDN and its password are the service account searches run as,
+	// an anonymous search when empty
+	BindDN           string `yaml:"bind_dn"`
+	BindPassword     string `yaml:"bind_password"`
+	BindPasswordFile string `yaml:"bind_password_file"`
+	BaseDN           string `yaml:"base_dn"`
+	// UserFilter finds the entry of a login, {login} is replaced with the
+	// escaped login
+	UserFilter     string `yaml:"user_filter"`
+	EmailAttribute string `yaml:"email_attribute"`
+	NameAttribute  string `yaml:"name_attribute"`
+	// IDAttribute, e.g. entryUUID or objectGUID, identifies the entry for
+	// good. Users are linked to their entry by its DN when empty, which
+	// breaks the link when the entry is moved or renamed.
+	IDAttribute string `yaml:"id_attribute"`
+	// GroupFilter, when set, finds the groups of a user under
+	// GroupBaseDN, {dn} is replaced with the user's DN. Otherwise the
+	// groups are read from the user's GroupAttribute (memberOf).
+	GroupBaseDN    string `yaml:"group_base_dn"`
+	GroupFilter    string `yaml:"group_filter"`
+	GroupAttribute string `yaml:"group_attribute"`
+	// DefaultRole is given to every user created on their first login
+	DefaultRole  string         `yaml:"default_role"`
+	RoleMappings []GroupMapping `yaml:"role_mappings"`
+}
+
+// GroupMapping gives Role to the members of Group, named by its DN or by
+// its common name, compared case-insensitively.
+type GroupMapping struct {
+	Group string `yaml:"group"`
+	Role  string `yaml:"role"`
+}
+
+// LoadDirectories reads and validates LDAP_CONFIG_FILE. A
+// bind_password_file is read right away.
+func LoadDirectories(path string) ([]*Directory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f DirectoryFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var errs []error
+	seen := map[string]bool{"local": true}
+	for i, d := range f.Directories {
+		if err := d.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("directory %d (%s): %w", i+1, d.Name, err))
+			continue
+		}
+		if seen[d.Name] {
+			errs = append(errs, fmt.Errorf("directory %d: name %q is taken", i+1, d.Name))
+		}
+		seen[d.Name] = true
+		if d.BindPasswordFile != "" {
+			secret, err := os.ReadFile(d.BindPasswordFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("directory %s: %w", d.Name, err))
+				continue
+			}
+			d.BindPassword = strings.TrimSpace(string(secret))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Directories, nil
+}
+
+// validate checks the directory and fills in the defaults, which suit
+// OpenLDAP and Active Directory alike.
+func (d *Directory) validate() error {
+	var errs []error
+	if !directoryName.MatchString(d.Name) {
+		errs = append(errs, fmt.Errorf("name %q must be 1 to 45 lower case letters, digits or \"-\"", d.Name))
+	}
+	if u, err := url.Parse(d.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("url %q must be ldap://host:port or ldaps://host:port", d.URL))
+	} else if u.Scheme == "ldaps" && d.StartTLS {
+		errs = append(errs, errors.New("start_tls does not apply to ldaps://"))
+	}
+	if d.BaseDN == "" {
+		errs = append(errs, errors.New("base_dn is required"))
+	}
+	if d.BindPassword != "" && d.BindPasswordFile != "" {
+		errs = append(errs, errors.New("set bind_password or bind_password_file, not both"))
+	}
+	if d.UserFilter != "" && !strings.Contains(d.UserFilter, "{login}") {
+		errs = append(errs, errors.New("user_filter must contain {login}"))
+	}
+	if d.GroupFilter != "" && !strings.Contains(d.GroupFilter, "{dn}") {
+		errs = append(errs, errors.New("group_filter must contain {dn}"))
+	}
+	if d.DefaultRole == "" {
+		errs = append(errs, errors.New("default_role is required"))
+	}
+	for i, m := range d.RoleMappings {
+		if m.Group == "" || m.Role == "" {
+			errs = append(errs, fmt.Errorf("role_mappings %d: group and role are required", i+1))
+		}
+	}
+
+	if d.UserFilter == "" {
+		d.UserFilter = "(&(objectClass=person)(|(uid={login})(sAMAccountName={login})(mail={login})))"
+	}
+	if d.EmailAttribute == "" {
+		d.EmailAttribute = "mail"
+	}
+	if d.NameAttribute == "" {
+		d.NameAttribute = "cn"
+	}
+	if d.GroupAttribute == "" {
+		d.GroupAttribute = "memberOf"
+	}
+	if d.GroupBaseDN == "" {
+		d.GroupBaseDN = d.BaseDN
+	}
+	return errors.Join(errs...)
+}
+
+// MappedRoles returns the names of the roles the role mappings give to
+// members of groups, without duplicates.
+func (d *Directory) MappedRoles(groups []string) []string {
+	var roles []string
+	for _, m := range d.RoleMappings {
+		for _, group := range groups {
+			if groupMatches(group, m.Group) && !contains(roles, m.Role) {
+				roles = append(roles, m.Role)
+			}
+		}
+	}
+	return roles
+}
+
+// attributes lists the attributes read from the entry of a login.
+func (d *Directory) attributes() []string {
+	attrs := []string{d.EmailAttribute, d.NameAttribute, d.GroupAttribute}
+	if d.IDAttribute != "" {
+		attrs = append(attrs, d.IDAttribute)
+	}
+	return attrs
+}
+
+// managedRoles returns the names of the roles the directory decides on.
+func (d *Directory) managedRoles() []string {
+	var roles []string
+	for _, m := range d.RoleMappings {
+		if !contains(roles, m.Role) {
+			roles = append(roles, m.Role)
+		}
+	}
+	return roles
+}
+
+// groupMatches compares a group DN with a mapping naming the group by DN
+// or by common name.
+func groupMatches(groupDN, name string) bool {
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil {
+		return strings.EqualFold(groupDN, name)
+	}
+	if other, err := ldap.ParseDN(name); err == nil && len(other.RDNs) > 1 {
+		return dn.EqualFold(other)
+	}
+	if len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return false
+	}
+	return strings.EqualFold(dn.RDNs[0].Attributes[0].Value, name)
+}
+
+// LDAPAuthenticator logs users in against a Directory. A directory user
+// logging in for the first time gets a local user created with the default
+// role and linked to the entry in federated_identities, whose name and
+// mapped roles follow the directory on every login. Roles named in the
+// role mappings are managed by the directory: they are removed from users
+// outside the group.
+type LDAPAuthenticator struct {
+	directory        *Directory
+	organizationRepo repository.OrganizationRepository
+	userRepo         repository.UserRepository
+	roleRepo         repository.RoleRepository
+	identityRepo     repository.FederatedIdentityRepository
+}
+
+func NewLDAPAuthenticator(directory *Directory, organizationRepo repository.OrganizationRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository, identityRepo repository.FederatedIdentityRepository) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		directory:        directory,
+		organizationRepo: organizationRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		identityRepo:     identityRepo,
+	}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return a.directory.Name
+}
+
+// provider names the directory in federated_identities.
+func (a *LDAPAuthenticator) provider() string {
+	return "ldap:" + a.directory.Name
+}
+
+// directoryEntry is what a successful bind learned about the user. id is
+// the DN or the hex encoded IDAttribute.
+type directoryEntry struct {
+	dn, id, email, name string
+	groups              []string
+}
+
+// Authenticate only applies to logins to the directory's organization.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, login, pass string) (*entity.User, error) {
+	// An empty password would be an unauthenticated bind, which servers
+	// accept for any DN
+	if login == "" || pass == "" {
+		return nil, ErrInvalidCredentials
+	}
+	organizationID, scoped := tenant.OrganizationID(ctx)
+	if !scoped {
+		return nil, ErrInvalidCredentials
+	}
+	organization, err := a.organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if organization.ID != organizationID {
+		return nil, ErrInvalidCredentials
+	}
+
+	entry, err := a.bind(login, pass)
+	if err != nil {
+		return nil, err
+	}
+	return a.sync(ctx, entry)
+}
+
+func (a *LDAPAuthenticator) organization(ctx context.Context) (*entity.Organization, error) {
+	if a.directory.Organization == "" {
+		return a.organizationRepo.GetByID(ctx, entity.DefaultOrganizationID)
+	}
+	return a.organizationRepo.GetBySlug(ctx, a.directory.Organization)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	d := a.directory
+	conn, err := ldap.DialURL(d.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if d.StartTLS {
+		u, _ := url.Parse(d.URL)
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// serviceBind binds as the service account, or stays anonymous.
+func (a *LDAPAuthenticator) serviceBind(conn *ldap.Conn) error {
+	if a.directory.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.directory.BindDN, a.directory.BindPassword); err != nil {
+		return fmt.Errorf("bind as %s: %w", a.directory.BindDN, err)
+	}
+	return nil
+}
+
+// bind finds the entry of login, checks the password by binding as it and
+// reads the user's groups.
+func (a *LDAPAuthenticator) bind(login, pass string) (*directoryEntry, error) {
+	d := a.directory
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.serviceBind(conn); err != nil {
+		return nil, err
+	}
+	filter := strings.ReplaceAll(d.UserFilter, "{login}", ldap.EscapeFilter(login))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout/time.Second), false,
+		filter, d.attributes(), nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("search %s: %w", filter, err)
+	}
+	// An ambiguous login matches nobody
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	found := result.Entries[0]
+
+	err = conn.Bind(found.DN, pass)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bind as %s: %w", found.DN, err)
+	}
+
+	entry := &directoryEntry{
+		dn:     found.DN,
+		id:     strings.ToLower(found.DN),
+		email:  found.GetEqualFoldAttributeValue(d.EmailAttribute),
+		name:   found.GetEqualFoldAttributeValue(d.NameAttribute),
+		groups: found.GetEqualFoldAttributeValues(d.GroupAttribute),
+	}
+	if d.IDAttribute != "" {
+		// objectGUID is binary
+		id := found.GetEqualFoldRawAttributeValue(d.IDAttribute)
+		if len(id) == 0 {
+			return nil, fmt.Errorf("entry %s has no %s attribute", found.DN, d.IDAttribute)
+		}
+		entry.id = hex.EncodeToString(id)
+	}
+	if d.GroupFilter == "" {
+		return entry, nil
+	}
+
+	// Group entries may not be readable by the user, search as the
+	// service account again
+	if err := a.serviceBind(conn); err != nil {
+		return nil, err
+	}
+	filter = strings.ReplaceAll(d.GroupFilter, "{dn}", ldap.EscapeFilter(found.DN))
+	groups, err := conn.Search(ldap.NewSearchRequest(
+		d.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout/time.Second), false,
+		filter, []string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search %s: %w", filter, err)
+	}
+	entry.groups = entry.groups[:0]
+	for _, group := range groups.Entries {
+		entry.groups = append(entry.groups, group.DN)
+	}
+	return entry, nil
+}
+
+// sync returns the local user of entry, creating it on the first login,
+// and brings its name and managed roles in line with the directory.
+func (a *LDAPAuthenticator) sync(ctx context.Context, entry *directoryEntry) (*entity.User, error) {
+	d := a.directory
+	if entry.email == "" {
+		return nil, fmt.Errorf("entry %s has no %s attribute", entry.dn, d.EmailAttribute)
+	}
+	name := entry.name
+	if name == "" {
+		name = entry.email
+	}
+
+	user, err := a.linkedUser(ctx, entry, name)
+	if err != nil {
+		return nil, err
+	}
+	if user.Name != name {
+		user.Name = name
+		if err := a.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	if user.DisabledAt != nil {
+		return user, nil
+	}
+
+	mapped := d.MappedRoles(entry.groups)
+	for _, roleName := range d.managedRoles() {
+		role, err := a.roleRepo.GetByName(ctx, roleName)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("ldap directory %s: mapped role %q does not exist", d.Name, roleName)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		holds, wants := user.HasRole(roleName), contains(mapped, roleName)
+		switch {
+		case wants && !holds:
+			err = a.userRepo.AssignRole(ctx, user.ID, role.ID)
+		case holds && !wants:
+			err = a.userRepo.UnassignRole(ctx, user.ID, role.ID)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("audit: ldap role synced directory=%s user=%d role=%s assigned=%t", d.Name, user.ID, roleName, wants)
+	}
+	return a.userRepo.GetByID(ctx, user.ID)
+}
+
+// linkedUser returns the user linked to entry, provisioning and linking one
+// on the first login. A local account with the entry's email is never
+// taken over: the directory would then decide its password and roles.
+func (a *LDAPAuthenticator) linkedUser(ctx context.Context, entry *directoryEntry, name string) (*entity.User, error) {
+	identity, err := a.identityRepo.GetBySubject(ctx, a.provider(), entry.id)
+	if err == nil {
+		if err := a.identityRepo.UpdateLastLogin(ctx, identity.ID); err != nil {
+			return nil, err
+		}
+		return a.userRepo.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	existing, err := a.userRepo.GetByEmail(ctx, entry.email)
+	if err == nil {
+		log.Printf("audit: ldap login refused directory=%s dn=%s user=%d reason=local_account", a.directory.Name, entry.dn, existing.ID)
+		return nil, fmt.Errorf("%w: %s", ErrAccountConflict, entry.email)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	user, err := a.provision(ctx, entry.email, name)
+	if err != nil {
+		return nil, err
+	}
+	identity = &entity.FederatedIdentity{
+		UserID:   user.ID,
+		Provider: a.provider(),
+		Subject:  entry.id,
+		Email:    entry.email,
+	}
+	if err := a.identityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: ldap identity linked directory=%s dn=%s user=%d", a.directory.Name, entry.dn, user.ID)
+	return user, nil
+}
+
+// provision creates the local user of a directory user, with the default
+// role and a random password nobody knows: the directory checks it.
+func (a *LDAPAuthenticator) provision(ctx context.Context, email, name string) (*entity.User, error) {
+	role, err := a.roleRepo.GetByName(ctx, a.directory.DefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("default role %q of directory %s: %w", a.directory.DefaultRole, a.directory.Name, err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	hashed, err := password.Hash(base64.RawURLEncoding.EncodeToString(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	user := &entity.User{
+		Roles:    []entity.Role{{ID: role.ID, Name: role.Name}},
+		Name:     name,
+		Email:    email,
+		Password: hashed,
+	}
+	if err := a.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: ldap user created directory=%s user=%d role=%s", a.directory.Name, user.ID, role.Name)
+	return user, nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
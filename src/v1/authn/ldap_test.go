@@ -0,0 +1,338 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/tenant"
+)
+
+const (
+	serviceDN = "cn=reader,dc=corp,dc=com"
+	janeDN    = "uid=jane,ou=people,dc=corp,dc=com"
+	adminsDN  = "cn=admins,ou=groups,dc=corp,dc=com"
+)
+
+type ldapTest struct {
+	stub       *ldapStub
+	store      *memory.Store
+	users      *memory.UserRepository
+	roles      *memory.RoleRepository
+	orgs       *memory.OrganizationRepository
+	identities *memory.FederatedIdentityRepository
+	directory  *Directory
+	auth       *LDAPAuthenticator
+}
+
+func newLDAPTest(t *testing.T) *ldapTest {
+	t.Helper()
+	stub := newLDAPStub(t)
+	stub.add(serviceDN, "reader-secret", nil)
+	stub.add(janeDN, "jane-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"jane"},
+		"mail":        {"jane@corp.com"},
+		"cn":          {"Jane Doe"},
+		"memberOf":    {adminsDN},
+		"entryUUID":   {"5f1c0e2a-jane"},
+	})
+	stub.add(adminsDN, "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"member":      {janeDN},
+	})
+
+	store := memory.NewStore()
+	lt := &ldapTest{
+		stub:       stub,
+		store:      store,
+		users:      memory.NewUserRepository(store),
+		roles:      memory.NewRoleRepository(store),
+		orgs:       memory.NewOrganizationRepository(store),
+		identities: memory.NewFederatedIdentityRepository(store),
+		directory: &Directory{
+			Name:         "corp",
+			URL:          stub.URL(),
+			BindDN:       serviceDN,
+			BindPassword: "reader-secret",
+			BaseDN:       "dc=corp,dc=com",
+			DefaultRole:  "user",
+			RoleMappings: []GroupMapping{{Group: "admins", Role: "admin"}},
+		},
+	}
+	if err := lt.directory.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"user", "admin"} {
+		if err := lt.roles.Create(lt.ctx(), &entity.Role{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lt.auth = NewLDAPAuthenticator(lt.directory, lt.orgs, lt.users, lt.roles, lt.identities)
+	return lt
+}
+
+func (lt *ldapTest) ctx() context.Context {
+	return tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+}
+
+func roleNames(user *entity.User) string {
+	var names []string
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestLDAPAuthenticatorProvisionsAndSyncs(t *testing.T) {
+	lt := newLDAPTest(t)
+
+	user, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Email != "jane@corp.com" || user.Name != "Jane Doe" {
+		t.Errorf("user = %q %q", user.Email, user.Name)
+	}
+	if !user.HasRole("user") || !user.HasRole("admin") {
+		t.Errorf("roles = %s, want user and admin", roleNames(user))
+	}
+
+	// The directory renames Jane and drops her from the admins
+	lt.stub.add(janeDN, "jane-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"jane"},
+		"mail":        {"jane@corp.com"},
+		"cn":          {"Jane Roe"},
+	})
+	again, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate again: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login got user %d, want %d", again.ID, user.ID)
+	}
+	if again.Name != "Jane Roe" {
+		t.Errorf("name = %q, want synced", again.Name)
+	}
+	if again.HasRole("admin") || !again.HasRole("user") {
+		t.Errorf("roles = %s, want only user", roleNames(again))
+	}
+}
+
+func TestLDAPAuthenticatorRefusesLocalAccount(t *testing.T) {
+	lt := newLDAPTest(t)
+	role, _ := lt.roles.GetByName(lt.ctx(), "user")
+	existing := &entity.User{Roles: []entity.Role{{ID: role.ID}}, Name: "jane", Email: "jane@corp.com", Password: "local-secret"}
+	if err := lt.users.Create(lt.ctx(), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Whoever controls the directory entry's mail must not get the account
+	if _, err := lt.auth.Authenticate(lt.ctx(), "jane@corp.com", "jane-secret"); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("err = %v, want ErrAccountConflict", err)
+	}
+	user, err := lt.users.GetByID(lt.ctx(), existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "jane" || user.HasRole("admin") {
+		t.Errorf("local account was synced: name %q, roles %s", user.Name, roleNames(user))
+	}
+	if _, err := lt.identities.GetBySubject(lt.ctx(), "ldap:corp", strings.ToLower(janeDN)); err == nil {
+		t.Error("local account was linked to the directory")
+	}
+}
+
+func TestLDAPAuthenticatorFollowsLinkedEntry(t *testing.T) {
+	lt := newLDAPTest(t)
+	lt.directory.IDAttribute = "entryUUID"
+	user, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	// The entry moves and changes its mail, the link still holds
+	lt.stub.remove(janeDN)
+	lt.stub.add("uid=jane,ou=staff,dc=corp,dc=com", "jane-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"jane"},
+		"mail":        {"jane.doe@corp.com"},
+		"cn":          {"Jane Doe"},
+		"entryUUID":   {"5f1c0e2a-jane"},
+	})
+	again, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate after the move: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("moved entry got user %d, want %d", again.ID, user.ID)
+	}
+}
+
+func TestLDAPAuthenticatorRejects(t *testing.T) {
+	lt := newLDAPTest(t)
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		login, pass string
+	}{
+		{"wrong password", lt.ctx(), "jane", "wrong"},
+		{"empty password", lt.ctx(), "jane", ""},
+		{"unknown login", lt.ctx(), "john", "jane-secret"},
+		{"filter injection", lt.ctx(), "*", "jane-secret"},
+		{"unscoped", context.Background(), "jane", "jane-secret"},
+		{"other organization", tenant.WithOrganization(context.Background(), 2), "jane", "jane-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lt.auth.Authenticate(tt.ctx, tt.login, tt.pass); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("err = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+	if _, err := lt.users.GetByEmail(lt.ctx(), "jane@corp.com"); err == nil {
+		t.Error("rejected logins created a user")
+	}
+}
+
+func TestLDAPAuthenticatorAmbiguousLogin(t *testing.T) {
+	lt := newLDAPTest(t)
+	lt.stub.add("uid=jane,ou=contractors,dc=corp,dc=com", "jane-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"jane"},
+		"mail":        {"jane@contractor.com"},
+	})
+	if _, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPAuthenticatorGroupFilter(t *testing.T) {
+	lt := newLDAPTest(t)
+	lt.directory.GroupBaseDN = "ou=groups,dc=corp,dc=com"
+	lt.directory.GroupFilter = "(&(objectClass=groupOfNames)(member={dn}))"
+	lt.directory.RoleMappings = []GroupMapping{{Group: adminsDN, Role: "admin"}}
+
+	user, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !user.HasRole("admin") {
+		t.Errorf("roles = %s, want admin from the group search", roleNames(user))
+	}
+}
+
+func TestLDAPAuthenticatorServiceBindFails(t *testing.T) {
+	lt := newLDAPTest(t)
+	lt.stub.setPassword(serviceDN, "rotated")
+	_, err := lt.auth.Authenticate(lt.ctx(), "jane", "jane-secret")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want a directory error", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	lt := newLDAPTest(t)
+	role, _ := lt.roles.GetByName(lt.ctx(), "user")
+	local := &entity.User{Roles: []entity.Role{{ID: role.ID}}, Name: "bob", Email: "bob@corp.com", Password: "bob-secret"}
+	if err := lt.users.Create(lt.ctx(), local); err != nil {
+		t.Fatal(err)
+	}
+	chain := Chain{NewLocalAuthenticator(lt.users), lt.auth}
+
+	if user, err := chain.Authenticate(lt.ctx(), "bob@corp.com", "bob-secret"); err != nil || user.ID != local.ID {
+		t.Errorf("local login = %v, %v", user, err)
+	}
+	if user, err := chain.Authenticate(lt.ctx(), "jane", "jane-secret"); err != nil || user.Email != "jane@corp.com" {
+		t.Errorf("ldap login = %v, %v", user, err)
+	}
+	if _, err := chain.Authenticate(lt.ctx(), "bob@corp.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password err = %v", err)
+	}
+
+	// An unreachable directory is skipped
+	lt.stub.listener.Close()
+	lt.directory.URL = "ldap://127.0.0.1:1"
+	if user, err := chain.Authenticate(lt.ctx(), "bob@corp.com", "bob-secret"); err != nil || user.ID != local.ID {
+		t.Errorf("local login during outage = %v, %v", user, err)
+	}
+	down := Chain{lt.auth, NewLocalAuthenticator(lt.users)}
+	if user, err := down.Authenticate(lt.ctx(), "bob@corp.com", "bob-secret"); err != nil || user.ID != local.ID {
+		t.Errorf("fallback to local = %v, %v", user, err)
+	}
+}
+
+func TestLoadDirectories(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, "ldap.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	directories, err := LoadDirectories(write(t, `
+directories:
+  - name: corp
+    url: ldaps://ldap.corp.com
+    bind_dn: cn=reader,dc=corp,dc=com
+    bind_password_file: `+secret+`
+    base_dn: dc=corp,dc=com
+    default_role: user
+`))
+	if err != nil {
+		t.Fatalf("LoadDirectories: %v", err)
+	}
+	d := directories[0]
+	if d.BindPassword != "s3cret" || d.EmailAttribute != "mail" || d.GroupAttribute != "memberOf" || d.GroupBaseDN != d.BaseDN {
+		t.Errorf("directory = %+v", d)
+	}
+
+	invalid := []struct{ name, yaml string }{
+		{"reserved name", "directories:\n  - {name: local, url: ldap://h, base_dn: dc=x, default_role: user}"},
+		{"long name", "directories:\n  - {name: " + strings.Repeat("a", 46) + ", url: ldap://h, base_dn: dc=x, default_role: user}"},
+		{"duplicate name", "directories:\n  - {name: a, url: ldap://h, base_dn: dc=x, default_role: user}\n  - {name: a, url: ldap://h, base_dn: dc=x, default_role: user}"},
+		{"bad url", "directories:\n  - {name: a, url: http://h, base_dn: dc=x, default_role: user}"},
+		{"start_tls on ldaps", "directories:\n  - {name: a, url: ldaps://h, start_tls: true, base_dn: dc=x, default_role: user}"},
+		{"no base_dn", "directories:\n  - {name: a, url: ldap://h, default_role: user}"},
+		{"no default_role", "directories:\n  - {name: a, url: ldap://h, base_dn: dc=x}"},
+		{"filter without login", "directories:\n  - {name: a, url: ldap://h, base_dn: dc=x, default_role: user, user_filter: (uid=x)}"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadDirectories(write(t, tt.yaml)); err == nil {
+				t.Error("LoadDirectories accepted an invalid file")
+			}
+		})
+	}
+}
+
+func TestGroupMatches(t *testing.T) {
+	tests := []struct {
+		group, name string
+		want        bool
+	}{
+		{adminsDN, "admins", true},
+		{adminsDN, "Admins", true},
+		{adminsDN, "CN=Admins,OU=Groups,DC=corp,DC=com", true},
+		{adminsDN, "cn=admins,ou=other,dc=corp,dc=com", false},
+		{adminsDN, "users", false},
+	}
+	for _, tt := range tests {
+		if got := groupMatches(tt.group, tt.name); got != tt.want {
+			t.Errorf("groupMatches(%q, %q) = %t, want %t", tt.group, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package authn
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapStub is an in-process LDAP server speaking just enough of the
+// protocol for the authenticator: simple bind, search with and, or, not,
+// equality and presence filters, and unbind.
+type ldapStub struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	entries map[string]*stubEntry
+}
+
+type stubEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+func newLDAPStub(t *testing.T) *ldapStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &ldapStub{listener: listener, entries: make(map[string]*stubEntry)}
+	t.Cleanup(func() { listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (s *ldapStub) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// add stores an entry; attribute names are matched case-insensitively.
+func (s *ldapStub) add(dn, password string, attrs map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lower := make(map[string][]string, len(attrs))
+	for name, values := range attrs {
+		lower[strings.ToLower(name)] = values
+	}
+	s.entries[strings.ToLower(dn)] = &stubEntry{dn: dn, password: password, attrs: lower}
+}
+
+func (s *ldapStub) remove(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, strings.ToLower(dn))
+}
+
+func (s *ldapStub) setPassword(dn, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[strings.ToLower(dn)].password = password
+}
+
+func (s *ldapStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *ldapStub) handle(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			code := s.bind(dn, op.Children[2].Data.String())
+			if code == ldap.LDAPResultSuccess {
+				bound = dn
+			}
+			reply(conn, id, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			s.search(conn, id, op, bound)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			reply(conn, id, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError)
+		}
+	}
+}
+
+func (s *ldapStub) bind(dn, password string) uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[strings.ToLower(dn)]
+	if !ok || password == "" || entry.password != password {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	return ldap.LDAPResultSuccess
+}
+
+func (s *ldapStub) search(conn net.Conn, id int64, op *ber.Packet, bound string) {
+	if bound == "" {
+		reply(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+		return
+	}
+	base := strings.ToLower(op.Children[0].Data.String())
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var wanted []string
+	for _, attr := range op.Children[7].Children {
+		wanted = append(wanted, strings.ToLower(attr.Data.String()))
+	}
+
+	s.mu.Lock()
+	var matches []*stubEntry
+	for dn, entry := range s.entries {
+		if (dn == base || strings.HasSuffix(dn, ","+base)) && matchFilter(entry, filter) {
+			matches = append(matches, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	code := uint16(ldap.LDAPResultSuccess)
+	if sizeLimit > 0 && int64(len(matches)) > sizeLimit {
+		matches, code = matches[:sizeLimit], ldap.LDAPResultSizeLimitExceeded
+	}
+	for _, entry := range matches {
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "entry")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "dn"))
+		attrs := ber.NewSequence("attributes")
+		for _, name := range wanted {
+			values, ok := entry.attrs[name]
+			if !ok {
+				continue
+			}
+			attr := ber.NewSequence("attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		result.AppendChild(attrs)
+		write(conn, id, result)
+	}
+	reply(conn, id, ldap.ApplicationSearchResultDone, code)
+}
+
+// matchFilter evaluates the filters the authenticator sends.
+func matchFilter(entry *stubEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchFilter(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(entry, filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		name, want := strings.ToLower(filter.Children[0].Data.String()), filter.Children[1].Data.String()
+		for _, v := range entry.attrs[name] {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		_, ok := entry.attrs[strings.ToLower(filter.Data.String())]
+		return ok
+	}
+	return false
+}
+
+func reply(conn net.Conn, id int64, tag ber.Tag, code uint16) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	write(conn, id, op)
+}
+
+func write(w io.Writer, id int64, op *ber.Packet) {
+	packet := ber.NewSequence("LDAPMessage")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "messageID"))
+	packet.AppendChild(op)
+	w.Write(packet.Bytes())
+}
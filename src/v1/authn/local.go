@@ -0,0 +1,43 @@
+package authn
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/repository"
+)
+
+// LocalAuthenticator checks the password hash in the users table; the
+// login is the user's email.
+type LocalAuthenticator struct {
+	userRepo repository.UserRepository
+}
+
+func NewLocalAuthenticator(userRepo repository.UserRepository) *LocalAuthenticator {
+	return &LocalAuthenticator{userRepo: userRepo}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+// Authenticate replaces a legacy plain text password with its hash.
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, login, pass string) (*entity.User, error) {
+	user, err := a.userRepo.GetByEmail(ctx, login)
+	if err != nil || !password.Compare(user.Password, pass) {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !password.IsHashed(user.Password) {
+		hashed, err := password.Hash(pass)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = hashed
+		if err := a.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,40 @@
+package authz
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ReasonHeader carries the reason code of a denied request.
+const ReasonHeader = "X-Authz-Reason"
+
+// Audit writes one log line per decision, in a key=value form log
+// pipelines can parse.
+func Audit(req *Request, d Decision) {
+	var b strings.Builder
+	if req.Client != nil {
+		fmt.Fprintf(&b, "audit: authz client=%s", req.Client.ClientID)
+	} else {
+		fmt.Fprintf(&b, "audit: authz user=%d", req.User.ID)
+	}
+	if req.Impersonation != nil {
+		fmt.Fprintf(&b, " impersonator=%d", req.Impersonation.ImpersonatorID)
+	}
+	fmt.Fprintf(&b, " section=%s method=%s path=%s route=%s allowed=%t reason=%s",
+		req.Section, req.Method, req.Path, req.Route, d.Allowed, d.Reason)
+	if d.Rule != nil {
+		fmt.Fprintf(&b, " rule=%d rule_route=%s", d.Rule.ID, d.Rule.Route)
+	}
+	if d.Policy != "" {
+		fmt.Fprintf(&b, " policy=%s", d.Policy)
+	}
+	log.Print(b.String())
+}
+
+// Deny answers 403 with the reason code in the body and in ReasonHeader.
+func Deny(w http.ResponseWriter, reason string) {
+	w.Header().Set(ReasonHeader, reason)
+	http.Error(w, "Permission denied: "+reason, http.StatusForbidden)
+}
@@ -0,0 +1,87 @@
+package authz
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/repository"
+)
+
+// SectionHeader names the section, e.g. "be", a request is made in.
+const SectionHeader = "section"
+
+// Request is what an Authorizer decides on. The principal is either User
+// or, for service-to-service calls, Client.
+type Request struct {
+	User   *entity.User
+	Client *entity.OAuthClient
+	// Section is the requested section, rights of other sections do not
+	// apply
+	Section string
+	// Route is the chi pattern, e.g. /users/user/{user_id}, Path the
+	// requested path
+	Route  string
+	Path   string
+	Method string
+	// Resource holds the attributes known about the target before it is
+	// loaded, the route parameters such as user_id
+	Resource map[string]string
+	// Impersonation is set when an admin acts as User, who is the one
+	// authorized
+	Impersonation *entity.Impersonation
+}
+
+// RoleIDs returns the roles the principal holds.
+func (r *Request) RoleIDs() []int64 {
+	if r.Client != nil {
+		return r.Client.RoleIDs()
+	}
+	return r.User.RoleIDs()
+}
+
+// Authorizer decides whether a request may proceed.
+type Authorizer interface {
+	Authorize(ctx context.Context, req *Request) (Decision, error)
+}
+
+// RoleRightsAuthorizer is the default Authorizer, backed by role_rights.
+type RoleRightsAuthorizer struct {
+	roleRightRepo repository.RoleRightRepository
+}
+
+func NewRoleRightsAuthorizer(roleRightRepo repository.RoleRightRepository) *RoleRightsAuthorizer {
+	return &RoleRightsAuthorizer{roleRightRepo: roleRightRepo}
+}
+
+// Authorize evaluates the rules of every role the principal holds and of
+// their ancestors. When the outcome depends on conditions such as "own", the
+// decision is allowed with a Check the service settles with Require.
+func (a *RoleRightsAuthorizer) Authorize(ctx context.Context, req *Request) (Decision, error) {
+	rights, err := a.roleRightRepo.GetEffective(ctx, req.RoleIDs(), req.Section)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	strict, lenient := Bounds(rights, req.Route, req.Path, req.Method)
+	if !lenient.Allowed {
+		return lenient, nil
+	}
+	if strict.Allowed {
+		return strict, nil
+	}
+	return Decision{
+		Allowed: true,
+		Reason:  ReasonConditionPending,
+		Matched: lenient.Matched,
+		Check: &Check{
+			Subject:       req.User,
+			Client:        req.Client,
+			Rights:        rights,
+			Section:       req.Section,
+			Route:         req.Route,
+			Path:          req.Path,
+			Method:        req.Method,
+			Impersonation: req.Impersonation,
+		},
+	}, nil
+}
@@ -0,0 +1,168 @@
+// Package authz decides whether a set of role rights allows a request.
+//
+// Precedence, from strongest to weakest:
+//
+//  1. Only rules flagging the request's operation take part. A rule that
+//     grants read says nothing about delete.
+//  2. The most specific matching rule wins. A concrete path such as
+//     /users/user/1 beats a route pattern such as /users/user/{user_id},
+//     which beats any /* prefix. Between prefixes the longer one wins.
+//  3. Among equally specific rules an explicit deny beats an allow, no
+//     matter which of the user's roles, or their ancestors, holds it.
+//  4. Without a matching rule the request is denied.
+//
+// A rule with a condition, such as "own", only takes part when the
+// condition holds for the authenticated user and the target resource.
+// The middleware cannot see the resource, so when the outcome depends on
+// a condition it lets the request through with a pending check, and the
+// service that loads the resource settles it with Require.
+package authz
+
+import (
+	"sort"
+	"strings"
+
+	"test-tablelink/src/entity"
+)
+
+// Specificity tiers. Prefix rules score the number of path segments of
+// their prefix, which stays well below exactPattern.
+const (
+	exactPattern = 1 << 16
+	exactPath    = 1 << 17
+)
+
+// Reason codes explain a Decision. They appear in 403 responses, the audit
+// log and POST /authz/check.
+const (
+	ReasonAllowedByRule      = "allowed_by_rule"
+	ReasonDeniedByRule       = "denied_by_rule"
+	ReasonNoMatchingRule     = "no_matching_rule"
+	ReasonConditionPending   = "condition_pending"
+	ReasonConditionFailed    = "condition_failed"
+	ReasonConditionUnchecked = "condition_unchecked"
+	ReasonUnsupportedMethod  = "unsupported_method"
+	ReasonAllowedByPolicy    = "allowed_by_policy"
+	ReasonDeniedByPolicy     = "denied_by_policy"
+	ReasonNoMatchingPolicy   = "no_matching_policy"
+	ReasonPolicyError        = "policy_error"
+	ReasonOutsideTokenScope  = "outside_token_scope"
+)
+
+// Decision is the outcome of an authorization. Rule is the role right that
+// decided it and Policy the name of the deciding policy, both empty when
+// nothing matched. Matched lists every rule covering the request, most
+// specific first. An allowed decision with a Check must still be settled
+// with Require once the resource is loaded.
+type Decision struct {
+	Allowed bool
+	Reason  string
+	Rule    *entity.RoleRight
+	Matched []*entity.RoleRight
+	Policy  string
+	Check   *Check
+}
+
+// Operation maps an HTTP method to the role_rights operation it needs.
+func Operation(method string) (string, bool) {
+	switch method {
+	case "POST":
+		return "create", true
+	case "GET":
+		return "read", true
+	case "PUT":
+		return "update", true
+	case "DELETE":
+		return "delete", true
+	}
+	return "", false
+}
+
+// Flags reports whether right flags op.
+func Flags(right *entity.RoleRight, op string) bool {
+	switch op {
+	case "create":
+		return right.RCreate
+	case "read":
+		return right.RRead
+	case "update":
+		return right.RUpdate
+	case "delete":
+		return right.RDelete
+	}
+	return false
+}
+
+// Evaluate applies the package precedence to rights for a request on
+// path, routed through the chi pattern route. Conditional rules are left
+// out, see EvaluateWith.
+func Evaluate(rights []*entity.RoleRight, route, path, method string) Decision {
+	return EvaluateWith(rights, route, path, method, func(right *entity.RoleRight) bool {
+		return right.Condition == ""
+	})
+}
+
+// EvaluateWith is Evaluate where applies decides whether a rule takes part,
+// typically by checking its condition.
+func EvaluateWith(rights []*entity.RoleRight, route, path, method string, applies func(*entity.RoleRight) bool) Decision {
+	op, ok := Operation(method)
+	if !ok {
+		return Decision{Reason: ReasonUnsupportedMethod}
+	}
+
+	type match struct {
+		right *entity.RoleRight
+		score int
+	}
+	var matches []match
+	for _, right := range rights {
+		if !Flags(right, op) || !applies(right) {
+			continue
+		}
+		if score, ok := Match(right.Route, route, path); ok {
+			matches = append(matches, match{right, score})
+		}
+	}
+	if len(matches) == 0 {
+		return Decision{Reason: ReasonNoMatchingRule}
+	}
+
+	// Most specific first, deny before allow at equal specificity
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].right.Deny && !matches[j].right.Deny
+	})
+	d := Decision{Rule: matches[0].right, Reason: ReasonDeniedByRule}
+	for _, m := range matches {
+		d.Matched = append(d.Matched, m.right)
+	}
+	if !d.Rule.Deny {
+		d.Allowed, d.Reason = true, ReasonAllowedByRule
+	}
+	return d
+}
+
+// Match reports whether the rule route covers the request and how
+// specific the match is. Higher scores are more specific.
+func Match(rule, route, path string) (int, bool) {
+	if prefix, ok := strings.CutSuffix(rule, "/*"); ok {
+		if under(path, prefix) || under(route, prefix) {
+			return strings.Count(prefix, "/"), true
+		}
+		return 0, false
+	}
+
+	switch {
+	case rule == path && !strings.Contains(rule, "{"):
+		return exactPath, true
+	case rule == route:
+		return exactPattern, true
+	}
+	return 0, false
+}
+
+func under(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
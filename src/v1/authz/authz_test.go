@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		rule, route, path string
+		want              bool
+	}{
+		{"/users/user", "/users/user", "/users/user", true},
+		{"/users/user/{user_id}", "/users/user/{user_id}", "/users/user/1", true},
+		{"/users/user/1", "/users/user/{user_id}", "/users/user/1", true},
+		{"/users/user/2", "/users/user/{user_id}", "/users/user/1", false},
+		{"/users/*", "/users/user/{user_id}", "/users/user/1", true},
+		{"/users/*", "/users", "/users", true},
+		{"/users/*", "/usersx", "/usersx", false},
+		{"/users/user/{user_id}/*", "/users/user/{user_id}/roles", "/users/user/1/roles", true},
+		{"/*", "/roles", "/roles", true},
+		{"/users/user", "/users/user/{user_id}", "/users/user/1", false},
+	}
+	for _, tt := range tests {
+		if _, got := Match(tt.rule, tt.route, tt.path); got != tt.want {
+			t.Errorf("Match(%s, %s, %s) = %v, want %v", tt.rule, tt.route, tt.path, got, tt.want)
+		}
+	}
+
+	score := func(rule string) int {
+		s, _ := Match(rule, "/users/user/{user_id}", "/users/user/1")
+		return s
+	}
+	order := []string{"/users/user/1", "/users/user/{user_id}", "/users/user/*", "/users/*", "/*"}
+	for i := 1; i < len(order); i++ {
+		if score(order[i-1]) <= score(order[i]) {
+			t.Errorf("%s is not more specific than %s", order[i-1], order[i])
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	allow := func(route string) *entity.RoleRight {
+		return &entity.RoleRight{Route: route, RRead: true}
+	}
+	deny := func(route string) *entity.RoleRight {
+		return &entity.RoleRight{Route: route, RRead: true, Deny: true}
+	}
+
+	tests := []struct {
+		name   string
+		rights []*entity.RoleRight
+		method string
+		want   bool
+	}{
+		{"no rules", nil, "GET", false},
+		{"allow", []*entity.RoleRight{allow("/users/user")}, "GET", true},
+		{"unflagged operation", []*entity.RoleRight{allow("/users/user")}, "DELETE", false},
+		{"unknown method", []*entity.RoleRight{allow("/users/user")}, "PATCH", false},
+		{"deny beats allow", []*entity.RoleRight{allow("/users/user"), deny("/users/user")}, "GET", false},
+		{"deny beats allow in any order", []*entity.RoleRight{deny("/users/user"), allow("/users/user")}, "GET", false},
+		{"specific allow beats prefix deny", []*entity.RoleRight{deny("/users/*"), allow("/users/user")}, "GET", true},
+		{"specific deny beats prefix allow", []*entity.RoleRight{allow("/users/*"), deny("/users/user")}, "GET", false},
+		{"longer prefix wins", []*entity.RoleRight{deny("/*"), allow("/users/*")}, "GET", true},
+		{"deny for another operation", []*entity.RoleRight{allow("/users/user"), {Route: "/users/user", RDelete: true, Deny: true}}, "GET", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Evaluate(tt.rights, "/users/user", "/users/user", tt.method)
+			if d.Allowed != tt.want {
+				t.Errorf("Allowed = %v, want %v", d.Allowed, tt.want)
+			}
+			if d.Allowed && (d.Rule == nil || d.Rule.Deny) {
+				t.Errorf("allowed by rule %+v", d.Rule)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	subject := &entity.User{ID: 1, OrganizationID: 3}
+	rights := []*entity.RoleRight{
+		{Route: "/users/user/{user_id}", RRead: true, Condition: "own"},
+		{Route: "/users/user/{user_id}", RUpdate: true, Condition: "same_organization"},
+		{Route: "/users/user/{user_id}", RDelete: true, Condition: "no-such-condition"},
+	}
+	route := "/users/user/{user_id}"
+
+	strict, lenient := Bounds(rights, route, "/users/user/2", "GET")
+	if strict.Allowed || !lenient.Allowed {
+		t.Fatalf("Bounds = %v, %v, want the outcome to depend on the condition", strict.Allowed, lenient.Allowed)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		resource interface{}
+		want     error
+	}{
+		{"own record", "GET", &entity.User{ID: 1}, nil},
+		{"other record", "GET", &entity.User{ID: 2}, ErrForbidden},
+		{"resource without owner", "GET", "not owned", ErrForbidden},
+		{"unknown condition fails closed", "DELETE", &entity.User{ID: 1}, ErrForbidden},
+		{"same organization", "PUT", &entity.User{ID: 2, OrganizationID: 3}, nil},
+		{"other organization", "PUT", &entity.User{ID: 2, OrganizationID: 4}, ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithCheck(context.Background(), &Check{Subject: subject, Rights: rights, Route: route, Path: "/users/user/1", Method: tt.method})
+			if err := Require(ctx, tt.resource); err != tt.want {
+				t.Errorf("Require = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := Require(context.Background(), nil); err != nil {
+		t.Errorf("Require without a pending check = %v", err)
+	}
+}
+
+func TestRequireAuditsImpersonation(t *testing.T) {
+	var audit strings.Builder
+	log.SetOutput(&audit)
+	defer log.SetOutput(os.Stderr)
+
+	check := &Check{
+		Subject:       &entity.User{ID: 1},
+		Rights:        []*entity.RoleRight{{Route: "/users/user/{user_id}", RRead: true, Condition: "own"}},
+		Route:         "/users/user/{user_id}",
+		Path:          "/users/user/1",
+		Method:        "GET",
+		Impersonation: &entity.Impersonation{ImpersonatorID: 7, UserID: 1},
+	}
+	if err := Require(WithCheck(context.Background(), check), &entity.User{ID: 1}); err != nil {
+		t.Fatalf("Require = %v", err)
+	}
+	if !strings.Contains(audit.String(), "user=1 impersonator=7 ") {
+		t.Errorf("audit = %q, want the impersonator", audit.String())
+	}
+}
+
+func TestConditionalDeny(t *testing.T) {
+	// Everyone may read users but not their own record through this route
+	rights := []*entity.RoleRight{
+		{Route: "/users/user/{user_id}", RRead: true},
+		{Route: "/users/user/{user_id}", RRead: true, Deny: true, Condition: "own"},
+	}
+	strict, lenient := Bounds(rights, "/users/user/{user_id}", "/users/user/1", "GET")
+	if strict.Allowed || !lenient.Allowed {
+		t.Fatalf("Bounds = %v, %v, want the outcome to depend on the condition", strict.Allowed, lenient.Allowed)
+	}
+
+	check := &Check{Subject: &entity.User{ID: 1}, Rights: rights, Route: "/users/user/{user_id}", Path: "/users/user/1", Method: "GET"}
+	ctx := WithCheck(context.Background(), check)
+	if err := Require(ctx, &entity.User{ID: 1}); err != ErrForbidden {
+		t.Errorf("own record = %v, want ErrForbidden", err)
+	}
+	if err := Require(ctx, &entity.User{ID: 2}); err != nil {
+		t.Errorf("other record = %v, want allowed", err)
+	}
+	if !check.Checked() {
+		t.Error("check not marked as checked")
+	}
+}
@@ -0,0 +1,289 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyFile is the YAML format of CEL policy files:
+//
+//	policies:
+//	  - name: admins
+//	    effect: allow
+//	    when: "'admin' in roles"
+//	  - name: no-self-delete
+//	    effect: deny
+//	    when: method == 'DELETE' && resource.user_id == string(user.id)
+//
+// A request is denied when any deny policy matches, allowed when an allow
+// policy matches, and denied when none does.
+type PolicyFile struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+type Policy struct {
+	Name   string `yaml:"name"`
+	Effect string `yaml:"effect"`
+	When   string `yaml:"when"`
+}
+
+type compiledPolicy struct {
+	Policy
+	program cel.Program
+}
+
+// CELAuthorizer evaluates CEL policies loaded from a file or from every
+// .yaml file in a directory. Expressions see these variables:
+//
+//	user      map: id, name, email, roles (names), role_ids; empty for an
+//	          OAuth client
+//	client    map: client_id, name, role_id; empty for a user
+//	roles     list of the principal's role names
+//	section   request section, e.g. "be"
+//	route     chi route pattern, e.g. "/users/user/{user_id}"
+//	path      requested path
+//	method    HTTP method
+//	resource  map of the route parameters, e.g. resource.user_id
+type CELAuthorizer struct {
+	path string
+	env  *cel.Env
+
+	mu          sync.RWMutex
+	policies    []compiledPolicy
+	fingerprint string
+}
+
+// NewCELAuthorizer compiles the policies at path. It fails when any policy
+// does not compile, so a broken policy never reaches a running server.
+func NewCELAuthorizer(path string) (*CELAuthorizer, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("client", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("roles", cel.ListType(cel.StringType)),
+		cel.Variable("section", cel.StringType),
+		cel.Variable("route", cel.StringType),
+		cel.Variable("path", cel.StringType),
+		cel.Variable("method", cel.StringType),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.StringType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &CELAuthorizer{path: path, env: env}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload recompiles the policies when the files changed since the last
+// load and reports whether it did. On error the previous policies stay in
+// effect.
+func (a *CELAuthorizer) Reload() (bool, error) {
+	files, fingerprint, err := policyFiles(a.path)
+	if err != nil {
+		return false, err
+	}
+
+	a.mu.RLock()
+	unchanged := fingerprint == a.fingerprint
+	a.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var policies []compiledPolicy
+	for _, file := range files {
+		compiled, err := a.compileFile(file)
+		if err != nil {
+			return false, err
+		}
+		policies = append(policies, compiled...)
+	}
+
+	a.mu.Lock()
+	a.policies, a.fingerprint = policies, fingerprint
+	a.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the policies every interval until ctx is done.
+func (a *CELAuthorizer) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := a.Reload()
+			if err != nil {
+				log.Printf("Keeping previous policies, reload failed: %v", err)
+				continue
+			}
+			if reloaded {
+				log.Printf("Reloaded %d policies from %s", a.count(), a.path)
+			}
+		}
+	}
+}
+
+func (a *CELAuthorizer) count() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.policies)
+}
+
+func (a *CELAuthorizer) compileFile(file string) ([]compiledPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pf PolicyFile
+	if err := yaml.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	compiled := make([]compiledPolicy, 0, len(pf.Policies))
+	for _, p := range pf.Policies {
+		if p.Effect != "allow" && p.Effect != "deny" {
+			return nil, fmt.Errorf("%s: policy %q: effect must be allow or deny, got %q", file, p.Name, p.Effect)
+		}
+		ast, iss := a.env.Compile(p.When)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("%s: policy %q: %w", file, p.Name, iss.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("%s: policy %q: expression must be a bool, got %s", file, p.Name, ast.OutputType())
+		}
+		program, err := a.env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("%s: policy %q: %w", file, p.Name, err)
+		}
+		compiled = append(compiled, compiledPolicy{Policy: p, program: program})
+	}
+	return compiled, nil
+}
+
+// Authorize applies the policies. An allow policy failing at runtime, e.g.
+// on a missing resource key, does not match, a deny policy failing at
+// runtime denies the request.
+func (a *CELAuthorizer) Authorize(ctx context.Context, req *Request) (Decision, error) {
+	a.mu.RLock()
+	policies := a.policies
+	a.mu.RUnlock()
+
+	roles := []string{}
+	user := map[string]interface{}{}
+	client := map[string]interface{}{}
+	if req.Client != nil {
+		if req.Client.Role != nil {
+			roles = append(roles, req.Client.Role.Name)
+		}
+		client = map[string]interface{}{
+			"client_id": req.Client.ClientID,
+			"name":      req.Client.Name,
+			"role_id":   req.Client.RoleID,
+		}
+	} else {
+		for _, r := range req.User.Roles {
+			roles = append(roles, r.Name)
+		}
+		user = map[string]interface{}{
+			"id":       req.User.ID,
+			"name":     req.User.Name,
+			"email":    req.User.Email,
+			"roles":    roles,
+			"role_ids": req.User.RoleIDs(),
+		}
+	}
+	resource := req.Resource
+	if resource == nil {
+		resource = map[string]string{}
+	}
+	vars := map[string]interface{}{
+		"user":     user,
+		"client":   client,
+		"roles":    roles,
+		"section":  req.Section,
+		"route":    req.Route,
+		"path":     req.Path,
+		"method":   req.Method,
+		"resource": resource,
+	}
+
+	var allowedBy string
+	for _, p := range policies {
+		out, _, err := p.program.Eval(vars)
+		if err != nil {
+			if p.Effect == "deny" {
+				log.Printf("Policy %q failed, denying: %v", p.Name, err)
+				return Decision{Policy: p.Name, Reason: ReasonPolicyError}, nil
+			}
+			continue
+		}
+		if matched, ok := out.Value().(bool); !ok || !matched {
+			continue
+		}
+		if p.Effect == "deny" {
+			return Decision{Policy: p.Name, Reason: ReasonDeniedByPolicy}, nil
+		}
+		if allowedBy == "" {
+			allowedBy = p.Name
+		}
+	}
+	if allowedBy == "" {
+		return Decision{Reason: ReasonNoMatchingPolicy}, nil
+	}
+	return Decision{Allowed: true, Policy: allowedBy, Reason: ReasonAllowedByPolicy}, nil
+}
+
+// policyFiles lists the policy files at path and fingerprints their names,
+// sizes and modification times.
+func policyFiles(path string) ([]string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+		sort.Strings(files)
+		if len(files) == 0 {
+			return nil, "", errors.New("no policy files in " + path)
+		}
+	}
+
+	var b strings.Builder
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return files, b.String(), nil
+}
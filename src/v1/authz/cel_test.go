@@ -0,0 +1,174 @@
+package authz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+)
+
+const testPolicies = `
+policies:
+  - name: admins
+    effect: allow
+    when: "'admin' in roles"
+  - name: own-record
+    effect: allow
+    when: route == '/users/user/{user_id}' && method in ['GET', 'PUT'] && resource.user_id == string(user.id)
+  - name: protect-user-1
+    effect: deny
+    when: method == 'DELETE' && resource.user_id == '1'
+`
+
+func writePolicy(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCELAuthorizer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicy(t, path, testPolicies)
+	a, err := NewCELAuthorizer(path)
+	if err != nil {
+		t.Fatalf("NewCELAuthorizer: %v", err)
+	}
+
+	admin := &entity.User{ID: 9, Roles: []entity.Role{{ID: 1, Name: "admin"}}}
+	plain := &entity.User{ID: 2, Roles: []entity.Role{{ID: 2, Name: "user"}}}
+	tests := []struct {
+		name       string
+		user       *entity.User
+		method     string
+		route      string
+		resource   map[string]string
+		want       bool
+		wantPolicy string
+	}{
+		{"admin", admin, "DELETE", "/users/user/{user_id}", map[string]string{"user_id": "2"}, true, "admins"},
+		{"own record", plain, "PUT", "/users/user/{user_id}", map[string]string{"user_id": "2"}, true, "own-record"},
+		{"other record", plain, "PUT", "/users/user/{user_id}", map[string]string{"user_id": "3"}, false, ""},
+		{"missing resource key does not match", plain, "GET", "/users/user/{user_id}", nil, false, ""},
+		{"deny beats allow", admin, "DELETE", "/users/user/{user_id}", map[string]string{"user_id": "1"}, false, "protect-user-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := a.Authorize(context.Background(), &Request{User: tt.user, Section: "be", Route: tt.route, Method: tt.method, Resource: tt.resource})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.want || d.Policy != tt.wantPolicy {
+				t.Errorf("decision = %v by %q, want %v by %q", d.Allowed, d.Policy, tt.want, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestCELAuthorizerDenyPolicyError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicy(t, path, testPolicies)
+	a, err := NewCELAuthorizer(path)
+	if err != nil {
+		t.Fatalf("NewCELAuthorizer: %v", err)
+	}
+
+	// Without user_id protect-user-1 fails to evaluate, the admins policy
+	// alone would allow the request
+	admin := &entity.User{ID: 9, Roles: []entity.Role{{ID: 1, Name: "admin"}}}
+	d, err := a.Authorize(context.Background(), &Request{User: admin, Section: "be", Route: "/users/user", Method: "DELETE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed || d.Reason != ReasonPolicyError || d.Policy != "protect-user-1" {
+		t.Errorf("decision = %v %s by %q, want denied %s by protect-user-1", d.Allowed, d.Reason, d.Policy, ReasonPolicyError)
+	}
+}
+
+func TestCELAuthorizerReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policies.yaml")
+	writePolicy(t, path, `
+policies:
+  - name: nobody
+    effect: allow
+    when: "false"
+`)
+	a, err := NewCELAuthorizer(dir)
+	if err != nil {
+		t.Fatalf("NewCELAuthorizer: %v", err)
+	}
+	req := &Request{User: &entity.User{ID: 1}, Route: "/users/user", Method: "GET"}
+	allowed := func() bool {
+		d, err := a.Authorize(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Allowed
+	}
+	if allowed() {
+		t.Fatal("allowed before the policy changed")
+	}
+
+	if reloaded, err := a.Reload(); err != nil || reloaded {
+		t.Errorf("Reload of unchanged files = %v, %v", reloaded, err)
+	}
+
+	writePolicy(t, path, `
+policies:
+  - name: everybody-reads
+    effect: allow
+    when: method == 'GET'
+`)
+	if reloaded, err := a.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload = %v, %v, want reloaded", reloaded, err)
+	}
+	if !allowed() {
+		t.Error("new policy not applied")
+	}
+
+	// A broken edit keeps the last good policies
+	writePolicy(t, path, `
+policies:
+  - name: broken
+    effect: allow
+    when: method ==
+`)
+	if _, err := a.Reload(); err == nil {
+		t.Error("Reload accepted a policy that does not compile")
+	}
+	if !allowed() {
+		t.Error("broken reload dropped the previous policies")
+	}
+}
+
+func TestCELAuthorizerRejectsBadPolicies(t *testing.T) {
+	tests := map[string]string{
+		"syntax":     "policies:\n  - {name: p, effect: allow, when: 'method =='}",
+		"not a bool": "policies:\n  - {name: p, effect: allow, when: 'method'}",
+		"unknown":    "policies:\n  - {name: p, effect: allow, when: 'tenant == 1'}",
+		"effect":     "policies:\n  - {name: p, effect: maybe, when: 'true'}",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "p.yaml")
+			writePolicy(t, path, content)
+			if _, err := NewCELAuthorizer(path); err == nil || !strings.Contains(err.Error(), "policy \"p\"") {
+				t.Errorf("NewCELAuthorizer error = %v", err)
+			}
+		})
+	}
+
+	if _, err := NewCELAuthorizer(t.TempDir()); err == nil {
+		t.Error("accepted a directory without policy files")
+	}
+}
+
+func TestExamplePolicies(t *testing.T) {
+	if _, err := NewCELAuthorizer("../../../policies"); err != nil {
+		t.Errorf("policies/example.yaml does not load: %v", err)
+	}
+}
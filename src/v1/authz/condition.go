@@ -0,0 +1,186 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"test-tablelink/src/entity"
+)
+
+// ErrForbidden is returned by Require when the conditions of the rules do
+// not allow the request on the resource. Its reason code is
+// ReasonConditionFailed.
+var ErrForbidden = errors.New("permission denied")
+
+// Condition reports whether a conditional rule applies to subject acting
+// on resource. resource is whatever the service loaded, nil when there is
+// none.
+type Condition func(subject *entity.User, resource interface{}) bool
+
+// Owned is implemented by resources that belong to a user.
+type Owned interface {
+	OwnerID() int64
+}
+
+// Organized is implemented by resources that belong to an organization.
+type Organized interface {
+	OrganizationOf() int64
+}
+
+var (
+	conditionsMu sync.RWMutex
+	conditions   = map[string]Condition{
+		"own":               own,
+		"same_organization": sameOrganization,
+	}
+
+	checkedRoutesMu sync.RWMutex
+	checkedRoutes   = map[string]bool{}
+)
+
+// RegisterCondition makes a condition available to role rights by name.
+func RegisterCondition(name string, c Condition) {
+	conditionsMu.Lock()
+	defer conditionsMu.Unlock()
+	conditions[name] = c
+}
+
+// KnownCondition reports whether name is a registered condition.
+func KnownCondition(name string) bool {
+	conditionsMu.RLock()
+	defer conditionsMu.RUnlock()
+	_, ok := conditions[name]
+	return ok
+}
+
+// own holds when the resource belongs to the subject.
+func own(subject *entity.User, resource interface{}) bool {
+	owned, ok := resource.(Owned)
+	return ok && owned.OwnerID() == subject.ID
+}
+
+// sameOrganization holds when the resource belongs to the subject's
+// organization.
+func sameOrganization(subject *entity.User, resource interface{}) bool {
+	organized, ok := resource.(Organized)
+	return ok && organized.OrganizationOf() == subject.OrganizationID
+}
+
+// RegisterCheckedRoute declares that the service behind method on route,
+// a chi pattern, settles pending checks with Require before it changes
+// anything. A request with a pending check on any other route is denied
+// before its handler runs.
+func RegisterCheckedRoute(method, route string) {
+	checkedRoutesMu.Lock()
+	defer checkedRoutesMu.Unlock()
+	checkedRoutes[method+" "+route] = true
+}
+
+// CheckedRoute reports whether method on route settles pending checks.
+func CheckedRoute(method, route string) bool {
+	checkedRoutesMu.RLock()
+	defer checkedRoutesMu.RUnlock()
+	return checkedRoutes[method+" "+route]
+}
+
+// holds evaluates the named condition. Unknown conditions never hold, so a
+// typo in a rule fails closed for allow rules. Conditions are about users,
+// so none holds for an OAuth client, whose subject is nil.
+func holds(name string, subject *entity.User, resource interface{}) bool {
+	if subject == nil {
+		return false
+	}
+	conditionsMu.RLock()
+	c, ok := conditions[name]
+	conditionsMu.RUnlock()
+	if !ok {
+		log.Printf("Unknown authorization condition %q", name)
+		return false
+	}
+	return c(subject, resource)
+}
+
+// Bounds evaluates the request once assuming every condition works against
+// it and once assuming every condition works for it. When both agree the
+// conditions cannot change the outcome.
+func Bounds(rights []*entity.RoleRight, route, path, method string) (strict, lenient Decision) {
+	strict = EvaluateWith(rights, route, path, method, func(r *entity.RoleRight) bool {
+		return r.Condition == "" || r.Deny
+	})
+	lenient = EvaluateWith(rights, route, path, method, func(r *entity.RoleRight) bool {
+		return r.Condition == "" || !r.Deny
+	})
+	return strict, lenient
+}
+
+// Check is a decision left pending until the resource is known.
+type Check struct {
+	// Subject is the user, nil when Client is the principal
+	Subject *entity.User
+	Client  *entity.OAuthClient
+	Rights  []*entity.RoleRight
+	Section string
+	Route   string
+	Path    string
+	Method  string
+	// Impersonation is set when an admin acts as Subject
+	Impersonation *entity.Impersonation
+
+	mu      sync.Mutex
+	checked bool
+}
+
+// Checked reports whether Require settled the check.
+func (c *Check) Checked() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checked
+}
+
+type checkKey struct{}
+
+// WithCheck stores a pending check in the request context.
+func WithCheck(ctx context.Context, c *Check) context.Context {
+	return context.WithValue(ctx, checkKey{}, c)
+}
+
+// Pending reports whether the request carries a check for Require.
+func Pending(ctx context.Context) bool {
+	_, ok := ctx.Value(checkKey{}).(*Check)
+	return ok
+}
+
+// Require settles the pending check of the request, if any, against the
+// target resource. Requests the middleware fully authorized carry no
+// check and always pass.
+func Require(ctx context.Context, resource interface{}) error {
+	c, ok := ctx.Value(checkKey{}).(*Check)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	c.checked = true
+	c.mu.Unlock()
+
+	d := EvaluateWith(c.Rights, c.Route, c.Path, c.Method, func(r *entity.RoleRight) bool {
+		return r.Condition == "" || holds(r.Condition, c.Subject, resource)
+	})
+	if !d.Allowed {
+		d.Reason = ReasonConditionFailed
+	}
+	Audit(&Request{
+		User:          c.Subject,
+		Client:        c.Client,
+		Section:       c.Section,
+		Route:         c.Route,
+		Path:          c.Path,
+		Method:        c.Method,
+		Impersonation: c.Impersonation,
+	}, d)
+	if !d.Allowed {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package authz
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type impersonationKey struct{}
+
+// WithImpersonation marks the request as made by an admin acting as the
+// context user.
+func WithImpersonation(ctx context.Context, impersonation *entity.Impersonation) context.Context {
+	return context.WithValue(ctx, impersonationKey{}, impersonation)
+}
+
+// Impersonation returns the impersonation the request was made with, false
+// for requests the user made themselves.
+func Impersonation(ctx context.Context) (*entity.Impersonation, bool) {
+	impersonation, ok := ctx.Value(impersonationKey{}).(*entity.Impersonation)
+	return impersonation, ok
+}
@@ -0,0 +1,42 @@
+package authz
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type scopesKey struct{}
+
+// WithTokenScopes marks the request as made with an API token limited to
+// scopes, allow rules in the form of role rights.
+func WithTokenScopes(ctx context.Context, scopes []*entity.RoleRight) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// TokenScopes returns the scopes of the API token the request was made
+// with, false for requests made with a session.
+func TokenScopes(ctx context.Context) ([]*entity.RoleRight, bool) {
+	scopes, ok := ctx.Value(scopesKey{}).([]*entity.RoleRight)
+	return scopes, ok
+}
+
+// Restrict narrows a decision on req to what scopes allow, so a request
+// made with an API token needs both a right of the token's owner and a
+// scope of the token. Scopes only allow and are matched like role rights,
+// in their own section.
+func Restrict(d Decision, scopes []*entity.RoleRight, req *Request) Decision {
+	if !d.Allowed {
+		return d
+	}
+	var inSection []*entity.RoleRight
+	for _, s := range scopes {
+		if s.Section == req.Section {
+			inSection = append(inSection, s)
+		}
+	}
+	if Evaluate(inSection, req.Route, req.Path, req.Method).Allowed {
+		return d
+	}
+	return Decision{Reason: ReasonOutsideTokenScope, Matched: d.Matched}
+}
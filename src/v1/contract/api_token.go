@@ -0,0 +1,32 @@
+package contract
+
+type APITokenResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// APITokenScope allows the flagged operations on a route of a section,
+// matched like a role right's route.
+type APITokenScope struct {
+	Section string `json:"section"`
+	Route   string `json:"route"`
+	Create  bool   `json:"create"`
+	Read    bool   `json:"read"`
+	Update  bool   `json:"update"`
+	Delete  bool   `json:"delete"`
+}
+
+// CreateAPITokenRequest names a new token and what it may do. ExpiresIn is
+// a Go duration such as "720h", the longest allowed lifetime when empty.
+type CreateAPITokenRequest struct {
+	Name      string          `json:"name"`
+	Scopes    []APITokenScope `json:"scopes"`
+	ExpiresIn string          `json:"expires_in,omitempty"`
+}
+
+// CreatedAPIToken carries the token itself, which is not shown again.
+type CreatedAPIToken struct {
+	Token    string      `json:"token"`
+	APIToken interface{} `json:"api_token"`
+}
@@ -0,0 +1,43 @@
+package contract
+
+// AuthzCheckRequest asks how a request would be decided. The subject is a
+// user, by UserID or Email, or a bare Role by name.
+type AuthzCheckRequest struct {
+	UserID  int64  `json:"user_id,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Section string `json:"section"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+}
+
+type AuthzRule struct {
+	ID        int64  `json:"id"`
+	Role      string `json:"role"`
+	Section   string `json:"section"`
+	Route     string `json:"route"`
+	Create    bool   `json:"create"`
+	Read      bool   `json:"read"`
+	Update    bool   `json:"update"`
+	Delete    bool   `json:"delete"`
+	Deny      bool   `json:"deny"`
+	Condition string `json:"condition,omitempty"`
+}
+
+// AuthzCheckResult explains a decision. Rule decided it and Matched lists
+// every rule covering the request, most specific first. Policy is set
+// instead when a policy authorizer decided.
+type AuthzCheckResult struct {
+	Allowed bool        `json:"allowed"`
+	Reason  string      `json:"reason"`
+	Route   string      `json:"route"`
+	Rule    *AuthzRule  `json:"rule,omitempty"`
+	Matched []AuthzRule `json:"matched"`
+	Policy  string      `json:"policy,omitempty"`
+}
+
+type AuthzCheckResponse struct {
+	Status  bool             `json:"status"`
+	Message string           `json:"message"`
+	Data    AuthzCheckResult `json:"data"`
+}
@@ -0,0 +1,24 @@
+package contract
+
+type FederationResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// IdentityProvider is an upstream identity provider users can log in
+// with, for a login page to list.
+type IdentityProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// FederatedCallback holds the parameters the identity provider sends the
+// user back with: a code, or an error.
+type FederatedCallback struct {
+	State            string
+	Code             string
+	Error            string
+	ErrorDescription string
+}
@@ -0,0 +1,16 @@
+package contract
+
+// RoleGrantRequest asks for a role for a limited time. UserID defaults to
+// the requester; Duration is a Go duration such as "2h".
+type RoleGrantRequest struct {
+	UserID        int64  `json:"user_id,omitempty"`
+	RoleID        int    `json:"role_id"`
+	Duration      string `json:"duration"`
+	Justification string `json:"justification"`
+}
+
+type RoleGrantResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
@@ -0,0 +1,35 @@
+package contract
+
+type GroupResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	ParentID    *int   `json:"parent_id,omitempty"`
+}
+
+type UpdateGroupRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	ParentID    *int   `json:"parent_id,omitempty"`
+}
+
+type GroupMemberRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+type GroupRoleRequest struct {
+	RoleID int `json:"role_id"`
+}
+
+// GroupDetail is a group with the roles granted to it directly and its
+// direct members. Members of nested groups are listed on their own group.
+type GroupDetail struct {
+	Group   interface{} `json:"group"`
+	Roles   interface{} `json:"roles"`
+	Members interface{} `json:"members"`
+}
@@ -0,0 +1,20 @@
+package contract
+
+type ImpersonationResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// ImpersonateRequest gives the reason for acting as another user, which is
+// kept in the audit log.
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ImpersonationToken carries the token to act as the user with, sent like
+// a session token.
+type ImpersonationToken struct {
+	AccessToken   string      `json:"access_token"`
+	Impersonation interface{} `json:"impersonation"`
+}
@@ -0,0 +1,19 @@
+package contract
+
+type MagicLinkResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+}
+
+// MagicLinkRequest asks for a login link sent to Email. Organization is
+// the slug of the user's organization, the default organization when
+// empty.
+type MagicLinkRequest struct {
+	Organization string `json:"organization,omitempty"`
+	Email        string `json:"email"`
+}
+
+// MagicLinkLoginRequest carries the token of a login link.
+type MagicLinkLoginRequest struct {
+	Token string `json:"token"`
+}
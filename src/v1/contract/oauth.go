@@ -0,0 +1,62 @@
+package contract
+
+type OAuthClientResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// CreateOAuthClientRequest registers a service. Scopes are "operation:route"
+// entries such as "read:/users/*", the most the client may request.
+type CreateOAuthClientRequest struct {
+	Name   string   `json:"name"`
+	RoleID int      `json:"role_id"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedOAuthClient carries the client secret, which is not shown again.
+type CreatedOAuthClient struct {
+	ClientID     string      `json:"client_id"`
+	ClientSecret string      `json:"client_secret"`
+	Client       interface{} `json:"client"`
+}
+
+// OAuthTokenResponse is the RFC 6749 access token response.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthError is the RFC 6749 error response.
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// IntrospectionResponse is the RFC 7662 introspection response. Only
+// Active is set for a token that is unknown, expired, revoked or of
+// another organization. Roles and OrganizationID extend the standard
+// members.
+type IntrospectionResponse struct {
+	Active         bool     `json:"active"`
+	Scope          string   `json:"scope,omitempty"`
+	ClientID       string   `json:"client_id,omitempty"`
+	Username       string   `json:"username,omitempty"`
+	TokenType      string   `json:"token_type,omitempty"`
+	ExpiresAt      int64    `json:"exp,omitempty"`
+	IssuedAt       int64    `json:"iat,omitempty"`
+	Subject        string   `json:"sub,omitempty"`
+	Roles          []string `json:"roles,omitempty"`
+	OrganizationID int64    `json:"organization_id,omitempty"`
+	// Act is the impersonator of an impersonation token, the actor claim
+	// of RFC 8693
+	Act *IntrospectionActor `json:"act,omitempty"`
+}
+
+// IntrospectionActor is the user acting as the subject of a token.
+type IntrospectionActor struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+}
@@ -0,0 +1,12 @@
+package contract
+
+type OrganizationResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type CreateOrganizationRequest struct {
+	Slug string `json:"slug" validate:"required"`
+	Name string `json:"name" validate:"required"`
+}
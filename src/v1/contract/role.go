@@ -7,9 +7,36 @@ type RoleResponse struct {
 }
 
 type CreateRoleRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name      string `json:"name" validate:"required"`
+	ParentID  *int   `json:"parent_id,omitempty"`
+	MagicLink bool   `json:"magic_link,omitempty"`
 }
 
 type UpdateRoleRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name      string `json:"name" validate:"required"`
+	ParentID  *int   `json:"parent_id,omitempty"`
+	MagicLink bool   `json:"magic_link,omitempty"`
+}
+
+// EffectiveRight is a role's merged permission on one route. Sources maps
+// each granted operation (create, read, update, delete) to the name of the
+// role, the role itself or an ancestor, that grants it. Deny rules and
+// rules with a condition are merged separately from plain allow rules on
+// the same route.
+type EffectiveRight struct {
+	Section   string            `json:"section"`
+	Route     string            `json:"route"`
+	Deny      bool              `json:"deny"`
+	Condition string            `json:"condition,omitempty"`
+	Create    bool              `json:"create"`
+	Read      bool              `json:"read"`
+	Update    bool              `json:"update"`
+	Delete    bool              `json:"delete"`
+	Sources   map[string]string `json:"sources"`
+}
+
+type EffectiveRights struct {
+	Role        interface{}      `json:"role"`
+	Inheritance []string         `json:"inheritance"`
+	Rights      []EffectiveRight `json:"rights"`
 }
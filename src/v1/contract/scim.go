@@ -0,0 +1,19 @@
+package contract
+
+type SCIMTokenResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// CreateSCIMTokenRequest names the token of a SCIM client, usually after
+// the identity provider it is configured in.
+type CreateSCIMTokenRequest struct {
+	Name string `json:"name"`
+}
+
+// CreatedSCIMToken carries the token itself, which is not shown again.
+type CreatedSCIMToken struct {
+	Token     string      `json:"token"`
+	SCIMToken interface{} `json:"scim_token"`
+}
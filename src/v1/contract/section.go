@@ -0,0 +1,12 @@
+package contract
+
+type SectionResponse struct {
+	Status  bool        `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type CreateSectionRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
@@ -19,3 +19,10 @@ type UpdateUserRequest struct {
 	Password string `json:"password,omitempty"`
 	RoleID   string `json:"role_id" validate:"required"`
 }
+
+// Me is the logged in user. Impersonation is set while an admin acts as
+// the user.
+type Me struct {
+	User          interface{} `json:"user"`
+	Impersonation interface{} `json:"impersonation,omitempty"`
+}
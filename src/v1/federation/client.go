@@ -0,0 +1,254 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"test-tablelink/src/jwt"
+)
+
+// ErrInvalidIDToken is returned for an ID token that does not verify or is
+// not meant for this login.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// clockSkew is how far the provider's clock may be ahead or behind.
+const clockSkew = time.Minute
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// metadata is the part of the provider's discovery document the login
+// needs.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type keyCache struct {
+	set       jwt.KeySet
+	fetchedAt time.Time
+}
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]interface{}
+
+// Subject returns the sub claim, the account at the provider.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Email returns the email claim.
+func (c Claims) Email() string {
+	return c.String("email")
+}
+
+// EmailVerified reports whether the provider vouches for the email. Some
+// providers send the flag as a string.
+func (c Claims) EmailVerified() bool {
+	switch v := c["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Name returns the name claim.
+func (c Claims) Name() string {
+	return c.String("name")
+}
+
+// String returns the claim as a string, empty when missing or not one.
+func (c Claims) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+// Has reports whether claim equals value, or contains it when the claim is
+// a list. Numbers and booleans are compared in their JSON form.
+func (c Claims) Has(claim, value string) bool {
+	switch v := c[claim].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if fmt.Sprint(item) == value {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	default:
+		return fmt.Sprint(v) == value
+	}
+}
+
+// discover returns the provider's metadata, read once.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var m metadata
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("provider %s discovery: %w", p.Name, err)
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("provider %s discovery: issuer %q does not match %q", p.Name, m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("provider %s discovery: authorization_endpoint, token_endpoint and jwks_uri are required", p.Name)
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// keySet returns the provider's signing keys. They are read again when
+// refresh is set, at most once a minute, to pick up rotated keys.
+func (p *Provider) keySet(ctx context.Context, m *metadata, refresh bool) (jwt.KeySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil && (!refresh || time.Since(p.keys.fetchedAt) < time.Minute) {
+		return p.keys.set, nil
+	}
+
+	var set jwt.KeySet
+	if err := getJSON(ctx, m.JWKSURI, &set); err != nil {
+		return jwt.KeySet{}, fmt.Errorf("provider %s keys: %w", p.Name, err)
+	}
+	p.keys = &keyCache{set: set, fetchedAt: time.Now()}
+	return set, nil
+}
+
+// AuthCodeURL returns the provider's authorization URL for a login with
+// state, nonce and the S256 PKCE challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("provider %s: %w", p.Name, err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURI)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems code at the provider's token endpoint and returns the
+// claims of the verified ID token, which must carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURI},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s token endpoint: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("provider %s token endpoint: %s: %w", p.Name, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("provider %s token endpoint: %s: %s %s", p.Name, resp.Status, token.Error, token.ErrorDescription)
+	}
+	return p.verify(ctx, m, token.IDToken, nonce)
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and
+// nonce.
+func (p *Provider) verify(ctx context.Context, m *metadata, idToken, nonce string) (Claims, error) {
+	set, err := p.keySet(ctx, m, false)
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := set.Verify(idToken, &claims); err != nil {
+		// The provider may have rotated its keys
+		if set, err = p.keySet(ctx, m, true); err != nil {
+			return nil, err
+		}
+		if err := set.Verify(idToken, &claims); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+		}
+	}
+
+	now := time.Now()
+	exp, _ := claims["exp"].(float64)
+	switch {
+	case strings.TrimSuffix(claims.String("iss"), "/") != p.Issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.String("iss"))
+	case !claims.Has("aud", p.ClientID):
+		return nil, fmt.Errorf("%w: not issued to %s", ErrInvalidIDToken, p.ClientID)
+	case now.Add(-clockSkew).Unix() >= int64(exp):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case claims.String("nonce") != nonce:
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	case claims.Subject() == "":
+		return nil, fmt.Errorf("%w: no sub claim", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,177 @@
+// Package federation logs users in through upstream OpenID Connect
+// identity providers, such as the company IdP. Providers are configured in
+// a YAML file (see identity-providers.example.yaml); each one belongs to an
+// organization, gives new users a default role and may map claims of the
+// ID token to further roles.
+package federation
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9-]{1,50}$`)
+
+// File is the layout of the providers file.
+type File struct {
+	Providers []*Provider `yaml:"providers"`
+}
+
+// Provider is an upstream OpenID Connect identity provider.
+type Provider struct {
+	// Name identifies the provider in the login URL and in
+	// federated_identities, it must not change once users logged in
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name"`
+	// Issuer is the provider's issuer URL, its metadata is read from
+	// Issuer/.well-known/openid-configuration
+	Issuer           string `yaml:"issuer"`
+	ClientID         string `yaml:"client_id"`
+	ClientSecret     string `yaml:"client_secret"`
+	ClientSecretFile string `yaml:"client_secret_file"`
+	// RedirectURI is this service's callback as registered at the
+	// provider, .../auth/federated/<name>/callback
+	RedirectURI string   `yaml:"redirect_uri"`
+	Scopes      []string `yaml:"scopes"`
+	// Organization is the slug of the organization users log in to, the
+	// default organization when empty
+	Organization string `yaml:"organization"`
+	// DefaultRole is given to every user created on their first login
+	DefaultRole  string        `yaml:"default_role"`
+	RoleMappings []RoleMapping `yaml:"role_mappings"`
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keyCache
+}
+
+// RoleMapping gives Role to users whose ID token claim Claim equals Value,
+// or contains it when the claim is a list (e.g. groups).
+type RoleMapping struct {
+	Claim string `yaml:"claim"`
+	Value string `yaml:"value"`
+	Role  string `yaml:"role"`
+}
+
+// LoadProviders reads and validates the providers file at path. A
+// client_secret_file is read right away.
+func LoadProviders(path string) ([]*Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for i, p := range f.Providers {
+		if err := p.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("provider %d (%s): %w", i+1, p.Name, err))
+			continue
+		}
+		if seen[p.Name] {
+			errs = append(errs, fmt.Errorf("provider %d: duplicate name %q", i+1, p.Name))
+		}
+		seen[p.Name] = true
+		if p.ClientSecretFile != "" {
+			secret, err := os.ReadFile(p.ClientSecretFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("provider %s: %w", p.Name, err))
+				continue
+			}
+			p.ClientSecret = strings.TrimSpace(string(secret))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Providers, nil
+}
+
+// validate checks the provider and fills in the defaults.
+func (p *Provider) validate() error {
+	var errs []error
+	if !providerName.MatchString(p.Name) {
+		errs = append(errs, fmt.Errorf("name %q must be 1 to 50 lower case letters, digits or \"-\"", p.Name))
+	}
+	if !validURL(p.Issuer) {
+		errs = append(errs, fmt.Errorf("issuer %q must be an https URL, or http on localhost", p.Issuer))
+	}
+	if !validURL(p.RedirectURI) {
+		errs = append(errs, fmt.Errorf("redirect_uri %q must be an https URL, or http on localhost", p.RedirectURI))
+	}
+	if p.ClientID == "" {
+		errs = append(errs, errors.New("client_id is required"))
+	}
+	if p.ClientSecret != "" && p.ClientSecretFile != "" {
+		errs = append(errs, errors.New("set client_secret or client_secret_file, not both"))
+	}
+	if p.DefaultRole == "" {
+		errs = append(errs, errors.New("default_role is required"))
+	}
+	for i, m := range p.RoleMappings {
+		if m.Claim == "" || m.Value == "" || m.Role == "" {
+			errs = append(errs, fmt.Errorf("role_mappings %d: claim, value and role are required", i+1))
+		}
+	}
+
+	p.Issuer = strings.TrimSuffix(p.Issuer, "/")
+	if p.DisplayName == "" {
+		p.DisplayName = p.Name
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "email", "profile"}
+	}
+	if !contains(p.Scopes, "openid") {
+		p.Scopes = append([]string{"openid"}, p.Scopes...)
+	}
+	return errors.Join(errs...)
+}
+
+// MappedRoles returns the names of the roles the role mappings give for
+// claims, without duplicates.
+func (p *Provider) MappedRoles(claims Claims) []string {
+	var roles []string
+	for _, m := range p.RoleMappings {
+		if claims.Has(m.Claim, m.Value) && !contains(roles, m.Role) {
+			roles = append(roles, m.Role)
+		}
+	}
+	return roles
+}
+
+// validURL accepts absolute https URLs, and http ones on the local machine
+// for development and tests.
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package federation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "providers.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProviders(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, `
+providers:
+  - name: corp
+    issuer: https://login.corp.com/
+    client_id: tablelink
+    client_secret_file: `+secret+`
+    redirect_uri: https://tablelink.corp.com/auth/federated/corp/callback
+    scopes: [email, groups]
+    default_role: user
+    role_mappings:
+      - {claim: groups, value: platform-admins, role: admin}
+`)
+	providers, err := LoadProviders(path)
+	if err != nil {
+		t.Fatalf("LoadProviders: %v", err)
+	}
+	p := providers[0]
+	if p.Issuer != "https://login.corp.com" || p.ClientSecret != "s3cret" || p.DisplayName != "corp" {
+		t.Errorf("provider = %+v", p)
+	}
+	if want := []string{"openid", "email", "groups"}; !reflect.DeepEqual(p.Scopes, want) {
+		t.Errorf("scopes = %v, want %v", p.Scopes, want)
+	}
+}
+
+func TestLoadProvidersInvalid(t *testing.T) {
+	path := writeFile(t, `
+providers:
+  - name: Corp
+    issuer: http://login.corp.com
+    redirect_uri: https://tablelink.corp.com/callback
+    default_role: user
+    role_mappings:
+      - {claim: groups, role: admin}
+  - name: dup
+    issuer: https://a.example.com
+    client_id: a
+    redirect_uri: https://tablelink.corp.com/callback
+    default_role: user
+  - name: dup
+    issuer: https://b.example.com
+    client_id: b
+    redirect_uri: https://tablelink.corp.com/callback
+    default_role: user
+`)
+	_, err := LoadProviders(path)
+	if err == nil {
+		t.Fatal("LoadProviders accepted an invalid file")
+	}
+	for _, want := range []string{`name "Corp"`, `issuer "http://login.corp.com"`, "client_id is required", "role_mappings 1", `duplicate name "dup"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestMappedRoles(t *testing.T) {
+	p := &Provider{RoleMappings: []RoleMapping{
+		{Claim: "groups", Value: "platform-admins", Role: "admin"},
+		{Claim: "groups", Value: "sre", Role: "admin"},
+		{Claim: "department", Value: "support", Role: "support"},
+		{Claim: "contractor", Value: "true", Role: "guest"},
+	}}
+	tests := []struct {
+		claims Claims
+		want   []string
+	}{
+		{Claims{"groups": []interface{}{"sre", "platform-admins"}}, []string{"admin"}},
+		{Claims{"department": "support"}, []string{"support"}},
+		{Claims{"department": []interface{}{"support"}, "contractor": true}, []string{"support", "guest"}},
+		{Claims{"groups": "staff"}, nil},
+		{Claims{}, nil},
+	}
+	for _, tt := range tests {
+		if got := p.MappedRoles(tt.claims); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MappedRoles(%v) = %v, want %v", tt.claims, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type APITokenHandler struct {
+	apiTokenService *service.APITokenService
+}
+
+func NewAPITokenHandler(apiTokenService *service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{apiTokenService: apiTokenService}
+}
+
+func (h *APITokenHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	response, err := h.apiTokenService.GetTokens(r.Context())
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *APITokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req contract.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.apiTokenService.CreateToken(r.Context(), &req)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *APITokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "token_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.apiTokenService.RevokeToken(r.Context(), id)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeAPITokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIToken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrSessionRequired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Token not found", http.StatusNotFound)
+	default:
+		writeServiceError(w, err)
+	}
+}
+
+func (h *APITokenHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/me/tokens", h.GetTokens)
+	r.Post("/me/tokens", h.CreateToken)
+	r.Delete("/me/tokens/{token_id}", h.RevokeToken)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -25,6 +26,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Organization == "" {
+		req.Organization = r.Header.Get(tenant.Header)
+	}
+
 	response, err := h.authService.Login(r.Context(), &req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RouteTable returns the routes serving a section, e.g. *Sections.
+type RouteTable interface {
+	Router(section string) chi.Routes
+}
+
+type AuthzHandler struct {
+	authzService *service.AuthzService
+	routes       RouteTable
+}
+
+// NewAuthzHandler resolves checked paths against the routes of the checked
+// section, normally the server's Sections.
+func NewAuthzHandler(authzService *service.AuthzService, routes RouteTable) *AuthzHandler {
+	return &AuthzHandler{authzService: authzService, routes: routes}
+}
+
+// Check answers whether a user or role may perform a request, and why,
+// without performing it.
+func (h *AuthzHandler) Check(w http.ResponseWriter, r *http.Request) {
+	var req contract.AuthzCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	route, params := h.resolve(req.Section, req.Method, req.Path)
+	response, err := h.authzService.Check(r.Context(), &req, route, params)
+	switch {
+	case errors.Is(err, service.ErrInvalidCheck):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "User or role not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolve finds the route pattern and parameters the request would be
+// routed to in section. Unknown routes are checked against the bare path,
+// as the middleware does without a router.
+func (h *AuthzHandler) resolve(section, method, path string) (string, map[string]string) {
+	rctx := chi.NewRouteContext()
+	if h.routes == nil || !h.routes.Router(section).Match(rctx, strings.ToUpper(method), path) {
+		return path, map[string]string{}
+	}
+	params := make(map[string]string)
+	for i, key := range rctx.URLParams.Keys {
+		if key != "*" {
+			params[key] = rctx.URLParams.Values[i]
+		}
+	}
+	return rctx.RoutePattern(), params
+}
+
+func (h *AuthzHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/authz/check", h.Check)
+}
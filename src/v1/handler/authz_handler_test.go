@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAuthzCheck(t *testing.T) {
+	// The organization middleware scopes the request in production
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+
+	role := &entity.Role{Name: "user"}
+	roles.Create(ctx, role)
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(role.ID), Section: "be", Route: "/users/user/{user_id}", RRead: true, Condition: "own"})
+
+	sections := NewSections()
+	authzHandler := NewAuthzHandler(service.NewAuthzService(authz.NewRoleRightsAuthorizer(roleRights), users, roles, memory.NewGroupRepository(store)), sections)
+	sections.Mount("be", func(r chi.Router) {
+		authzHandler.RegisterRoutes(r)
+		NewUserHandler(service.NewUserService(users, memory.NewRedisRepository())).RegisterRoutes(r)
+	})
+	// fe only serves the authz check
+	sections.Mount("fe", authzHandler.RegisterRoutes)
+	r := chi.NewRouter()
+	r.Mount("/", sections)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantRoute  string
+		wantReason string
+	}{
+		{"resolves the route pattern", `{"role":"user","section":"be","method":"GET","path":"/users/user/7"}`, http.StatusOK, "/users/user/{user_id}", authz.ReasonConditionPending},
+		{"unknown route falls back to the path", `{"role":"user","section":"be","method":"GET","path":"/nope"}`, http.StatusOK, "/nope", authz.ReasonNoMatchingRule},
+		{"resolves in the checked section", `{"role":"user","section":"fe","method":"GET","path":"/users/user/7"}`, http.StatusOK, "/users/user/7", authz.ReasonNoMatchingRule},
+		{"missing subject", `{"section":"be","method":"GET","path":"/users/user"}`, http.StatusBadRequest, "", ""},
+		{"unknown role", `{"role":"ghost","section":"be","method":"GET","path":"/users/user"}`, http.StatusNotFound, "", ""},
+		{"bad body", `{`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/authz/check", strings.NewReader(tt.body)).WithContext(ctx)
+			req.Header.Set("section", "be")
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp contract.AuthzCheckResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data.Route != tt.wantRoute || resp.Data.Reason != tt.wantReason {
+				t.Errorf("result = %+v, want route %s reason %s", resp.Data, tt.wantRoute, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// federatedStateCookie binds a federated login to the browser that started
+// it, so a callback link cannot log someone else in.
+const federatedStateCookie = "federated_state"
+
+type FederationHandler struct {
+	federationService *service.FederationService
+}
+
+func NewFederationHandler(federationService *service.FederationService) *FederationHandler {
+	return &FederationHandler{federationService: federationService}
+}
+
+func (h *FederationHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.federationService.GetProviders(r.Context()))
+}
+
+// Login sends the browser to the identity provider.
+func (h *FederationHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	start, err := h.federationService.Start(r.Context(), provider)
+	if err != nil {
+		writeFederationError(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     federatedStateCookie,
+		Value:    start.State,
+		Path:     "/auth/federated/" + provider,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		// Lax, the provider sends the user back with a top level GET
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, start.URL, http.StatusFound)
+}
+
+// Callback completes the login the identity provider sent the user back
+// from and answers like POST /auth/login.
+func (h *FederationHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	var browserState string
+	if cookie, err := r.Cookie(federatedStateCookie); err == nil {
+		browserState = cookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     federatedStateCookie,
+		Path:     "/auth/federated/" + provider,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	query := r.URL.Query()
+	response, err := h.federationService.Callback(r.Context(), provider, browserState, &contract.FederatedCallback{
+		State:            query.Get("state"),
+		Code:             query.Get("code"),
+		Error:            query.Get("error"),
+		ErrorDescription: query.Get("error_description"),
+	})
+	if err != nil {
+		writeFederationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeFederationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownIdentityProvider):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidFederatedLogin):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrFederatedLoginFailed), errors.Is(err, service.ErrUserDisabled):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, service.ErrUnverifiedEmail):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error in federated login: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// RegisterRoutes registers the public login routes.
+func (h *FederationHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/auth/federated", h.GetProviders)
+	r.Get("/auth/federated/{provider}/login", h.Login)
+	r.Get("/auth/federated/{provider}/callback", h.Callback)
+}
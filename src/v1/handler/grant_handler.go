@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type GrantHandler struct {
+	grantService *service.GrantService
+}
+
+func NewGrantHandler(grantService *service.GrantService) *GrantHandler {
+	return &GrantHandler{grantService: grantService}
+}
+
+func (h *GrantHandler) RequestGrant(w http.ResponseWriter, r *http.Request) {
+	var req contract.RoleGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.grantService.Request(r.Context(), &req)
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GrantHandler) GetGrants(w http.ResponseWriter, r *http.Request) {
+	response, err := h.grantService.GetGrants(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GrantHandler) GetGrant(w http.ResponseWriter, r *http.Request) {
+	h.withGrant(w, r, h.grantService.GetGrant)
+}
+
+func (h *GrantHandler) ApproveGrant(w http.ResponseWriter, r *http.Request) {
+	h.withGrant(w, r, h.grantService.Approve)
+}
+
+func (h *GrantHandler) RejectGrant(w http.ResponseWriter, r *http.Request) {
+	h.withGrant(w, r, h.grantService.Reject)
+}
+
+func (h *GrantHandler) RevokeGrant(w http.ResponseWriter, r *http.Request) {
+	h.withGrant(w, r, h.grantService.Revoke)
+}
+
+// withGrant calls fn with the grant ID from the URL and writes its result.
+func (h *GrantHandler) withGrant(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, id int64) (*contract.RoleGrantResponse, error)) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "grant_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := fn(r.Context(), id)
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeGrantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidGrant):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrGrantConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrSelfApproval):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Grant, user or role not found", http.StatusNotFound)
+	default:
+		writeServiceError(w, err)
+	}
+}
+
+func (h *GrantHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/grants", h.RequestGrant)
+	r.Get("/grants", h.GetGrants)
+	r.Get("/grants/{grant_id}", h.GetGrant)
+	r.Post("/grants/{grant_id}/approve", h.ApproveGrant)
+	r.Post("/grants/{grant_id}/reject", h.RejectGrant)
+	r.Post("/grants/{grant_id}/revoke", h.RevokeGrant)
+}
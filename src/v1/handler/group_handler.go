@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type GroupHandler struct {
+	groupService *service.GroupService
+}
+
+func NewGroupHandler(groupService *service.GroupService) *GroupHandler {
+	return &GroupHandler{groupService: groupService}
+}
+
+func (h *GroupHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	response, err := h.groupService.GetGroups(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	response, err := h.groupService.GetGroup(r.Context(), chi.URLParam(r, "group_id"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req contract.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.CreateGroup(r.Context(), &req)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var req contract.UpdateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.UpdateGroup(r.Context(), chi.URLParam(r, "group_id"), &req)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	response, err := h.groupService.DeleteGroup(r.Context(), chi.URLParam(r, "group_id"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(chi.URLParam(r, "group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.GetMembers(r.Context(), groupID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(chi.URLParam(r, "group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contract.GroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.AddMember(r.Context(), groupID, &req)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(chi.URLParam(r, "group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.RemoveMember(r.Context(), groupID, userID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(chi.URLParam(r, "group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contract.GroupRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.AssignRole(r.Context(), groupID, &req)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) UnassignRole(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(chi.URLParam(r, "group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	roleID, err := strconv.Atoi(chi.URLParam(r, "role_id"))
+	if err != nil {
+		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.groupService.UnassignRole(r.Context(), groupID, roleID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *GroupHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/groups", h.GetGroups)
+	r.Post("/groups", h.CreateGroup)
+	r.Get("/groups/{group_id}", h.GetGroup)
+	r.Put("/groups/{group_id}", h.UpdateGroup)
+	r.Delete("/groups/{group_id}", h.DeleteGroup)
+	r.Get("/groups/{group_id}/members", h.GetMembers)
+	r.Post("/groups/{group_id}/members", h.AddMember)
+	r.Delete("/groups/{group_id}/members/{user_id}", h.RemoveMember)
+	r.Post("/groups/{group_id}/roles", h.AssignRole)
+	r.Delete("/groups/{group_id}/roles/{role_id}", h.UnassignRole)
+}
+
+// writeGroupError answers 400 for a bad group, parent, user or role, 404 for
+// one that does not exist in the organization, 409 for a duplicate name and
+// falls back to writeServiceError.
+func writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidGroup), errors.Is(err, entity.ErrGroupCycle), errors.Is(err, strconv.ErrSyntax):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrGroupExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Group, user or role not found", http.StatusNotFound)
+	default:
+		writeServiceError(w, err)
+	}
+}
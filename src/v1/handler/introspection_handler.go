@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type IntrospectionHandler struct {
+	introspectionService *service.IntrospectionService
+}
+
+func NewIntrospectionHandler(introspectionService *service.IntrospectionService) *IntrospectionHandler {
+	return &IntrospectionHandler{introspectionService: introspectionService}
+}
+
+// Introspect is the RFC 7662 introspection endpoint. The client
+// authenticates like at the token endpoint.
+func (h *IntrospectionHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.ErrInvalidRequest)
+		return
+	}
+	clientID, secret := clientCredentials(r)
+
+	response, err := h.introspectionService.Introspect(r.Context(), clientID, secret, r.PostForm.Get("token"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Revoke is the RFC 7009 revocation endpoint. It answers 200 with an
+// empty body, also for tokens that were not active.
+func (h *IntrospectionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.ErrInvalidRequest)
+		return
+	}
+	clientID, secret := clientCredentials(r)
+
+	if err := h.introspectionService.Revoke(r.Context(), clientID, secret, r.PostForm.Get("token")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RegisterRoutes registers the introspection and revocation endpoints,
+// which are public: the client authenticates with its secret.
+func (h *IntrospectionHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/oauth/introspect", h.Introspect)
+	r.Post("/oauth/revoke", h.Revoke)
+}
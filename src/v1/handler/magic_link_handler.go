@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MagicLinkHandler struct {
+	magicLinkService *service.MagicLinkService
+}
+
+func NewMagicLinkHandler(magicLinkService *service.MagicLinkService) *MagicLinkHandler {
+	return &MagicLinkHandler{magicLinkService: magicLinkService}
+}
+
+func (h *MagicLinkHandler) Send(w http.ResponseWriter, r *http.Request) {
+	var req contract.MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Organization == "" {
+		req.Organization = r.Header.Get(tenant.Header)
+	}
+
+	response, err := h.magicLinkService.Send(r.Context(), &req)
+	if errors.Is(err, service.ErrUnknownOrganization) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MagicLinkHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req contract.MagicLinkLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.magicLinkService.Login(r.Context(), &req)
+	if errors.Is(err, service.ErrInvalidMagicLink) || errors.Is(err, service.ErrUserDisabled) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MagicLinkHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/auth/magic-link", h.Send)
+	r.Post("/auth/magic-link/verify", h.Login)
+}
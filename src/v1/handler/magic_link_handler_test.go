@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/mail"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// lastLink keeps the link of the last message sent.
+type lastLink struct{ token string }
+
+func (l *lastLink) Send(ctx context.Context, msg mail.Message) error {
+	link, err := url.Parse(strings.Fields(msg.Body[strings.Index(msg.Body, "http"):])[0])
+	if err != nil {
+		return err
+	}
+	l.token = link.Query().Get("token")
+	return nil
+}
+
+// brokenRedis fails to redeem magic links, as an unreachable Redis would.
+type brokenRedis struct {
+	repository.RedisRepository
+}
+
+func (brokenRedis) TakeMagicLink(ctx context.Context, id string) (*entity.MagicLink, error) {
+	return nil, errors.New("redis: connection refused")
+}
+
+func TestMagicLinkLoginErrors(t *testing.T) {
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	orgs := memory.NewOrganizationRepository(store)
+	groups := memory.NewGroupRepository(store)
+	org := &entity.Organization{Slug: "acme", Name: "Acme"}
+	if err := orgs.Create(context.Background(), org); err != nil {
+		t.Fatal(err)
+	}
+	ctx := tenant.WithOrganization(context.Background(), org.ID)
+	reader := &entity.Role{Name: "reader", MagicLink: true}
+	if err := memory.NewRoleRepository(store).Create(ctx, reader); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(ctx, &entity.User{Roles: []entity.Role{*reader}, Name: "Bob", Email: "bob@acme.com", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(redis repository.RedisRepository, token string) int {
+		t.Helper()
+		auth := service.NewAuthService(users, orgs, groups, redis, authn.NewLocalAuthenticator(users))
+		var sent lastLink
+		svc := service.NewMagicLinkService(users, orgs, groups, redis, auth, &sent, []byte(strings.Repeat("k", 32)), "https://app.example.com/login", 15*time.Minute)
+		if token == "" {
+			if _, err := svc.Send(context.Background(), &contract.MagicLinkRequest{Organization: "acme", Email: "bob@acme.com"}); err != nil {
+				t.Fatal(err)
+			}
+			token = sent.token
+		}
+		r := chi.NewRouter()
+		NewMagicLinkHandler(svc).RegisterRoutes(r)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/magic-link/verify", strings.NewReader(`{"token":"`+token+`"}`)))
+		return rec.Code
+	}
+
+	if code := serve(memory.NewRedisRepository(), "forged.token"); code != http.StatusUnauthorized {
+		t.Errorf("invalid link status = %d, want 401", code)
+	}
+	if code := serve(memory.NewRedisRepository(), ""); code != http.StatusOK {
+		t.Errorf("valid link status = %d, want 200", code)
+	}
+	// A server fault is not the caller's fault
+	if code := serve(brokenRedis{memory.NewRedisRepository()}, ""); code != http.StatusInternalServerError {
+		t.Errorf("status with Redis down = %d, want 500", code)
+	}
+}
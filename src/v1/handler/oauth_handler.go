@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type OAuthHandler struct {
+	oauthService *service.OAuthService
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService) *OAuthHandler {
+	return &OAuthHandler{oauthService: oauthService}
+}
+
+// Token is the RFC 6749 token endpoint. The client authenticates with HTTP
+// Basic or with client_id and client_secret in the form.
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.ErrInvalidRequest)
+		return
+	}
+	clientID, secret := clientCredentials(r)
+
+	response, err := h.oauthService.Token(r.Context(), r.PostForm.Get("grant_type"), clientID, secret, r.PostForm.Get("scope"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// clientCredentials returns the client_id and secret of a parsed form
+// request, sent with HTTP Basic or in the form.
+func clientCredentials(r *http.Request) (string, string) {
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	return clientID, secret
+}
+
+// writeOAuthError answers with the RFC 6749 error body, the code being the
+// sentinel's text and the description whatever was wrapped around it.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var code error
+	status := http.StatusBadRequest
+	for _, sentinel := range []error{service.ErrInvalidRequest, service.ErrInvalidClient, service.ErrUnsupportedGrantType, service.ErrInvalidScope, service.ErrInvalidAuthorizationCode, service.ErrUnsupportedTokenType} {
+		if errors.Is(err, sentinel) {
+			code = sentinel
+		}
+	}
+	if code == nil {
+		log.Printf("Error serving OAuth request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if code == service.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		status = http.StatusUnauthorized
+	}
+
+	description := strings.TrimPrefix(strings.TrimPrefix(err.Error(), code.Error()), ": ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(contract.OAuthError{Error: code.Error(), ErrorDescription: description})
+}
+
+func (h *OAuthHandler) GetClients(w http.ResponseWriter, r *http.Request) {
+	response, err := h.oauthService.GetClients(r.Context())
+	if err != nil {
+		writeOAuthClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OAuthHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var req contract.CreateOAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.oauthService.CreateClient(r.Context(), &req)
+	if err != nil {
+		writeOAuthClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OAuthHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	response, err := h.oauthService.DeleteClient(r.Context(), chi.URLParam(r, "client_id"))
+	if err != nil {
+		writeOAuthClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeOAuthClientError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidOAuthClient):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Client not found", http.StatusNotFound)
+	default:
+		writeServiceError(w, err)
+	}
+}
+
+// RegisterTokenRoutes registers the token endpoint, which is public: the
+// client authenticates with its secret.
+func (h *OAuthHandler) RegisterTokenRoutes(r chi.Router) {
+	r.Post("/oauth/token", h.Token)
+}
+
+func (h *OAuthHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/oauth/clients", h.GetClients)
+	r.Post("/oauth/clients", h.CreateClient)
+	r.Delete("/oauth/clients/{client_id}", h.DeleteClient)
+}
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type OIDCHandler struct {
+	oidcService *service.OIDCService
+}
+
+func NewOIDCHandler(oidcService *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService}
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.Client}}</title></head>
+<body>
+<h1>Sign in to {{.Client}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oidc/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>Email <input type="email" name="email" value="{{.Email}}" required autofocus></label>
+<label>Password <input type="password" name="password" required></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Allow {{.Client}}</title></head>
+<body>
+<h1>{{.Client}} would like to access your account</h1>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="/oidc/consent">
+<input type="hidden" name="ticket" value="{{.Ticket}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+func (h *OIDCHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.oidcService.Discovery())
+}
+
+func (h *OIDCHandler) KeySet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.oidcService.KeySet())
+}
+
+func authorizeRequest(values map[string][]string) *contract.AuthorizeRequest {
+	get := func(key string) string {
+		if v := values[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	return &contract.AuthorizeRequest{
+		ResponseType:        get("response_type"),
+		ClientID:            get("client_id"),
+		RedirectURI:         get("redirect_uri"),
+		Scope:               get("scope"),
+		State:               get("state"),
+		Nonce:               get("nonce"),
+		CodeChallenge:       get("code_challenge"),
+		CodeChallengeMethod: get("code_challenge_method"),
+	}
+}
+
+// authorizeParams returns the parameters of req the login form posts back.
+func authorizeParams(req *contract.AuthorizeRequest) map[string]string {
+	return map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	}
+}
+
+// Authorize shows the login form of an authorization request.
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest(r.URL.Query())
+	client, err := h.oidcService.CheckAuthorization(r.Context(), req)
+	if err != nil {
+		h.writeAuthorizeError(w, r, req, err)
+		return
+	}
+	renderPage(w, http.StatusOK, loginPage, map[string]interface{}{
+		"Client": client.Name,
+		"Params": authorizeParams(req),
+	})
+}
+
+// Login checks the credentials posted by the login form, then sends the
+// user back to the client or asks for their consent.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	req := authorizeRequest(r.PostForm)
+	email := r.PostForm.Get("email")
+
+	authorization, err := h.oidcService.Login(r.Context(), req, email, r.PostForm.Get("password"))
+	if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrUserDisabled) {
+		client, checkErr := h.oidcService.CheckAuthorization(r.Context(), req)
+		if checkErr != nil {
+			h.writeAuthorizeError(w, r, req, checkErr)
+			return
+		}
+		renderPage(w, http.StatusUnauthorized, loginPage, map[string]interface{}{
+			"Client": client.Name,
+			"Params": authorizeParams(req),
+			"Email":  email,
+			"Error":  err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		h.writeAuthorizeError(w, r, req, err)
+		return
+	}
+
+	if authorization.Redirect != "" {
+		http.Redirect(w, r, authorization.Redirect, http.StatusFound)
+		return
+	}
+	renderPage(w, http.StatusOK, consentPage, map[string]interface{}{
+		"Client": authorization.Client.Name,
+		"Scopes": authorization.Scopes,
+		"Ticket": authorization.Ticket,
+	})
+}
+
+// Consent records the decision posted by the consent form.
+func (h *OIDCHandler) Consent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	redirect, err := h.oidcService.Consent(r.Context(), r.PostForm.Get("ticket"), r.PostForm.Get("decision") == "allow")
+	if err != nil {
+		h.writeAuthorizeError(w, r, nil, err)
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// writeAuthorizeError shows ErrInvalidRedirect to the user and sends other
+// request errors back to the client.
+func (h *OIDCHandler) writeAuthorizeError(w http.ResponseWriter, r *http.Request, req *contract.AuthorizeRequest, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRedirect):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case req != nil && (errors.Is(err, service.ErrInvalidRequest) || errors.Is(err, service.ErrUnsupportedResponseType) || errors.Is(err, service.ErrInvalidScope)):
+		http.Redirect(w, r, service.ErrorRedirect(req, err), http.StatusFound)
+	default:
+		log.Printf("Error authorizing OIDC request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func renderPage(w http.ResponseWriter, status int, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The pages take credentials and consent, keep them out of frames
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := page.Execute(w, data); err != nil {
+		log.Printf("Error rendering %s page: %v", page.Name(), err)
+	}
+}
+
+// Token is the token endpoint of the authorization code flow.
+func (h *OIDCHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.ErrInvalidRequest)
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	response, err := h.oidcService.Exchange(r.Context(), &contract.OIDCTokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     clientID,
+		ClientSecret: secret,
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UserInfo returns the claims of the user an access token was issued for.
+func (h *OIDCHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oidc"`)
+		http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.oidcService.UserInfo(r.Context(), token)
+	if errors.Is(err, service.ErrInvalidAccessToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oidc", error="invalid_token"`)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claims)
+}
+
+func (h *OIDCHandler) GetClients(w http.ResponseWriter, r *http.Request) {
+	response, err := h.oidcService.GetClients(r.Context())
+	if err != nil {
+		writeOIDCClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OIDCHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var req contract.CreateOIDCClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.oidcService.CreateClient(r.Context(), &req)
+	if err != nil {
+		writeOIDCClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OIDCHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	response, err := h.oidcService.DeleteClient(r.Context(), chi.URLParam(r, "client_id"))
+	if err != nil {
+		writeOIDCClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeOIDCClientError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidOIDCClient):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Client not found", http.StatusNotFound)
+	default:
+		writeServiceError(w, err)
+	}
+}
+
+// RegisterProviderRoutes registers the public endpoints of the provider,
+// the ones relying parties and browsers talk to.
+func (h *OIDCHandler) RegisterProviderRoutes(r chi.Router) {
+	r.Get("/.well-known/openid-configuration", h.Discovery)
+	r.Get("/jwks.json", h.KeySet)
+	r.Get("/oidc/authorize", h.Authorize)
+	r.Post("/oidc/authorize", h.Login)
+	r.Post("/oidc/consent", h.Consent)
+	r.Post("/oidc/token", h.Token)
+	r.Get("/oidc/userinfo", h.UserInfo)
+	r.Post("/oidc/userinfo", h.UserInfo)
+}
+
+func (h *OIDCHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/oidc/clients", h.GetClients)
+	r.Post("/oidc/clients", h.CreateClient)
+	r.Delete("/oidc/clients/{client_id}", h.DeleteClient)
+}
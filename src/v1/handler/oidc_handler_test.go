@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/jwt"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const callback = "http://localhost:9090/callback"
+
+// TestOIDCFlow plays a relying party through the authorization code flow
+// with PKCE, using only what a standard OIDC library would: discovery,
+// the key set and the endpoints they name.
+func TestOIDCFlow(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	groups := memory.NewGroupRepository(store)
+	redis := memory.NewRedisRepository()
+	clients := memory.NewOIDCClientRepository(store)
+
+	role := &entity.Role{Name: "admin"}
+	roles.Create(ctx, role)
+	user := &entity.User{Roles: []entity.Role{*role}, Name: "Jane", Email: "jane@gmail.com", Password: "secret"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	var router http.Handler
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { router.ServeHTTP(w, r) }))
+	defer provider.Close()
+
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authService := service.NewAuthService(users, memory.NewOrganizationRepository(store), groups, redis, authn.NewLocalAuthenticator(users))
+	oidcService := service.NewOIDCService(clients, users, groups, redis, authService, jwt.NewSigner(key), provider.URL, time.Hour)
+	r := chi.NewRouter()
+	NewOIDCHandler(oidcService).RegisterProviderRoutes(r)
+	router = r
+
+	resp, err := oidcService.CreateClient(tenant.WithOrganization(ctx, 1), &contract.CreateOIDCClientRequest{Name: "Wiki", RedirectURIs: []string{callback}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := resp.Data.(contract.CreatedOIDCClient)
+
+	// The relying party reads the redirects itself
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	var discovery contract.OIDCDiscovery
+	getJSON(t, provider.URL+"/.well-known/openid-configuration", "", &discovery)
+	if discovery.Issuer != provider.URL || discovery.JWKSURI != provider.URL+"/jwks.json" {
+		t.Fatalf("discovery = %+v", discovery)
+	}
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {callback},
+		"scope":                 {"openid profile email roles"},
+		"state":                 {"af0ifjsldkj"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	page := send(t, browser, http.MethodGet, discovery.AuthorizationEndpoint+"?"+params.Encode(), nil, http.StatusOK)
+	if !strings.Contains(page, "Sign in to Wiki") {
+		t.Fatalf("login page = %s", page)
+	}
+
+	login := url.Values{"email": {"jane@gmail.com"}, "password": {"wrong"}}
+	for k, v := range params {
+		login[k] = v
+	}
+	send(t, browser, http.MethodPost, discovery.AuthorizationEndpoint, login, http.StatusUnauthorized)
+
+	login.Set("password", "secret")
+	page = send(t, browser, http.MethodPost, discovery.AuthorizationEndpoint, login, http.StatusOK)
+	ticket := regexp.MustCompile(`name="ticket" value="([^"]+)"`).FindStringSubmatch(page)
+	if ticket == nil {
+		t.Fatalf("consent page = %s", page)
+	}
+
+	code := redirectCode(t, send(t, browser, http.MethodPost, provider.URL+"/oidc/consent", url.Values{"ticket": {ticket[1]}, "decision": {"allow"}}, http.StatusFound))
+
+	exchange := url.Values{
+		"grant_type":    {service.GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {callback},
+		"code_verifier": {verifier},
+	}
+	req, _ := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(exchange.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens contract.OIDCTokenResponse
+	json.NewDecoder(res.Body).Decode(&tokens)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		t.Fatalf("token response %d: %+v", res.StatusCode, tokens)
+	}
+
+	var keys jwt.KeySet
+	getJSON(t, discovery.JWKSURI, "", &keys)
+	claims := verifyIDToken(t, keys, tokens.IDToken)
+	if claims["iss"] != provider.URL || claims["aud"] != client.ClientID || claims["nonce"] != "n-0S6_WzA2Mj" || claims["email"] != "jane@gmail.com" {
+		t.Errorf("id token claims = %v", claims)
+	}
+
+	var info map[string]interface{}
+	getJSON(t, discovery.UserinfoEndpoint, tokens.AccessToken, &info)
+	if info["name"] != "Jane" || info["email"] != "jane@gmail.com" || !onlyRole(info["roles"], "admin") {
+		t.Errorf("userinfo = %v", info)
+	}
+
+	// A code is redeemed once
+	req, _ = http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(exchange.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var oauthErr contract.OAuthError
+	json.NewDecoder(res.Body).Decode(&oauthErr)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Errorf("second exchange = %d %+v, want invalid_grant", res.StatusCode, oauthErr)
+	}
+
+	// Having consented, the next login goes straight back to the client
+	redirectCode(t, send(t, browser, http.MethodPost, discovery.AuthorizationEndpoint, login, http.StatusFound))
+
+	// An unregistered redirect_uri is never redirected to
+	params.Set("redirect_uri", "https://evil.example/callback")
+	send(t, browser, http.MethodGet, discovery.AuthorizationEndpoint+"?"+params.Encode(), nil, http.StatusBadRequest)
+}
+
+// send makes a request, form encoded when form is set, and returns the
+// body, or the Location of a redirect.
+func send(t *testing.T, c *http.Client, method, target string, form url.Values, want int) string {
+	t.Helper()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, _ := http.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != want {
+		t.Fatalf("%s %s = %d, want %d: %s", method, target, res.StatusCode, want, data)
+	}
+	if res.StatusCode == http.StatusFound {
+		return res.Header.Get("Location")
+	}
+	return string(data)
+}
+
+func redirectCode(t *testing.T, location string) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, callback+"?") {
+		t.Fatalf("redirect = %q, want %s", location, callback)
+	}
+	if u.Query().Get("state") != "af0ifjsldkj" || u.Query().Get("code") == "" {
+		t.Fatalf("redirect = %q, want a code and the state", location)
+	}
+	return u.Query().Get("code")
+}
+
+func getJSON(t *testing.T, target, bearer string, v interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d", target, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyIDToken checks the signature against the published key set, as a
+// relying party does.
+func verifyIDToken(t *testing.T, keys jwt.KeySet, token string) map[string]interface{} {
+	t.Helper()
+	if len(keys.Keys) != 1 {
+		t.Fatalf("key set = %+v", keys)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(keys.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(keys.Keys[0].E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	parts := strings.Split(token, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("id token signature: %v", err)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	json.Unmarshal(payload, &claims)
+	return claims
+}
+
+func onlyRole(v interface{}, want string) bool {
+	roles, ok := v.([]interface{})
+	return ok && len(roles) == 1 && roles[0] == want
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"test-tablelink/src/entity"
 	"test-tablelink/src/v1/contract"
 	"test-tablelink/src/v1/service"
 
@@ -43,6 +45,10 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response, err := h.roleService.CreateRole(r.Context(), &req)
+	if errors.Is(err, entity.ErrCrossOrganization) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -66,8 +72,12 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response, err := h.roleService.UpdateRole(r.Context(), roleID, &req)
+	if errors.Is(err, entity.ErrRoleCycle) || errors.Is(err, entity.ErrCrossOrganization) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, err)
 		return
 	}
 
@@ -83,6 +93,23 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response, err := h.roleService.DeleteRole(r.Context(), roleID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *RoleHandler) GetEffectiveRights(w http.ResponseWriter, r *http.Request) {
+	roleID := chi.URLParam(r, "id")
+	if roleID == "" {
+		http.Error(w, "Role ID is required", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.roleService.GetEffectiveRights(r.Context(), roleID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -94,6 +121,7 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 
 func (h *RoleHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/roles/{id}", h.GetRole)
+	r.Get("/roles/{id}/rights", h.GetEffectiveRights)
 	r.Post("/roles", h.CreateRole)
 	r.Put("/roles/{id}", h.UpdateRole)
 	r.Delete("/roles/{id}", h.DeleteRole)
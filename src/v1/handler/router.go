@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+
+	"test-tablelink/src/v1/scim"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Handlers are the handlers and middlewares NewRouter serves.
+type Handlers struct {
+	Auth          *AuthHandler
+	User          *UserHandler
+	Role          *RoleHandler
+	Grant         *GrantHandler
+	Section       *SectionHandler
+	Organization  *OrganizationHandler
+	Group         *GroupHandler
+	APIToken      *APITokenHandler
+	OAuth         *OAuthHandler
+	OIDC          *OIDCHandler
+	Introspection *IntrospectionHandler
+	Federation    *FederationHandler
+	SCIM          *SCIMHandler
+	Impersonation *ImpersonationHandler
+	MagicLink     *MagicLinkHandler
+	AuthzService  *service.AuthzService
+
+	// Authenticate and Authorize guard the routes of the sections,
+	// SCIMAuthenticate the SCIM endpoints
+	Authenticate     func(http.Handler) http.Handler
+	Authorize        func(http.Handler) http.Handler
+	SCIMAuthenticate func(http.Handler) http.Handler
+}
+
+// NewRouter serves the public routes, the SCIM endpoints and the protected
+// routes of each section listed below. The end-user apps, fe and mobile,
+// only get the routes of their own user, partner integrations the user and
+// group routes, and be all of them. Any other section is answered with 404,
+// also once it is registered, until it is added here.
+func NewRouter(h *Handlers) http.Handler {
+	sections := NewSections()
+	authz := NewAuthzHandler(h.AuthzService, sections)
+	protected := func(routes ...func(r chi.Router)) func(r chi.Router) {
+		return func(r chi.Router) {
+			r.Use(h.Authenticate)
+			r.Use(h.Authorize)
+			authz.RegisterRoutes(r)
+			for _, register := range routes {
+				register(r)
+			}
+		}
+	}
+	endUser := []func(r chi.Router){h.User.RegisterRoutes, h.Grant.RegisterRoutes, h.APIToken.RegisterRoutes}
+	routes := map[string][]func(r chi.Router){
+		"be": {
+			h.User.RegisterRoutes,
+			h.Role.RegisterRoutes,
+			h.Grant.RegisterRoutes,
+			h.Section.RegisterRoutes,
+			h.Organization.RegisterRoutes,
+			h.Group.RegisterRoutes,
+			h.APIToken.RegisterRoutes,
+			h.OAuth.RegisterRoutes,
+			h.OIDC.RegisterRoutes,
+			h.SCIM.RegisterRoutes,
+			h.Impersonation.RegisterRoutes,
+		},
+		"fe":      endUser,
+		"mobile":  endUser,
+		"partner": {h.User.RegisterRoutes, h.Group.RegisterRoutes},
+	}
+	for section, register := range routes {
+		sections.Mount(section, protected(register...))
+	}
+
+	r := chi.NewRouter()
+
+	// Public routes
+	r.Group(func(r chi.Router) {
+		h.Auth.RegisterRoutes(r)
+		h.MagicLink.RegisterRoutes(r)
+		h.OAuth.RegisterTokenRoutes(r)
+		h.Introspection.RegisterRoutes(r)
+		h.OIDC.RegisterProviderRoutes(r)
+		h.Federation.RegisterRoutes(r)
+	})
+
+	// SCIM provisioning, authenticated with SCIM tokens only
+	r.Route(scim.BasePath, func(r chi.Router) {
+		r.Use(h.SCIMAuthenticate)
+		h.SCIM.RegisterSCIMRoutes(r)
+	})
+	r.Mount("/", sections)
+	return r
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewRouter(t *testing.T) {
+	pass := func(next http.Handler) http.Handler { return next }
+	// Authorize answers with the matched route instead of calling the
+	// handlers, which have no services here
+	r := NewRouter(&Handlers{
+		Authenticate: pass,
+		Authorize: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(chi.RouteContext(r.Context()).RoutePattern()))
+			})
+		},
+		SCIMAuthenticate: pass,
+	})
+
+	tests := []struct {
+		section  string
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"be", http.MethodGet, "/roles/7", http.StatusOK, "/roles/{id}"},
+		{"be", http.MethodGet, "/groups/3", http.StatusOK, "/groups/{group_id}"},
+		// A section without routes of its own is served nothing
+		{"crm", http.MethodGet, "/roles/7", http.StatusNotFound, ""},
+		{"crm", http.MethodPost, "/authz/check", http.StatusNotFound, ""},
+		{"fe", http.MethodGet, "/users/user/7", http.StatusOK, "/users/user/{user_id}"},
+		{"fe", http.MethodPost, "/authz/check", http.StatusOK, "/authz/check"},
+		{"fe", http.MethodGet, "/roles/7", http.StatusNotFound, ""},
+		{"mobile", http.MethodGet, "/me/tokens", http.StatusOK, "/me/tokens"},
+		{"mobile", http.MethodPost, "/organizations", http.StatusNotFound, ""},
+		{"partner", http.MethodGet, "/groups/3", http.StatusOK, "/groups/{group_id}"},
+		{"partner", http.MethodGet, "/grants", http.StatusNotFound, ""},
+		// Public routes ignore the section
+		{"fe", http.MethodGet, "/auth/login", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("section", tt.section)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode || (tt.wantBody != "" && rec.Body.String() != tt.wantBody) {
+			t.Errorf("%s %s %s = %d %q, want %d %q", tt.section, tt.method, tt.path, rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+		}
+	}
+}
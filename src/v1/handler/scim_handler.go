@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/scim"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SCIMHandler struct {
+	scimService *service.SCIMService
+}
+
+func NewSCIMHandler(scimService *service.SCIMService) *SCIMHandler {
+	return &SCIMHandler{scimService: scimService}
+}
+
+func (h *SCIMHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	response, err := h.scimService.GetTokens(r.Context())
+	if err != nil {
+		writeSCIMTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *SCIMHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req contract.CreateSCIMTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.scimService.CreateToken(r.Context(), &req)
+	if err != nil {
+		writeSCIMTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *SCIMHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "token_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.scimService.DeleteToken(r.Context(), id)
+	if err != nil {
+		writeSCIMTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeSCIMTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSCIMToken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrSCIMSessionRequired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Token not found", http.StatusNotFound)
+	default:
+		writeServiceError(w, err)
+	}
+}
+
+func (h *SCIMHandler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	scim.Write(w, http.StatusOK, scim.NewServiceProviderConfig())
+}
+
+func (h *SCIMHandler) ResourceTypes(w http.ResponseWriter, r *http.Request) {
+	types := scim.ResourceTypes()
+	scim.Write(w, http.StatusOK, &scim.ListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: len(types),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+func (h *SCIMHandler) ResourceType(w http.ResponseWriter, r *http.Request) {
+	for _, t := range scim.ResourceTypes() {
+		if t.ID == chi.URLParam(r, "id") {
+			scim.Write(w, http.StatusOK, t)
+			return
+		}
+	}
+	writeSCIMError(w, sql.ErrNoRows)
+}
+
+func (h *SCIMHandler) Schemas(w http.ResponseWriter, r *http.Request) {
+	schemas := scim.Schemas()
+	scim.Write(w, http.StatusOK, &scim.ListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: len(schemas),
+		StartIndex:   1,
+		ItemsPerPage: len(schemas),
+		Resources:    schemas,
+	})
+}
+
+func (h *SCIMHandler) Schema(w http.ResponseWriter, r *http.Request) {
+	for _, s := range scim.Schemas() {
+		if s.ID == chi.URLParam(r, "id") {
+			scim.Write(w, http.StatusOK, s)
+			return
+		}
+	}
+	writeSCIMError(w, sql.ErrNoRows)
+}
+
+func (h *SCIMHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	q, err := scim.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	list, err := h.scimService.ListUsers(r.Context(), q)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.scimService.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var resource scim.User
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	user, err := h.scimService.CreateUser(r.Context(), &resource)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	w.Header().Set("Location", user.Meta.Location)
+	scim.Write(w, http.StatusCreated, user)
+}
+
+func (h *SCIMHandler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var resource scim.User
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	user, err := h.scimService.ReplaceUser(r.Context(), chi.URLParam(r, "id"), &resource)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	var req scim.PatchRequest
+	if !decodeSCIM(w, r, &req) {
+		return
+	}
+	user, err := h.scimService.PatchUser(r.Context(), chi.URLParam(r, "id"), &req)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.scimService.DeleteUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	q, err := scim.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	list, err := h.scimService.ListGroups(r.Context(), q)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.scimService.GetGroup(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var resource scim.Group
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	group, err := h.scimService.CreateGroup(r.Context(), &resource)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	w.Header().Set("Location", group.Meta.Location)
+	scim.Write(w, http.StatusCreated, group)
+}
+
+func (h *SCIMHandler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var resource scim.Group
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	group, err := h.scimService.ReplaceGroup(r.Context(), chi.URLParam(r, "id"), &resource)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var req scim.PatchRequest
+	if !decodeSCIM(w, r, &req) {
+		return
+	}
+	group, err := h.scimService.PatchGroup(r.Context(), chi.URLParam(r, "id"), &req)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	scim.Write(w, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.scimService.DeleteGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeSCIM reads the request body into v, or answers with an
+// invalidSyntax error.
+func decodeSCIM(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeSCIMError(w, scim.Errorf(http.StatusBadRequest, scim.InvalidSyntax, "Invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeSCIMError(w http.ResponseWriter, err error) {
+	var scimErr *scim.Error
+	switch {
+	case errors.As(err, &scimErr):
+		scim.WriteError(w, scimErr)
+	case errors.Is(err, sql.ErrNoRows):
+		scim.WriteError(w, scim.Errorf(http.StatusNotFound, "", "Resource not found"))
+	case errors.Is(err, entity.ErrCrossOrganization):
+		scim.WriteError(w, scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "%v", err))
+	default:
+		log.Printf("SCIM request failed: %v", err)
+		scim.WriteError(w, scim.Errorf(http.StatusInternalServerError, "", "Internal server error"))
+	}
+}
+
+// RegisterRoutes registers the management of SCIM tokens, which runs like
+// any other protected route.
+func (h *SCIMHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/scim/tokens", h.GetTokens)
+	r.Post("/scim/tokens", h.CreateToken)
+	r.Delete("/scim/tokens/{token_id}", h.DeleteToken)
+}
+
+// RegisterSCIMRoutes registers the SCIM endpoints, relative to
+// scim.BasePath, behind the SCIM middleware.
+func (h *SCIMHandler) RegisterSCIMRoutes(r chi.Router) {
+	r.Get("/ServiceProviderConfig", h.ServiceProviderConfig)
+	r.Get("/ResourceTypes", h.ResourceTypes)
+	r.Get("/ResourceTypes/{id}", h.ResourceType)
+	r.Get("/Schemas", h.Schemas)
+	r.Get("/Schemas/{id}", h.Schema)
+
+	r.Get("/Users", h.ListUsers)
+	r.Post("/Users", h.CreateUser)
+	r.Get("/Users/{id}", h.GetUser)
+	r.Put("/Users/{id}", h.ReplaceUser)
+	r.Patch("/Users/{id}", h.PatchUser)
+	r.Delete("/Users/{id}", h.DeleteUser)
+
+	r.Get("/Groups", h.ListGroups)
+	r.Post("/Groups", h.CreateGroup)
+	r.Get("/Groups/{id}", h.GetGroup)
+	r.Put("/Groups/{id}", h.ReplaceGroup)
+	r.Patch("/Groups/{id}", h.PatchGroup)
+	r.Delete("/Groups/{id}", h.DeleteGroup)
+}
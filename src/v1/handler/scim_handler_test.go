@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/middleware"
+	"test-tablelink/src/v1/scim"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestSCIMEndpoints drives the SCIM endpoints the way an identity provider
+// does, through the SCIM middleware.
+func TestSCIMEndpoints(t *testing.T) {
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	store := memory.NewStore()
+	scimService := service.NewSCIMService(memory.NewSCIMTokenRepository(store), store, memory.NewUserRepository(store), memory.NewRoleRepository(store), memory.NewRedisRepository())
+	scimHandler := NewSCIMHandler(scimService)
+	r := chi.NewRouter()
+	r.Route(scim.BasePath, func(r chi.Router) {
+		r.Use(middleware.NewSCIMMiddleware(scimService).Authenticate)
+		scimHandler.RegisterSCIMRoutes(r)
+	})
+
+	resp, err := scimService.CreateToken(ctx, &contract.CreateSCIMTokenRequest{Name: "okta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := resp.Data.(contract.CreatedSCIMToken).Token
+
+	do := func(method, path, bearer, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, scim.BasePath+path, strings.NewReader(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s = %d, want %d: %s", method, path, rec.Code, want, rec.Body)
+		}
+		if rec.Code != http.StatusNoContent && rec.Header().Get("Content-Type") != scim.ContentType {
+			t.Errorf("%s %s content type = %q", method, path, rec.Header().Get("Content-Type"))
+		}
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/Users", "", "", http.StatusUnauthorized)
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("401 without WWW-Authenticate")
+	}
+	do(http.MethodGet, "/Users", "tlsc_bogus_token", "", http.StatusUnauthorized)
+
+	var config map[string]interface{}
+	json.NewDecoder(do(http.MethodGet, "/ServiceProviderConfig", token, "", http.StatusOK).Body).Decode(&config)
+	if patch, _ := config["patch"].(map[string]interface{}); patch["supported"] != true {
+		t.Errorf("config = %v, want patch supported", config)
+	}
+	do(http.MethodGet, "/ResourceTypes/User", token, "", http.StatusOK)
+	do(http.MethodGet, "/Schemas/"+scim.GroupSchema, token, "", http.StatusOK)
+	do(http.MethodGet, "/Schemas/nope", token, "", http.StatusNotFound)
+
+	rec = do(http.MethodPost, "/Users", token, `{"schemas":["`+scim.UserSchema+`"],"userName":"jane@gmail.com","name":{"givenName":"Jane"}}`, http.StatusCreated)
+	var user scim.User
+	json.NewDecoder(rec.Body).Decode(&user)
+	if rec.Header().Get("Location") != scim.BasePath+"/Users/"+user.ID {
+		t.Errorf("location = %q, user = %+v", rec.Header().Get("Location"), user)
+	}
+
+	var scimErr scim.Error
+	json.NewDecoder(do(http.MethodPost, "/Users", token, `{"userName":"jane@gmail.com"}`, http.StatusConflict).Body).Decode(&scimErr)
+	if scimErr.ScimType != scim.Uniqueness || scimErr.Status != "409" || scimErr.Schemas[0] != scim.ErrorSchema {
+		t.Errorf("error = %+v", scimErr)
+	}
+	do(http.MethodPost, "/Users", token, `{`, http.StatusBadRequest)
+	do(http.MethodGet, `/Users?filter=userName+eq`, token, "", http.StatusBadRequest)
+
+	var list struct {
+		TotalResults int         `json:"totalResults"`
+		Resources    []scim.User `json:"Resources"`
+	}
+	json.NewDecoder(do(http.MethodGet, `/Users?filter=userName+eq+%22jane@gmail.com%22`, token, "", http.StatusOK).Body).Decode(&list)
+	if list.TotalResults != 1 || list.Resources[0].ID != user.ID {
+		t.Errorf("list = %+v", list)
+	}
+
+	do(http.MethodPatch, "/Users/"+user.ID, token, `{"schemas":["`+scim.PatchOpSchema+`"],"Operations":[{"op":"replace","path":"active","value":false}]}`, http.StatusOK)
+	rec = do(http.MethodPost, "/Groups", token, `{"displayName":"engineers","members":[{"value":"`+user.ID+`"}]}`, http.StatusCreated)
+	var group scim.Group
+	json.NewDecoder(rec.Body).Decode(&group)
+	do(http.MethodDelete, "/Groups/"+group.ID, token, "", http.StatusNoContent)
+	do(http.MethodDelete, "/Users/"+user.ID, token, "", http.StatusNoContent)
+	do(http.MethodGet, "/Users/"+user.ID, token, "", http.StatusNotFound)
+}
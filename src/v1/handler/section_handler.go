@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SectionHandler struct {
+	sectionService *service.SectionService
+}
+
+func NewSectionHandler(sectionService *service.SectionService) *SectionHandler {
+	return &SectionHandler{sectionService: sectionService}
+}
+
+func (h *SectionHandler) GetSections(w http.ResponseWriter, r *http.Request) {
+	response, err := h.sectionService.GetSections(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *SectionHandler) CreateSection(w http.ResponseWriter, r *http.Request) {
+	var req contract.CreateSectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.sectionService.CreateSection(r.Context(), &req)
+	switch {
+	case errors.Is(err, service.ErrInvalidSection):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrSectionExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *SectionHandler) DeleteSection(w http.ResponseWriter, r *http.Request) {
+	response, err := h.sectionService.DeleteSection(r.Context(), chi.URLParam(r, "name"), r.Header.Get(authz.SectionHeader))
+	switch {
+	case errors.Is(err, service.ErrSectionInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Section not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *SectionHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/sections", h.GetSections)
+	r.Post("/sections", h.CreateSection)
+	r.Delete("/sections/{name}", h.DeleteSection)
+}
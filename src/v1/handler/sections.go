@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"test-tablelink/src/v1/authz"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Sections routes a request to the routes mounted for the section in its
+// section header. A section without routes of its own is answered with 404,
+// so a section registered at runtime is served nothing until it is given
+// routes. It does not check that the section is registered, the auth
+// middleware does.
+type Sections struct {
+	routers map[string]*chi.Mux
+	none    *chi.Mux
+}
+
+func NewSections() *Sections {
+	return &Sections{
+		routers: make(map[string]*chi.Mux),
+		none:    chi.NewRouter(),
+	}
+}
+
+// Mount gives section its own routes, registered by fn.
+func (s *Sections) Mount(section string, fn func(r chi.Router)) {
+	r := chi.NewRouter()
+	r.Group(fn)
+	s.routers[section] = r
+}
+
+// Router returns the routes serving section, none when it is not mounted.
+func (s *Sections) Router(section string) chi.Routes {
+	return s.router(section)
+}
+
+func (s *Sections) router(section string) *chi.Mux {
+	if r, ok := s.routers[section]; ok {
+		return r
+	}
+	return s.none
+}
+
+func (s *Sections) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router(r.Header.Get(authz.SectionHeader)).ServeHTTP(w, r)
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSections(t *testing.T) {
+	pattern := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + chi.RouteContext(r.Context()).RoutePattern()))
+		}
+	}
+	sections := NewSections()
+	sections.Mount("be", func(r chi.Router) {
+		r.Get("/users/user/{user_id}", pattern("be"))
+		r.Get("/roles", pattern("be"))
+	})
+	sections.Mount("mobile", func(r chi.Router) {
+		r.Get("/users/user/{user_id}", pattern("mobile"))
+	})
+
+	r := chi.NewRouter()
+	r.Get("/auth/login", pattern("public"))
+	r.Mount("/", sections)
+
+	tests := []struct {
+		section  string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"be", "/users/user/7", http.StatusOK, "be /users/user/{user_id}"},
+		{"fe", "/roles", http.StatusNotFound, ""},
+		{"mobile", "/users/user/7", http.StatusOK, "mobile /users/user/{user_id}"},
+		{"mobile", "/roles", http.StatusNotFound, ""},
+		{"", "/auth/login", http.StatusOK, "public /auth/login"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("section", tt.section)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode || (tt.wantBody != "" && rec.Body.String() != tt.wantBody) {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.section, tt.path, rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+		}
+	}
+
+	if rctx := chi.NewRouteContext(); !sections.Router("mobile").Match(rctx, http.MethodGet, "/users/user/7") || sections.Router("mobile").Match(chi.NewRouteContext(), http.MethodGet, "/roles") {
+		t.Error("Router(mobile) does not match the mobile routes")
+	}
+	if sections.Router("fe").Match(chi.NewRouteContext(), http.MethodGet, "/roles") {
+		t.Error("Router(fe) matches routes of another section")
+	}
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
 	"test-tablelink/src/v1/service"
 
 	"github.com/go-chi/chi/v5"
@@ -55,7 +59,58 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	response, err := h.userService.UpdateUser(r.Context(), &req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
+	response, err := h.userService.Me(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.userService.GetUser(r.Context(), id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) UpdateUserByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req service.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.userService.UpdateUserByID(r.Context(), id, &req)
+	if err != nil {
+		writeUserError(w, err)
 		return
 	}
 
@@ -78,7 +133,53 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	response, err := h.userService.DeleteUser(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req service.AssignRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.userService.AssignRole(r.Context(), userID, &req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) UnassignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	roleID, err := strconv.Atoi(chi.URLParam(r, "role_id"))
+	if err != nil {
+		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.userService.UnassignRole(r.Context(), userID, roleID)
+	if err != nil {
+		writeServiceError(w, err)
 		return
 	}
 
@@ -89,6 +190,48 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/users/user", h.GetAllUsers)
 	r.Post("/users/user", h.CreateUser)
-	r.Put("/users/user", h.UpdateUser)
-	r.Delete("/users/user/{user_id}", h.DeleteUser)
+	checked(r, http.MethodPut, "/users/user", h.UpdateUser)
+	checked(r, http.MethodGet, "/users/user/{user_id}", h.GetUser)
+	checked(r, http.MethodPut, "/users/user/{user_id}", h.UpdateUserByID)
+	checked(r, http.MethodDelete, "/users/user/{user_id}", h.DeleteUser)
+	checked(r, http.MethodPost, "/users/user/{user_id}/roles", h.AssignRole)
+	checked(r, http.MethodDelete, "/users/user/{user_id}/roles/{role_id}", h.UnassignRole)
+	r.Get("/me", h.Me)
+}
+
+// checked registers a route whose service settles conditional rights with
+// authz.Require, other routes are denied when a condition is pending.
+func checked(r chi.Router, method, pattern string, h http.HandlerFunc) {
+	authz.RegisterCheckedRoute(method, pattern)
+	r.Method(method, pattern, h)
+}
+
+// writeUserError answers 404 for a user that does not exist or belongs to
+// another organization.
+func writeUserError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	writeServiceError(w, err)
+}
+
+// writeServiceError answers 403 when the conditions of the caller's rights
+// rule out the target resource or the action is refused while
+// impersonating, 400 for a role of another organization and 500
+// otherwise.
+func writeServiceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, authz.ErrForbidden) {
+		authz.Deny(w, authz.ReasonConditionFailed)
+		return
+	}
+	if errors.Is(err, service.ErrImpersonating) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, entity.ErrCrossOrganization) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGetUserNotFound(t *testing.T) {
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	orgs := memory.NewOrganizationRepository(store)
+	redis := memory.NewRedisRepository()
+
+	newUser := func(slug string) (context.Context, *entity.User) {
+		org := &entity.Organization{Slug: slug, Name: slug}
+		if err := orgs.Create(context.Background(), org); err != nil {
+			t.Fatal(err)
+		}
+		ctx := tenant.WithOrganization(context.Background(), org.ID)
+		user := &entity.User{Name: slug, Email: "jane@" + slug + ".com", Password: "secret"}
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		return ctx, user
+	}
+	acme, _ := newUser("acme")
+	_, globexUser := newUser("globex")
+	// The cache is shared by every organization
+	if err := redis.SetUser(context.Background(), globexUser); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	NewUserHandler(service.NewUserService(users, redis)).RegisterRoutes(r)
+	for name, id := range map[string]int64{"missing user": 999, "cached user of another organization": globexUser.ID} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/user/%d", id), nil)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req.WithContext(acme))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want 404: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -1,34 +1,60 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
 
 	"test-tablelink/src/entity"
-	"test-tablelink/src/repository"
+	"test-tablelink/src/v1/authz"
 	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type AuthMiddleware struct {
-	authService   *service.AuthService
-	roleRightRepo *repository.RoleRightRepository
+	authService          *service.AuthService
+	sectionService       *service.SectionService
+	organizationService  *service.OrganizationService
+	apiTokenService      *service.APITokenService
+	oauthService         *service.OAuthService
+	impersonationService *service.ImpersonationService
+	authorizer           authz.Authorizer
 }
 
-func NewAuthMiddleware(authService *service.AuthService, roleRightRepo *repository.RoleRightRepository) *AuthMiddleware {
+// NewAuthMiddleware authorizes requests with authorizer, usually an
+// authz.RoleRightsAuthorizer, in the sections registered with
+// sectionService, and limits them to an organization with
+// organizationService. Besides session tokens it accepts the API tokens of
+// apiTokenService and the OAuth access tokens of oauthService, both
+// limited to their scopes, and the tokens of impersonationService.
+func NewAuthMiddleware(authService *service.AuthService, sectionService *service.SectionService, organizationService *service.OrganizationService, apiTokenService *service.APITokenService, oauthService *service.OAuthService, impersonationService *service.ImpersonationService, authorizer authz.Authorizer) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService:   authService,
-		roleRightRepo: roleRightRepo,
+		authService:          authService,
+		sectionService:       sectionService,
+		organizationService:  organizationService,
+		apiTokenService:      apiTokenService,
+		oauthService:         oauthService,
+		impersonationService: impersonationService,
+		authorizer:           authorizer,
 	}
 }
 
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check X-Link-Service header
-		section := r.Header.Get("section")
-		if section != "be" {
+		// The section header must name a registered section
+		known, err := m.sectionService.Exists(r.Context(), r.Header.Get(authz.SectionHeader))
+		if err != nil {
+			log.Printf("Error checking section: %v", err)
+			http.Error(w, "Error checking section", http.StatusInternalServerError)
+			return
+		}
+		if !known {
 			http.Error(w, "Invalid service section", http.StatusUnauthorized)
 			return
 		}
@@ -48,50 +74,194 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 		token := parts[1]
 
-		// Validate token and get user
-		user, err := m.authService.ValidateToken(r.Context(), token)
+		// OAuth clients act for themselves rather than for a user
+		if strings.HasPrefix(token, entity.ClientTokenPrefix) {
+			m.authenticateClient(w, r, next, token)
+			return
+		}
+
+		// Validate token and get user, API and impersonation tokens are
+		// told apart by their prefix. The token tells the organization, so
+		// it is looked up in all of them.
+		lookup := tenant.All(r.Context())
+		var user *entity.User
+		var apiToken *entity.APIToken
+		var impersonation *entity.Impersonation
+		switch {
+		case strings.HasPrefix(token, entity.APITokenPrefix):
+			user, apiToken, err = m.apiTokenService.Authenticate(lookup, token)
+		case strings.HasPrefix(token, entity.ImpersonationTokenPrefix):
+			user, impersonation, err = m.impersonationService.Authenticate(lookup, token)
+		default:
+			user, err = m.authService.ValidateToken(lookup, token)
+		}
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
+		// Limit the request to the user's organization, or to the one a
+		// super-admin selects
+		ctx, err := m.organizationService.Scope(r.Context(), user, r.Header.Get(tenant.Header))
+		if err != nil {
+			writeScopeError(w, err)
+			return
+		}
+
+		if apiToken != nil {
+			ctx = authz.WithTokenScopes(ctx, apiToken.Rights())
+		}
+		// An admin acting as the user, every request is audited with them
+		if impersonation != nil {
+			ctx = authz.WithImpersonation(ctx, impersonation)
+		}
+
 		// Add user to context
-		ctx := context.WithValue(r.Context(), "user", user)
+		ctx = context.WithValue(ctx, "user", user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticateClient serves a request made with an OAuth access token. The
+// client is stored in the context under "client", limited to its
+// organization and to the scopes of the token.
+func (m *AuthMiddleware) authenticateClient(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	client, scopes, err := m.oauthService.Authenticate(tenant.All(r.Context()), token)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, err := m.organizationService.ScopeClient(r.Context(), client, r.Header.Get(tenant.Header))
+	if err != nil {
+		writeScopeError(w, err)
+		return
+	}
+
+	ctx = authz.WithTokenScopes(ctx, entity.ScopeRights(scopes, r.Header.Get(authz.SectionHeader)))
+	ctx = context.WithValue(ctx, "client", client)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func writeScopeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tenant.ErrOrganizationMismatch):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrUnknownOrganization):
+		http.Error(w, "Invalid organization", http.StatusUnauthorized)
+	default:
+		log.Printf("Error resolving organization: %v", err)
+		http.Error(w, "Error resolving organization", http.StatusInternalServerError)
+	}
+}
+
 func (m *AuthMiddleware) Authorize(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get user from context
-		user, ok := r.Context().Value("user").(*entity.User)
-		if !ok {
+		// Get the user, or the OAuth client, from context
+		user, _ := r.Context().Value("user").(*entity.User)
+		client, _ := r.Context().Value("client").(*entity.OAuthClient)
+		if user == nil && client == nil {
 			http.Error(w, "User not found in context", http.StatusUnauthorized)
 			return
 		}
 
-		// Get route pattern
+		// Get route pattern, role rights are stored per chi pattern such as
+		// /users/user/{user_id}. Without a router, fall back to the path.
 		routePattern := r.URL.Path
-		log.Printf("Checking permission for route: %s, method: %s, user role: %d", routePattern, r.Method, user.RoleID)
-
-		// Check permission
-		hasPermission, err := m.roleRightRepo.CheckPermission(
-			r.Context(),
-			user.RoleID,
-			"be",
-			routePattern,
-			r.Method,
-		)
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			routePattern = rctx.RoutePattern()
+		}
+
+		impersonation, _ := authz.Impersonation(r.Context())
+		req := &authz.Request{
+			User:          user,
+			Client:        client,
+			Section:       r.Header.Get(authz.SectionHeader),
+			Route:         routePattern,
+			Path:          r.URL.Path,
+			Method:        r.Method,
+			Resource:      urlParams(r),
+			Impersonation: impersonation,
+		}
+		decision, err := m.authorizer.Authorize(r.Context(), req)
 		if err != nil {
 			log.Printf("Error checking permission: %v", err)
 			http.Error(w, fmt.Sprintf("Error checking permission: %v", err), http.StatusInternalServerError)
 			return
 		}
-		if !hasPermission {
-			http.Error(w, "Permission denied", http.StatusForbidden)
+		if scopes, ok := authz.TokenScopes(r.Context()); ok {
+			decision = authz.Restrict(decision, scopes, req)
+		}
+		authz.Audit(req, decision)
+		if !decision.Allowed {
+			authz.Deny(w, decision.Reason)
+			return
+		}
+		if decision.Check == nil {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// The outcome depends on conditions such as "own", which the
+		// service settles once it has loaded the target resource. Routes
+		// whose service does not settle checks are denied up front, before
+		// they change anything.
+		if !authz.CheckedRoute(r.Method, routePattern) {
+			authz.Audit(req, authz.Decision{Reason: authz.ReasonConditionUnchecked})
+			authz.Deny(w, authz.ReasonConditionUnchecked)
+			return
+		}
+		// The response is held back so a service that still fails to
+		// settle the check is denied rather than answered.
+		held := newHeldResponse()
+		next.ServeHTTP(held, r.WithContext(authz.WithCheck(r.Context(), decision.Check)))
+		if !decision.Check.Checked() {
+			log.Printf("Conditional permission on %s %s was never checked", r.Method, routePattern)
+			authz.Audit(req, authz.Decision{Reason: authz.ReasonConditionUnchecked})
+			authz.Deny(w, authz.ReasonConditionUnchecked)
+			return
+		}
+		held.flush(w)
 	})
 }
+
+// heldResponse records a response so it can be sent or dropped once the
+// handler returns.
+type heldResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newHeldResponse() *heldResponse {
+	return &heldResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (h *heldResponse) Header() http.Header { return h.header }
+
+func (h *heldResponse) WriteHeader(status int) { h.status = status }
+
+func (h *heldResponse) Write(b []byte) (int, error) { return h.body.Write(b) }
+
+// flush sends the recorded response to w.
+func (h *heldResponse) flush(w http.ResponseWriter) {
+	for key, values := range h.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(h.status)
+	w.Write(h.body.Bytes())
+}
+
+// urlParams returns the route parameters, the attributes of the target
+// resource known before it is loaded.
+func urlParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			if key != "*" {
+				params[key] = rctx.URLParams.Values[i]
+			}
+		}
+	}
+	return params
+}
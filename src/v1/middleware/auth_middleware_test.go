@@ -0,0 +1,769 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/handler"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type fixture struct {
+	middleware *AuthMiddleware
+	adminToken string
+	userToken  string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := tenant.All(context.Background())
+
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+	redis := memory.NewRedisRepository()
+	authService := service.NewAuthService(users, memory.NewOrganizationRepository(store), memory.NewGroupRepository(store), redis, authn.NewLocalAuthenticator(users))
+
+	login := func(roleName, email string) string {
+		role := &entity.Role{Name: roleName}
+		if err := roles.Create(ctx, role); err != nil {
+			t.Fatal(err)
+		}
+		user := &entity.User{Roles: []entity.Role{*role}, Name: roleName, Email: email, Password: "secret"}
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := authService.Login(ctx, &service.LoginRequest{Email: email, Password: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.AccessToken
+	}
+
+	sections := memory.NewSectionRepository(store)
+	if err := sections.Create(ctx, &entity.Section{Name: "fe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.NewOrganizationRepository(store).Create(ctx, &entity.Organization{Slug: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{
+		middleware: NewAuthMiddleware(authService, service.NewSectionService(sections), service.NewOrganizationService(memory.NewOrganizationRepository(store)), service.NewAPITokenService(memory.NewAPITokenRepository(store), users, memory.NewGroupRepository(store), time.Hour), service.NewOAuthService(memory.NewOAuthClientRepository(store), roles, redis, time.Hour), service.NewImpersonationService(users, memory.NewGroupRepository(store), redis, time.Hour), authz.NewRoleRightsAuthorizer(roleRights)),
+		adminToken: login("admin", "admin@gmail.com"),
+		userToken:  login("user", "user@gmail.com"),
+	}
+
+	rights := []entity.RoleRight{
+		{RoleID: 1, Section: "be", Route: "/users/user", RCreate: true, RRead: true, RUpdate: true, RDelete: true},
+		{RoleID: 2, Section: "be", Route: "/users/user", RRead: true},
+		{RoleID: 2, Section: "fe", Route: "/users/user", RCreate: true},
+	}
+	for i := range rights {
+		if err := roleRights.Create(ctx, &rights[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func TestAuthenticate(t *testing.T) {
+	f := newFixture(t)
+	h := f.middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(*entity.User)
+		if !ok || user.Email != "admin@gmail.com" {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name    string
+		section string
+		auth    string
+		want    int
+	}{
+		{"valid", "be", "Bearer " + f.adminToken, http.StatusOK},
+		{"missing section", "", "Bearer " + f.adminToken, http.StatusUnauthorized},
+		{"other section", "fe", "Bearer " + f.adminToken, http.StatusOK},
+		{"unregistered section", "partner", "Bearer " + f.adminToken, http.StatusUnauthorized},
+		{"missing header", "be", "", http.StatusUnauthorized},
+		{"not bearer", "be", "Basic " + f.adminToken, http.StatusUnauthorized},
+		{"unknown token", "be", "Bearer nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/user", nil)
+			if tt.section != "" {
+				req.Header.Set("section", tt.section)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateOrganization(t *testing.T) {
+	f := newFixture(t)
+	h := f.middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := tenant.OrganizationID(r.Context())
+		if !ok || id != entity.DefaultOrganizationID {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name string
+		org  string
+		want int
+	}{
+		{"own by default", "", http.StatusOK},
+		{"own by slug", "default", http.StatusOK},
+		{"other organization", "acme", http.StatusForbidden},
+		{"unknown organization", "nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/user", nil)
+			req.Header.Set("section", "be")
+			req.Header.Set("Authorization", "Bearer "+f.adminToken)
+			if tt.org != "" {
+				req.Header.Set(tenant.Header, tt.org)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	f := newFixture(t)
+	h := f.middleware.Authenticate(f.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"admin read", f.adminToken, http.MethodGet, "/users/user", http.StatusOK},
+		{"admin create", f.adminToken, http.MethodPost, "/users/user", http.StatusOK},
+		{"admin update", f.adminToken, http.MethodPut, "/users/user", http.StatusOK},
+		{"user read", f.userToken, http.MethodGet, "/users/user", http.StatusOK},
+		{"user create", f.userToken, http.MethodPost, "/users/user", http.StatusForbidden},
+		{"user update", f.userToken, http.MethodPut, "/users/user", http.StatusForbidden},
+		{"unknown route", f.adminToken, http.MethodGet, "/roles", http.StatusForbidden},
+		{"unsupported method", f.adminToken, http.MethodPatch, "/users/user", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("section", "be")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeSection(t *testing.T) {
+	f := newFixture(t)
+	h := f.middleware.Authenticate(f.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name    string
+		section string
+		token   string
+		method  string
+		want    int
+	}{
+		{"be right in be", "be", f.userToken, http.MethodGet, http.StatusOK},
+		{"be right in fe", "fe", f.userToken, http.MethodGet, http.StatusForbidden},
+		{"fe right in fe", "fe", f.userToken, http.MethodPost, http.StatusOK},
+		{"fe right in be", "be", f.userToken, http.MethodPost, http.StatusForbidden},
+		{"admin has no fe rights", "fe", f.adminToken, http.MethodGet, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users/user", nil)
+			req.Header.Set("section", tt.section)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// TestAuthorizeImpersonation checks that an admin acting as a user has the
+// user's rights and that each request is audited with the admin.
+func TestAuthorizeImpersonation(t *testing.T) {
+	f := newFixture(t)
+	ctx := tenant.All(context.Background())
+	admin, err := f.middleware.authService.ValidateToken(ctx, f.adminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := f.middleware.authService.ValidateToken(ctx, f.userToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only an admin holding the user's roles may act as them
+	admin.Roles = append(admin.Roles, user.Roles...)
+	resp, err := f.middleware.impersonationService.Impersonate(context.WithValue(ctx, "user", admin), user.ID, &contract.ImpersonateRequest{Reason: "ticket 42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := resp.Data.(contract.ImpersonationToken).AccessToken
+
+	h := f.middleware.Authenticate(f.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, _ := r.Context().Value("user").(*entity.User); got == nil || got.ID != user.ID {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	var audit strings.Builder
+	log.SetOutput(&audit)
+	defer log.SetOutput(os.Stderr)
+
+	for method, want := range map[string]int{http.MethodGet: http.StatusOK, http.MethodPost: http.StatusForbidden} {
+		req := httptest.NewRequest(method, "/users/user", nil)
+		req.Header.Set("section", "be")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s status = %d, want %d", method, rec.Code, want)
+		}
+	}
+	if n := strings.Count(audit.String(), fmt.Sprintf("impersonator=%d", admin.ID)); n != 2 {
+		t.Errorf("audit log has %d impersonated requests, want 2:\n%s", n, audit.String())
+	}
+}
+
+func TestAuthorizeWithoutUser(t *testing.T) {
+	f := newFixture(t)
+	h := f.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/user", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthorizeAnyRole(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+	redis := memory.NewRedisRepository()
+	authService := service.NewAuthService(users, memory.NewOrganizationRepository(store), memory.NewGroupRepository(store), redis, authn.NewLocalAuthenticator(users))
+
+	support := &entity.Role{Name: "support"}
+	billing := &entity.Role{Name: "billing"}
+	roles.Create(ctx, support)
+	roles.Create(ctx, billing)
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(support.ID), Section: "be", Route: "/users/user", RRead: true})
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(billing.ID), Section: "be", Route: "/users/user/{user_id}", RDelete: true})
+
+	user := &entity.User{Roles: []entity.Role{*support, *billing}, Name: "S", Email: "s@gmail.com", Password: "secret"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := authService.Login(ctx, &service.LoginRequest{Email: "s@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewAuthMiddleware(authService, service.NewSectionService(memory.NewSectionRepository(store)), service.NewOrganizationService(memory.NewOrganizationRepository(store)), service.NewAPITokenService(memory.NewAPITokenRepository(store), users, memory.NewGroupRepository(store), time.Hour), service.NewOAuthService(memory.NewOAuthClientRepository(store), roles, redis, time.Hour), service.NewImpersonationService(users, memory.NewGroupRepository(store), redis, time.Hour), authz.NewRoleRightsAuthorizer(roleRights))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(m.Authenticate)
+		r.Use(m.Authorize)
+		r.Get("/users/user", ok)
+		r.Post("/users/user", ok)
+		r.Delete("/users/user/{user_id}", ok)
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/users/user", http.StatusOK},
+		{http.MethodDelete, "/users/user/42", http.StatusOK},
+		{http.MethodPost, "/users/user", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("section", "be")
+		req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAuthorizeDenyPrecedence(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+	redis := memory.NewRedisRepository()
+	authService := service.NewAuthService(users, memory.NewOrganizationRepository(store), memory.NewGroupRepository(store), redis, authn.NewLocalAuthenticator(users))
+
+	// support reads everything under /users except the admins, and may
+	// manage one specific user. auditor, inherited by support, may not
+	// delete anything under /users/user.
+	auditor := &entity.Role{Name: "auditor"}
+	roles.Create(ctx, auditor)
+	support := &entity.Role{Name: "support", ParentID: &auditor.ID}
+	roles.Create(ctx, support)
+	rights := []entity.RoleRight{
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/*", RRead: true},
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/admins", RRead: true, Deny: true},
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/user/{user_id}", RUpdate: true, RDelete: true},
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/user/1", RUpdate: true, Deny: true},
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/user/{user_id}/roles", RCreate: true},
+		{RoleID: int64(auditor.ID), Section: "be", Route: "/users/user/{user_id}/roles", RCreate: true, Deny: true},
+		{RoleID: int64(auditor.ID), Section: "be", Route: "/users/user/*", RDelete: true, Deny: true},
+	}
+	for i := range rights {
+		if err := roleRights.Create(ctx, &rights[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := &entity.User{Roles: []entity.Role{*support}, Name: "S", Email: "s@gmail.com", Password: "secret"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := authService.Login(ctx, &service.LoginRequest{Email: "s@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewAuthMiddleware(authService, service.NewSectionService(memory.NewSectionRepository(store)), service.NewOrganizationService(memory.NewOrganizationRepository(store)), service.NewAPITokenService(memory.NewAPITokenRepository(store), users, memory.NewGroupRepository(store), time.Hour), service.NewOAuthService(memory.NewOAuthClientRepository(store), roles, redis, time.Hour), service.NewImpersonationService(users, memory.NewGroupRepository(store), redis, time.Hour), authz.NewRoleRightsAuthorizer(roleRights))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(m.Authenticate)
+		r.Use(m.Authorize)
+		r.Get("/users", ok)
+		r.Get("/users/admins", ok)
+		r.Get("/users/user", ok)
+		r.Post("/users/user", ok)
+		r.Get("/users/user/{user_id}", ok)
+		r.Put("/users/user/{user_id}", ok)
+		r.Delete("/users/user/{user_id}", ok)
+		r.Post("/users/user/{user_id}/roles", ok)
+		r.Get("/roles/{id}", ok)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"prefix covers its root", http.MethodGet, "/users", http.StatusOK},
+		{"prefix covers literal route", http.MethodGet, "/users/user", http.StatusOK},
+		{"prefix covers pattern route", http.MethodGet, "/users/user/7", http.StatusOK},
+		{"specific deny beats prefix allow", http.MethodGet, "/users/admins", http.StatusForbidden},
+		{"allow covers other methods only when flagged", http.MethodPost, "/users/user", http.StatusForbidden},
+		{"pattern allow", http.MethodPut, "/users/user/7", http.StatusOK},
+		{"concrete path deny beats pattern allow", http.MethodPut, "/users/user/1", http.StatusForbidden},
+		{"deny only covers its operations", http.MethodGet, "/users/user/1", http.StatusOK},
+		{"pattern allow beats inherited prefix deny", http.MethodDelete, "/users/user/7", http.StatusOK},
+		{"inherited deny beats allow at equal specificity", http.MethodPost, "/users/user/7/roles", http.StatusForbidden},
+		{"no matching rule", http.MethodGet, "/roles/1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("section", "be")
+			req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+			}
+			if tt.want == http.StatusForbidden && rec.Header().Get(authz.ReasonHeader) == "" {
+				t.Errorf("%s %s: 403 without a reason code", tt.method, tt.path)
+			}
+		})
+	}
+}
+
+func TestAuthorizeOwnership(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	roles := memory.NewRoleRepository(store)
+	roleRights := memory.NewRoleRightRepository(store)
+	redis := memory.NewRedisRepository()
+	authService := service.NewAuthService(users, memory.NewOrganizationRepository(store), memory.NewGroupRepository(store), redis, authn.NewLocalAuthenticator(users))
+
+	admin := &entity.Role{Name: "admin"}
+	plain := &entity.Role{Name: "user"}
+	roles.Create(ctx, admin)
+	roles.Create(ctx, plain)
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(admin.ID), Section: "be", Route: "/users/user/{user_id}", RRead: true, RUpdate: true, RDelete: true})
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(plain.ID), Section: "be", Route: "/users/user/{user_id}", RRead: true, RUpdate: true, Condition: "own"})
+	// Listing users and creating groups never settle the check, the
+	// requests must not pass
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(plain.ID), Section: "be", Route: "/users/user", RRead: true, Condition: "own"})
+	roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(plain.ID), Section: "be", Route: "/groups", RCreate: true, Condition: "own"})
+
+	login := func(role *entity.Role, email string) (int64, string) {
+		user := &entity.User{Roles: []entity.Role{*role}, Name: email, Email: email, Password: "secret"}
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := authService.Login(ctx, &service.LoginRequest{Email: email, Password: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.ID, resp.AccessToken
+	}
+	_, adminToken := login(admin, "admin@gmail.com")
+	aliceID, aliceToken := login(plain, "alice@gmail.com")
+	bobID, _ := login(plain, "bob@gmail.com")
+
+	m := NewAuthMiddleware(authService, service.NewSectionService(memory.NewSectionRepository(store)), service.NewOrganizationService(memory.NewOrganizationRepository(store)), service.NewAPITokenService(memory.NewAPITokenRepository(store), users, memory.NewGroupRepository(store), time.Hour), service.NewOAuthService(memory.NewOAuthClientRepository(store), roles, redis, time.Hour), service.NewImpersonationService(users, memory.NewGroupRepository(store), redis, time.Hour), authz.NewRoleRightsAuthorizer(roleRights))
+	userHandler := handler.NewUserHandler(service.NewUserService(users, redis))
+	groups := memory.NewGroupRepository(store)
+	groupHandler := handler.NewGroupHandler(service.NewGroupService(groups, users, roles))
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(m.Authenticate)
+		r.Use(m.Authorize)
+		userHandler.RegisterRoutes(r)
+		groupHandler.RegisterRoutes(r)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"user reads own record", aliceToken, http.MethodGet, fmt.Sprintf("/users/user/%d", aliceID), http.StatusOK},
+		{"user updates own record", aliceToken, http.MethodPut, fmt.Sprintf("/users/user/%d", aliceID), http.StatusOK},
+		{"user reads another record", aliceToken, http.MethodGet, fmt.Sprintf("/users/user/%d", bobID), http.StatusForbidden},
+		{"user updates another record", aliceToken, http.MethodPut, fmt.Sprintf("/users/user/%d", bobID), http.StatusForbidden},
+		{"user deletes own record", aliceToken, http.MethodDelete, fmt.Sprintf("/users/user/%d", aliceID), http.StatusForbidden},
+		{"admin reads any record", adminToken, http.MethodGet, fmt.Sprintf("/users/user/%d", bobID), http.StatusOK},
+		{"admin updates any record", adminToken, http.MethodPut, fmt.Sprintf("/users/user/%d", bobID), http.StatusOK},
+		{"user lists records unchecked", aliceToken, http.MethodGet, "/users/user", http.StatusForbidden},
+		{"user creates a group unchecked", aliceToken, http.MethodPost, "/groups", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"renamed"}`))
+			req.Header.Set("section", "be")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s status = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), "Permission denied: ") {
+				t.Errorf("403 body %q has no reason code", rec.Body)
+			}
+		})
+	}
+
+	if bob, _ := users.GetByID(ctx, bobID); bob.Name != "renamed" {
+		t.Errorf("admin update did not apply, name = %q", bob.Name)
+	}
+	// The denied request must not have written anything
+	if all, err := groups.GetAll(ctx); err != nil || len(all) != 0 {
+		t.Errorf("groups after the denied create = %v, %v; want none", all, err)
+	}
+}
+
+func TestAuthorizeWithCEL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	policy := `
+policies:
+  - name: own-record
+    effect: allow
+    when: route == '/users/user/{user_id}' && resource.user_id == string(user.id)
+`
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := authz.NewCELAuthorizer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFixture(t)
+	m := NewAuthMiddleware(f.middleware.authService, f.middleware.sectionService, f.middleware.organizationService, f.middleware.apiTokenService, f.middleware.oauthService, f.middleware.impersonationService, authorizer)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(m.Authenticate)
+		r.Use(m.Authorize)
+		r.Get("/users/user", ok)
+		r.Get("/users/user/{user_id}", ok)
+	})
+
+	// The fixture's admin is user 1
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/users/user/1", http.StatusOK},
+		{"/users/user/2", http.StatusForbidden},
+		{"/users/user", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("section", "be")
+		req.Header.Set("Authorization", "Bearer "+f.adminToken)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("GET %s status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAuthorizeAPIToken(t *testing.T) {
+	f := newFixture(t)
+	h := f.middleware.Authenticate(f.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	issue := func(session string, scopes ...contract.APITokenScope) string {
+		t.Helper()
+		ctx := tenant.All(context.Background())
+		owner, err := f.middleware.authService.ValidateToken(ctx, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := f.middleware.apiTokenService.CreateToken(context.WithValue(ctx, "user", owner), &contract.CreateAPITokenRequest{Name: "ci", Scopes: scopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data.(contract.CreatedAPIToken).Token
+	}
+	adminRead := issue(f.adminToken, contract.APITokenScope{Section: "be", Route: "/users/user", Read: true})
+	adminAll := issue(f.adminToken, contract.APITokenScope{Section: "be", Route: "/users/*", Create: true, Read: true})
+	adminFe := issue(f.adminToken, contract.APITokenScope{Section: "fe", Route: "/users/user", Read: true})
+	userCreate := issue(f.userToken, contract.APITokenScope{Section: "be", Route: "/users/user", Create: true})
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		want   int
+		reason string
+	}{
+		{"in scope", adminRead, http.MethodGet, http.StatusOK, ""},
+		{"outside scope", adminRead, http.MethodPost, http.StatusForbidden, authz.ReasonOutsideTokenScope},
+		{"prefix scope", adminAll, http.MethodPost, http.StatusOK, ""},
+		{"scope of another section", adminFe, http.MethodGet, http.StatusForbidden, authz.ReasonOutsideTokenScope},
+		{"scope beyond the owner's rights", userCreate, http.MethodPost, http.StatusForbidden, authz.ReasonNoMatchingRule},
+		{"malformed", entity.APITokenPrefix + "nope", http.MethodGet, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users/user", nil)
+			req.Header.Set("section", "be")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get(authz.ReasonHeader); got != tt.reason {
+				t.Errorf("reason = %q, want %q", got, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAuthorizeOAuthClient(t *testing.T) {
+	f := newFixture(t)
+	var principal string
+	h := f.middleware.Authenticate(f.middleware.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("user").(*entity.User); ok {
+			principal = "user"
+		}
+		if client, ok := r.Context().Value("client").(*entity.OAuthClient); ok {
+			principal = client.ClientID
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Role 1 is the fixture's admin role, role 2 the user role
+	issue := func(roleID int, scope string, scopes ...string) (string, string) {
+		t.Helper()
+		ctx := tenant.WithOrganization(context.Background(), 1)
+		resp, err := f.middleware.oauthService.CreateClient(ctx, &contract.CreateOAuthClientRequest{Name: "billing", RoleID: roleID, Scopes: scopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created := resp.Data.(contract.CreatedOAuthClient)
+		token, err := f.middleware.oauthService.Token(ctx, service.GrantClientCredentials, created.ClientID, created.ClientSecret, scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.AccessToken, created.ClientID
+	}
+	adminAll, adminID := issue(1, "", "read:/users/*", "create:/users/*")
+	adminRead, _ := issue(1, "read:/users/*", "read:/users/*", "create:/users/*")
+	userCreate, _ := issue(2, "", "create:/users/user")
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		want   int
+		reason string
+	}{
+		{"role right in scope", adminAll, http.MethodPost, http.StatusOK, ""},
+		{"narrower token", adminRead, http.MethodPost, http.StatusForbidden, authz.ReasonOutsideTokenScope},
+		{"scope beyond the role's rights", userCreate, http.MethodPost, http.StatusForbidden, authz.ReasonNoMatchingRule},
+		{"unknown", entity.ClientTokenPrefix + "nope", http.MethodGet, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users/user", nil)
+			req.Header.Set("section", "be")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get(authz.ReasonHeader); got != tt.reason {
+				t.Errorf("reason = %q, want %q", got, tt.reason)
+			}
+		})
+	}
+
+	principal = ""
+	req := httptest.NewRequest(http.MethodGet, "/users/user", nil)
+	req.Header.Set("section", "be")
+	req.Header.Set("Authorization", "Bearer "+adminAll)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if principal != adminID {
+		t.Errorf("principal = %q, want client %s", principal, adminID)
+	}
+}
+
+func TestAuthorizeUncheckedCondition(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	store := memory.NewStore()
+	role := &entity.Role{Name: "user"}
+	if err := memory.NewRoleRepository(store).Create(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+	user := &entity.User{ID: 7, Roles: []entity.Role{*role}}
+	rights := memory.NewRoleRightRepository(store)
+	for _, route := range []string{"/things", "/checked-things"} {
+		rights.Create(ctx, &entity.RoleRight{RoleID: int64(role.ID), Section: "be", Route: route, RRead: true, Condition: "own"})
+	}
+	authz.RegisterCheckedRoute(http.MethodGet, "/checked-things")
+	m := &AuthMiddleware{authorizer: authz.NewRoleRightsAuthorizer(rights)}
+
+	serve := func(path string, settle bool) (*httptest.ResponseRecorder, bool) {
+		ran := false
+		h := m.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ran = true
+			if settle {
+				if err := authz.Require(r.Context(), user); err != nil {
+					authz.Deny(w, authz.ReasonConditionFailed)
+					return
+				}
+			}
+			w.Header().Set("X-Thing", "secret")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("the thing"))
+		}))
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("section", "be")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(context.WithValue(ctx, "user", user)))
+		return rec, ran
+	}
+	denied := func(name string, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if rec.Code != http.StatusForbidden || rec.Header().Get(authz.ReasonHeader) != authz.ReasonConditionUnchecked {
+			t.Errorf("%s: status = %d, reason = %q; want 403 %s", name, rec.Code, rec.Header().Get(authz.ReasonHeader), authz.ReasonConditionUnchecked)
+		}
+		if strings.Contains(rec.Body.String(), "the thing") || rec.Header().Get("X-Thing") != "" {
+			t.Errorf("%s: response leaked: %v %q", name, rec.Header(), rec.Body)
+		}
+	}
+
+	// A route not known to settle checks never reaches its handler
+	rec, ran := serve("/things", true)
+	denied("unchecked route", rec)
+	if ran {
+		t.Error("the handler of an unchecked route ran")
+	}
+
+	// A checked route whose service forgets the check is still denied
+	rec, _ = serve("/checked-things", false)
+	denied("check forgotten", rec)
+
+	rec, _ = serve("/checked-things", true)
+	if rec.Code != http.StatusCreated || rec.Body.String() != "the thing" || rec.Header().Get("X-Thing") != "secret" {
+		t.Errorf("checked: got %d %v %q, want the handler's response", rec.Code, rec.Header(), rec.Body)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"test-tablelink/src/v1/scim"
+	"test-tablelink/src/v1/service"
+	"test-tablelink/src/v1/tenant"
+)
+
+// SCIMMiddleware authenticates the SCIM endpoints. They take SCIM tokens
+// only, and SCIM tokens are good for nothing else: the auth middleware
+// does not know them.
+type SCIMMiddleware struct {
+	scimService *service.SCIMService
+}
+
+func NewSCIMMiddleware(scimService *service.SCIMService) *SCIMMiddleware {
+	return &SCIMMiddleware{scimService: scimService}
+}
+
+// Authenticate limits the request to the organization of the token.
+func (m *SCIMMiddleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			scim.WriteError(w, scim.Errorf(http.StatusUnauthorized, "", "Authorization header is required"))
+			return
+		}
+
+		scimToken, err := m.scimService.Authenticate(r.Context(), token)
+		if errors.Is(err, service.ErrInvalidSCIMToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+			scim.WriteError(w, scim.Errorf(http.StatusUnauthorized, "", "Invalid token"))
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking SCIM token: %v", err)
+			scim.WriteError(w, scim.Errorf(http.StatusInternalServerError, "", "Error checking token"))
+			return
+		}
+
+		ctx := tenant.WithOrganization(r.Context(), scimToken.OrganizationID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
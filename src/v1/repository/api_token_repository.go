@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"test-tablelink/src/entity"
+)
+
+type APITokenRepository interface {
+	// GetByPrefix looks a token up by its public part, across
+	// organizations, with its scopes.
+	GetByPrefix(ctx context.Context, prefix string) (*entity.APIToken, error)
+	// GetByUserID returns the user's tokens with their scopes, newest
+	// first, revoked ones included.
+	GetByUserID(ctx context.Context, userID int64) ([]*entity.APIToken, error)
+	// Create inserts the token and its scopes.
+	Create(ctx context.Context, token *entity.APIToken) error
+	// Revoke sets revoked_at of the user's token, sql.ErrNoRows when the
+	// user has no such token that is not revoked yet.
+	Revoke(ctx context.Context, userID, id int64, at time.Time) error
+	UpdateLastUsed(ctx context.Context, id int64, at time.Time) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+// FederatedIdentityRepository links users to their accounts at upstream
+// identity providers. Lookups run across organizations: the provider
+// decides the organization.
+type FederatedIdentityRepository interface {
+	// GetBySubject returns sql.ErrNoRows when the account is not linked
+	GetBySubject(ctx context.Context, provider, subject string) (*entity.FederatedIdentity, error)
+	Create(ctx context.Context, identity *entity.FederatedIdentity) error
+	UpdateLastLogin(ctx context.Context, id int64) error
+}
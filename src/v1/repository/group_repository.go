@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type GroupRepository interface {
+	GetAll(ctx context.Context) ([]*entity.Group, error)
+	GetByID(ctx context.Context, id int) (*entity.Group, error)
+	Create(ctx context.Context, group *entity.Group) error
+	Update(ctx context.Context, group *entity.Group) error
+	Delete(ctx context.Context, id int) error
+
+	GetMembers(ctx context.Context, groupID int) ([]*entity.GroupMember, error)
+	AddMember(ctx context.Context, groupID int, userID int64) error
+	RemoveMember(ctx context.Context, groupID int, userID int64) error
+
+	GetRoles(ctx context.Context, groupID int) ([]entity.Role, error)
+	AssignRole(ctx context.Context, groupID int, roleID int) error
+	UnassignRole(ctx context.Context, groupID int, roleID int) error
+
+	// GetRolesByUserID returns the roles the user gets through the groups
+	// they are a member of and the groups those are nested in.
+	GetRolesByUserID(ctx context.Context, userID int64) ([]entity.Role, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type OAuthClientRepository interface {
+	GetAll(ctx context.Context) ([]*entity.OAuthClient, error)
+	GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error)
+	// Create registers the client in the organization of ctx. The role
+	// must belong to the same organization.
+	Create(ctx context.Context, client *entity.OAuthClient) error
+	Delete(ctx context.Context, clientID string) error
+}
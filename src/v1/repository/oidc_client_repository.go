@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+// OIDCClientRepository holds the relying parties and the consents users
+// gave them.
+type OIDCClientRepository interface {
+	GetAll(ctx context.Context) ([]*entity.OIDCClient, error)
+	GetByClientID(ctx context.Context, clientID string) (*entity.OIDCClient, error)
+	// Create registers the client in the organization of ctx
+	Create(ctx context.Context, client *entity.OIDCClient) error
+	Delete(ctx context.Context, clientID string) error
+	// GetConsent returns sql.ErrNoRows when the user never consented
+	GetConsent(ctx context.Context, userID int64, clientID string) (*entity.OIDCConsent, error)
+	SaveConsent(ctx context.Context, consent *entity.OIDCConsent) error
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type OrganizationRepository interface {
+	GetAll(ctx context.Context) ([]*entity.Organization, error)
+	GetByID(ctx context.Context, id int64) (*entity.Organization, error)
+	GetBySlug(ctx context.Context, slug string) (*entity.Organization, error)
+	Create(ctx context.Context, organization *entity.Organization) error
+}
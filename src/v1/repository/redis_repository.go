@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+// RedisRepository holds the session state: cached users, the token -> user
+// ID mapping, OAuth access tokens, impersonation tokens, OIDC
+// authorization codes, pending federated logins and magic links. Missing
+// keys are reported as redis.Nil.
+type RedisRepository interface {
+	SetUser(ctx context.Context, user *entity.User) error
+	GetUser(ctx context.Context, id int64) (*entity.User, error)
+	DeleteUser(ctx context.Context, id int64) error
+	SetToken(ctx context.Context, token string, userID int64) error
+	GetUserIDByToken(ctx context.Context, token string) (int64, error)
+	// GetSession returns the user ID and the expiry of a session token.
+	GetSession(ctx context.Context, token string) (*entity.Session, error)
+	DeleteToken(ctx context.Context, token string) error
+	ListSessions(ctx context.Context) ([]*entity.Session, error)
+	// SetClientToken stores an OAuth access token until clientToken.ExpiresAt.
+	SetClientToken(ctx context.Context, token string, clientToken *entity.ClientToken) error
+	GetClientToken(ctx context.Context, token string) (*entity.ClientToken, error)
+	DeleteClientToken(ctx context.Context, token string) error
+	// SetImpersonation stores an impersonation token until
+	// impersonation.ExpiresAt.
+	SetImpersonation(ctx context.Context, token string, impersonation *entity.Impersonation) error
+	GetImpersonation(ctx context.Context, token string) (*entity.Impersonation, error)
+	DeleteImpersonation(ctx context.Context, token string) error
+	// SetAuthorizationCode stores an OIDC authorization code until
+	// authCode.ExpiresAt, TakeAuthorizationCode returns and removes it.
+	SetAuthorizationCode(ctx context.Context, code string, authCode *entity.AuthorizationCode) error
+	TakeAuthorizationCode(ctx context.Context, code string) (*entity.AuthorizationCode, error)
+	// SetFederatedLogin stores a login started at an upstream identity
+	// provider until login.ExpiresAt, TakeFederatedLogin returns and
+	// removes it.
+	SetFederatedLogin(ctx context.Context, state string, login *entity.FederatedLogin) error
+	TakeFederatedLogin(ctx context.Context, state string) (*entity.FederatedLogin, error)
+	// SetMagicLink stores a magic link until link.ExpiresAt, TakeMagicLink
+	// returns and removes it.
+	SetMagicLink(ctx context.Context, id string, link *entity.MagicLink) error
+	TakeMagicLink(ctx context.Context, id string) (*entity.MagicLink, error)
+}
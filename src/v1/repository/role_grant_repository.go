@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"test-tablelink/src/entity"
+)
+
+type RoleGrantRepository interface {
+	GetByID(ctx context.Context, id int64) (*entity.RoleGrant, error)
+	// GetAll returns the grants with the given status, or all of them when
+	// status is empty, newest first.
+	GetAll(ctx context.Context, status string) ([]*entity.RoleGrant, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*entity.RoleGrant, error)
+	// GetDue returns the approved grants that expired at or before now.
+	GetDue(ctx context.Context, now time.Time) ([]*entity.RoleGrant, error)
+	Create(ctx context.Context, grant *entity.RoleGrant) error
+	// Update saves the decision and lifecycle columns: status, decided_by,
+	// expires_at, decided_at and ended_at.
+	Update(ctx context.Context, grant *entity.RoleGrant) error
+}
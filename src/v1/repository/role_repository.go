@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type RoleRepository interface {
+	GetByID(ctx context.Context, id int) (*entity.Role, error)
+	GetAll(ctx context.Context) ([]*entity.Role, error)
+	GetByName(ctx context.Context, name string) (*entity.Role, error)
+	Create(ctx context.Context, role *entity.Role) error
+	Update(ctx context.Context, role *entity.Role) error
+	Delete(ctx context.Context, id int) error
+}
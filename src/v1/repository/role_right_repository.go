@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type RoleRightRepository interface {
+	GetByRoleIDAndRoute(ctx context.Context, roleID int64, section, route string) (*entity.RoleRight, error)
+	GetByRoleID(ctx context.Context, roleID int64) ([]*entity.RoleRight, error)
+	GetAll(ctx context.Context) ([]*entity.RoleRight, error)
+	// GetEffective returns the section's rights of the roles and of all
+	// their ancestors, allow and deny alike.
+	GetEffective(ctx context.Context, roleIDs []int64, section string) ([]*entity.RoleRight, error)
+	Create(ctx context.Context, roleRight *entity.RoleRight) error
+	Update(ctx context.Context, roleRight *entity.RoleRight) error
+	Delete(ctx context.Context, id int64) error
+}
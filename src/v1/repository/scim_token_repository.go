@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"test-tablelink/src/entity"
+)
+
+type SCIMTokenRepository interface {
+	GetAll(ctx context.Context) ([]*entity.SCIMToken, error)
+	// GetByPrefix looks a token up by its public part, across
+	// organizations.
+	GetByPrefix(ctx context.Context, prefix string) (*entity.SCIMToken, error)
+	// Create inserts the token into the organization of ctx.
+	Create(ctx context.Context, token *entity.SCIMToken) error
+	// Delete removes the token, sql.ErrNoRows when there is no such token.
+	Delete(ctx context.Context, id int64) error
+	UpdateLastUsed(ctx context.Context, id int64, at time.Time) error
+}
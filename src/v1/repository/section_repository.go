@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"test-tablelink/src/entity"
+)
+
+type SectionRepository interface {
+	GetAll(ctx context.Context) ([]*entity.Section, error)
+	GetByName(ctx context.Context, name string) (*entity.Section, error)
+	Create(ctx context.Context, section *entity.Section) error
+	Delete(ctx context.Context, name string) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import "context"
+
+// Transactor runs fn in one transaction. Repository calls made with the
+// context passed to fn take part in it; fn returning an error rolls it
+// back. Nested calls join the outer transaction.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// Lock takes the advisory lock key for the transaction in ctx, waiting
+	// while another transaction holds it. It is released when the
+	// transaction ends, which serializes work across replicas.
+	Lock(ctx context.Context, key int64) error
+	// TryLock is Lock without the wait: it reports false when another
+	// transaction holds key.
+	TryLock(ctx context.Context, key int64) (bool, error)
+}
@@ -2,42 +2,30 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"time"
+
 	"test-tablelink/src/entity"
 )
 
 type UserRepository interface {
 	GetAll(ctx context.Context) ([]*entity.User, error)
-	GetByID(ctx context.Context, id int) (*entity.User, error)
+	GetByID(ctx context.Context, id int64) (*entity.User, error)
+	GetByEmail(ctx context.Context, email string) (*entity.User, error)
+	GetByEmailAndPassword(ctx context.Context, email, password string) (*entity.User, error)
 	Create(ctx context.Context, user *entity.User) error
 	Update(ctx context.Context, user *entity.User) error
-	Delete(ctx context.Context, id int) error
-}
-
-type userRepository struct {
-	db *sql.DB
-}
-
-func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepository{db: db}
-}
-
-func (r *userRepository) GetAll(ctx context.Context) ([]*entity.User, error) {
-	return nil, nil
-}
-
-func (r *userRepository) GetByID(ctx context.Context, id int) (*entity.User, error) {
-	return nil, nil
-}
-
-func (r *userRepository) Create(ctx context.Context, user *entity.User) error {
-	return nil
-}
-
-func (r *userRepository) Update(ctx context.Context, user *entity.User) error {
-	return nil
-}
-
-func (r *userRepository) Delete(ctx context.Context, id int) error {
-	return nil
+	AssignRole(ctx context.Context, userID int64, roleID int) error
+	UnassignRole(ctx context.Context, userID int64, roleID int) error
+	// AssignRoleUntil assigns the role until the given time. It never
+	// shortens a permanent assignment, and AssignRole makes a temporary one
+	// permanent.
+	AssignRoleUntil(ctx context.Context, userID int64, roleID int, until time.Time) error
+	// UnassignTemporaryRole removes the role only if it was assigned with
+	// AssignRoleUntil.
+	UnassignTemporaryRole(ctx context.Context, userID int64, roleID int) error
+	// RemoveExpiredRoles removes the assignments that expired at or before
+	// now and returns the IDs of the users that lost a role.
+	RemoveExpiredRoles(ctx context.Context, now time.Time) ([]int64, error)
+	UpdateLastAccess(ctx context.Context, id int64) error
+	Delete(ctx context.Context, id int64) error
 }
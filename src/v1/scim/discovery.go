@@ -0,0 +1,204 @@
+package scim
+
+// The discovery documents of RFC 7644 section 4: what the service
+// provider supports, its resource types and their schemas. They are the
+// same for every organization.
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type filterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type bulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+// ServiceProviderConfig describes the supported SCIM features.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  bulkSupport            `json:"bulk"`
+	Filter                filterSupport          `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	ETag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+// NewServiceProviderConfig returns the configuration: PATCH and filters,
+// no bulk, sorting or ETags, authentication with a SCIM bearer token.
+func NewServiceProviderConfig() *ServiceProviderConfig {
+	return &ServiceProviderConfig{
+		Schemas:        []string{ServiceProviderConfigSchema},
+		Patch:          supported{true},
+		Filter:         filterSupport{Supported: true, MaxResults: MaxResults},
+		ChangePassword: supported{true},
+		AuthenticationSchemes: []authenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "SCIM bearer token",
+			Description: "A token issued for the organization with POST /scim/tokens",
+			Primary:     true,
+		}},
+		Meta: Meta{ResourceType: "ServiceProviderConfig", Location: BasePath + "/ServiceProviderConfig"},
+	}
+}
+
+// ResourceType names a resource, its endpoint and schema.
+type ResourceType struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Endpoint    string   `json:"endpoint"`
+	Description string   `json:"description"`
+	Schema      string   `json:"schema"`
+	Meta        Meta     `json:"meta"`
+}
+
+// ResourceTypes returns the User and Group resource types.
+func ResourceTypes() []*ResourceType {
+	return []*ResourceType{
+		{
+			Schemas:     []string{ResourceTypeSchema},
+			ID:          "User",
+			Name:        "User",
+			Endpoint:    "/Users",
+			Description: "A user of the organization, userName is their email",
+			Schema:      UserSchema,
+			Meta:        Meta{ResourceType: "ResourceType", Location: BasePath + "/ResourceTypes/User"},
+		},
+		{
+			Schemas:     []string{ResourceTypeSchema},
+			ID:          "Group",
+			Name:        "Group",
+			Endpoint:    "/Groups",
+			Description: "A role of the organization, its members are the users holding it",
+			Schema:      GroupSchema,
+			Meta:        Meta{ResourceType: "ResourceType", Location: BasePath + "/ResourceTypes/Group"},
+		},
+	}
+}
+
+// Attribute describes an attribute of a schema.
+type Attribute struct {
+	Name          string       `json:"name"`
+	Type          string       `json:"type"`
+	MultiValued   bool         `json:"multiValued"`
+	Description   string       `json:"description,omitempty"`
+	Required      bool         `json:"required"`
+	CaseExact     bool         `json:"caseExact"`
+	Mutability    string       `json:"mutability"`
+	Returned      string       `json:"returned"`
+	Uniqueness    string       `json:"uniqueness"`
+	SubAttributes []*Attribute `json:"subAttributes,omitempty"`
+}
+
+// Schema lists the attributes of a resource.
+type Schema struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Attributes  []*Attribute `json:"attributes"`
+	Meta        Meta         `json:"meta"`
+}
+
+// attribute returns a single-valued, optional, read-write string
+// attribute, which the options adjust.
+func attribute(name, description string, options ...func(*Attribute)) *Attribute {
+	a := &Attribute{
+		Name:        name,
+		Type:        "string",
+		Description: description,
+		Mutability:  "readWrite",
+		Returned:    "default",
+		Uniqueness:  "none",
+	}
+	for _, option := range options {
+		option(a)
+	}
+	return a
+}
+
+func required(a *Attribute)    { a.Required = true }
+func multiValued(a *Attribute) { a.MultiValued = true }
+func readOnly(a *Attribute)    { a.Mutability = "readOnly" }
+func unique(a *Attribute)      { a.Uniqueness = "server" }
+
+func ofType(t string) func(*Attribute) {
+	return func(a *Attribute) { a.Type = t }
+}
+
+func writeOnly(a *Attribute) {
+	a.Mutability = "writeOnly"
+	a.Returned = "never"
+}
+
+func withSubAttributes(subs ...*Attribute) func(*Attribute) {
+	return func(a *Attribute) {
+		a.Type = "complex"
+		a.SubAttributes = subs
+	}
+}
+
+// Schemas returns the User and Group schemas, limited to the attributes
+// that are stored. Other attributes are accepted and ignored.
+func Schemas() []*Schema {
+	reference := func(description string) []*Attribute {
+		return []*Attribute{
+			attribute("value", "The id of the "+description),
+			attribute("display", "The name of the "+description, readOnly),
+			attribute("$ref", "The URI of the "+description, ofType("reference"), readOnly),
+		}
+	}
+	return []*Schema{
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          UserSchema,
+			Name:        "User",
+			Description: "User Account",
+			Attributes: []*Attribute{
+				attribute("userName", "The email the user logs in with", required, unique),
+				attribute("name", "The name of the user", withSubAttributes(
+					attribute("formatted", "The full name"),
+					attribute("givenName", "Joined into formatted when it is missing"),
+					attribute("familyName", "Joined into formatted when it is missing"),
+				)),
+				attribute("displayName", "The name of the user, same as name.formatted"),
+				attribute("emails", "The email of the user, same as userName", multiValued, readOnly, withSubAttributes(
+					attribute("value", "The email"),
+					attribute("type", "Always work"),
+					attribute("primary", "Always true", ofType("boolean")),
+				)),
+				attribute("active", "Whether the user may log in", ofType("boolean")),
+				attribute("password", "The password of the user", writeOnly),
+				attribute("groups", "The roles the user holds", multiValued, readOnly, withSubAttributes(reference("role")...)),
+			},
+			Meta: Meta{ResourceType: "Schema", Location: BasePath + "/Schemas/" + UserSchema},
+		},
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          GroupSchema,
+			Name:        "Group",
+			Description: "Role",
+			Attributes: []*Attribute{
+				attribute("displayName", "The name of the role", required, unique),
+				attribute("members", "The users holding the role", multiValued, withSubAttributes(reference("user")...)),
+			},
+			Meta: Meta{ResourceType: "Schema", Location: BasePath + "/Schemas/" + GroupSchema},
+		},
+	}
+}
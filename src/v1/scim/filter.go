@@ -0,0 +1,375 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Resource is anything a filter can be matched against: it returns the
+// values at an attribute path such as "userName" or "emails.value", none
+// when the attribute is absent.
+type Resource interface {
+	Values(path string) []string
+}
+
+// Filter is a parsed filter expression of RFC 7644 section 3.4.2.2:
+// attribute comparisons (eq, ne, co, sw, ew, gt, ge, lt, le, pr) joined
+// with and, or, not and parentheses. Attribute names and string values
+// are compared case-insensitively. Value paths such as
+// emails[type eq "work"] are only supported in PATCH paths.
+type Filter struct {
+	op       string
+	attr     string
+	value    *string
+	children []*Filter
+}
+
+// Match reports whether r matches the filter. A nil filter matches
+// everything.
+func (f *Filter) Match(r Resource) bool {
+	if f == nil {
+		return true
+	}
+	switch f.op {
+	case "and":
+		return f.children[0].Match(r) && f.children[1].Match(r)
+	case "or":
+		return f.children[0].Match(r) || f.children[1].Match(r)
+	case "not":
+		return !f.children[0].Match(r)
+	}
+
+	values := r.Values(f.attr)
+	if f.op == "pr" {
+		return len(values) > 0
+	}
+	if f.value == nil {
+		// only eq null and ne null are meaningful
+		return (f.op == "eq") == (len(values) == 0)
+	}
+	want := strings.ToLower(*f.value)
+	if f.op == "ne" {
+		for _, v := range values {
+			if strings.ToLower(v) == want {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compare(f.op, strings.ToLower(v), want) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(op, have, want string) bool {
+	switch op {
+	case "eq":
+		return have == want
+	case "co":
+		return strings.Contains(have, want)
+	case "sw":
+		return strings.HasPrefix(have, want)
+	case "ew":
+		return strings.HasSuffix(have, want)
+	case "gt":
+		return have > want
+	case "ge":
+		return have >= want
+	case "lt":
+		return have < want
+	case "le":
+		return have <= want
+	}
+	return false
+}
+
+var comparisons = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter expression. An empty expression is a nil
+// filter, which matches everything.
+func ParseFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, invalidFilter("unexpected %q", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+func invalidFilter(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusBadRequest, InvalidFilter, "invalid filter: "+format, args...)
+}
+
+type token struct {
+	text string
+	// quoted is set for string literals, text is then the unquoted value
+	quoted bool
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(expr[i:end+1]), &s); err != nil {
+				return nil, invalidFilter("bad string %s", expr[i:end+1])
+			}
+			tokens = append(tokens, token{text: s, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(expr) && !strings.ContainsRune(" \t\r\n()[]\"", rune(expr[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: expr[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword consumes the next token when it is the unquoted word.
+func (p *parser) keyword(word string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (*Filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{op: "or", children: []*Filter{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (*Filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{op: "and", children: []*Filter{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (*Filter, error) {
+	if p.keyword("not") {
+		f, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{op: "not", children: []*Filter{f}}, nil
+	}
+	if t, ok := p.peek(); ok && !t.quoted && t.text == "(" {
+		return p.group()
+	}
+	return p.comparison()
+}
+
+// group parses a parenthesized filter.
+func (p *parser) group() (*Filter, error) {
+	if !p.keyword("(") {
+		return nil, invalidFilter("expected \"(\"")
+	}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.keyword(")") {
+		return nil, invalidFilter("expected \")\"")
+	}
+	return f, nil
+}
+
+func (p *parser) comparison() (*Filter, error) {
+	t, ok := p.peek()
+	if !ok || t.quoted || !validAttrPath(t.text) {
+		return nil, invalidFilter("expected an attribute path, got %q", t.text)
+	}
+	p.pos++
+	attr := trimSchema(t.text)
+	if next, ok := p.peek(); ok && next.text == "[" && !next.quoted {
+		return nil, invalidFilter("value paths are not supported, use %s.<attribute>", attr)
+	}
+
+	opToken, ok := p.peek()
+	if !ok || opToken.quoted {
+		return nil, invalidFilter("expected an operator after %s", attr)
+	}
+	op := strings.ToLower(opToken.text)
+	p.pos++
+	if op == "pr" {
+		return &Filter{op: op, attr: attr}, nil
+	}
+	if !comparisons[op] {
+		return nil, invalidFilter("unknown operator %q", opToken.text)
+	}
+
+	v, ok := p.peek()
+	if !ok {
+		return nil, invalidFilter("expected a value after %s %s", attr, op)
+	}
+	p.pos++
+	f := &Filter{op: op, attr: attr}
+	switch {
+	case v.quoted:
+		f.value = &v.text
+	case v.text == "null":
+		if op != "eq" && op != "ne" {
+			return nil, invalidFilter("null only compares with eq and ne")
+		}
+	case v.text == "true" || v.text == "false":
+		f.value = &v.text
+	default:
+		if _, err := strconv.ParseFloat(v.text, 64); err != nil {
+			return nil, invalidFilter("bad value %q", v.text)
+		}
+		f.value = &v.text
+	}
+	return f, nil
+}
+
+func validAttrPath(s string) bool {
+	if s == "" || s == "(" || s == ")" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(".:_-$", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimSchema removes the core schema URN from a fully qualified attribute
+// path such as urn:ietf:params:scim:schemas:core:2.0:User:userName.
+func trimSchema(path string) string {
+	lower := strings.ToLower(path)
+	for _, schema := range []string{UserSchema, GroupSchema} {
+		if prefix := strings.ToLower(schema) + ":"; strings.HasPrefix(lower, prefix) {
+			return path[len(prefix):]
+		}
+	}
+	return path
+}
+
+// Path is a parsed PATCH path: an attribute, optionally narrowed to the
+// entries of a multi-valued attribute matching Filter, and a sub-attribute.
+// members[value eq "2"] has Attr "members" and a filter, name.givenName
+// has Attr "name" and Sub "givenname". Attr and Sub are lower case.
+type Path struct {
+	Attr   string
+	Filter *Filter
+	Sub    string
+}
+
+// ParsePath parses a PATCH path. Attributes of extension schemas keep
+// their URN in Attr.
+func ParsePath(path string) (*Path, error) {
+	path = trimSchema(strings.TrimSpace(path))
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return &Path{Attr: strings.ToLower(path)}, nil
+	}
+
+	p := &Path{}
+	attr, rest := path, ""
+	if i := strings.IndexByte(path, '['); i >= 0 {
+		end := strings.LastIndexByte(path, ']')
+		if end < i {
+			return nil, Errorf(http.StatusBadRequest, InvalidPath, "invalid path %q", path)
+		}
+		f, err := ParseFilter(path[i+1 : end])
+		if err != nil {
+			return nil, Errorf(http.StatusBadRequest, InvalidPath, "invalid path %q: %v", path, err)
+		}
+		p.Filter = f
+		attr, rest = path[:i], strings.TrimPrefix(path[end+1:], ".")
+	} else if i := strings.IndexByte(path, '.'); i >= 0 {
+		attr, rest = path[:i], path[i+1:]
+	}
+	if !validAttrPath(attr) || strings.Contains(rest, ".") {
+		return nil, Errorf(http.StatusBadRequest, InvalidPath, "invalid path %q", path)
+	}
+	p.Attr, p.Sub = strings.ToLower(attr), strings.ToLower(rest)
+	return p, nil
+}
+
+// Values makes an entry of a multi-valued attribute a Resource, for the
+// filters of PATCH paths.
+func (v MultiValue) Values(path string) []string {
+	switch strings.ToLower(path) {
+	case "value":
+		return []string{v.Value}
+	case "display":
+		return nonEmpty(v.Display)
+	case "type":
+		return nonEmpty(v.Type)
+	case "primary":
+		return []string{strconv.FormatBool(v.Primary)}
+	}
+	return nil
+}
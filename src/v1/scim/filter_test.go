@@ -0,0 +1,152 @@
+package scim
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testUser() *User {
+	active := Bool(true)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &User{
+		ID:          "7",
+		UserName:    "Jane@Corp.com",
+		DisplayName: "Jane Doe",
+		Emails:      []MultiValue{{Value: "jane@corp.com", Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      []MultiValue{{Value: "3", Display: "admin"}},
+		Meta:        &Meta{ResourceType: "User", Created: &created},
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "jane@corp.com"`, true},
+		{`USERNAME EQ "JANE@CORP.COM"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jane@corp.com"`, true},
+		{`userName eq "john@corp.com"`, false},
+		{`userName ne "john@corp.com"`, true},
+		{`userName sw "jane"`, true},
+		{`userName ew "@corp.com"`, true},
+		{`displayName co "doe"`, true},
+		{`emails.value eq "jane@corp.com"`, true},
+		{`emails eq "jane@corp.com"`, true},
+		{`groups.display eq "admin"`, true},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`externalId pr`, false},
+		{`externalId eq null`, true},
+		{`displayName ne null`, true},
+		{`meta.created gt "2024-01-01T00:00:00Z"`, true},
+		{`meta.created lt "2024-01-01T00:00:00Z"`, false},
+		{`userName eq "jane@corp.com" and active eq false`, false},
+		{`userName eq "x" or displayName eq "jane doe"`, true},
+		{`userName eq "x" or userName eq "y" and active eq true`, false},
+		{`(userName eq "x" or userName eq "jane@corp.com") and active eq true`, true},
+		{`not (userName eq "jane@corp.com")`, false},
+		{`displayName eq "Jane \"JD\" Doe"`, false},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%s): %v", tt.filter, err)
+			continue
+		}
+		if got := f.Match(testUser()); got != tt.want {
+			t.Errorf("%s = %t, want %t", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		`userName`,
+		`userName eq`,
+		`userName like "x"`,
+		`userName eq "x`,
+		`userName eq x`,
+		`userName gt null`,
+		`(userName eq "x"`,
+		`userName eq "x" and`,
+		`not userName eq "x"`,
+		`emails[type eq "work"]`,
+		`userName eq "x" "y"`,
+	} {
+		_, err := ParseFilter(filter)
+		var scimErr *Error
+		if !errors.As(err, &scimErr) || scimErr.ScimType != InvalidFilter || scimErr.StatusCode() != 400 {
+			t.Errorf("ParseFilter(%s) = %v, want an invalidFilter error", filter, err)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	p, err := ParsePath(`members[value eq "2"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Attr != "members" || p.Sub != "" || !p.Filter.Match(MultiValue{Value: "2"}) || p.Filter.Match(MultiValue{Value: "3"}) {
+		t.Errorf("path = %+v", p)
+	}
+
+	p, err = ParsePath(`emails[type eq "work"].value`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Attr != "emails" || p.Sub != "value" || !p.Filter.Match(MultiValue{Type: "work"}) {
+		t.Errorf("path = %+v", p)
+	}
+
+	p, err = ParsePath("name.givenName")
+	if err != nil || p.Attr != "name" || p.Sub != "givenname" {
+		t.Errorf("path = %+v, %v", p, err)
+	}
+
+	p, err = ParsePath("urn:ietf:params:scim:schemas:core:2.0:User:active")
+	if err != nil || p.Attr != "active" {
+		t.Errorf("path = %+v, %v", p, err)
+	}
+
+	p, err = ParsePath("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department")
+	if err != nil || p.Attr != "urn:ietf:params:scim:schemas:extension:enterprise:2.0:user:department" {
+		t.Errorf("path = %+v, %v", p, err)
+	}
+
+	for _, path := range []string{`members[value eq`, `members]value[`, "a.b.c", "bad path"} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("ParsePath(%q) accepted an invalid path", path)
+		}
+	}
+}
+
+func TestParseQueryAndList(t *testing.T) {
+	q, err := ParseQuery(url.Values{"startIndex": {"2"}, "count": {"1000"}, "excludedAttributes": {"members"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.StartIndex != 2 || q.Count != MaxResults || !q.Excludes("members") {
+		t.Errorf("query = %+v", q)
+	}
+	if _, err := ParseQuery(url.Values{"count": {"x"}}); err == nil {
+		t.Error("ParseQuery accepted a bad count")
+	}
+
+	resources := []Resource{
+		&Group{ID: "1", DisplayName: "a"},
+		&Group{ID: "2", DisplayName: "b"},
+		&Group{ID: "3", DisplayName: "c"},
+	}
+	list := List(resources, &Query{StartIndex: 2, Count: 1})
+	if list.TotalResults != 3 || list.ItemsPerPage != 1 || list.Resources.([]Resource)[0].(*Group).ID != "2" {
+		t.Errorf("list = %+v", list)
+	}
+	list = List(resources, &Query{StartIndex: 10, Count: 5})
+	if list.TotalResults != 3 || list.ItemsPerPage != 0 {
+		t.Errorf("list past the end = %+v", list)
+	}
+}
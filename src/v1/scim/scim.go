@@ -0,0 +1,365 @@
+// Package scim holds the wire format of SCIM 2.0 (RFC 7643 and 7644): the
+// User and Group resources, list and patch messages, errors, the filter
+// language and the discovery documents. Mapping resources onto users and
+// roles is left to the service.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BasePath is where the SCIM endpoints are served.
+const BasePath = "/scim/v2"
+
+// ContentType is the media type of every SCIM request and response.
+const ContentType = "application/scim+json"
+
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// MaxResults is the most resources one list response returns.
+const MaxResults = 200
+
+// The scimType values of RFC 7644 section 3.12.
+const (
+	InvalidFilter = "invalidFilter"
+	InvalidSyntax = "invalidSyntax"
+	InvalidPath   = "invalidPath"
+	InvalidValue  = "invalidValue"
+	NoTarget      = "noTarget"
+	Uniqueness    = "uniqueness"
+	Mutability    = "mutability"
+)
+
+// Error is a SCIM error response. It is also returned as an error by the
+// service, so the handler can send it as is.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// Errorf returns an Error with an HTTP status and a scimType, which may be
+// empty.
+func Errorf(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// StatusCode returns the HTTP status of the error.
+func (e *Error) StatusCode() int {
+	code, err := strconv.Atoi(e.Status)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return code
+}
+
+// Meta describes a resource. Created and LastModified are left out when
+// zero.
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+// Name is the structured name of a user. Only Formatted is stored, the
+// parts are joined into it when it is missing.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Full returns Formatted, or the given and family names.
+func (n *Name) Full() string {
+	if n == nil {
+		return ""
+	}
+	if n.Formatted != "" {
+		return n.Formatted
+	}
+	return strings.TrimSpace(n.GivenName + " " + n.FamilyName)
+}
+
+// MultiValue is an entry of a multi-valued attribute such as emails,
+// groups or members.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Bool is a boolean that also accepts "True" and "False" strings, which
+// some providers send for active.
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseBool(strings.ToLower(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		*b = Bool(v)
+		return nil
+	}
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = Bool(v)
+	return nil
+}
+
+// User is the SCIM User resource. Password is only ever read.
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *Bool        `json:"active,omitempty"`
+	Password    string       `json:"password,omitempty"`
+	Groups      []MultiValue `json:"groups,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// Values returns the values at path for filtering, see Filter.
+func (u *User) Values(path string) []string {
+	switch strings.ToLower(path) {
+	case "id":
+		return []string{u.ID}
+	case "externalid":
+		return nonEmpty(u.ExternalID)
+	case "username":
+		return []string{u.UserName}
+	case "displayname":
+		return nonEmpty(u.DisplayName)
+	case "name.formatted":
+		return nonEmpty(u.Name.Full())
+	case "active":
+		if u.Active == nil {
+			return nil
+		}
+		return []string{strconv.FormatBool(bool(*u.Active))}
+	case "emails", "emails.value":
+		return multiValues(u.Emails)
+	case "groups", "groups.value":
+		return multiValues(u.Groups)
+	case "groups.display":
+		return multiDisplays(u.Groups)
+	case "meta.created":
+		return timestamp(u.Meta, true)
+	case "meta.lastmodified":
+		return timestamp(u.Meta, false)
+	}
+	return nil
+}
+
+// Group is the SCIM Group resource.
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// Values returns the values at path for filtering, see Filter.
+func (g *Group) Values(path string) []string {
+	switch strings.ToLower(path) {
+	case "id":
+		return []string{g.ID}
+	case "externalid":
+		return nonEmpty(g.ExternalID)
+	case "displayname":
+		return []string{g.DisplayName}
+	case "members", "members.value":
+		return multiValues(g.Members)
+	case "members.display":
+		return multiDisplays(g.Members)
+	case "meta.created":
+		return timestamp(g.Meta, true)
+	case "meta.lastmodified":
+		return timestamp(g.Meta, false)
+	}
+	return nil
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func multiValues(values []MultiValue) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, v.Value)
+	}
+	return out
+}
+
+func multiDisplays(values []MultiValue) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v.Display != "" {
+			out = append(out, v.Display)
+		}
+	}
+	return out
+}
+
+func timestamp(meta *Meta, created bool) []string {
+	if meta == nil {
+		return nil
+	}
+	at := meta.LastModified
+	if created {
+		at = meta.Created
+	}
+	if at == nil {
+		return nil
+	}
+	return []string{at.UTC().Format(time.RFC3339)}
+}
+
+// ListResponse is a page of resources. StartIndex is 1-based.
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// PatchRequest is a PATCH body.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation adds, replaces or removes the value at Path, or the
+// attributes of Value when there is no path. Op is compared
+// case-insensitively, some providers send "Replace".
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Query is the paging, filtering and attribute selection of a list
+// request.
+type Query struct {
+	Filter *Filter
+	// StartIndex is 1-based
+	StartIndex int
+	Count      int
+	// ExcludedAttributes are lower case
+	ExcludedAttributes []string
+}
+
+// ParseQuery reads filter, startIndex, count and excludedAttributes. Count
+// defaults to, and is capped at, MaxResults.
+func ParseQuery(values url.Values) (*Query, error) {
+	q := &Query{StartIndex: 1, Count: MaxResults}
+	filter, err := ParseFilter(values.Get("filter"))
+	if err != nil {
+		return nil, err
+	}
+	q.Filter = filter
+	if s := values.Get("startIndex"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, Errorf(http.StatusBadRequest, InvalidValue, "startIndex must be a number")
+		}
+		if n > 1 {
+			q.StartIndex = n
+		}
+	}
+	if s := values.Get("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, Errorf(http.StatusBadRequest, InvalidValue, "count must be a number")
+		}
+		q.Count = min(max(n, 0), MaxResults)
+	}
+	for _, attr := range strings.Split(values.Get("excludedAttributes"), ",") {
+		if attr = strings.ToLower(trimSchema(strings.TrimSpace(attr))); attr != "" {
+			q.ExcludedAttributes = append(q.ExcludedAttributes, attr)
+		}
+	}
+	return q, nil
+}
+
+// Excludes reports whether attr, lower case, is left out of the response.
+func (q *Query) Excludes(attr string) bool {
+	for _, excluded := range q.ExcludedAttributes {
+		if excluded == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the page of the resources matching the query's filter.
+func List(resources []Resource, q *Query) *ListResponse {
+	matched := make([]Resource, 0, len(resources))
+	for _, r := range resources {
+		if q.Filter.Match(r) {
+			matched = append(matched, r)
+		}
+	}
+	from := min(q.StartIndex-1, len(matched))
+	to := min(from+q.Count, len(matched))
+	return &ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: len(matched),
+		StartIndex:   q.StartIndex,
+		ItemsPerPage: to - from,
+		Resources:    matched[from:to],
+	}
+}
+
+// Write sends v as a SCIM response.
+func Write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError sends err as a SCIM error response.
+func WriteError(w http.ResponseWriter, err *Error) {
+	Write(w, err.StatusCode(), err)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+)
+
+var (
+	// ErrInvalidAPIToken is returned for a token request without a name or
+	// scopes, with a malformed scope or an out of range lifetime, and when
+	// authenticating with a token that is unknown, expired or revoked.
+	ErrInvalidAPIToken = errors.New("invalid API token")
+	// ErrSessionRequired is returned when API tokens are managed with an
+	// API token, which could otherwise mint itself broader scopes.
+	ErrSessionRequired = errors.New("API tokens can only be managed when logged in")
+)
+
+// APITokenService manages personal access tokens: named, scoped and
+// expiring tokens for scripts and other machine clients. A token reads
+// "tlk_<id>_<secret>"; "tlk_<id>" is its public prefix and only the SHA-256
+// of the whole token is stored.
+type APITokenService struct {
+	apiTokenRepo repository.APITokenRepository
+	userRepo     repository.UserRepository
+	groupRepo    repository.GroupRepository
+	maxLifetime  time.Duration
+	now          func() time.Time
+}
+
+func NewAPITokenService(
+	apiTokenRepo repository.APITokenRepository,
+	userRepo repository.UserRepository,
+	groupRepo repository.GroupRepository,
+	maxLifetime time.Duration,
+) *APITokenService {
+	return &APITokenService{
+		apiTokenRepo: apiTokenRepo,
+		userRepo:     userRepo,
+		groupRepo:    groupRepo,
+		maxLifetime:  maxLifetime,
+		now:          time.Now,
+	}
+}
+
+// owner returns the logged in user, refusing requests made with an API
+// token or while impersonating the user.
+func (s *APITokenService) owner(ctx context.Context) (*entity.User, error) {
+	if _, ok := authz.TokenScopes(ctx); ok {
+		return nil, ErrSessionRequired
+	}
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	return currentUser(ctx)
+}
+
+func (s *APITokenService) GetTokens(ctx context.Context) (*contract.APITokenResponse, error) {
+	user, err := s.owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.apiTokenRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.APITokenResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    tokens,
+	}, nil
+}
+
+// CreateToken issues a token for the logged in user. The token is only
+// part of this response.
+func (s *APITokenService) CreateToken(ctx context.Context, req *contract.CreateAPITokenRequest) (*contract.APITokenResponse, error) {
+	user, err := s.owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := s.maxLifetime
+	if req.ExpiresIn != "" {
+		lifetime, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || lifetime < time.Minute {
+			return nil, fmt.Errorf("%w: expires_in must be a duration such as 720h", ErrInvalidAPIToken)
+		}
+	}
+	switch {
+	case lifetime > s.maxLifetime:
+		return nil, fmt.Errorf("%w: expires_in must be at most %s", ErrInvalidAPIToken, s.maxLifetime)
+	case strings.TrimSpace(req.Name) == "":
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIToken)
+	case len(req.Scopes) == 0:
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIToken)
+	}
+
+	scopes := make([]entity.TokenScope, 0, len(req.Scopes))
+	for _, sc := range req.Scopes {
+		if sc.Section == "" || !strings.HasPrefix(sc.Route, "/") || !(sc.Create || sc.Read || sc.Update || sc.Delete) {
+			return nil, fmt.Errorf("%w: a scope needs a section, a route and at least one operation", ErrInvalidAPIToken)
+		}
+		scopes = append(scopes, entity.TokenScope{
+			Section: sc.Section,
+			Route:   sc.Route,
+			Create:  sc.Create,
+			Read:    sc.Read,
+			Update:  sc.Update,
+			Delete:  sc.Delete,
+		})
+	}
+
+	raw, prefix, err := generatePrefixedToken(entity.APITokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+	token := &entity.APIToken{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: s.now().Add(lifetime),
+	}
+	if err := s.apiTokenRepo.Create(ctx, token); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: api token created id=%d user=%d prefix=%s expires_at=%s", token.ID, user.ID, prefix, token.ExpiresAt.Format(time.RFC3339))
+
+	return &contract.APITokenResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    contract.CreatedAPIToken{Token: raw, APIToken: token},
+	}, nil
+}
+
+// RevokeToken ends one of the logged in user's tokens, sql.ErrNoRows when
+// they have no such active token.
+func (s *APITokenService) RevokeToken(ctx context.Context, id int64) (*contract.APITokenResponse, error) {
+	user, err := s.owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apiTokenRepo.Revoke(ctx, user.ID, id, s.now()); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: api token revoked id=%d user=%d", id, user.ID)
+
+	return &contract.APITokenResponse{
+		Status:  true,
+		Message: "Successfully",
+	}, nil
+}
+
+// Authenticate returns the owner of an active token, with their group
+// roles, and the token with its scopes. The request must then be limited
+// to the scopes, see authz.Restrict.
+func (s *APITokenService) Authenticate(ctx context.Context, raw string) (*entity.User, *entity.APIToken, error) {
+	prefix, ok := publicPrefix(raw, entity.APITokenPrefix)
+	if !ok {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	token, err := s.apiTokenRepo.GetByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := s.now()
+	if subtle.ConstantTimeCompare([]byte(token.TokenHash), []byte(hashToken(raw))) != 1 || !token.Active(now) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, ErrUserDisabled
+	}
+	if err := withGroupRoles(ctx, s.groupRepo, user); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.apiTokenRepo.UpdateLastUsed(ctx, token.ID, now); err != nil {
+		return nil, nil, err
+	}
+	token.LastUsedAt = &now
+	return user, token, nil
+}
+
+// generatePrefixedToken returns a new "<prefix><id>_<secret>" token and
+// its public part, "<prefix><id>".
+func generatePrefixedToken(tokenPrefix string) (string, string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix := tokenPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// publicPrefix returns the public part of a token made by
+// generatePrefixedToken.
+func publicPrefix(raw, tokenPrefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, tokenPrefix)
+	if !ok {
+		return "", false
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok || id == "" {
+		return "", false
+	}
+	return tokenPrefix + id, true
+}
+
+// hashToken returns the hex SHA-256 of a token. Tokens carry 256 random
+// bits, so unlike passwords they need no slow hash.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
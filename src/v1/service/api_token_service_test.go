@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+var readUsers = contract.APITokenScope{Section: "be", Route: "/users/user", Read: true}
+
+func TestAPITokenServiceCreate(t *testing.T) {
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "user@gmail.com", "secret")
+	svc := NewAPITokenService(repos.apiTokens, repos.users, repos.groups, 24*time.Hour)
+	ctx := context.WithValue(tenant.All(context.Background()), "user", user)
+
+	tests := []struct {
+		name string
+		req  contract.CreateAPITokenRequest
+	}{
+		{"no name", contract.CreateAPITokenRequest{Scopes: []contract.APITokenScope{readUsers}}},
+		{"no scopes", contract.CreateAPITokenRequest{Name: "ci"}},
+		{"scope without operation", contract.CreateAPITokenRequest{Name: "ci", Scopes: []contract.APITokenScope{{Section: "be", Route: "/users/user"}}}},
+		{"relative route", contract.CreateAPITokenRequest{Name: "ci", Scopes: []contract.APITokenScope{{Section: "be", Route: "users", Read: true}}}},
+		{"bad lifetime", contract.CreateAPITokenRequest{Name: "ci", Scopes: []contract.APITokenScope{readUsers}, ExpiresIn: "soon"}},
+		{"lifetime too long", contract.CreateAPITokenRequest{Name: "ci", Scopes: []contract.APITokenScope{readUsers}, ExpiresIn: "48h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.CreateToken(ctx, &tt.req); !errors.Is(err, ErrInvalidAPIToken) {
+				t.Errorf("CreateToken error = %v, want ErrInvalidAPIToken", err)
+			}
+		})
+	}
+
+	resp, err := svc.CreateToken(ctx, &contract.CreateAPITokenRequest{Name: "ci", Scopes: []contract.APITokenScope{readUsers}})
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	created := resp.Data.(contract.CreatedAPIToken)
+	token := created.APIToken.(*entity.APIToken)
+	if !strings.HasPrefix(created.Token, token.Prefix+"_") || !strings.HasPrefix(token.Prefix, entity.APITokenPrefix) {
+		t.Errorf("token %q does not start with its prefix %q", created.Token, token.Prefix)
+	}
+	if token.TokenHash == created.Token || strings.Contains(token.TokenHash, created.Token) {
+		t.Error("the token is stored in clear")
+	}
+	if got := token.ExpiresAt.Sub(token.CreatedAt); got < 23*time.Hour || got > 25*time.Hour {
+		t.Errorf("lifetime = %s, want the 24h maximum by default", got)
+	}
+
+	// Tokens cannot manage tokens
+	scoped := authz.WithTokenScopes(ctx, token.Rights())
+	if _, err := svc.CreateToken(scoped, &contract.CreateAPITokenRequest{Name: "more", Scopes: []contract.APITokenScope{readUsers}}); !errors.Is(err, ErrSessionRequired) {
+		t.Errorf("CreateToken with a token error = %v, want ErrSessionRequired", err)
+	}
+}
+
+func TestAPITokenServiceAuthenticate(t *testing.T) {
+	bg := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "user@gmail.com", "secret")
+	svc := NewAPITokenService(repos.apiTokens, repos.users, repos.groups, 24*time.Hour)
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+	ctx := context.WithValue(bg, "user", user)
+
+	create := func(expiresIn string) (string, int64) {
+		t.Helper()
+		resp, err := svc.CreateToken(ctx, &contract.CreateAPITokenRequest{Name: "ci", Scopes: []contract.APITokenScope{readUsers}, ExpiresIn: expiresIn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created := resp.Data.(contract.CreatedAPIToken)
+		return created.Token, created.APIToken.(*entity.APIToken).ID
+	}
+	raw, id := create("")
+
+	got, token, err := svc.Authenticate(bg, raw)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got.ID != user.ID || len(token.Scopes) != 1 || token.Scopes[0].Route != readUsers.Route {
+		t.Errorf("Authenticate = %+v, %+v, want the owner and the token's scope", got, token)
+	}
+	listed, _ := repos.apiTokens.GetByUserID(bg, user.ID)
+	if len(listed) != 1 || listed[0].LastUsedAt == nil || !listed[0].LastUsedAt.Equal(now) {
+		t.Errorf("last used = %+v, want %s", listed, now)
+	}
+
+	if _, _, err := svc.Authenticate(bg, raw+"x"); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("wrong secret error = %v, want ErrInvalidAPIToken", err)
+	}
+	if _, _, err := svc.Authenticate(bg, entity.APITokenPrefix+"0000_secret"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown prefix error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Expired
+	short, _ := create("1h")
+	now = now.Add(2 * time.Hour)
+	if _, _, err := svc.Authenticate(bg, short); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("expired token error = %v, want ErrInvalidAPIToken", err)
+	}
+
+	// Revoked, only by its owner
+	other := repos.createUser(t, role.ID, "other@gmail.com", "secret")
+	if _, err := svc.RevokeToken(context.WithValue(bg, "user", other), id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("revoking another user's token error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := svc.RevokeToken(ctx, id); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, _, err := svc.Authenticate(bg, raw); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("revoked token error = %v, want ErrInvalidAPIToken", err)
+	}
+	if _, err := svc.RevokeToken(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second revoke error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Disabled owner
+	live, _ := create("")
+	stored, _ := repos.users.GetByID(bg, user.ID)
+	stored.DisabledAt = &now
+	if err := repos.users.Update(bg, stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Authenticate(bg, live); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("disabled owner error = %v, want ErrUserDisabled", err)
+	}
+}
@@ -4,27 +4,48 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
+	"log"
+	"strings"
 
 	"test-tablelink/src/entity"
-	"test-tablelink/src/repository"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var (
+	// ErrUserDisabled is returned when a disabled user logs in or uses a
+	// token issued before they were disabled.
+	ErrUserDisabled = authn.ErrUserDisabled
+	// ErrInvalidCredentials is returned for an unknown email or a wrong
+	// password, without telling which.
+	ErrInvalidCredentials = authn.ErrInvalidCredentials
 )
 
 type AuthService struct {
-	userRepo  *repository.UserRepository
-	redisRepo *repository.RedisRepository
+	userRepo         repository.UserRepository
+	organizationRepo repository.OrganizationRepository
+	groupRepo        repository.GroupRepository
+	redisRepo        repository.RedisRepository
+	authenticator    authn.Authenticator
 }
 
-func NewAuthService(userRepo *repository.UserRepository, redisRepo *repository.RedisRepository) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, organizationRepo repository.OrganizationRepository, groupRepo repository.GroupRepository, redisRepo repository.RedisRepository, authenticator authn.Authenticator) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		redisRepo: redisRepo,
+		userRepo:         userRepo,
+		organizationRepo: organizationRepo,
+		groupRepo:        groupRepo,
+		redisRepo:        redisRepo,
+		authenticator:    authenticator,
 	}
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	// Organization is the slug of the user's organization, the default
+	// organization when empty
+	Organization string `json:"organization,omitempty"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
 }
 
 type LoginResponse struct {
@@ -34,12 +55,23 @@ type LoginResponse struct {
 }
 
 func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
-	// Get user by email and password
-	user, err := s.userRepo.GetByEmailAndPassword(ctx, req.Email, req.Password)
+	// Emails are unique per organization, look the user up in the one named
+	organization, err := resolveOrganization(ctx, s.organizationRepo, req.Organization)
+	if err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithOrganization(ctx, organization.ID)
+
+	user, err := s.CheckPassword(ctx, req.Email, req.Password)
 	if err != nil {
-		return nil, errors.New("invalid email or password")
+		return nil, err
 	}
+	return s.StartSession(ctx, user)
+}
 
+// StartSession issues a session token for a user who proved who they are,
+// with a password or at an identity provider.
+func (s *AuthService) StartSession(ctx context.Context, user *entity.User) (*LoginResponse, error) {
 	// Generate access token
 	token, err := generateToken()
 	if err != nil {
@@ -71,15 +103,36 @@ func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*LoginRespo
 	}, nil
 }
 
+// CheckPassword returns the active user with login and password in the
+// organization of ctx, without starting a session. The authenticator
+// decides whether the password is right: the users table, an LDAP
+// directory or a chain of them.
+func (s *AuthService) CheckPassword(ctx context.Context, login, pass string) (*entity.User, error) {
+	user, err := s.authenticator.Authenticate(ctx, login, pass)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
 func (s *AuthService) Logout(ctx context.Context, token string) error {
+	// Logging out of an impersonation ends it, the user's own sessions
+	// go on
+	if strings.HasPrefix(token, entity.ImpersonationTokenPrefix) {
+		return s.endImpersonation(ctx, token)
+	}
+
 	// Get user ID from token
 	userID, err := s.redisRepo.GetUserIDByToken(ctx, token)
 	if err != nil {
 		return err
 	}
 
-	// Get user by ID
-	user, err := s.userRepo.GetByID(ctx, userID)
+	// Get user by ID, the token tells the organization
+	user, err := s.userRepo.GetByID(tenant.All(ctx), userID)
 	if err != nil {
 		return err
 	}
@@ -94,6 +147,18 @@ func (s *AuthService) Logout(ctx context.Context, token string) error {
 	return s.redisRepo.DeleteToken(ctx, token)
 }
 
+func (s *AuthService) endImpersonation(ctx context.Context, token string) error {
+	impersonation, err := s.redisRepo.GetImpersonation(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := s.redisRepo.DeleteImpersonation(ctx, token); err != nil {
+		return err
+	}
+	log.Printf("audit: impersonation ended impersonator=%d user=%d", impersonation.ImpersonatorID, impersonation.UserID)
+	return nil
+}
+
 func (s *AuthService) ValidateToken(ctx context.Context, token string) (*entity.User, error) {
 	// Get user ID from token
 	userID, err := s.redisRepo.GetUserIDByToken(ctx, token)
@@ -106,6 +171,9 @@ func (s *AuthService) ValidateToken(ctx context.Context, token string) (*entity.
 	if err != nil {
 		return nil, err
 	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
 
 	// Get user data from Redis
 	cachedUser, err := s.redisRepo.GetUser(ctx, user.ID)
@@ -113,6 +181,12 @@ func (s *AuthService) ValidateToken(ctx context.Context, token string) (*entity.
 		return nil, err
 	}
 
+	// Group roles are resolved per request, so membership changes apply to
+	// running sessions without refreshing the cached user
+	if err := withGroupRoles(ctx, s.groupRepo, cachedUser); err != nil {
+		return nil, err
+	}
+
 	return cachedUser, nil
 }
 
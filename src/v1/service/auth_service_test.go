@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/tenant"
+
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+type testRepos struct {
+	store       *memory.Store
+	users       *memory.UserRepository
+	roles       *memory.RoleRepository
+	roleRights  *memory.RoleRightRepository
+	redis       *memory.RedisRepository
+	grants      *memory.RoleGrantRepository
+	orgs        *memory.OrganizationRepository
+	groups      *memory.GroupRepository
+	apiTokens   *memory.APITokenRepository
+	clients     *memory.OAuthClientRepository
+	oidcClients *memory.OIDCClientRepository
+	identities  *memory.FederatedIdentityRepository
+	scimTokens  *memory.SCIMTokenRepository
+}
+
+func newTestRepos(t *testing.T) *testRepos {
+	t.Helper()
+	store := memory.NewStore()
+	return &testRepos{
+		store:       store,
+		users:       memory.NewUserRepository(store),
+		roles:       memory.NewRoleRepository(store),
+		roleRights:  memory.NewRoleRightRepository(store),
+		redis:       memory.NewRedisRepository(),
+		grants:      memory.NewRoleGrantRepository(store),
+		orgs:        memory.NewOrganizationRepository(store),
+		groups:      memory.NewGroupRepository(store),
+		apiTokens:   memory.NewAPITokenRepository(store),
+		clients:     memory.NewOAuthClientRepository(store),
+		oidcClients: memory.NewOIDCClientRepository(store),
+		identities:  memory.NewFederatedIdentityRepository(store),
+		scimTokens:  memory.NewSCIMTokenRepository(store),
+	}
+}
+
+func (r *testRepos) createRole(t *testing.T, name string) *entity.Role {
+	t.Helper()
+	role := &entity.Role{Name: name}
+	if err := r.roles.Create(tenant.All(context.Background()), role); err != nil {
+		t.Fatalf("create role %q: %v", name, err)
+	}
+	return role
+}
+
+func (r *testRepos) createUser(t *testing.T, roleID int, email, password string) *entity.User {
+	t.Helper()
+	user := &entity.User{
+		Roles:    []entity.Role{{ID: roleID}},
+		Name:     email,
+		Email:    email,
+		Password: password,
+	}
+	if err := r.users.Create(tenant.All(context.Background()), user); err != nil {
+		t.Fatalf("create user %q: %v", email, err)
+	}
+	return user
+}
+
+func TestAuthServiceLogin(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "admin")
+	user := repos.createUser(t, role.ID, "admin@gmail.com", "adminadmin")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+
+	resp, err := svc.Login(ctx, &LoginRequest{Email: "admin@gmail.com", Password: "adminadmin"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !resp.Status || resp.AccessToken == "" {
+		t.Fatalf("Login response = %+v, want status and token", resp)
+	}
+
+	userID, err := repos.redis.GetUserIDByToken(ctx, resp.AccessToken)
+	if err != nil || userID != user.ID {
+		t.Fatalf("token maps to %d (%v), want %d", userID, err, user.ID)
+	}
+
+	cached, err := repos.redis.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("user not cached: %v", err)
+	}
+	if !cached.HasRole("admin") {
+		t.Errorf("cached roles = %+v, want admin", cached.Roles)
+	}
+
+	stored, _ := repos.users.GetByID(ctx, user.ID)
+	if stored.LastAccess == nil {
+		t.Error("last access was not updated")
+	}
+	if !password.IsHashed(stored.Password) {
+		t.Error("legacy plain text password was not upgraded to a hash")
+	}
+
+	// Logging in again checks against the upgraded hash
+	if _, err := svc.Login(ctx, &LoginRequest{Email: "admin@gmail.com", Password: "adminadmin"}); err != nil {
+		t.Fatalf("Login with hashed password: %v", err)
+	}
+}
+
+func TestAuthServiceLoginInvalidCredentials(t *testing.T) {
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "admin")
+	repos.createUser(t, role.ID, "admin@gmail.com", "adminadmin")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+
+	tests := []struct {
+		name string
+		req  LoginRequest
+	}{
+		{"wrong password", LoginRequest{Email: "admin@gmail.com", Password: "nope"}},
+		{"unknown email", LoginRequest{Email: "ghost@gmail.com", Password: "adminadmin"}},
+		{"empty", LoginRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Login(context.Background(), &tt.req); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthServiceValidateToken(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "user@gmail.com", "secret")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+
+	resp, err := svc.Login(ctx, &LoginRequest{Email: "user@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	got, err := svc.ValidateToken(ctx, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if got.ID != user.ID || len(got.Roles) != 1 || got.Roles[0].ID != role.ID {
+		t.Errorf("ValidateToken = %+v, want user %d with role %d", got, user.ID, role.ID)
+	}
+
+	if _, err := svc.ValidateToken(ctx, "unknown"); !errors.Is(err, goRedis.Nil) {
+		t.Errorf("ValidateToken(unknown) error = %v, want redis.Nil", err)
+	}
+}
+
+func TestAuthServiceLogout(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "user@gmail.com", "secret")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+
+	resp, err := svc.Login(ctx, &LoginRequest{Email: "user@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	if err := svc.Logout(ctx, resp.AccessToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := svc.ValidateToken(ctx, resp.AccessToken); err == nil {
+		t.Error("token still valid after logout")
+	}
+	if _, err := repos.redis.GetUser(ctx, user.ID); !errors.Is(err, goRedis.Nil) {
+		t.Errorf("cached user error = %v, want redis.Nil", err)
+	}
+	if err := svc.Logout(ctx, resp.AccessToken); err == nil {
+		t.Error("second logout should fail")
+	}
+}
+
+func TestAuthServiceDisabledUser(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "user@gmail.com", "secret")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+
+	resp, err := svc.Login(ctx, &LoginRequest{Email: "user@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	stored, _ := repos.users.GetByID(ctx, user.ID)
+	now := time.Now()
+	stored.DisabledAt = &now
+	if err := repos.users.Update(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.ValidateToken(ctx, resp.AccessToken); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("ValidateToken error = %v, want ErrUserDisabled", err)
+	}
+	if _, err := svc.Login(ctx, &LoginRequest{Email: "user@gmail.com", Password: "secret"}); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Login error = %v, want ErrUserDisabled", err)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+)
+
+// ErrInvalidCheck is returned for an incomplete POST /authz/check request.
+var ErrInvalidCheck = errors.New("invalid authorization check")
+
+type AuthzService struct {
+	authorizer authz.Authorizer
+	userRepo   repository.UserRepository
+	roleRepo   repository.RoleRepository
+	groupRepo  repository.GroupRepository
+}
+
+func NewAuthzService(authorizer authz.Authorizer, userRepo repository.UserRepository, roleRepo repository.RoleRepository, groupRepo repository.GroupRepository) *AuthzService {
+	return &AuthzService{
+		authorizer: authorizer,
+		userRepo:   userRepo,
+		roleRepo:   roleRepo,
+		groupRepo:  groupRepo,
+	}
+}
+
+// Check runs the authorizer for req without performing the request. route
+// and params are the chi pattern and route parameters the path resolves to.
+func (s *AuthzService) Check(ctx context.Context, req *contract.AuthzCheckRequest, route string, params map[string]string) (*contract.AuthzCheckResponse, error) {
+	if req.Section == "" || req.Method == "" || req.Path == "" {
+		return nil, fmt.Errorf("%w: section, method and path are required", ErrInvalidCheck)
+	}
+	subject, err := s.subject(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, err := s.authorizer.Authorize(ctx, &authz.Request{
+		User:     subject,
+		Section:  req.Section,
+		Route:    route,
+		Path:     req.Path,
+		Method:   strings.ToUpper(req.Method),
+		Resource: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := contract.AuthzCheckResult{
+		Allowed: decision.Allowed,
+		Reason:  decision.Reason,
+		Route:   route,
+		Matched: []contract.AuthzRule{},
+		Policy:  decision.Policy,
+	}
+	names := make(map[int64]string)
+	for _, r := range decision.Matched {
+		rule, err := s.rule(ctx, r, names)
+		if err != nil {
+			return nil, err
+		}
+		result.Matched = append(result.Matched, rule)
+		if r == decision.Rule {
+			result.Rule = &result.Matched[len(result.Matched)-1]
+		}
+	}
+
+	return &contract.AuthzCheckResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    result,
+	}, nil
+}
+
+func (s *AuthzService) subject(ctx context.Context, req *contract.AuthzCheckRequest) (*entity.User, error) {
+	var user *entity.User
+	var err error
+	switch {
+	case req.UserID != 0:
+		user, err = s.userRepo.GetByID(ctx, req.UserID)
+	case req.Email != "":
+		user, err = s.userRepo.GetByEmail(ctx, req.Email)
+	case req.Role != "":
+		role, err := s.roleRepo.GetByName(ctx, req.Role)
+		if err != nil {
+			return nil, err
+		}
+		return &entity.User{Roles: []entity.Role{*role}}, nil
+	default:
+		return nil, fmt.Errorf("%w: one of user_id, email or role is required", ErrInvalidCheck)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Decide as the middleware would, with the user's group roles
+	if err := withGroupRoles(ctx, s.groupRepo, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AuthzService) rule(ctx context.Context, r *entity.RoleRight, names map[int64]string) (contract.AuthzRule, error) {
+	name, ok := names[r.RoleID]
+	if !ok {
+		role, err := s.roleRepo.GetByID(ctx, int(r.RoleID))
+		if err != nil {
+			return contract.AuthzRule{}, err
+		}
+		name = role.Name
+		names[r.RoleID] = name
+	}
+	return contract.AuthzRule{
+		ID:        r.ID,
+		Role:      name,
+		Section:   r.Section,
+		Route:     r.Route,
+		Create:    r.RCreate,
+		Read:      r.RRead,
+		Update:    r.RUpdate,
+		Delete:    r.RDelete,
+		Deny:      r.Deny,
+		Condition: r.Condition,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestAuthzServiceCheck(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	support := repos.createRole(t, "support")
+	user := repos.createUser(t, support.ID, "s@gmail.com", "secret")
+
+	rights := []entity.RoleRight{
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/*", RRead: true},
+		{RoleID: int64(support.ID), Section: "be", Route: "/users/admins", RRead: true, Deny: true},
+	}
+	for i := range rights {
+		if err := repos.roleRights.Create(ctx, &rights[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := NewAuthzService(authz.NewRoleRightsAuthorizer(repos.roleRights), repos.users, repos.roles, repos.groups)
+
+	tests := []struct {
+		name        string
+		req         contract.AuthzCheckRequest
+		wantAllowed bool
+		wantReason  string
+		wantRule    string
+		wantMatched int
+	}{
+		{"role allowed", contract.AuthzCheckRequest{Role: "support", Section: "be", Method: "get", Path: "/users/user"}, true, authz.ReasonAllowedByRule, "/users/*", 1},
+		{"user denied", contract.AuthzCheckRequest{UserID: user.ID, Section: "be", Method: "GET", Path: "/users/admins"}, false, authz.ReasonDeniedByRule, "/users/admins", 2},
+		{"email no rule", contract.AuthzCheckRequest{Email: "s@gmail.com", Section: "be", Method: "DELETE", Path: "/users/user"}, false, authz.ReasonNoMatchingRule, "", 0},
+		{"other section", contract.AuthzCheckRequest{Role: "support", Section: "fe", Method: "GET", Path: "/users/user"}, false, authz.ReasonNoMatchingRule, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.Check(ctx, &tt.req, tt.req.Path, nil)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			got := resp.Data
+			if got.Allowed != tt.wantAllowed || got.Reason != tt.wantReason {
+				t.Errorf("decision = %v %s, want %v %s", got.Allowed, got.Reason, tt.wantAllowed, tt.wantReason)
+			}
+			if len(got.Matched) != tt.wantMatched {
+				t.Errorf("matched %d rules, want %d: %+v", len(got.Matched), tt.wantMatched, got.Matched)
+			}
+			if tt.wantRule == "" {
+				if got.Rule != nil {
+					t.Errorf("rule = %+v, want none", got.Rule)
+				}
+				return
+			}
+			if got.Rule == nil || got.Rule.Route != tt.wantRule || got.Rule.Role != "support" {
+				t.Errorf("rule = %+v, want %s of support", got.Rule, tt.wantRule)
+			}
+		})
+	}
+
+	if _, err := svc.Check(ctx, &contract.AuthzCheckRequest{Section: "be", Method: "GET", Path: "/"}, "/", nil); !errors.Is(err, ErrInvalidCheck) {
+		t.Errorf("missing subject error = %v, want ErrInvalidCheck", err)
+	}
+	if _, err := svc.Check(ctx, &contract.AuthzCheckRequest{Role: "ghost", Section: "be", Method: "GET", Path: "/"}, "/", nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown role error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/federation"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrUnknownIdentityProvider is returned for a provider name that is
+	// not configured.
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	// ErrInvalidFederatedLogin is returned for a callback whose state was
+	// not started by this browser, already completed or expired.
+	ErrInvalidFederatedLogin = errors.New("invalid or expired login, start again")
+	// ErrFederatedLoginFailed is returned when the identity provider
+	// reports an error or its ID token does not verify.
+	ErrFederatedLoginFailed = errors.New("login at the identity provider failed")
+	// ErrUnverifiedEmail is returned when the provider's email belongs to
+	// an account that is not linked yet and the provider did not verify
+	// the email, which anyone could have typed in.
+	ErrUnverifiedEmail = errors.New("an account with this email exists, but the identity provider did not verify the email")
+)
+
+const federatedLoginLifetime = 10 * time.Minute
+
+// FederationService logs users in through upstream identity providers. A
+// provider account is linked to a local user on the first login: to the
+// user with the same, verified, email, or to a user created in the
+// provider's organization with its default role. Role mappings add roles
+// on every login; roles are never removed here.
+type FederationService struct {
+	providers        []*federation.Provider
+	identityRepo     repository.FederatedIdentityRepository
+	userRepo         repository.UserRepository
+	roleRepo         repository.RoleRepository
+	organizationRepo repository.OrganizationRepository
+	redisRepo        repository.RedisRepository
+	authService      *AuthService
+	now              func() time.Time
+}
+
+func NewFederationService(
+	providers []*federation.Provider,
+	identityRepo repository.FederatedIdentityRepository,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	organizationRepo repository.OrganizationRepository,
+	redisRepo repository.RedisRepository,
+	authService *AuthService,
+) *FederationService {
+	return &FederationService{
+		providers:        providers,
+		identityRepo:     identityRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		organizationRepo: organizationRepo,
+		redisRepo:        redisRepo,
+		authService:      authService,
+		now:              time.Now,
+	}
+}
+
+func (s *FederationService) provider(name string) (*federation.Provider, error) {
+	for _, p := range s.providers {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownIdentityProvider, name)
+}
+
+// GetProviders lists the configured identity providers.
+func (s *FederationService) GetProviders(ctx context.Context) *contract.FederationResponse {
+	providers := make([]contract.IdentityProvider, 0, len(s.providers))
+	for _, p := range s.providers {
+		providers = append(providers, contract.IdentityProvider{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			LoginURL:    "/auth/federated/" + p.Name + "/login",
+		})
+	}
+	return &contract.FederationResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    providers,
+	}
+}
+
+// FederatedStart is a started login: the user is sent to URL, and State
+// must come back with them from the same browser.
+type FederatedStart struct {
+	URL   string
+	State string
+}
+
+// Start begins a login at the named provider, with PKCE and a nonce kept
+// in Redis until the provider sends the user back.
+func (s *FederationService) Start(ctx context.Context, name string) (*FederatedStart, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return nil, err
+	}
+
+	login := &entity.FederatedLogin{
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    s.now().Add(federatedLoginLifetime),
+	}
+	if err := s.redisRepo.SetFederatedLogin(ctx, state, login); err != nil {
+		return nil, err
+	}
+	return &FederatedStart{URL: authURL, State: state}, nil
+}
+
+// Callback completes a login the provider sent the user back from and
+// starts a session for the linked user. browserState is the state Start
+// handed to the browser, which ties the callback to the browser that
+// started the login.
+func (s *FederationService) Callback(ctx context.Context, name, browserState string, cb *contract.FederatedCallback) (*LoginResponse, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return nil, err
+	}
+	if cb.State == "" || subtle.ConstantTimeCompare([]byte(cb.State), []byte(browserState)) != 1 {
+		return nil, ErrInvalidFederatedLogin
+	}
+	login, err := s.redisRepo.TakeFederatedLogin(ctx, cb.State)
+	if errors.Is(err, goRedis.Nil) {
+		return nil, ErrInvalidFederatedLogin
+	}
+	if err != nil {
+		return nil, err
+	}
+	if login.Provider != provider.Name {
+		return nil, ErrInvalidFederatedLogin
+	}
+	if cb.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrFederatedLoginFailed, cb.Error, cb.ErrorDescription)
+	}
+
+	claims, err := provider.Exchange(ctx, cb.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("federated login at %s failed: %v", provider.Name, err)
+		return nil, ErrFederatedLoginFailed
+	}
+
+	organization, err := resolveOrganization(ctx, s.organizationRepo, provider.Organization)
+	if err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithOrganization(ctx, organization.ID)
+
+	user, identity, err := s.linkedUser(ctx, provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	if err := s.assignMappedRoles(ctx, provider, user, claims); err != nil {
+		return nil, err
+	}
+	if err := s.identityRepo.UpdateLastLogin(ctx, identity.ID); err != nil {
+		return nil, err
+	}
+
+	// Reload for the roles just assigned, the session caches the user
+	user, err = s.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("audit: federated login provider=%s subject=%s user=%d", provider.Name, identity.Subject, user.ID)
+	return s.authService.StartSession(ctx, user)
+}
+
+// linkedUser returns the user the provider account is linked to, linking
+// it first when this is its first login.
+func (s *FederationService) linkedUser(ctx context.Context, provider *federation.Provider, claims federation.Claims) (*entity.User, *entity.FederatedIdentity, error) {
+	identity, err := s.identityRepo.GetBySubject(ctx, provider.Name, claims.Subject())
+	if err == nil {
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return user, identity, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, err
+	}
+
+	email := claims.Email()
+	if email == "" {
+		return nil, nil, fmt.Errorf("%w: the identity provider sent no email", ErrFederatedLoginFailed)
+	}
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified() {
+			return nil, nil, ErrUnverifiedEmail
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if user, err = s.provision(ctx, provider, claims); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, err
+	}
+
+	identity = &entity.FederatedIdentity{
+		UserID:   user.ID,
+		Provider: provider.Name,
+		Subject:  claims.Subject(),
+		Email:    email,
+	}
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("audit: federated identity linked provider=%s subject=%s user=%d", provider.Name, identity.Subject, user.ID)
+	return user, identity, nil
+}
+
+// provision creates the user of a first login, with the provider's
+// default role and a random password nobody knows.
+func (s *FederationService) provision(ctx context.Context, provider *federation.Provider, claims federation.Claims) (*entity.User, error) {
+	role, err := s.roleRepo.GetByName(ctx, provider.DefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("default role %q of provider %s: %w", provider.DefaultRole, provider.Name, err)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := password.Hash(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name()
+	if name == "" {
+		name = claims.Email()
+	}
+	user := &entity.User{
+		Roles:    []entity.Role{{ID: role.ID, Name: role.Name}},
+		Name:     name,
+		Email:    claims.Email(),
+		Password: hashed,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: federated user created provider=%s user=%d role=%s", provider.Name, user.ID, role.Name)
+	return user, nil
+}
+
+// assignMappedRoles gives the user the roles the provider's role mappings
+// grant for claims. A mapping naming a role the organization does not have
+// is logged and skipped.
+func (s *FederationService) assignMappedRoles(ctx context.Context, provider *federation.Provider, user *entity.User, claims federation.Claims) error {
+	for _, name := range provider.MappedRoles(claims) {
+		role, err := s.roleRepo.GetByName(ctx, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("federated login at %s: mapped role %q does not exist", provider.Name, name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if holdsRole(user, role.ID) {
+			continue
+		}
+		if err := s.userRepo.AssignRole(ctx, user.ID, role.ID); err != nil {
+			return err
+		}
+		log.Printf("audit: federated role assigned provider=%s user=%d role=%s", provider.Name, user.ID, role.Name)
+	}
+	return nil
+}
+
+func holdsRole(user *entity.User, roleID int) bool {
+	for _, r := range user.Roles {
+		if r.ID == roleID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/jwt"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/federation"
+	"test-tablelink/src/v1/tenant"
+)
+
+// mockIdP is an upstream OpenID Connect provider that logs in whoever
+// claims says, without asking.
+type mockIdP struct {
+	server *httptest.Server
+	signer *jwt.Signer
+
+	mu sync.Mutex
+	// tamper changes the claims of the ID tokens before they are signed
+	tamper func(claims map[string]interface{})
+	// forger, when set, signs the ID tokens instead of the published key
+	forger *jwt.Signer
+	codes  map[string]mockCode
+}
+
+// mockCode is an issued code, claims describe the account that logged in.
+type mockCode struct {
+	nonce, challenge, redirectURI string
+	claims                        map[string]interface{}
+}
+
+const (
+	mockClientID     = "tablelink"
+	mockClientSecret = "s3cret"
+)
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{signer: jwt.NewSigner(key), codes: make(map[string]mockCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(idp.signer.KeySet())
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) provider() *federation.Provider {
+	return &federation.Provider{
+		Name:         "corp",
+		Issuer:       idp.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURI:  "http://localhost:8080/auth/federated/corp/callback",
+		Scopes:       []string{"openid", "email", "profile", "groups"},
+		DefaultRole:  "user",
+		RoleMappings: []federation.RoleMapping{{Claim: "groups", Value: "platform-admins", Role: "admin"}},
+	}
+}
+
+// authorize plays the user logging in at the provider: it checks the
+// authorization URL and returns the state and the code the provider sends
+// the user back with.
+func (idp *mockIdP) authorize(t *testing.T, authURL string, claims map[string]interface{}) (string, string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil || u.Path != "/authorize" {
+		t.Fatalf("authorization URL = %q", authURL)
+	}
+	q := u.Query()
+	if q.Get("client_id") != mockClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid email profile groups" {
+		t.Fatalf("authorization request = %v", q)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + q.Get("state")
+	idp.codes[code] = mockCode{nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: claims}
+	return q.Get("state"), code
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, _ := r.BasicAuth()
+	if clientID != mockClientID || secret != mockClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	idp.mu.Lock()
+	code, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	tamper, signer := idp.tamper, idp.signer
+	if idp.forger != nil {
+		signer = idp.forger
+	}
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || code.redirectURI != r.PostFormValue("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   mockClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": code.nonce,
+	}
+	for name, value := range code.claims {
+		claims[name] = value
+	}
+	if tamper != nil {
+		tamper(claims)
+	}
+	idToken, _ := signer.Sign("JWT", claims)
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+type federationTest struct {
+	repos *testRepos
+	idp   *mockIdP
+	svc   *FederationService
+	auth  *AuthService
+}
+
+func newFederationTest(t *testing.T) *federationTest {
+	t.Helper()
+	repos := newTestRepos(t)
+	idp := newMockIdP(t)
+	auth := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+	svc := NewFederationService([]*federation.Provider{idp.provider()}, repos.identities, repos.users, repos.roles, repos.orgs, repos.redis, auth)
+	return &federationTest{repos: repos, idp: idp, svc: svc, auth: auth}
+}
+
+// login runs a whole federated login as the provider account claims
+// describes and returns the session user.
+func (ft *federationTest) login(t *testing.T, claims map[string]interface{}) (*entity.User, error) {
+	t.Helper()
+	ctx := tenant.All(context.Background())
+	start, err := ft.svc.Start(ctx, "corp")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	state, code := ft.idp.authorize(t, start.URL, claims)
+	if state != start.State {
+		t.Fatalf("state = %q, want %q", state, start.State)
+	}
+	resp, err := ft.svc.Callback(ctx, "corp", start.State, &contract.FederatedCallback{State: state, Code: code})
+	if err != nil {
+		return nil, err
+	}
+	return ft.auth.ValidateToken(ctx, resp.AccessToken)
+}
+
+func TestFederatedLoginProvisionsUser(t *testing.T) {
+	ft := newFederationTest(t)
+	user := ft.repos.createRole(t, "user")
+	admin := ft.repos.createRole(t, "admin")
+
+	claims := map[string]interface{}{
+		"sub":    "idp-42",
+		"email":  "jane@corp.com",
+		"name":   "Jane Doe",
+		"groups": []string{"staff", "platform-admins"},
+	}
+	got, err := ft.login(t, claims)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if got.Email != "jane@corp.com" || got.Name != "Jane Doe" || got.OrganizationID != entity.DefaultOrganizationID {
+		t.Errorf("provisioned user = %+v", got)
+	}
+	if !holdsRole(got, user.ID) || !holdsRole(got, admin.ID) || len(got.Roles) != 2 {
+		t.Errorf("roles = %+v, want the default and the mapped role", got.Roles)
+	}
+	if _, err := ft.auth.CheckPassword(tenant.WithOrganization(context.Background(), 1), "jane@corp.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("provisioned user logs in with an empty password: %v", err)
+	}
+
+	// The next login finds the identity by subject, even with a new email
+	claims["email"] = "jane.doe@corp.com"
+	again, err := ft.login(t, claims)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again.ID != got.ID {
+		t.Errorf("second login user = %d, want %d", again.ID, got.ID)
+	}
+	identity, err := ft.repos.identities.GetBySubject(tenant.All(context.Background()), "corp", "idp-42")
+	if err != nil || identity.UserID != got.ID || identity.LastLoginAt == nil {
+		t.Errorf("identity = %+v, %v", identity, err)
+	}
+}
+
+func TestFederatedLoginLinksVerifiedEmail(t *testing.T) {
+	ft := newFederationTest(t)
+	role := ft.repos.createRole(t, "user")
+	existing := ft.repos.createUser(t, role.ID, "bob@corp.com", "secret")
+
+	unverified := map[string]interface{}{"sub": "idp-7", "email": "bob@corp.com", "email_verified": false}
+	if _, err := ft.login(t, unverified); !errors.Is(err, ErrUnverifiedEmail) {
+		t.Fatalf("unverified email error = %v, want ErrUnverifiedEmail", err)
+	}
+
+	verified := map[string]interface{}{"sub": "idp-7", "email": "bob@corp.com", "email_verified": true}
+	got, err := ft.login(t, verified)
+	if err != nil {
+		t.Fatalf("verified login: %v", err)
+	}
+	if got.ID != existing.ID {
+		t.Errorf("linked user = %d, want existing user %d", got.ID, existing.ID)
+	}
+}
+
+func TestFederatedLoginDisabledUser(t *testing.T) {
+	ft := newFederationTest(t)
+	role := ft.repos.createRole(t, "user")
+	existing := ft.repos.createUser(t, role.ID, "bob@corp.com", "secret")
+	now := time.Now()
+	existing.DisabledAt = &now
+	if err := ft.repos.users.Update(tenant.All(context.Background()), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "idp-7", "email": "bob@corp.com", "email_verified": "true"}
+	if _, err := ft.login(t, claims); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("disabled user error = %v, want ErrUserDisabled", err)
+	}
+}
+
+func TestFederatedLoginRejectsBadTokens(t *testing.T) {
+	claims := map[string]interface{}{"sub": "idp-1", "email": "eve@corp.com"}
+	tests := []struct {
+		name   string
+		tamper func(map[string]interface{})
+	}{
+		{"wrong nonce", func(c map[string]interface{}) { c["nonce"] = "replayed" }},
+		{"other audience", func(c map[string]interface{}) { c["aud"] = []string{"another-app"} }},
+		{"other issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no subject", func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFederationTest(t)
+			ft.repos.createRole(t, "user")
+			ft.idp.tamper = tt.tamper
+			if _, err := ft.login(t, claims); !errors.Is(err, ErrFederatedLoginFailed) {
+				t.Errorf("error = %v, want ErrFederatedLoginFailed", err)
+			}
+		})
+	}
+
+	// A token signed with a key the provider does not publish
+	ft := newFederationTest(t)
+	ft.repos.createRole(t, "user")
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.idp.forger = jwt.NewSigner(key)
+	if _, err := ft.login(t, claims); !errors.Is(err, ErrFederatedLoginFailed) {
+		t.Errorf("forged token error = %v, want ErrFederatedLoginFailed", err)
+	}
+}
+
+func TestFederatedCallbackState(t *testing.T) {
+	ft := newFederationTest(t)
+	ft.repos.createRole(t, "user")
+	ctx := tenant.All(context.Background())
+	claims := map[string]interface{}{"sub": "idp-1", "email": "eve@corp.com"}
+
+	// A callback link opened in another browser
+	start, err := ft.svc.Start(ctx, "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := ft.idp.authorize(t, start.URL, claims)
+	if _, err := ft.svc.Callback(ctx, "corp", "", &contract.FederatedCallback{State: state, Code: code}); !errors.Is(err, ErrInvalidFederatedLogin) {
+		t.Errorf("callback without the browser state error = %v, want ErrInvalidFederatedLogin", err)
+	}
+
+	// A state is completed once
+	cb := &contract.FederatedCallback{State: state, Code: code}
+	if _, err := ft.svc.Callback(ctx, "corp", state, cb); err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if _, err := ft.svc.Callback(ctx, "corp", state, cb); !errors.Is(err, ErrInvalidFederatedLogin) {
+		t.Errorf("replayed callback error = %v, want ErrInvalidFederatedLogin", err)
+	}
+
+	// The provider reports an error
+	start, err = ft.svc.Start(ctx, "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ft.svc.Callback(ctx, "corp", start.State, &contract.FederatedCallback{State: start.State, Error: "access_denied"})
+	if !errors.Is(err, ErrFederatedLoginFailed) {
+		t.Errorf("provider error = %v, want ErrFederatedLoginFailed", err)
+	}
+
+	if _, err := ft.svc.Start(ctx, "other"); !errors.Is(err, ErrUnknownIdentityProvider) {
+		t.Errorf("unknown provider error = %v, want ErrUnknownIdentityProvider", err)
+	}
+}
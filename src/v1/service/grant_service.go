@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var (
+	// ErrInvalidGrant is returned for a grant request with a missing or
+	// out of range field.
+	ErrInvalidGrant = errors.New("invalid grant request")
+	// ErrGrantConflict is returned when the grant cannot move to the
+	// requested state, or the user already holds or has requested the role.
+	ErrGrantConflict = errors.New("grant conflict")
+	// ErrSelfApproval is returned when the requester or the user receiving
+	// the role tries to approve the grant.
+	ErrSelfApproval = errors.New("a grant must be approved by someone else")
+)
+
+// GrantService handles just-in-time role grants: a user requests a role
+// for a limited time with a justification, someone else approves it, and
+// the role is removed again when the grant expires. Every step is written
+// to the log as an "audit: grant" line and kept in role_grants.
+type GrantService struct {
+	transactor  repository.Transactor
+	grantRepo   repository.RoleGrantRepository
+	userRepo    repository.UserRepository
+	roleRepo    repository.RoleRepository
+	redisRepo   repository.RedisRepository
+	maxDuration time.Duration
+	now         func() time.Time
+}
+
+func NewGrantService(
+	transactor repository.Transactor,
+	grantRepo repository.RoleGrantRepository,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	redisRepo repository.RedisRepository,
+	maxDuration time.Duration,
+) *GrantService {
+	return &GrantService{
+		transactor:  transactor,
+		grantRepo:   grantRepo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		redisRepo:   redisRepo,
+		maxDuration: maxDuration,
+		now:         time.Now,
+	}
+}
+
+func currentUser(ctx context.Context) (*entity.User, error) {
+	user, ok := ctx.Value("user").(*entity.User)
+	if !ok {
+		return nil, errors.New("user not found in context")
+	}
+	return user, nil
+}
+
+// Request records a pending grant for the logged in user, or for
+// req.UserID when set.
+func (s *GrantService) Request(ctx context.Context, req *contract.RoleGrantRequest) (*contract.RoleGrantResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	requester, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID := req.UserID
+	if userID == 0 {
+		userID = requester.ID
+	}
+
+	duration, err := time.ParseDuration(req.Duration)
+	switch {
+	case err != nil || duration < time.Second:
+		return nil, fmt.Errorf("%w: duration must be a positive duration such as 2h", ErrInvalidGrant)
+	case duration > s.maxDuration:
+		return nil, fmt.Errorf("%w: duration must be at most %s", ErrInvalidGrant, s.maxDuration)
+	case strings.TrimSpace(req.Justification) == "":
+		return nil, fmt.Errorf("%w: justification is required", ErrInvalidGrant)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.roleRepo.GetByID(ctx, req.RoleID); err != nil {
+		return nil, err
+	}
+	for _, r := range user.Roles {
+		if r.ID == req.RoleID {
+			return nil, fmt.Errorf("%w: user already holds the role", ErrGrantConflict)
+		}
+	}
+	grants, err := s.grantRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		if g.RoleID == req.RoleID && g.Open() {
+			return nil, fmt.Errorf("%w: grant %d for the role is %s", ErrGrantConflict, g.ID, g.Status)
+		}
+	}
+
+	grant := &entity.RoleGrant{
+		UserID:          userID,
+		RoleID:          req.RoleID,
+		RequestedBy:     requester.ID,
+		Justification:   strings.TrimSpace(req.Justification),
+		DurationSeconds: int64(duration / time.Second),
+		Status:          entity.GrantPending,
+	}
+	if err := s.grantRepo.Create(ctx, grant); err != nil {
+		return nil, err
+	}
+	auditGrant(grant, "requested", requester.ID)
+	return grantResponse(grant), nil
+}
+
+// Approve assigns the role until now plus the requested duration.
+func (s *GrantService) Approve(ctx context.Context, id int64) (*contract.RoleGrantResponse, error) {
+	return s.decide(ctx, id, "approved", func(ctx context.Context, grant *entity.RoleGrant, approver *entity.User) error {
+		if approver.ID == grant.RequestedBy || approver.ID == grant.UserID {
+			return ErrSelfApproval
+		}
+		expiresAt := grant.DecidedAt.Add(grant.Duration())
+		grant.Status = entity.GrantApproved
+		grant.ExpiresAt = &expiresAt
+		return s.userRepo.AssignRoleUntil(ctx, grant.UserID, grant.RoleID, expiresAt)
+	})
+}
+
+func (s *GrantService) Reject(ctx context.Context, id int64) (*contract.RoleGrantResponse, error) {
+	return s.decide(ctx, id, "rejected", func(ctx context.Context, grant *entity.RoleGrant, _ *entity.User) error {
+		grant.Status = entity.GrantRejected
+		return nil
+	})
+}
+
+// decide settles a pending grant in one transaction.
+func (s *GrantService) decide(ctx context.Context, id int64, action string, apply func(ctx context.Context, grant *entity.RoleGrant, by *entity.User) error) (*contract.RoleGrantResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	by, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var grant *entity.RoleGrant
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if grant, err = s.grantRepo.GetByID(ctx, id); err != nil {
+			return err
+		}
+		if grant.Status != entity.GrantPending {
+			return fmt.Errorf("%w: grant %d is %s", ErrGrantConflict, grant.ID, grant.Status)
+		}
+		now := s.now()
+		grant.DecidedBy = &by.ID
+		grant.DecidedAt = &now
+		if err := apply(ctx, grant, by); err != nil {
+			return err
+		}
+		return s.grantRepo.Update(ctx, grant)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditGrant(grant, action, by.ID)
+	s.refreshSession(ctx, grant.UserID)
+	return grantResponse(grant), nil
+}
+
+// Revoke ends an approved grant before it expires.
+func (s *GrantService) Revoke(ctx context.Context, id int64) (*contract.RoleGrantResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	by, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var grant *entity.RoleGrant
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if grant, err = s.grantRepo.GetByID(ctx, id); err != nil {
+			return err
+		}
+		if grant.Status != entity.GrantApproved {
+			return fmt.Errorf("%w: grant %d is %s", ErrGrantConflict, grant.ID, grant.Status)
+		}
+		now := s.now()
+		grant.Status = entity.GrantRevoked
+		grant.EndedAt = &now
+		if err := s.userRepo.UnassignTemporaryRole(ctx, grant.UserID, grant.RoleID); err != nil {
+			return err
+		}
+		return s.grantRepo.Update(ctx, grant)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditGrant(grant, "revoked", by.ID)
+	s.refreshSession(ctx, grant.UserID)
+	return grantResponse(grant), nil
+}
+
+func (s *GrantService) GetGrant(ctx context.Context, id int64) (*contract.RoleGrantResponse, error) {
+	grant, err := s.grantRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return grantResponse(grant), nil
+}
+
+// GetGrants lists the grants with the given status, all when empty.
+func (s *GrantService) GetGrants(ctx context.Context, status string) (*contract.RoleGrantResponse, error) {
+	grants, err := s.grantRepo.GetAll(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.RoleGrantResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    grants,
+	}, nil
+}
+
+// expiryLockKey identifies the advisory lock ExpireDue holds, so only one
+// replica expires grants at a time.
+const expiryLockKey int64 = 7270736903
+
+// ExpireDue removes the roles of expired grants, marks the grants expired
+// and refreshes the affected sessions, in every organization. It returns
+// the number of grants that expired, 0 when another replica is already
+// expiring them.
+func (s *GrantService) ExpireDue(ctx context.Context) (int, error) {
+	ctx = tenant.All(ctx)
+	now := s.now()
+	var (
+		due     []*entity.RoleGrant
+		userIDs []int64
+	)
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		locked, err := s.transactor.TryLock(ctx, expiryLockKey)
+		if err != nil || !locked {
+			return err
+		}
+		if due, err = s.grantRepo.GetDue(ctx, now); err != nil {
+			return err
+		}
+		if userIDs, err = s.userRepo.RemoveExpiredRoles(ctx, now); err != nil {
+			return err
+		}
+		for _, grant := range due {
+			grant.Status = entity.GrantExpired
+			grant.EndedAt = &now
+			if err := s.grantRepo.Update(ctx, grant); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, grant := range due {
+		auditGrant(grant, "expired", 0)
+	}
+	for _, id := range userIDs {
+		s.refreshSession(ctx, id)
+	}
+	return len(due), nil
+}
+
+// RunExpiry calls ExpireDue every interval until ctx is done.
+func (s *GrantService) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireDue(ctx); err != nil {
+				log.Printf("Failed to expire role grants: %v", err)
+			}
+		}
+	}
+}
+
+// refreshSession updates the cached copy of the user, which is what their
+// sessions are authorized against, so a role change applies to the next
+// request. Users without a cached copy pick it up when they log in.
+func (s *GrantService) refreshSession(ctx context.Context, userID int64) {
+	if _, err := s.redisRepo.GetUser(ctx, userID); err != nil {
+		return
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err == nil {
+		err = s.redisRepo.SetUser(ctx, user)
+	}
+	if err != nil {
+		log.Printf("Failed to refresh session roles of user %d: %v", userID, err)
+	}
+}
+
+// auditGrant logs one line per grant event; by is 0 for the expiry job.
+func auditGrant(g *entity.RoleGrant, action string, by int64) {
+	line := fmt.Sprintf("audit: grant id=%d action=%s user=%d role=%d by=%d requested_by=%d status=%s",
+		g.ID, action, g.UserID, g.RoleID, by, g.RequestedBy, g.Status)
+	if g.ExpiresAt != nil {
+		line += " expires_at=" + g.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if action == "requested" {
+		line += fmt.Sprintf(" duration=%s justification=%q", g.Duration(), g.Justification)
+	}
+	log.Print(line)
+}
+
+func grantResponse(grant *entity.RoleGrant) *contract.RoleGrantResponse {
+	return &contract.RoleGrantResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    grant,
+	}
+}
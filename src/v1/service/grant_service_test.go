@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestGrantLifecycle(t *testing.T) {
+	repos := newTestRepos(t)
+	userRole := repos.createRole(t, "user")
+	adminRole := repos.createRole(t, "admin")
+	engineer := repos.createUser(t, userRole.ID, "eng@gmail.com", "secret")
+	approver := repos.createUser(t, adminRole.ID, "lead@gmail.com", "secret")
+	svc := NewGrantService(repos.store, repos.grants, repos.users, repos.roles, repos.redis, 8*time.Hour)
+
+	// the engineer is logged in, so their session has a cached copy
+	cached, _ := repos.users.GetByID(tenant.All(context.Background()), engineer.ID)
+	repos.redis.SetUser(context.Background(), cached)
+
+	asEngineer := context.WithValue(tenant.All(context.Background()), "user", engineer)
+	asApprover := context.WithValue(tenant.All(context.Background()), "user", approver)
+
+	resp, err := svc.Request(asEngineer, &contract.RoleGrantRequest{RoleID: adminRole.ID, Duration: "2h", Justification: "incident 42"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	grant := resp.Data.(*entity.RoleGrant)
+	if grant.Status != entity.GrantPending || grant.UserID != engineer.ID || grant.RequestedBy != engineer.ID {
+		t.Fatalf("requested grant = %+v", grant)
+	}
+
+	if _, err := svc.Request(asEngineer, &contract.RoleGrantRequest{RoleID: adminRole.ID, Duration: "1h", Justification: "again"}); !errors.Is(err, ErrGrantConflict) {
+		t.Errorf("second request error = %v, want ErrGrantConflict", err)
+	}
+	if _, err := svc.Approve(asEngineer, grant.ID); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("self approval error = %v, want ErrSelfApproval", err)
+	}
+
+	start := time.Now()
+	svc.now = func() time.Time { return start }
+	resp, err = svc.Approve(asApprover, grant.ID)
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	grant = resp.Data.(*entity.RoleGrant)
+	if grant.Status != entity.GrantApproved || *grant.DecidedBy != approver.ID || !grant.ExpiresAt.Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("approved grant = %+v", grant)
+	}
+	if session, _ := repos.redis.GetUser(context.Background(), engineer.ID); !session.HasRole("admin") {
+		t.Errorf("session roles after approval = %+v, want admin", session.Roles)
+	}
+
+	svc.now = func() time.Time { return start.Add(time.Hour) }
+	if n, err := svc.ExpireDue(context.Background()); err != nil || n != 0 {
+		t.Fatalf("ExpireDue before expiry = %d, %v", n, err)
+	}
+
+	svc.now = func() time.Time { return start.Add(2 * time.Hour) }
+	// Another replica holding the lock expires the grant instead
+	err = repos.store.WithinTx(context.Background(), func(ctx context.Context) error {
+		if err := repos.store.Lock(ctx, expiryLockKey); err != nil {
+			return err
+		}
+		if n, err := svc.ExpireDue(context.Background()); err != nil || n != 0 {
+			t.Errorf("ExpireDue while locked = %d, %v, want 0", n, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := svc.ExpireDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("ExpireDue = %d, %v, want 1 grant", n, err)
+	}
+	if user, _ := repos.users.GetByID(tenant.All(context.Background()), engineer.ID); user.HasRole("admin") || !user.HasRole("user") {
+		t.Errorf("roles after expiry = %+v, want only user", user.Roles)
+	}
+	if session, _ := repos.redis.GetUser(context.Background(), engineer.ID); session.HasRole("admin") {
+		t.Error("session kept the expired role")
+	}
+	if expired, _ := repos.grants.GetByID(tenant.All(context.Background()), grant.ID); expired.Status != entity.GrantExpired || expired.EndedAt == nil {
+		t.Errorf("grant after expiry = %+v", expired)
+	}
+}
+
+func TestGrantRefusesImpersonation(t *testing.T) {
+	repos := newTestRepos(t)
+	userRole := repos.createRole(t, "user")
+	adminRole := repos.createRole(t, "admin")
+	admin := repos.createUser(t, adminRole.ID, "admin@gmail.com", "secret")
+	approver := repos.createUser(t, adminRole.ID, "lead@gmail.com", "secret")
+	engineer := repos.createUser(t, userRole.ID, "eng@gmail.com", "secret")
+	svc := NewGrantService(repos.store, repos.grants, repos.users, repos.roles, repos.redis, 8*time.Hour)
+
+	// The admin requests a role for the engineer, then approves it as the
+	// lead to get around ErrSelfApproval
+	resp, err := svc.Request(context.WithValue(tenant.All(context.Background()), "user", admin), &contract.RoleGrantRequest{UserID: engineer.ID, RoleID: adminRole.ID, Duration: "2h", Justification: "incident 42"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	grant := resp.Data.(*entity.RoleGrant)
+	asApprover := authz.WithImpersonation(context.WithValue(tenant.All(context.Background()), "user", approver), &entity.Impersonation{ImpersonatorID: admin.ID, UserID: approver.ID})
+
+	if _, err := svc.Approve(asApprover, grant.ID); !errors.Is(err, ErrImpersonating) {
+		t.Errorf("Approve while impersonating error = %v, want %v", err, ErrImpersonating)
+	}
+	if _, err := svc.Reject(asApprover, grant.ID); !errors.Is(err, ErrImpersonating) {
+		t.Errorf("Reject while impersonating error = %v, want %v", err, ErrImpersonating)
+	}
+	if _, err := svc.Request(asApprover, &contract.RoleGrantRequest{RoleID: userRole.ID, Duration: "1h", Justification: "x"}); !errors.Is(err, ErrImpersonating) {
+		t.Errorf("Request while impersonating error = %v, want %v", err, ErrImpersonating)
+	}
+	if pending, _ := repos.grants.GetByID(tenant.All(context.Background()), grant.ID); pending.Status != entity.GrantPending {
+		t.Errorf("grant status = %s, want it still pending", pending.Status)
+	}
+	if user, _ := repos.users.GetByID(tenant.All(context.Background()), engineer.ID); user.HasRole("admin") {
+		t.Error("the engineer got the role")
+	}
+
+	approved, err := svc.Approve(context.WithValue(tenant.All(context.Background()), "user", approver), grant.ID)
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if _, err := svc.Revoke(asApprover, approved.Data.(*entity.RoleGrant).ID); !errors.Is(err, ErrImpersonating) {
+		t.Errorf("Revoke while impersonating error = %v, want %v", err, ErrImpersonating)
+	}
+}
+
+func TestGrantRevokeKeepsPermanentRole(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	userRole := repos.createRole(t, "user")
+	opsRole := repos.createRole(t, "ops")
+	engineer := repos.createUser(t, userRole.ID, "eng@gmail.com", "secret")
+	approver := repos.createUser(t, opsRole.ID, "lead@gmail.com", "secret")
+	svc := NewGrantService(repos.store, repos.grants, repos.users, repos.roles, repos.redis, 8*time.Hour)
+	asApprover := context.WithValue(ctx, "user", approver)
+
+	// the approver requests ops for the engineer, who meanwhile gets it
+	// assigned for good
+	resp, err := svc.Request(asApprover, &contract.RoleGrantRequest{UserID: engineer.ID, RoleID: opsRole.ID, Duration: "1h", Justification: "on call"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	grant := resp.Data.(*entity.RoleGrant)
+	if _, err := svc.Approve(asApprover, grant.ID); !errors.Is(err, ErrSelfApproval) {
+		t.Fatalf("requester approval error = %v, want ErrSelfApproval", err)
+	}
+	third := repos.createUser(t, opsRole.ID, "third@gmail.com", "secret")
+	if _, err := svc.Approve(context.WithValue(ctx, "user", third), grant.ID); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if err := repos.users.AssignRole(ctx, engineer.ID, opsRole.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Revoke(asApprover, grant.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := svc.Revoke(asApprover, grant.ID); !errors.Is(err, ErrGrantConflict) {
+		t.Errorf("second revoke error = %v, want ErrGrantConflict", err)
+	}
+	if user, _ := repos.users.GetByID(ctx, engineer.ID); !user.HasRole("ops") {
+		t.Errorf("revoke removed the permanent role: %+v", user.Roles)
+	}
+}
+
+func TestGrantRequestValidates(t *testing.T) {
+	repos := newTestRepos(t)
+	userRole := repos.createRole(t, "user")
+	adminRole := repos.createRole(t, "admin")
+	engineer := repos.createUser(t, userRole.ID, "eng@gmail.com", "secret")
+	svc := NewGrantService(repos.store, repos.grants, repos.users, repos.roles, repos.redis, 8*time.Hour)
+	ctx := context.WithValue(tenant.All(context.Background()), "user", engineer)
+
+	tests := map[string]*contract.RoleGrantRequest{
+		"no duration":      {RoleID: adminRole.ID, Justification: "x"},
+		"too long":         {RoleID: adminRole.ID, Duration: "9h", Justification: "x"},
+		"negative":         {RoleID: adminRole.ID, Duration: "-1h", Justification: "x"},
+		"no justification": {RoleID: adminRole.ID, Duration: "1h", Justification: "  "},
+	}
+	for name, req := range tests {
+		if _, err := svc.Request(ctx, req); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("%s: error = %v, want ErrInvalidGrant", name, err)
+		}
+	}
+	if _, err := svc.Request(ctx, &contract.RoleGrantRequest{RoleID: userRole.ID, Duration: "1h", Justification: "x"}); !errors.Is(err, ErrGrantConflict) {
+		t.Errorf("held role error = %v, want ErrGrantConflict", err)
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+)
+
+var (
+	// ErrInvalidGroup is returned for a group without a name.
+	ErrInvalidGroup = errors.New("invalid group")
+	// ErrGroupExists is returned when the organization already has a group
+	// with the name.
+	ErrGroupExists = errors.New("group already exists")
+)
+
+type GroupService struct {
+	groupRepo repository.GroupRepository
+	userRepo  repository.UserRepository
+	roleRepo  repository.RoleRepository
+}
+
+func NewGroupService(groupRepo repository.GroupRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository) *GroupService {
+	return &GroupService{
+		groupRepo: groupRepo,
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+	}
+}
+
+func (s *GroupService) GetGroups(ctx context.Context) (*contract.GroupResponse, error) {
+	groups, err := s.groupRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.GroupResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    groups,
+	}, nil
+}
+
+// GetGroup returns the group with its roles and direct members.
+func (s *GroupService) GetGroup(ctx context.Context, id string) (*contract.GroupResponse, error) {
+	groupID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, groupID)
+}
+
+func (s *GroupService) CreateGroup(ctx context.Context, req *contract.CreateGroupRequest) (*contract.GroupResponse, error) {
+	group := &entity.Group{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		ParentID:    req.ParentID,
+	}
+	if group.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidGroup)
+	}
+
+	err := s.groupRepo.Create(ctx, group)
+	if isViolation(err, "23505") {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, group.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &contract.GroupResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    group,
+	}, nil
+}
+
+func (s *GroupService) UpdateGroup(ctx context.Context, id string, req *contract.UpdateGroupRequest) (*contract.GroupResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	groupID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	group.Name = strings.TrimSpace(req.Name)
+	group.Description = req.Description
+	group.ParentID = req.ParentID
+	if group.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidGroup)
+	}
+
+	err = s.groupRepo.Update(ctx, group)
+	if isViolation(err, "23505") {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, group.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &contract.GroupResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    group,
+	}, nil
+}
+
+func (s *GroupService) DeleteGroup(ctx context.Context, id string) (*contract.GroupResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	groupID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.Delete(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	return &contract.GroupResponse{
+		Status:  true,
+		Message: "Successfully",
+	}, nil
+}
+
+func (s *GroupService) GetMembers(ctx context.Context, groupID int) (*contract.GroupResponse, error) {
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	members, err := s.groupRepo.GetMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.GroupResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    members,
+	}, nil
+}
+
+// AddMember puts the user in the group. Both must exist in the organization
+// of ctx, an unknown one is reported as sql.ErrNoRows.
+func (s *GroupService) AddMember(ctx context.Context, groupID int, req *contract.GroupMemberRequest) (*contract.GroupResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByID(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+	if err := s.groupRepo.AddMember(ctx, groupID, req.UserID); err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, groupID)
+}
+
+func (s *GroupService) RemoveMember(ctx context.Context, groupID int, userID int64) (*contract.GroupResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	if err := s.groupRepo.RemoveMember(ctx, groupID, userID); err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, groupID)
+}
+
+// AssignRole grants the role to every member of the group and of the
+// groups nested in it.
+func (s *GroupService) AssignRole(ctx context.Context, groupID int, req *contract.GroupRoleRequest) (*contract.GroupResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	if _, err := s.roleRepo.GetByID(ctx, req.RoleID); err != nil {
+		return nil, err
+	}
+	if err := s.groupRepo.AssignRole(ctx, groupID, req.RoleID); err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, groupID)
+}
+
+func (s *GroupService) UnassignRole(ctx context.Context, groupID int, roleID int) (*contract.GroupResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	if err := s.groupRepo.UnassignRole(ctx, groupID, roleID); err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, groupID)
+}
+
+func (s *GroupService) detail(ctx context.Context, groupID int) (*contract.GroupResponse, error) {
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.groupRepo.GetRoles(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.groupRepo.GetMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.GroupResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    contract.GroupDetail{Group: group, Roles: roles, Members: members},
+	}, nil
+}
+
+// withGroupRoles adds the roles the user gets through their groups to
+// user.Roles, so the user is authorized against the union of their direct
+// and group roles. Roles held both ways are listed once.
+func withGroupRoles(ctx context.Context, groupRepo repository.GroupRepository, user *entity.User) error {
+	roles, err := groupRepo.GetRolesByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	held := make(map[int]bool, len(user.Roles))
+	for _, role := range user.Roles {
+		held[role.ID] = true
+	}
+	for _, role := range roles {
+		if !held[role.ID] {
+			held[role.ID] = true
+			user.Roles = append(user.Roles, role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func (r *testRepos) createGroup(t *testing.T, ctx context.Context, name string, parentID *int) *entity.Group {
+	t.Helper()
+	group := &entity.Group{Name: name, ParentID: parentID}
+	if err := r.groups.Create(ctx, group); err != nil {
+		t.Fatalf("create group %q: %v", name, err)
+	}
+	return group
+}
+
+func roleIDs(user *entity.User) map[int]bool {
+	ids := make(map[int]bool)
+	for _, role := range user.Roles {
+		ids[role.ID] = true
+	}
+	return ids
+}
+
+func TestAuthServiceValidateTokenGroupRoles(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	userRole := repos.createRole(t, "user")
+	admin := repos.createRole(t, "admin")
+	auditor := repos.createRole(t, "auditor")
+	user := repos.createUser(t, userRole.ID, "user@gmail.com", "secret")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+	groups := NewGroupService(repos.groups, repos.users, repos.roles)
+
+	// backend is nested in engineering and inherits its roles
+	engineering := repos.createGroup(t, ctx, "engineering", nil)
+	backend := repos.createGroup(t, ctx, "backend", &engineering.ID)
+	if _, err := groups.AssignRole(ctx, engineering.ID, &contract.GroupRoleRequest{RoleID: admin.ID}); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	if _, err := groups.AssignRole(ctx, backend.ID, &contract.GroupRoleRequest{RoleID: auditor.ID}); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	// A role held directly and through a group is listed once
+	if _, err := groups.AssignRole(ctx, backend.ID, &contract.GroupRoleRequest{RoleID: userRole.ID}); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+
+	resp, err := svc.Login(ctx, &LoginRequest{Email: "user@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	got, err := svc.ValidateToken(ctx, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if len(got.Roles) != 1 {
+		t.Errorf("roles without groups = %+v, want only the direct role", got.Roles)
+	}
+
+	// Membership applies to the running session
+	if _, err := groups.AddMember(ctx, backend.ID, &contract.GroupMemberRequest{UserID: user.ID}); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	got, err = svc.ValidateToken(ctx, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	ids := roleIDs(got)
+	if len(got.Roles) != 3 || !ids[userRole.ID] || !ids[admin.ID] || !ids[auditor.ID] {
+		t.Errorf("roles = %+v, want user, admin and auditor once each", got.Roles)
+	}
+
+	// The cached user keeps only the direct roles
+	cached, _ := repos.redis.GetUser(ctx, user.ID)
+	if len(cached.Roles) != 1 {
+		t.Errorf("cached roles = %+v, want only the direct role", cached.Roles)
+	}
+
+	if _, err := groups.RemoveMember(ctx, backend.ID, user.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	got, _ = svc.ValidateToken(ctx, resp.AccessToken)
+	if len(got.Roles) != 1 {
+		t.Errorf("roles after leaving the group = %+v, want only the direct role", got.Roles)
+	}
+}
+
+func TestGroupServiceCycle(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewGroupService(repos.groups, repos.users, repos.roles)
+	a := repos.createGroup(t, ctx, "a", nil)
+	b := repos.createGroup(t, ctx, "b", &a.ID)
+	c := repos.createGroup(t, ctx, "c", &b.ID)
+
+	tests := []struct {
+		name   string
+		id     int
+		parent int
+	}{
+		{"self", a.ID, a.ID},
+		{"child", a.ID, b.ID},
+		{"grandchild", a.ID, c.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &contract.UpdateGroupRequest{Name: "x", ParentID: &tt.parent}
+			if _, err := svc.UpdateGroup(ctx, strconv.Itoa(tt.id), req); !errors.Is(err, entity.ErrGroupCycle) {
+				t.Errorf("UpdateGroup error = %v, want ErrGroupCycle", err)
+			}
+		})
+	}
+
+	// Moving c under a is fine
+	if _, err := svc.UpdateGroup(ctx, strconv.Itoa(c.ID), &contract.UpdateGroupRequest{Name: "c", ParentID: &a.ID}); err != nil {
+		t.Errorf("UpdateGroup: %v", err)
+	}
+}
+
+func TestGroupServiceCreate(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewGroupService(repos.groups, repos.users, repos.roles)
+
+	if _, err := svc.CreateGroup(ctx, &contract.CreateGroupRequest{Name: "ops"}); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if _, err := svc.CreateGroup(ctx, &contract.CreateGroupRequest{Name: "ops"}); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("duplicate error = %v, want ErrGroupExists", err)
+	}
+	if _, err := svc.CreateGroup(ctx, &contract.CreateGroupRequest{Name: " "}); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("empty name error = %v, want ErrInvalidGroup", err)
+	}
+	missing := 99
+	if _, err := svc.CreateGroup(ctx, &contract.CreateGroupRequest{Name: "orphan", ParentID: &missing}); !isViolation(err, "23503") {
+		t.Errorf("unknown parent error = %v, want foreign key violation", err)
+	}
+	if _, err := svc.AddMember(ctx, 99, &contract.GroupMemberRequest{UserID: 1}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown group error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGroupServiceOrganization(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewGroupService(repos.groups, repos.users, repos.roles)
+	acme, acmeRole, acmeUser := newTenant(t, repos, "acme", "member@gmail.com")
+	globex, globexRole, globexUser := newTenant(t, repos, "globex", "member@gmail.com")
+	group := repos.createGroup(t, acme, "ops", nil)
+
+	// Groups are limited to their organization like users and roles
+	if _, err := svc.GetGroup(globex, strconv.Itoa(group.ID)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("reading another tenant's group error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := svc.AddMember(acme, group.ID, &contract.GroupMemberRequest{UserID: globexUser.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("scoped cross-tenant member error = %v, want sql.ErrNoRows", err)
+	}
+	globexGroup := repos.createGroup(t, globex, "ops", nil)
+	if _, err := svc.CreateGroup(acme, &contract.CreateGroupRequest{Name: "child", ParentID: &globexGroup.ID}); !errors.Is(err, entity.ErrCrossOrganization) {
+		t.Errorf("parent in another tenant error = %v, want ErrCrossOrganization", err)
+	}
+
+	// Unscoped callers see every group, the repository still refuses mixing
+	if _, err := svc.AddMember(ctx, group.ID, &contract.GroupMemberRequest{UserID: globexUser.ID}); !errors.Is(err, entity.ErrCrossOrganization) {
+		t.Errorf("cross-tenant member error = %v, want ErrCrossOrganization", err)
+	}
+	if _, err := svc.AssignRole(ctx, group.ID, &contract.GroupRoleRequest{RoleID: globexRole.ID}); !errors.Is(err, entity.ErrCrossOrganization) {
+		t.Errorf("cross-tenant role error = %v, want ErrCrossOrganization", err)
+	}
+
+	if _, err := svc.AddMember(acme, group.ID, &contract.GroupMemberRequest{UserID: acmeUser.ID}); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if _, err := svc.AssignRole(acme, group.ID, &contract.GroupRoleRequest{RoleID: acmeRole.ID}); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	members, err := repos.groups.GetMembers(globex, group.ID)
+	if err != nil || len(members) != 0 {
+		t.Errorf("members seen from globex = %+v (%v), want none", members, err)
+	}
+
+	// Deleting the user removes the membership, a role held by a group
+	// cannot be deleted
+	if err := repos.roles.Delete(acme, acmeRole.ID); !isViolation(err, "23503") {
+		t.Errorf("deleting a group's role error = %v, want foreign key violation", err)
+	}
+	if err := repos.users.Delete(acme, acmeUser.ID); err != nil {
+		t.Fatal(err)
+	}
+	if members, _ := repos.groups.GetMembers(acme, group.ID); len(members) != 0 {
+		t.Errorf("members after deleting the user = %+v, want none", members)
+	}
+}
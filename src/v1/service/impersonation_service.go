@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+)
+
+var (
+	// ErrInvalidImpersonation is returned for an impersonation without a
+	// reason, of oneself, of a super-admin, of a disabled user or of a user
+	// holding a role the impersonator lacks, and when it is not started
+	// from a login session.
+	ErrInvalidImpersonation = errors.New("invalid impersonation")
+	// ErrImpersonating is returned for sensitive actions, such as managing
+	// credentials or changing anyone's roles, attempted while impersonating
+	// a user.
+	ErrImpersonating = errors.New("not allowed while impersonating a user")
+)
+
+// ImpersonationService lets support staff act as a user of their
+// organization to reproduce an issue. An impersonation token reads
+// "tli_<random>", lives in Redis for the configured lifetime and carries
+// both users: requests are authorized as the user and audited with the
+// impersonator.
+type ImpersonationService struct {
+	userRepo  repository.UserRepository
+	groupRepo repository.GroupRepository
+	redisRepo repository.RedisRepository
+	lifetime  time.Duration
+	now       func() time.Time
+}
+
+func NewImpersonationService(
+	userRepo repository.UserRepository,
+	groupRepo repository.GroupRepository,
+	redisRepo repository.RedisRepository,
+	lifetime time.Duration,
+) *ImpersonationService {
+	return &ImpersonationService{
+		userRepo:  userRepo,
+		groupRepo: groupRepo,
+		redisRepo: redisRepo,
+		lifetime:  lifetime,
+		now:       time.Now,
+	}
+}
+
+// Impersonate issues a token for the logged in user to act as the user
+// with userID. The token is only part of this response.
+func (s *ImpersonationService) Impersonate(ctx context.Context, userID int64, req *contract.ImpersonateRequest) (*contract.ImpersonationResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, ok := authz.TokenScopes(ctx); ok {
+		return nil, fmt.Errorf("%w: impersonation needs a login session", ErrInvalidImpersonation)
+	}
+	impersonator, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrInvalidImpersonation)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.Require(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := withGroupRoles(ctx, s.groupRepo, user); err != nil {
+		return nil, err
+	}
+	switch {
+	case user.ID == impersonator.ID:
+		return nil, fmt.Errorf("%w: you cannot impersonate yourself", ErrInvalidImpersonation)
+	case user.HasRole(entity.SuperAdminRole):
+		return nil, fmt.Errorf("%w: super-admins cannot be impersonated", ErrInvalidImpersonation)
+	case user.DisabledAt != nil:
+		return nil, fmt.Errorf("%w: the user is disabled", ErrInvalidImpersonation)
+	}
+	// Acting as the user must not grant the impersonator more rights
+	for _, role := range user.Roles {
+		if !holdsRole(impersonator, role.ID) {
+			return nil, fmt.Errorf("%w: the user holds role %s, which you do not", ErrInvalidImpersonation, role.Name)
+		}
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token := entity.ImpersonationTokenPrefix + raw
+	now := s.now()
+	impersonation := &entity.Impersonation{
+		ImpersonatorID:    impersonator.ID,
+		ImpersonatorEmail: impersonator.Email,
+		UserID:            user.ID,
+		OrganizationID:    user.OrganizationID,
+		Reason:            reason,
+		StartedAt:         now,
+		ExpiresAt:         now.Add(s.lifetime),
+	}
+	if err := s.redisRepo.SetImpersonation(ctx, token, impersonation); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: impersonation started impersonator=%d user=%d organization=%d expires_at=%s reason=%q",
+		impersonator.ID, user.ID, user.OrganizationID, impersonation.ExpiresAt.Format(time.RFC3339), reason)
+
+	return &contract.ImpersonationResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    contract.ImpersonationToken{AccessToken: token, Impersonation: impersonation},
+	}, nil
+}
+
+// Authenticate returns the impersonated user of a token, with their group
+// roles, and the impersonation. The impersonation ends as soon as either
+// user is disabled or deleted.
+func (s *ImpersonationService) Authenticate(ctx context.Context, token string) (*entity.User, *entity.Impersonation, error) {
+	impersonation, err := s.redisRepo.GetImpersonation(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	impersonator, err := s.userRepo.GetByID(ctx, impersonation.ImpersonatorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if impersonator.DisabledAt != nil {
+		return nil, nil, ErrUserDisabled
+	}
+	user, err := s.userRepo.GetByID(ctx, impersonation.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, ErrUserDisabled
+	}
+	if err := withGroupRoles(ctx, s.groupRepo, user); err != nil {
+		return nil, nil, err
+	}
+	return user, impersonation, nil
+}
+
+// refuseImpersonation guards sensitive actions, which the user must take
+// themselves.
+func refuseImpersonation(ctx context.Context) error {
+	if _, ok := authz.Impersonation(ctx); ok {
+		return ErrImpersonating
+	}
+	return nil
+}
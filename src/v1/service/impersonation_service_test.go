@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestImpersonation(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, acmeRole, jane := newTenant(t, repos, "acme", "jane@acme.com")
+	_, _, john := newTenant(t, repos, "globex", "john@globex.com")
+	bob := &entity.User{Roles: []entity.Role{*acmeRole}, Name: "bob", Email: "bob@acme.com", Password: "secret"}
+	if err := repos.users.Create(acme, bob); err != nil {
+		t.Fatal(err)
+	}
+	superAdmin := &entity.Role{Name: entity.SuperAdminRole}
+	if err := repos.roles.Create(acme, superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	root := &entity.User{Roles: []entity.Role{*superAdmin}, Name: "root", Email: "root@acme.com", Password: "secret"}
+	if err := repos.users.Create(acme, root); err != nil {
+		t.Fatal(err)
+	}
+
+	billing := &entity.Role{Name: "billing"}
+	if err := repos.roles.Create(acme, billing); err != nil {
+		t.Fatal(err)
+	}
+	carol := &entity.User{Roles: []entity.Role{*acmeRole, *billing}, Name: "carol", Email: "carol@acme.com", Password: "secret"}
+	if err := repos.users.Create(acme, carol); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewImpersonationService(repos.users, repos.groups, repos.redis, 15*time.Minute)
+	auth := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+	asJane := context.WithValue(acme, "user", jane)
+	reason := &contract.ImpersonateRequest{Reason: "ticket 42"}
+
+	refusals := []struct {
+		name   string
+		ctx    context.Context
+		userID int64
+		req    *contract.ImpersonateRequest
+		want   error
+	}{
+		{"no reason", asJane, bob.ID, &contract.ImpersonateRequest{Reason: " "}, ErrInvalidImpersonation},
+		{"oneself", asJane, jane.ID, reason, ErrInvalidImpersonation},
+		{"super-admin", asJane, root.ID, reason, ErrInvalidImpersonation},
+		{"role the impersonator lacks", asJane, carol.ID, reason, ErrInvalidImpersonation},
+		{"other organization", asJane, john.ID, reason, sql.ErrNoRows},
+		{"API token", authz.WithTokenScopes(asJane, nil), bob.ID, reason, ErrInvalidImpersonation},
+	}
+	for _, tt := range refusals {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Impersonate(tt.ctx, tt.userID, tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("Impersonate error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	resp, err := svc.Impersonate(asJane, bob.ID, reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := resp.Data.(contract.ImpersonationToken)
+	impersonation := started.Impersonation.(*entity.Impersonation)
+	if impersonation.ImpersonatorID != jane.ID || impersonation.UserID != bob.ID || impersonation.Reason != "ticket 42" {
+		t.Errorf("impersonation = %+v", impersonation)
+	}
+	if lifetime := impersonation.ExpiresAt.Sub(impersonation.StartedAt); lifetime != 15*time.Minute {
+		t.Errorf("lifetime = %s, want 15m", lifetime)
+	}
+
+	user, got, err := svc.Authenticate(tenant.All(context.Background()), started.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != bob.ID || got.ImpersonatorID != jane.ID {
+		t.Errorf("Authenticate = %+v, %+v; want bob impersonated by jane", user, got)
+	}
+
+	// Acting as bob, jane cannot manage credentials or impersonate anew
+	asBob := authz.WithImpersonation(context.WithValue(acme, "user", user), got)
+	apiTokens := NewAPITokenService(repos.apiTokens, repos.users, repos.groups, time.Hour)
+	if _, err := apiTokens.CreateToken(asBob, &contract.CreateAPITokenRequest{Name: "ci"}); !errors.Is(err, ErrImpersonating) {
+		t.Errorf("CreateToken while impersonating error = %v, want %v", err, ErrImpersonating)
+	}
+	if _, err := svc.Impersonate(asBob, jane.ID, reason); !errors.Is(err, ErrImpersonating) {
+		t.Errorf("Impersonate while impersonating error = %v, want %v", err, ErrImpersonating)
+	}
+
+	// Logging out ends the impersonation only
+	session, err := auth.StartSession(acme, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.Logout(tenant.All(context.Background()), started.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Authenticate(tenant.All(context.Background()), started.AccessToken); err == nil {
+		t.Error("the impersonation outlived logout")
+	}
+	if _, err := auth.ValidateToken(tenant.All(context.Background()), session.AccessToken); err != nil {
+		t.Errorf("logging out of the impersonation ended jane's session: %v", err)
+	}
+
+	// Disabling the impersonator ends the impersonation at once
+	resp, err = svc.Impersonate(asJane, bob.ID, reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := resp.Data.(contract.ImpersonationToken).AccessToken
+	disabledAt := time.Now()
+	jane.DisabledAt = &disabledAt
+	if err := repos.users.Update(acme, jane); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Authenticate(tenant.All(context.Background()), token); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Authenticate with a disabled impersonator error = %v, want %v", err, ErrUserDisabled)
+	}
+	if _, err := svc.Impersonate(context.WithValue(acme, "user", bob), jane.ID, reason); !errors.Is(err, ErrInvalidImpersonation) {
+		t.Errorf("Impersonate of a disabled user error = %v, want %v", err, ErrInvalidImpersonation)
+	}
+}
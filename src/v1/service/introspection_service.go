@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+// ErrUnsupportedTokenType is the RFC 7009 error for a token that cannot be
+// revoked: OIDC access tokens are self-contained JWTs and stay valid
+// until they expire.
+var ErrUnsupportedTokenType = errors.New("unsupported_token_type")
+
+// IntrospectionService lets registered OAuth clients, such as gateways
+// and sidecars, check (RFC 7662) and revoke (RFC 7009) the bearer tokens
+// presented to them: session tokens, impersonation tokens, API tokens,
+// OAuth access tokens and OIDC access tokens, told apart by their shape. A client only sees the
+// tokens of its own organization; the others are reported inactive.
+type IntrospectionService struct {
+	oauthService    *OAuthService
+	apiTokenService *APITokenService
+	oidcService     *OIDCService
+	apiTokenRepo    repository.APITokenRepository
+	userRepo        repository.UserRepository
+	groupRepo       repository.GroupRepository
+	redisRepo       repository.RedisRepository
+	now             func() time.Time
+}
+
+func NewIntrospectionService(
+	oauthService *OAuthService,
+	apiTokenService *APITokenService,
+	oidcService *OIDCService,
+	apiTokenRepo repository.APITokenRepository,
+	userRepo repository.UserRepository,
+	groupRepo repository.GroupRepository,
+	redisRepo repository.RedisRepository,
+) *IntrospectionService {
+	return &IntrospectionService{
+		oauthService:    oauthService,
+		apiTokenService: apiTokenService,
+		oidcService:     oidcService,
+		apiTokenRepo:    apiTokenRepo,
+		userRepo:        userRepo,
+		groupRepo:       groupRepo,
+		redisRepo:       redisRepo,
+		now:             time.Now,
+	}
+}
+
+// authenticate returns a context limited to the organization of the
+// calling client.
+func (s *IntrospectionService) authenticate(ctx context.Context, clientID, secret, token string) (context.Context, *entity.OAuthClient, error) {
+	client, err := s.oauthService.AuthenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == "" {
+		return nil, nil, fmt.Errorf("%w: token is required", ErrInvalidRequest)
+	}
+	return tenant.WithOrganization(ctx, client.OrganizationID), client, nil
+}
+
+// Introspect tells the client whether token is active and, if so, who it
+// stands for: the user, or the client of an OAuth access token, with
+// their roles and the token's expiry. The token_type_hint of RFC 7662 is
+// not needed, the prefix of the token tells its kind.
+func (s *IntrospectionService) Introspect(ctx context.Context, clientID, secret, token string) (*contract.IntrospectionResponse, error) {
+	ctx, _, err := s.authenticate(ctx, clientID, secret, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *contract.IntrospectionResponse
+	switch {
+	case strings.HasPrefix(token, entity.ClientTokenPrefix):
+		resp, err = s.introspectClientToken(ctx, token)
+	case strings.HasPrefix(token, entity.APITokenPrefix):
+		resp, err = s.introspectAPIToken(ctx, token)
+	case strings.HasPrefix(token, entity.ImpersonationTokenPrefix):
+		resp, err = s.introspectImpersonation(ctx, token)
+	case strings.Count(token, ".") == 2:
+		resp, err = s.introspectAccessToken(ctx, token)
+	default:
+		resp, err = s.introspectSession(ctx, token)
+	}
+	if inactive(err) {
+		return &contract.IntrospectionResponse{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Active = true
+	resp.TokenType = "Bearer"
+	return resp, nil
+}
+
+func (s *IntrospectionService) introspectSession(ctx context.Context, token string) (*contract.IntrospectionResponse, error) {
+	session, err := s.redisRepo.GetSession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.activeUser(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	resp := userIntrospection(user)
+	resp.ExpiresAt = session.ExpiresAt.Unix()
+	return resp, nil
+}
+
+// introspectImpersonation describes the impersonated user, with the
+// impersonator as the actor. Like for requests made with the token, it is
+// inactive as soon as either user is disabled.
+func (s *IntrospectionService) introspectImpersonation(ctx context.Context, token string) (*contract.IntrospectionResponse, error) {
+	impersonation, err := s.redisRepo.GetImpersonation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	impersonator, err := s.activeUser(ctx, impersonation.ImpersonatorID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.activeUser(ctx, impersonation.UserID)
+	if err != nil {
+		return nil, err
+	}
+	resp := userIntrospection(user)
+	resp.ExpiresAt = impersonation.ExpiresAt.Unix()
+	resp.IssuedAt = impersonation.StartedAt.Unix()
+	resp.Act = &contract.IntrospectionActor{
+		Subject:  strconv.FormatInt(impersonator.ID, 10),
+		Username: impersonator.Email,
+	}
+	return resp, nil
+}
+
+// introspectAPIToken counts as a use of the token, like any request made
+// with it.
+func (s *IntrospectionService) introspectAPIToken(ctx context.Context, token string) (*contract.IntrospectionResponse, error) {
+	user, apiToken, err := s.apiTokenService.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	resp := userIntrospection(user)
+	resp.ExpiresAt = apiToken.ExpiresAt.Unix()
+	resp.IssuedAt = apiToken.CreatedAt.Unix()
+	return resp, nil
+}
+
+func (s *IntrospectionService) introspectClientToken(ctx context.Context, token string) (*contract.IntrospectionResponse, error) {
+	clientToken, err := s.redisRepo.GetClientToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.oauthService.tokenClient(ctx, clientToken)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.IntrospectionResponse{
+		Scope:          strings.Join(clientToken.Scopes, " "),
+		ClientID:       client.ClientID,
+		ExpiresAt:      clientToken.ExpiresAt.Unix(),
+		Subject:        client.ClientID,
+		Roles:          []string{client.Role.Name},
+		OrganizationID: client.OrganizationID,
+	}, nil
+}
+
+func (s *IntrospectionService) introspectAccessToken(ctx context.Context, token string) (*contract.IntrospectionResponse, error) {
+	claims, userID, err := s.oidcService.verifyAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resp := userIntrospection(user)
+	resp.Scope = claims.Scope
+	resp.ClientID = claims.ClientID
+	resp.ExpiresAt = claims.ExpiresAt
+	resp.IssuedAt = claims.IssuedAt
+	return resp, nil
+}
+
+// Revoke ends token at once. As RFC 7009 asks, a token that is unknown,
+// already expired or of another organization is not an error. Any client
+// of the organization may revoke its tokens, the way a gateway ends the
+// session presented to it.
+func (s *IntrospectionService) Revoke(ctx context.Context, clientID, secret, token string) error {
+	ctx, client, err := s.authenticate(ctx, clientID, secret, token)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(token, entity.ClientTokenPrefix):
+		err = s.revokeClientToken(ctx, token)
+	case strings.HasPrefix(token, entity.APITokenPrefix):
+		err = s.revokeAPIToken(ctx, token)
+	case strings.HasPrefix(token, entity.ImpersonationTokenPrefix):
+		err = s.revokeImpersonation(ctx, token)
+	case strings.Count(token, ".") == 2:
+		return fmt.Errorf("%w: OIDC access tokens expire on their own", ErrUnsupportedTokenType)
+	default:
+		err = s.revokeSession(ctx, token)
+	}
+	if inactive(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("audit: token revoked client=%s", client.ClientID)
+	return nil
+}
+
+func (s *IntrospectionService) revokeSession(ctx context.Context, token string) error {
+	userID, err := s.redisRepo.GetUserIDByToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	return s.redisRepo.DeleteToken(ctx, token)
+}
+
+func (s *IntrospectionService) revokeImpersonation(ctx context.Context, token string) error {
+	impersonation, err := s.redisRepo.GetImpersonation(ctx, token)
+	if err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetByID(ctx, impersonation.UserID); err != nil {
+		return err
+	}
+	if err := s.redisRepo.DeleteImpersonation(ctx, token); err != nil {
+		return err
+	}
+	log.Printf("audit: impersonation ended impersonator=%d user=%d", impersonation.ImpersonatorID, impersonation.UserID)
+	return nil
+}
+
+func (s *IntrospectionService) revokeAPIToken(ctx context.Context, token string) error {
+	user, apiToken, err := s.apiTokenService.Authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+	return s.apiTokenRepo.Revoke(ctx, user.ID, apiToken.ID, s.now())
+}
+
+func (s *IntrospectionService) revokeClientToken(ctx context.Context, token string) error {
+	clientToken, err := s.redisRepo.GetClientToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if _, err := s.oauthService.tokenClient(ctx, clientToken); err != nil {
+		return err
+	}
+	return s.redisRepo.DeleteClientToken(ctx, token)
+}
+
+// activeUser loads a user of the organization of ctx with their group
+// roles, refusing disabled ones.
+func (s *IntrospectionService) activeUser(ctx context.Context, userID int64) (*entity.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	if err := withGroupRoles(ctx, s.groupRepo, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func userIntrospection(user *entity.User) *contract.IntrospectionResponse {
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+	return &contract.IntrospectionResponse{
+		Username:       user.Email,
+		Subject:        strconv.FormatInt(user.ID, 10),
+		Roles:          roles,
+		OrganizationID: user.OrganizationID,
+	}
+}
+
+// inactive reports whether err means that the token is not active, rather
+// than that it could not be checked.
+func inactive(err error) bool {
+	for _, target := range []error{goRedis.Nil, sql.ErrNoRows, ErrInvalidAPIToken, ErrInvalidAccessToken, ErrInvalidClientToken, ErrUserDisabled} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestIntrospectionService(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, acmeRole, jane := newTenant(t, repos, "acme", "jane@acme.com")
+	globex, _, john := newTenant(t, repos, "globex", "john@globex.com")
+
+	auth := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+	oauth := NewOAuthService(repos.clients, repos.roles, repos.redis, time.Hour)
+	apiTokens := NewAPITokenService(repos.apiTokens, repos.users, repos.groups, 24*time.Hour)
+	oidc := newOIDCService(t, repos)
+	svc := NewIntrospectionService(oauth, apiTokens, oidc, repos.apiTokens, repos.users, repos.groups, repos.redis)
+
+	resp, err := oauth.CreateClient(acme, &contract.CreateOAuthClientRequest{Name: "gateway", RoleID: acmeRole.ID, Scopes: []string{"read:/users/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := resp.Data.(contract.CreatedOAuthClient)
+
+	session, err := auth.StartSession(acme, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := apiTokens.CreateToken(context.WithValue(acme, "user", jane), &contract.CreateAPITokenRequest{
+		Name:   "ci",
+		Scopes: []contract.APITokenScope{{Section: "be", Route: "/users/*", Read: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiToken := created.Data.(contract.CreatedAPIToken).Token
+	clientToken, err := oauth.Token(context.Background(), GrantClientCredentials, gateway.ClientID, gateway.ClientSecret, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	accessToken, err := oidc.signer.Sign(accessTokenType, accessTokenClaims{
+		Issuer:    oidc.issuer,
+		Subject:   strconv.FormatInt(jane.ID, 10),
+		Audience:  oidc.issuer,
+		ClientID:  "wiki",
+		Scope:     "openid email",
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		IssuedAt:  now.Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	johnSession, err := auth.StartSession(globex, john)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	introspect := func(token string) *contract.IntrospectionResponse {
+		t.Helper()
+		resp, err := svc.Introspect(context.Background(), gateway.ClientID, gateway.ClientSecret, token)
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		return resp
+	}
+
+	janeID := strconv.FormatInt(jane.ID, 10)
+	tests := []struct {
+		name     string
+		token    string
+		sub      string
+		username string
+		clientID string
+		scope    string
+		expires  time.Duration
+	}{
+		{"session", session.AccessToken, janeID, "jane@acme.com", "", "", 24 * time.Hour},
+		{"API token", apiToken, janeID, "jane@acme.com", "", "", 24 * time.Hour},
+		{"OAuth access token", clientToken.AccessToken, gateway.ClientID, "", gateway.ClientID, "read:/users/*", time.Hour},
+		{"OIDC access token", accessToken, janeID, "jane@acme.com", "wiki", "openid email", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := introspect(tt.token)
+			if !got.Active || got.TokenType != "Bearer" || got.Subject != tt.sub || got.Username != tt.username || got.ClientID != tt.clientID || got.Scope != tt.scope {
+				t.Errorf("Introspect = %+v", got)
+			}
+			if len(got.Roles) != 1 || got.Roles[0] != "admin" || got.OrganizationID != jane.OrganizationID {
+				t.Errorf("roles = %v, organization = %d; want admin of acme", got.Roles, got.OrganizationID)
+			}
+			if exp := now.Add(tt.expires).Unix(); got.ExpiresAt < exp-5 || got.ExpiresAt > exp+5 {
+				t.Errorf("exp = %d, want about %d", got.ExpiresAt, exp)
+			}
+		})
+	}
+
+	// An impersonation token stands for the user, acted on by the
+	// impersonator
+	bob := &entity.User{Roles: []entity.Role{*acmeRole}, Name: "bob", Email: "bob@acme.com", Password: "secret"}
+	if err := repos.users.Create(acme, bob); err != nil {
+		t.Fatal(err)
+	}
+	impersonations := NewImpersonationService(repos.users, repos.groups, repos.redis, 15*time.Minute)
+	started, err := impersonations.Impersonate(context.WithValue(acme, "user", jane), bob.ID, &contract.ImpersonateRequest{Reason: "ticket 42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	impersonation := started.Data.(contract.ImpersonationToken).AccessToken
+	got := introspect(impersonation)
+	if !got.Active || got.Subject != strconv.FormatInt(bob.ID, 10) || got.Act == nil || got.Act.Subject != janeID {
+		t.Errorf("Introspect(impersonation) = %+v, want bob acted on by jane", got)
+	}
+	revoke := func(token string) {
+		t.Helper()
+		if err := svc.Revoke(context.Background(), gateway.ClientID, gateway.ClientSecret, token); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+	}
+	revoke(impersonation)
+	if got := introspect(impersonation); got.Active {
+		t.Errorf("revoked impersonation = %+v, want inactive", got)
+	}
+
+	// Unknown tokens and the tokens of other organizations are inactive
+	for _, token := range []string{"unknown", "tlo_unknown", "tlk_1_unknown", "tli_unknown", "a.b.c", johnSession.AccessToken} {
+		if got := introspect(token); got.Active || got.Subject != "" {
+			t.Errorf("Introspect(%q) = %+v, want inactive", token, got)
+		}
+	}
+
+	if _, err := svc.Introspect(context.Background(), gateway.ClientID, "wrong", session.AccessToken); !errors.Is(err, ErrInvalidClient) {
+		t.Errorf("Introspect with a wrong secret error = %v, want invalid_client", err)
+	}
+	if _, err := svc.Introspect(context.Background(), gateway.ClientID, gateway.ClientSecret, ""); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Introspect without a token error = %v, want invalid_request", err)
+	}
+
+	// A disabled user's tokens are inactive at once
+	disabledAt := time.Now()
+	jane.DisabledAt = &disabledAt
+	if err := repos.users.Update(acme, jane); err != nil {
+		t.Fatal(err)
+	}
+	if got := introspect(session.AccessToken); got.Active {
+		t.Errorf("session of a disabled user = %+v, want inactive", got)
+	}
+	jane.DisabledAt = nil
+	if err := repos.users.Update(acme, jane); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{session.AccessToken, apiToken, clientToken.AccessToken} {
+		revoke(token)
+		if got := introspect(token); got.Active {
+			t.Errorf("revoked token %q = %+v, want inactive", token, got)
+		}
+	}
+	if _, err := auth.ValidateToken(tenant.All(context.Background()), session.AccessToken); err == nil {
+		t.Error("the revoked session still works")
+	}
+
+	// Revoking an unknown token or another organization's succeeds without
+	// doing anything
+	revoke("unknown")
+	revoke(johnSession.AccessToken)
+	if _, err := auth.ValidateToken(tenant.All(context.Background()), johnSession.AccessToken); err != nil {
+		t.Errorf("acme's client ended globex's session: %v", err)
+	}
+
+	if err := svc.Revoke(context.Background(), gateway.ClientID, gateway.ClientSecret, accessToken); !errors.Is(err, ErrUnsupportedTokenType) {
+		t.Errorf("Revoke of an OIDC access token error = %v, want unsupported_token_type", err)
+	}
+}
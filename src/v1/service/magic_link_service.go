@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/mail"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidMagicLink is returned for a login link that is forged,
+// expired, already used or no longer allowed for the user.
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+// MagicLinkService logs users in without a password: it emails them a
+// link, which logs in once within the configured lifetime. Only users
+// holding a role with MagicLink get one. The link carries a token signed
+// with key, its ID names the pending login in Redis.
+type MagicLinkService struct {
+	userRepo         repository.UserRepository
+	organizationRepo repository.OrganizationRepository
+	groupRepo        repository.GroupRepository
+	redisRepo        repository.RedisRepository
+	authService      *AuthService
+	mailer           mail.Mailer
+	key              []byte
+	linkURL          string
+	lifetime         time.Duration
+	now              func() time.Time
+}
+
+func NewMagicLinkService(
+	userRepo repository.UserRepository,
+	organizationRepo repository.OrganizationRepository,
+	groupRepo repository.GroupRepository,
+	redisRepo repository.RedisRepository,
+	authService *AuthService,
+	mailer mail.Mailer,
+	key []byte,
+	linkURL string,
+	lifetime time.Duration,
+) *MagicLinkService {
+	return &MagicLinkService{
+		userRepo:         userRepo,
+		organizationRepo: organizationRepo,
+		groupRepo:        groupRepo,
+		redisRepo:        redisRepo,
+		authService:      authService,
+		mailer:           mailer,
+		key:              key,
+		linkURL:          linkURL,
+		lifetime:         lifetime,
+		now:              time.Now,
+	}
+}
+
+// magicLinkClaims is the signed part of a link.
+type magicLinkClaims struct {
+	ID             string `json:"jti"`
+	UserID         int64  `json:"sub"`
+	OrganizationID int64  `json:"org"`
+	ExpiresAt      int64  `json:"exp"`
+}
+
+// Send emails a login link to the user with req.Email. The answer is the
+// same whether a link was sent or not, so it does not tell which emails
+// belong to a user allowed to log in this way.
+func (s *MagicLinkService) Send(ctx context.Context, req *contract.MagicLinkRequest) (*contract.MagicLinkResponse, error) {
+	organization, err := resolveOrganization(ctx, s.organizationRepo, req.Organization)
+	if err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithOrganization(ctx, organization.ID)
+
+	sent := &contract.MagicLinkResponse{Status: true, Message: "Successfully"}
+	user, err := s.userRepo.GetByEmail(ctx, strings.TrimSpace(req.Email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return sent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allowed(ctx, user); err != nil {
+		if errors.Is(err, ErrInvalidMagicLink) || errors.Is(err, ErrUserDisabled) {
+			log.Printf("audit: magic link refused user=%d organization=%d: %v", user.ID, user.OrganizationID, err)
+			return sent, nil
+		}
+		return nil, err
+	}
+
+	id, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := s.now().Add(s.lifetime)
+	link := &entity.MagicLink{UserID: user.ID, OrganizationID: user.OrganizationID, ExpiresAt: expiresAt}
+	if err := s.redisRepo.SetMagicLink(ctx, id, link); err != nil {
+		return nil, err
+	}
+	token, err := s.sign(magicLinkClaims{ID: id, UserID: user.ID, OrganizationID: user.OrganizationID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return nil, err
+	}
+	linkURL, err := url.Parse(s.linkURL)
+	if err != nil {
+		return nil, err
+	}
+	query := linkURL.Query()
+	query.Set("token", token)
+	linkURL.RawQuery = query.Encode()
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hello %s,\n\nopen this link to log in. It works once, within %s:\n\n%s\n\nIf you did not ask for it, you can ignore this email.\n",
+			user.Name, s.lifetime, linkURL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send login link: %w", err)
+	}
+	log.Printf("audit: magic link sent user=%d organization=%d expires_at=%s", user.ID, user.OrganizationID, expiresAt.Format(time.RFC3339))
+	return sent, nil
+}
+
+// Login redeems the token of a link for a session token, as a password
+// login would. The user must still be active and allowed magic links.
+func (s *MagicLinkService) Login(ctx context.Context, req *contract.MagicLinkLoginRequest) (*LoginResponse, error) {
+	claims, err := s.verify(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: the link expired", ErrInvalidMagicLink)
+	}
+	link, err := s.redisRepo.TakeMagicLink(ctx, claims.ID)
+	if errors.Is(err, goRedis.Nil) {
+		return nil, fmt.Errorf("%w: the link was already used", ErrInvalidMagicLink)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.UserID != claims.UserID || link.OrganizationID != claims.OrganizationID {
+		return nil, ErrInvalidMagicLink
+	}
+
+	ctx = tenant.WithOrganization(ctx, link.OrganizationID)
+	user, err := s.userRepo.GetByID(ctx, link.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allowed(ctx, user); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: magic link login user=%d organization=%d", user.ID, user.OrganizationID)
+	return s.authService.StartSession(ctx, user)
+}
+
+// allowed refuses disabled users and users without a role, held directly
+// or through a group, that allows magic links.
+func (s *MagicLinkService) allowed(ctx context.Context, user *entity.User) error {
+	if user.DisabledAt != nil {
+		return ErrUserDisabled
+	}
+	groupRoles, err := s.groupRepo.GetRolesByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, role := range append(append([]entity.Role{}, user.Roles...), groupRoles...) {
+		if role.MagicLink {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no role of the user allows magic links", ErrInvalidMagicLink)
+}
+
+// sign returns claims as "<payload>.<signature>", both base64url encoded,
+// signed with HMAC-SHA256.
+func (s *MagicLinkService) sign(claims magicLinkClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+func (s *MagicLinkService) verify(token string) (*magicLinkClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidMagicLink
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sum, s.mac(encoded)) {
+		return nil, ErrInvalidMagicLink
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	var claims magicLinkClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" {
+		return nil, ErrInvalidMagicLink
+	}
+	return &claims, nil
+}
+
+// mac signs the payload for magic links only, so the key cannot be used
+// to forge another kind of token signed with it.
+func (s *MagicLinkService) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte("magic-link." + encoded))
+	return h.Sum(nil)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/mail"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+)
+
+// outbox records the messages sent instead of delivering them.
+type outbox []mail.Message
+
+func (o *outbox) Send(ctx context.Context, msg mail.Message) error {
+	*o = append(*o, msg)
+	return nil
+}
+
+// token returns the token of the link in the last message.
+func (o outbox) token(t *testing.T) string {
+	t.Helper()
+	if len(o) == 0 {
+		t.Fatal("no message was sent")
+	}
+	body := o[len(o)-1].Body
+	start := strings.Index(body, "http")
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+func TestMagicLink(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, _, jane := newTenant(t, repos, "acme", "jane@acme.com")
+	reader := &entity.Role{Name: "reader", MagicLink: true}
+	if err := repos.roles.Create(acme, reader); err != nil {
+		t.Fatal(err)
+	}
+	bob := &entity.User{Roles: []entity.Role{*reader}, Name: "Bob", Email: "bob@acme.com", Password: "secret"}
+	if err := repos.users.Create(acme, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent outbox
+	auth := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+	svc := NewMagicLinkService(repos.users, repos.orgs, repos.groups, repos.redis, auth, &sent, []byte(strings.Repeat("k", 32)), "https://app.example.com/login?from=mail", 15*time.Minute)
+	send := func(email string) {
+		t.Helper()
+		if _, err := svc.Send(context.Background(), &contract.MagicLinkRequest{Organization: "acme", Email: email}); err != nil {
+			t.Fatalf("Send(%s): %v", email, err)
+		}
+	}
+	login := func(token string) (*LoginResponse, error) {
+		return svc.Login(context.Background(), &contract.MagicLinkLoginRequest{Token: token})
+	}
+
+	// Unknown emails and users without a magic link role get nothing,
+	// without telling the caller
+	send("nobody@acme.com")
+	send(jane.Email)
+	if len(sent) != 0 {
+		t.Fatalf("sent %d messages, want none", len(sent))
+	}
+
+	send(bob.Email)
+	if len(sent) != 1 || sent[0].To != bob.Email || !strings.Contains(sent[0].Body, "https://app.example.com/login?from=mail&token=") {
+		t.Fatalf("sent = %+v", sent)
+	}
+	token := sent.token(t)
+	resp, err := login(token)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	user, err := auth.ValidateToken(acme, resp.AccessToken)
+	if err != nil || user.ID != bob.ID {
+		t.Fatalf("session = %+v, %v; want bob's", user, err)
+	}
+	if _, err := login(token); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("second Login error = %v, want %v", err, ErrInvalidMagicLink)
+	}
+
+	// A forged or expired link is refused
+	send(bob.Email)
+	token = sent.token(t)
+	payload, _, _ := strings.Cut(token, ".")
+	other := NewMagicLinkService(repos.users, repos.orgs, repos.groups, repos.redis, auth, &sent, []byte(strings.Repeat("x", 32)), "https://app.example.com/login", 15*time.Minute)
+	otherKey, err := other.sign(magicLinkClaims{ID: "guess", UserID: bob.ID, OrganizationID: bob.OrganizationID, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, forged := range []string{"", "nope", payload, payload + ".AAAA", strings.ToUpper(token), otherKey} {
+		if _, err := login(forged); !errors.Is(err, ErrInvalidMagicLink) {
+			t.Errorf("Login(%q) error = %v, want %v", forged, err, ErrInvalidMagicLink)
+		}
+	}
+	svc.now = func() time.Time { return time.Now().Add(16 * time.Minute) }
+	if _, err := login(token); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("Login with an expired link error = %v, want %v", err, ErrInvalidMagicLink)
+	}
+	svc.now = time.Now
+
+	// A role held through a group allows it as well
+	group := &entity.Group{Name: "readers"}
+	if err := repos.groups.Create(acme, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.groups.AssignRole(acme, group.ID, reader.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.groups.AddMember(acme, group.ID, jane.ID); err != nil {
+		t.Fatal(err)
+	}
+	send(jane.Email)
+	token = sent.token(t)
+	if sent[len(sent)-1].To != jane.Email {
+		t.Fatalf("sent = %+v, want a link for jane", sent[len(sent)-1])
+	}
+
+	// Links stop working once the user is disabled
+	disabledAt := time.Now()
+	jane.DisabledAt = &disabledAt
+	if err := repos.users.Update(acme, jane); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(token); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Login of a disabled user error = %v, want %v", err, ErrUserDisabled)
+	}
+}
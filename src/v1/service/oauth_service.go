@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+// The token endpoint errors carry the RFC 6749 error codes.
+var (
+	ErrInvalidRequest       = errors.New("invalid_request")
+	ErrInvalidClient        = errors.New("invalid_client")
+	ErrUnsupportedGrantType = errors.New("unsupported_grant_type")
+	ErrInvalidScope         = errors.New("invalid_scope")
+
+	// ErrInvalidOAuthClient is returned for a client registration without a
+	// name, a role or scopes, or with a malformed scope.
+	ErrInvalidOAuthClient = errors.New("invalid OAuth client")
+	// ErrInvalidClientToken is returned when authenticating with an access
+	// token that is unknown, expired or whose client was deleted.
+	ErrInvalidClientToken = errors.New("invalid client token")
+)
+
+// GrantClientCredentials is the only grant type the token endpoint serves.
+const GrantClientCredentials = "client_credentials"
+
+// OAuthService registers OAuth clients and issues them access tokens with
+// the client_credentials grant, for services that call the API without a
+// user. Access tokens read "tlo_<random>" and live in Redis; client
+// secrets are stored hashed like passwords.
+type OAuthService struct {
+	clientRepo    repository.OAuthClientRepository
+	roleRepo      repository.RoleRepository
+	redisRepo     repository.RedisRepository
+	tokenLifetime time.Duration
+	now           func() time.Time
+}
+
+func NewOAuthService(
+	clientRepo repository.OAuthClientRepository,
+	roleRepo repository.RoleRepository,
+	redisRepo repository.RedisRepository,
+	tokenLifetime time.Duration,
+) *OAuthService {
+	return &OAuthService{
+		clientRepo:    clientRepo,
+		roleRepo:      roleRepo,
+		redisRepo:     redisRepo,
+		tokenLifetime: tokenLifetime,
+		now:           time.Now,
+	}
+}
+
+func (s *OAuthService) GetClients(ctx context.Context) (*contract.OAuthClientResponse, error) {
+	clients, err := s.clientRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.OAuthClientResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    clients,
+	}, nil
+}
+
+// CreateClient registers a client in the organization of ctx. The secret
+// is only part of this response.
+func (s *OAuthService) CreateClient(ctx context.Context, req *contract.CreateOAuthClientRequest) (*contract.OAuthClientResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.TrimSpace(req.Name) == "":
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOAuthClient)
+	case req.RoleID == 0:
+		return nil, fmt.Errorf("%w: role_id is required", ErrInvalidOAuthClient)
+	case len(req.Scopes) == 0:
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidOAuthClient)
+	}
+	for _, scope := range req.Scopes {
+		if len(entity.ScopeRights([]string{scope}, "")) == 0 {
+			return nil, fmt.Errorf("%w: scope %q is not \"<create|read|update|delete>:<route>\"", ErrInvalidOAuthClient, scope)
+		}
+	}
+	if _, err := s.roleRepo.GetByID(ctx, req.RoleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: role %d does not exist", ErrInvalidOAuthClient, req.RoleID)
+		}
+		return nil, err
+	}
+
+	clientID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := password.Hash(secret)
+	if err != nil {
+		return nil, err
+	}
+	client := &entity.OAuthClient{
+		ClientID:   clientID,
+		Name:       strings.TrimSpace(req.Name),
+		SecretHash: hashed,
+		RoleID:     req.RoleID,
+		Scope:      strings.Join(req.Scopes, " "),
+	}
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: oauth client created client=%s role=%d scope=%q", client.ClientID, client.RoleID, client.Scope)
+
+	return &contract.OAuthClientResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    contract.CreatedOAuthClient{ClientID: clientID, ClientSecret: secret, Client: client},
+	}, nil
+}
+
+// DeleteClient removes a client, its access tokens stop working at once.
+func (s *OAuthService) DeleteClient(ctx context.Context, clientID string) (*contract.OAuthClientResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.clientRepo.GetByClientID(ctx, clientID); err != nil {
+		return nil, err
+	}
+	if err := s.clientRepo.Delete(ctx, clientID); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: oauth client deleted client=%s", clientID)
+
+	return &contract.OAuthClientResponse{
+		Status:  true,
+		Message: "Successfully",
+	}, nil
+}
+
+// Token serves the client_credentials grant. The requested scope, space
+// separated, must be a subset of the client's scopes; all of them are
+// granted when it is empty.
+func (s *OAuthService) Token(ctx context.Context, grantType, clientID, secret, scope string) (*contract.OAuthTokenResponse, error) {
+	if grantType == "" {
+		return nil, fmt.Errorf("%w: grant_type is required", ErrInvalidRequest)
+	}
+	if grantType != GrantClientCredentials {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedGrantType, grantType)
+	}
+	client, err := s.AuthenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := client.Scopes()
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		allowed := make(map[string]bool, len(granted))
+		for _, sc := range granted {
+			allowed[sc] = true
+		}
+		for _, sc := range requested {
+			if !allowed[sc] {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidScope, sc)
+			}
+		}
+		granted = requested
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token := entity.ClientTokenPrefix + raw
+	clientToken := &entity.ClientToken{
+		ClientID:  client.ClientID,
+		Scopes:    granted,
+		ExpiresAt: s.now().Add(s.tokenLifetime),
+	}
+	if err := s.redisRepo.SetClientToken(ctx, token, clientToken); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: oauth token issued client=%s scope=%q", client.ClientID, strings.Join(granted, " "))
+
+	return &contract.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.tokenLifetime / time.Second),
+		Scope:       strings.Join(granted, " "),
+	}, nil
+}
+
+// AuthenticateClient returns the client with clientID when secret is
+// its secret, ErrInvalidClient otherwise. Client IDs are unique across
+// organizations, the client is looked up in all of them.
+func (s *OAuthService) AuthenticateClient(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error) {
+	if clientID == "" || secret == "" {
+		return nil, fmt.Errorf("%w: client authentication is required", ErrInvalidClient)
+	}
+
+	client, err := s.clientRepo.GetByClientID(tenant.All(ctx), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !password.Compare(client.SecretHash, secret) {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// Authenticate returns the client of an access token, with its role, and
+// the scopes it was granted. The request must then be limited to the
+// scopes, see entity.ScopeRights and authz.Restrict.
+func (s *OAuthService) Authenticate(ctx context.Context, token string) (*entity.OAuthClient, []string, error) {
+	clientToken, err := s.redisRepo.GetClientToken(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := s.tokenClient(ctx, clientToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, clientToken.Scopes, nil
+}
+
+// tokenClient returns the client an access token was issued to, with its
+// role, ErrInvalidClientToken when the client was deleted.
+func (s *OAuthService) tokenClient(ctx context.Context, clientToken *entity.ClientToken) (*entity.OAuthClient, error) {
+	client, err := s.clientRepo.GetByClientID(ctx, clientToken.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClientToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.Role, err = s.roleRepo.GetByID(ctx, client.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomToken returns n random bytes, base64url encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestOAuthServiceToken(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "billing")
+	svc := NewOAuthService(repos.clients, repos.roles, repos.redis, time.Hour)
+
+	resp, err := svc.CreateClient(ctx, &contract.CreateOAuthClientRequest{
+		Name:   "billing",
+		RoleID: role.ID,
+		Scopes: []string{"read:/users/*", "update:/users/user/{user_id}"},
+	})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	created := resp.Data.(contract.CreatedOAuthClient)
+	if created.ClientID == "" || created.ClientSecret == "" {
+		t.Fatalf("CreateClient = %+v, want a client ID and secret", created)
+	}
+	stored, _ := repos.clients.GetByClientID(ctx, created.ClientID)
+	if stored.SecretHash == created.ClientSecret {
+		t.Error("client secret stored in plain text")
+	}
+
+	token, err := svc.Token(ctx, GrantClientCredentials, created.ClientID, created.ClientSecret, "")
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if token.TokenType != "Bearer" || token.ExpiresIn != 3600 || token.Scope != "read:/users/* update:/users/user/{user_id}" {
+		t.Errorf("Token = %+v, want a bearer token for an hour with every allowed scope", token)
+	}
+
+	client, scopes, err := svc.Authenticate(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if client.ClientID != created.ClientID || client.Role == nil || client.Role.Name != "billing" {
+		t.Errorf("Authenticate = %+v, want the client with its role", client)
+	}
+	if want := []string{"read:/users/*", "update:/users/user/{user_id}"}; !reflect.DeepEqual(scopes, want) {
+		t.Errorf("scopes = %v, want %v", scopes, want)
+	}
+
+	narrow, err := svc.Token(ctx, GrantClientCredentials, created.ClientID, created.ClientSecret, "read:/users/*")
+	if err != nil {
+		t.Fatalf("Token with scope: %v", err)
+	}
+	if narrow.Scope != "read:/users/*" {
+		t.Errorf("scope = %q, want read:/users/*", narrow.Scope)
+	}
+
+	tests := []struct {
+		name      string
+		grantType string
+		secret    string
+		scope     string
+		want      error
+	}{
+		{"wrong secret", GrantClientCredentials, "nope", "", ErrInvalidClient},
+		{"no secret", GrantClientCredentials, "", "", ErrInvalidClient},
+		{"password grant", "password", created.ClientSecret, "", ErrUnsupportedGrantType},
+		{"no grant type", "", created.ClientSecret, "", ErrInvalidRequest},
+		{"scope not allowed", GrantClientCredentials, created.ClientSecret, "delete:/users/*", ErrInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Token(ctx, tt.grantType, created.ClientID, tt.secret, tt.scope); !errors.Is(err, tt.want) {
+				t.Errorf("Token error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Deleting the client ends its tokens
+	if _, err := svc.DeleteClient(ctx, created.ClientID); err != nil {
+		t.Fatalf("DeleteClient: %v", err)
+	}
+	if _, _, err := svc.Authenticate(ctx, token.AccessToken); !errors.Is(err, ErrInvalidClientToken) {
+		t.Errorf("Authenticate after delete error = %v, want ErrInvalidClientToken", err)
+	}
+}
+
+func TestOAuthServiceCreateClientInvalid(t *testing.T) {
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "billing")
+	svc := NewOAuthService(repos.clients, repos.roles, repos.redis, time.Hour)
+
+	tests := []struct {
+		name string
+		req  contract.CreateOAuthClientRequest
+	}{
+		{"no name", contract.CreateOAuthClientRequest{RoleID: role.ID, Scopes: []string{"read:/users/*"}}},
+		{"no scopes", contract.CreateOAuthClientRequest{Name: "x", RoleID: role.ID}},
+		{"malformed scope", contract.CreateOAuthClientRequest{Name: "x", RoleID: role.ID, Scopes: []string{"users"}}},
+		{"unknown operation", contract.CreateOAuthClientRequest{Name: "x", RoleID: role.ID, Scopes: []string{"write:/users/*"}}},
+		{"unknown role", contract.CreateOAuthClientRequest{Name: "x", RoleID: 99, Scopes: []string{"read:/users/*"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.CreateClient(tenant.All(context.Background()), &tt.req); !errors.Is(err, ErrInvalidOAuthClient) {
+				t.Errorf("CreateClient error = %v, want ErrInvalidOAuthClient", err)
+			}
+		})
+	}
+}
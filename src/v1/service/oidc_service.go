@@ -0,0 +1,601 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/jwt"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrInvalidRedirect is returned for an authorization request with an
+	// unknown client or an unregistered redirect_uri. It is shown to the
+	// user: redirecting would make this service an open redirector.
+	ErrInvalidRedirect = errors.New("unknown client_id or redirect_uri")
+	// ErrInvalidOIDCClient is returned for a client registration without a
+	// name or with an invalid redirect URI.
+	ErrInvalidOIDCClient = errors.New("invalid OIDC client")
+
+	// The errors sent back to the relying party carry the RFC 6749 codes,
+	// like ErrInvalidRequest and the other token endpoint errors.
+	ErrUnsupportedResponseType  = errors.New("unsupported_response_type")
+	ErrAccessDenied             = errors.New("access_denied")
+	ErrInvalidAuthorizationCode = errors.New("invalid_grant")
+	ErrInvalidAccessToken       = errors.New("invalid_token")
+)
+
+// The scopes the provider knows, others are ignored.
+var oidcScopes = []string{"openid", "profile", "email", "roles"}
+
+const (
+	// GrantAuthorizationCode is the grant type of the OIDC token endpoint.
+	GrantAuthorizationCode = "authorization_code"
+
+	authorizationCodeLifetime = time.Minute
+	consentTicketLifetime     = 10 * time.Minute
+
+	idTokenType       = "JWT"
+	accessTokenType   = "at+jwt"
+	consentTicketType = "consent+jwt"
+)
+
+// OIDCService makes this service an OpenID Connect provider for internal
+// apps, with the authorization code flow and PKCE (S256 only). ID tokens,
+// access tokens and consent tickets are JWTs signed by signer; codes live
+// in Redis and are redeemed once. Users log in to the organization of the
+// client.
+type OIDCService struct {
+	clientRepo    repository.OIDCClientRepository
+	userRepo      repository.UserRepository
+	groupRepo     repository.GroupRepository
+	redisRepo     repository.RedisRepository
+	authService   *AuthService
+	signer        *jwt.Signer
+	issuer        string
+	tokenLifetime time.Duration
+	now           func() time.Time
+}
+
+func NewOIDCService(
+	clientRepo repository.OIDCClientRepository,
+	userRepo repository.UserRepository,
+	groupRepo repository.GroupRepository,
+	redisRepo repository.RedisRepository,
+	authService *AuthService,
+	signer *jwt.Signer,
+	issuer string,
+	tokenLifetime time.Duration,
+) *OIDCService {
+	return &OIDCService{
+		clientRepo:    clientRepo,
+		userRepo:      userRepo,
+		groupRepo:     groupRepo,
+		redisRepo:     redisRepo,
+		authService:   authService,
+		signer:        signer,
+		issuer:        strings.TrimSuffix(issuer, "/"),
+		tokenLifetime: tokenLifetime,
+		now:           time.Now,
+	}
+}
+
+// Discovery returns the provider metadata.
+func (s *OIDCService) Discovery() *contract.OIDCDiscovery {
+	return &contract.OIDCDiscovery{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/oidc/authorize",
+		TokenEndpoint:                     s.issuer + "/oidc/token",
+		UserinfoEndpoint:                  s.issuer + "/oidc/userinfo",
+		JWKSURI:                           s.issuer + "/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   oidcScopes,
+		ClaimsSupported:                   []string{"sub", "name", "email", "roles"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+// KeySet returns the keys relying parties verify ID tokens with.
+func (s *OIDCService) KeySet() jwt.KeySet {
+	return s.signer.KeySet()
+}
+
+func (s *OIDCService) GetClients(ctx context.Context) (*contract.OIDCClientResponse, error) {
+	clients, err := s.clientRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.OIDCClientResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    clients,
+	}, nil
+}
+
+// CreateClient registers a relying party in the organization of ctx. The
+// secret of a confidential client is only part of this response.
+func (s *OIDCService) CreateClient(ctx context.Context, req *contract.CreateOIDCClientRequest) (*contract.OIDCClientResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOIDCClient)
+	}
+	if len(req.RedirectURIs) == 0 {
+		return nil, fmt.Errorf("%w: at least one redirect URI is required", ErrInvalidOIDCClient)
+	}
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, fmt.Errorf("%w: redirect URI %q must be an https URL, or http on localhost, without a fragment", ErrInvalidOIDCClient, uri)
+		}
+	}
+
+	clientID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	client := &entity.OIDCClient{
+		ClientID:     clientID,
+		Name:         strings.TrimSpace(req.Name),
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+	}
+	var secret string
+	if !req.Public {
+		if secret, err = randomToken(32); err != nil {
+			return nil, err
+		}
+		if client.SecretHash, err = password.Hash(secret); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: oidc client created client=%s public=%t", client.ClientID, client.Public())
+
+	return &contract.OIDCClientResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    contract.CreatedOIDCClient{ClientID: clientID, ClientSecret: secret, Client: client},
+	}, nil
+}
+
+func (s *OIDCService) DeleteClient(ctx context.Context, clientID string) (*contract.OIDCClientResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.clientRepo.GetByClientID(ctx, clientID); err != nil {
+		return nil, err
+	}
+	if err := s.clientRepo.Delete(ctx, clientID); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: oidc client deleted client=%s", clientID)
+
+	return &contract.OIDCClientResponse{
+		Status:  true,
+		Message: "Successfully",
+	}, nil
+}
+
+// validRedirectURI accepts absolute https URLs, and http ones on the local
+// machine for development.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+// CheckAuthorization validates an authorization request and returns its
+// client. ErrInvalidRedirect must be shown to the user, other errors are
+// sent to the client with ErrorRedirect. Client IDs are unique across
+// organizations, the client is looked up in all of them.
+func (s *OIDCService) CheckAuthorization(ctx context.Context, req *contract.AuthorizeRequest) (*entity.OIDCClient, error) {
+	client, err := s.clientRepo.GetByClientID(tenant.All(ctx), req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRedirect
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return nil, ErrInvalidRedirect
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		return client, fmt.Errorf("%w: only response_type=code is supported", ErrUnsupportedResponseType)
+	case !containsScope(req.Scope, "openid"):
+		return client, fmt.Errorf("%w: the openid scope is required", ErrInvalidScope)
+	case req.CodeChallenge == "":
+		return client, fmt.Errorf("%w: code_challenge is required", ErrInvalidRequest)
+	case req.CodeChallengeMethod != "S256":
+		return client, fmt.Errorf("%w: code_challenge_method must be S256", ErrInvalidRequest)
+	}
+	return client, nil
+}
+
+// Authorization is the outcome of a login: either Redirect, back to the
+// client, or a consent the user has to give first.
+type Authorization struct {
+	Redirect string
+	// Ticket carries the pending authorization to Consent
+	Ticket string
+	Client *entity.OIDCClient
+	Scopes []string
+}
+
+// consentTicket is the pending authorization of a logged in user, signed so
+// the consent form cannot alter it.
+type consentTicket struct {
+	Issuer    string                    `json:"iss"`
+	UserID    int64                     `json:"user_id"`
+	AuthTime  int64                     `json:"auth_time"`
+	ExpiresAt int64                     `json:"exp"`
+	Request   contract.AuthorizeRequest `json:"request"`
+}
+
+// Login checks the user's credentials in the client's organization. The
+// code is issued right away when the user already consented to the
+// requested scopes.
+func (s *OIDCService) Login(ctx context.Context, req *contract.AuthorizeRequest, email, pass string) (*Authorization, error) {
+	client, err := s.CheckAuthorization(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.authService.CheckPassword(tenant.WithOrganization(ctx, client.OrganizationID), email, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	scopes := knownScopes(req.Scope)
+	consent, err := s.clientRepo.GetConsent(ctx, user.ID, client.ClientID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if consent != nil && consent.Covers(scopes) {
+		redirect, err := s.issueCode(ctx, req, user.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		return &Authorization{Redirect: redirect, Client: client, Scopes: scopes}, nil
+	}
+
+	ticket, err := s.signer.Sign(consentTicketType, consentTicket{
+		Issuer:    s.issuer,
+		UserID:    user.ID,
+		AuthTime:  now.Unix(),
+		ExpiresAt: now.Add(consentTicketLifetime).Unix(),
+		Request:   *req,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Authorization{Ticket: ticket, Client: client, Scopes: scopes}, nil
+}
+
+// Consent completes the authorization of a ticket from Login and returns
+// where to send the user: the client with a code when they allowed it,
+// with access_denied otherwise.
+func (s *OIDCService) Consent(ctx context.Context, ticket string, allow bool) (string, error) {
+	var t consentTicket
+	if err := s.signer.Verify(ticket, consentTicketType, &t); err != nil || t.Issuer != s.issuer {
+		return "", ErrInvalidRedirect
+	}
+	if s.now().Unix() >= t.ExpiresAt {
+		return "", fmt.Errorf("%w: the login expired, start again", ErrInvalidRedirect)
+	}
+	req := &t.Request
+	client, err := s.CheckAuthorization(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if !allow {
+		log.Printf("audit: oidc consent denied client=%s user=%d", client.ClientID, t.UserID)
+		return ErrorRedirect(req, ErrAccessDenied), nil
+	}
+
+	// Keep what was consented to before, so switching between apps that
+	// ask for fewer scopes does not ask again
+	scopes := knownScopes(req.Scope)
+	if previous, err := s.clientRepo.GetConsent(ctx, t.UserID, client.ClientID); err == nil {
+		scopes = knownScopes(previous.Scope + " " + req.Scope)
+	}
+	consent := &entity.OIDCConsent{UserID: t.UserID, ClientID: client.ClientID, Scope: strings.Join(scopes, " ")}
+	if err := s.clientRepo.SaveConsent(ctx, consent); err != nil {
+		return "", err
+	}
+	log.Printf("audit: oidc consent given client=%s user=%d scope=%q", client.ClientID, t.UserID, consent.Scope)
+
+	return s.issueCode(ctx, req, t.UserID, time.Unix(t.AuthTime, 0))
+}
+
+// issueCode stores a new authorization code and returns the redirect to
+// the client carrying it.
+func (s *OIDCService) issueCode(ctx context.Context, req *contract.AuthorizeRequest, userID int64, authTime time.Time) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	authCode := &entity.AuthorizationCode{
+		ClientID:      req.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(knownScopes(req.Scope), " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      authTime,
+		ExpiresAt:     s.now().Add(authorizationCodeLifetime),
+	}
+	if err := s.redisRepo.SetAuthorizationCode(ctx, code, authCode); err != nil {
+		return "", err
+	}
+	return redirectWith(req, url.Values{"code": {code}}), nil
+}
+
+// ErrorRedirect returns the redirect to the client reporting err, whose
+// RFC 6749 code is the text of the sentinel it wraps.
+func ErrorRedirect(req *contract.AuthorizeRequest, err error) string {
+	code, description := ErrInvalidRequest.Error(), err.Error()
+	for _, sentinel := range []error{ErrInvalidRequest, ErrUnsupportedResponseType, ErrInvalidScope, ErrAccessDenied} {
+		if errors.Is(err, sentinel) {
+			code = sentinel.Error()
+			description = strings.TrimPrefix(strings.TrimPrefix(err.Error(), code), ": ")
+		}
+	}
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	return redirectWith(req, params)
+}
+
+func redirectWith(req *contract.AuthorizeRequest, params url.Values) string {
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type idTokenClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  string   `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	AuthTime  int64    `json:"auth_time"`
+	Nonce     string   `json:"nonce,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// accessTokenClaims follow RFC 9068, the token is only good for the
+// userinfo endpoint.
+type accessTokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ClientID  string `json:"client_id"`
+	Scope     string `json:"scope"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+// Exchange redeems an authorization code for an ID token and an access
+// token for the userinfo endpoint.
+func (s *OIDCService) Exchange(ctx context.Context, req *contract.OIDCTokenRequest) (*contract.OIDCTokenResponse, error) {
+	if req.GrantType != GrantAuthorizationCode {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedGrantType, req.GrantType)
+	}
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, fmt.Errorf("%w: code and code_verifier are required", ErrInvalidRequest)
+	}
+
+	client, err := s.clientRepo.GetByClientID(tenant.All(ctx), req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if client.Public() != (req.ClientSecret == "") || (!client.Public() && !password.Compare(client.SecretHash, req.ClientSecret)) {
+		return nil, ErrInvalidClient
+	}
+
+	authCode, err := s.redisRepo.TakeAuthorizationCode(ctx, req.Code)
+	if errors.Is(err, goRedis.Nil) {
+		return nil, fmt.Errorf("%w: unknown or expired code", ErrInvalidAuthorizationCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if authCode.ClientID != client.ClientID || authCode.RedirectURI != req.RedirectURI {
+		return nil, fmt.Errorf("%w: the code was issued for another client or redirect_uri", ErrInvalidAuthorizationCode)
+	}
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != authCode.CodeChallenge {
+		return nil, fmt.Errorf("%w: code_verifier does not match the code_challenge", ErrInvalidAuthorizationCode)
+	}
+
+	user, err := s.activeUser(tenant.WithOrganization(ctx, client.OrganizationID), authCode.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	subject := strconv.FormatInt(user.ID, 10)
+	claims := userClaims(user, authCode.Scope)
+	idToken, err := s.signer.Sign(idTokenType, idTokenClaims{
+		Issuer:    s.issuer,
+		Subject:   subject,
+		Audience:  client.ClientID,
+		ExpiresAt: now.Add(s.tokenLifetime).Unix(),
+		IssuedAt:  now.Unix(),
+		AuthTime:  authCode.AuthTime.Unix(),
+		Nonce:     authCode.Nonce,
+		Name:      stringClaim(claims, "name"),
+		Email:     stringClaim(claims, "email"),
+		Roles:     roleClaim(claims),
+	})
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.signer.Sign(accessTokenType, accessTokenClaims{
+		Issuer:    s.issuer,
+		Subject:   subject,
+		Audience:  s.issuer,
+		ClientID:  client.ClientID,
+		Scope:     authCode.Scope,
+		ExpiresAt: now.Add(s.tokenLifetime).Unix(),
+		IssuedAt:  now.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("audit: oidc tokens issued client=%s user=%d scope=%q", client.ClientID, user.ID, authCode.Scope)
+
+	return &contract.OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.tokenLifetime / time.Second),
+		IDToken:     idToken,
+		Scope:       authCode.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims of the access token's user, per the scopes
+// it was granted: sub always, name for profile, email for email and the
+// names of the user's roles for roles.
+func (s *OIDCService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims, userID, err := s.verifyAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	// The token names the user, of whichever organization
+	user, err := s.activeUser(tenant.All(ctx), userID)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	return userClaims(user, claims.Scope), nil
+}
+
+// verifyAccessToken returns the claims of an unexpired access token issued
+// by this provider, and the ID of its user.
+func (s *OIDCService) verifyAccessToken(accessToken string) (*accessTokenClaims, int64, error) {
+	var claims accessTokenClaims
+	if err := s.signer.Verify(accessToken, accessTokenType, &claims); err != nil {
+		return nil, 0, ErrInvalidAccessToken
+	}
+	if claims.Issuer != s.issuer || claims.Audience != s.issuer || s.now().Unix() >= claims.ExpiresAt {
+		return nil, 0, ErrInvalidAccessToken
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, 0, ErrInvalidAccessToken
+	}
+	return &claims, userID, nil
+}
+
+// activeUser loads a user with their group roles, refusing disabled ones.
+func (s *OIDCService) activeUser(ctx context.Context, userID int64) (*entity.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: the user no longer exists", ErrInvalidAuthorizationCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthorizationCode, ErrUserDisabled)
+	}
+	if err := withGroupRoles(ctx, s.groupRepo, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// userClaims builds the claims of user released by scope.
+func userClaims(user *entity.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": strconv.FormatInt(user.ID, 10)}
+	if containsScope(scope, "profile") {
+		claims["name"] = user.Name
+	}
+	if containsScope(scope, "email") {
+		claims["email"] = user.Email
+	}
+	if containsScope(scope, "roles") {
+		roles := make([]string, 0, len(user.Roles))
+		for _, role := range user.Roles {
+			roles = append(roles, role.Name)
+		}
+		claims["roles"] = roles
+	}
+	return claims
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func roleClaim(claims map[string]interface{}) []string {
+	roles, _ := claims["roles"].([]string)
+	return roles
+}
+
+func containsScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// knownScopes returns the scopes of scope the provider supports, in a
+// fixed order and without duplicates.
+func knownScopes(scope string) []string {
+	scopes := make([]string, 0, len(oidcScopes))
+	for _, known := range oidcScopes {
+		if containsScope(scope, known) {
+			scopes = append(scopes, known)
+		}
+	}
+	return scopes
+}
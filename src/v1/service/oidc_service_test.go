@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"test-tablelink/src/jwt"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+const oidcVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func newOIDCService(t *testing.T, repos *testRepos) *OIDCService {
+	t.Helper()
+	key, err := jwt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+	return NewOIDCService(repos.oidcClients, repos.users, repos.groups, repos.redis, auth, jwt.NewSigner(key), "https://id.example.com/", time.Hour)
+}
+
+func authorizeRequest(clientID string) *contract.AuthorizeRequest {
+	sum := sha256.Sum256([]byte(oidcVerifier))
+	return &contract.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid email offline_access",
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+func TestOIDCServicePublicClient(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	repos.createUser(t, role.ID, "jane@gmail.com", "secret")
+	svc := newOIDCService(t, repos)
+
+	resp, err := svc.CreateClient(tenant.WithOrganization(ctx, 1), &contract.CreateOIDCClientRequest{
+		Name: "SPA", RedirectURIs: []string{"https://app.example.com/callback"}, Public: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	client := resp.Data.(contract.CreatedOIDCClient)
+	if client.ClientSecret != "" {
+		t.Fatal("public client got a secret")
+	}
+
+	req := authorizeRequest(client.ClientID)
+	authorization, err := svc.Login(ctx, req, "jane@gmail.com", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if strings.Join(authorization.Scopes, " ") != "openid email" {
+		t.Errorf("scopes = %v, want the known ones", authorization.Scopes)
+	}
+	redirect, err := svc.Consent(ctx, authorization.Ticket, true)
+	if err != nil {
+		t.Fatalf("Consent: %v", err)
+	}
+	u, _ := url.Parse(redirect)
+	code := u.Query().Get("code")
+
+	exchange := &contract.OIDCTokenRequest{
+		GrantType:    GrantAuthorizationCode,
+		Code:         code,
+		RedirectURI:  req.RedirectURI,
+		ClientID:     client.ClientID,
+		CodeVerifier: "another verifier of the required length, 43+",
+	}
+	if _, err := svc.Exchange(ctx, exchange); !errors.Is(err, ErrInvalidAuthorizationCode) {
+		t.Errorf("wrong verifier error = %v, want invalid_grant", err)
+	}
+
+	// The failed attempt used the code up
+	authorization, err = svc.Login(ctx, req, "jane@gmail.com", "secret")
+	if err != nil || authorization.Redirect == "" {
+		t.Fatalf("second Login = %+v, %v; want a redirect, consent was given", authorization, err)
+	}
+	u, _ = url.Parse(authorization.Redirect)
+	exchange.Code = u.Query().Get("code")
+	exchange.CodeVerifier = oidcVerifier
+	tokens, err := svc.Exchange(ctx, exchange)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	info, err := svc.UserInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if info["email"] != "jane@gmail.com" || info["name"] != nil {
+		t.Errorf("userinfo = %v, want the email only", info)
+	}
+	if _, err := svc.UserInfo(ctx, tokens.IDToken); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("userinfo with the ID token error = %v, want invalid_token", err)
+	}
+}
+
+func TestOIDCServiceAuthorizationErrors(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	repos.createUser(t, role.ID, "jane@gmail.com", "secret")
+	svc := newOIDCService(t, repos)
+
+	resp, err := svc.CreateClient(ctx, &contract.CreateOIDCClientRequest{Name: "Wiki", RedirectURIs: []string{"https://app.example.com/callback"}})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	clientID := resp.Data.(contract.CreatedOIDCClient).ClientID
+
+	tests := []struct {
+		name   string
+		modify func(*contract.AuthorizeRequest)
+		want   error
+	}{
+		{"unknown client", func(r *contract.AuthorizeRequest) { r.ClientID = "nope" }, ErrInvalidRedirect},
+		{"unregistered redirect", func(r *contract.AuthorizeRequest) { r.RedirectURI = "https://app.example.com/other" }, ErrInvalidRedirect},
+		{"implicit flow", func(r *contract.AuthorizeRequest) { r.ResponseType = "token" }, ErrUnsupportedResponseType},
+		{"no openid scope", func(r *contract.AuthorizeRequest) { r.Scope = "email" }, ErrInvalidScope},
+		{"no PKCE", func(r *contract.AuthorizeRequest) { r.CodeChallenge = "" }, ErrInvalidRequest},
+		{"plain PKCE", func(r *contract.AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authorizeRequest(clientID)
+			tt.modify(req)
+			if _, err := svc.CheckAuthorization(ctx, req); !errors.Is(err, tt.want) {
+				t.Errorf("CheckAuthorization error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	authorization, err := svc.Login(ctx, authorizeRequest(clientID), "jane@gmail.com", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	redirect, err := svc.Consent(ctx, authorization.Ticket, false)
+	if err != nil {
+		t.Fatalf("Consent: %v", err)
+	}
+	if u, _ := url.Parse(redirect); u.Query().Get("error") != "access_denied" || u.Query().Get("state") != "xyz" {
+		t.Errorf("denied redirect = %q, want access_denied with the state", redirect)
+	}
+	if _, err := repos.oidcClients.GetConsent(ctx, 1, clientID); err == nil {
+		t.Error("consent recorded after a denial")
+	}
+
+	if _, err := svc.Consent(ctx, authorization.Ticket+"x", true); !errors.Is(err, ErrInvalidRedirect) {
+		t.Errorf("tampered ticket error = %v, want ErrInvalidRedirect", err)
+	}
+	if _, err := svc.Login(ctx, authorizeRequest(clientID), "jane@gmail.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestOIDCServiceCreateClientInvalid(t *testing.T) {
+	svc := newOIDCService(t, newTestRepos(t))
+	tests := []struct {
+		name string
+		uris []string
+	}{
+		{"none", nil},
+		{"relative", []string{"/callback"}},
+		{"plain http", []string{"http://app.example.com/callback"}},
+		{"fragment", []string{"https://app.example.com/callback#x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateClient(tenant.All(context.Background()), &contract.CreateOIDCClientRequest{Name: "x", RedirectURIs: tt.uris})
+			if !errors.Is(err, ErrInvalidOIDCClient) {
+				t.Errorf("CreateClient error = %v, want ErrInvalidOIDCClient", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
+)
+
+var (
+	// ErrInvalidOrganization is returned for a slug that is not 1 to 50
+	// lower case letters, digits or "-", or a missing name.
+	ErrInvalidOrganization = errors.New("invalid organization")
+	// ErrOrganizationExists is returned when creating a slug twice.
+	ErrOrganizationExists = errors.New("organization already exists")
+	// ErrUnknownOrganization is returned when a login or request names an
+	// organization that does not exist.
+	ErrUnknownOrganization = errors.New("unknown organization")
+	// ErrCrossTenantOnly is returned when a request limited to one
+	// organization manages the organizations themselves.
+	ErrCrossTenantOnly = errors.New("only super-admins can manage organizations")
+)
+
+var organizationSlug = regexp.MustCompile(`^[a-z0-9-]{1,50}$`)
+
+type OrganizationService struct {
+	organizationRepo repository.OrganizationRepository
+}
+
+func NewOrganizationService(organizationRepo repository.OrganizationRepository) *OrganizationService {
+	return &OrganizationService{organizationRepo: organizationRepo}
+}
+
+// Resolve returns the organization named by slug, or the default
+// organization for an empty slug.
+func (s *OrganizationService) Resolve(ctx context.Context, slug string) (*entity.Organization, error) {
+	return resolveOrganization(ctx, s.organizationRepo, slug)
+}
+
+func resolveOrganization(ctx context.Context, organizationRepo repository.OrganizationRepository, slug string) (*entity.Organization, error) {
+	var organization *entity.Organization
+	var err error
+	if slug == "" {
+		organization, err = organizationRepo.GetByID(ctx, entity.DefaultOrganizationID)
+	} else {
+		organization, err = organizationRepo.GetBySlug(ctx, slug)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOrganization, slug)
+	}
+	return organization, err
+}
+
+// Scope limits ctx to the organization a request by user operates in.
+// Users are limited to their own organization and may only name it in
+// slug. Super-admins operate across organizations, see tenant.All, unless
+// slug selects one.
+func (s *OrganizationService) Scope(ctx context.Context, user *entity.User, slug string) (context.Context, error) {
+	if slug == "" {
+		if user.IsSuperAdmin() {
+			return tenant.All(ctx), nil
+		}
+		return tenant.WithOrganization(ctx, user.OrganizationID), nil
+	}
+
+	organization, err := s.Resolve(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if organization.ID != user.OrganizationID && !user.IsSuperAdmin() {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrOrganizationMismatch, slug)
+	}
+	return tenant.WithOrganization(ctx, organization.ID), nil
+}
+
+// ScopeClient limits the request of an OAuth client to the client's
+// organization. A slug, when given, must name that organization.
+func (s *OrganizationService) ScopeClient(ctx context.Context, client *entity.OAuthClient, slug string) (context.Context, error) {
+	if slug != "" {
+		organization, err := s.Resolve(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		if organization.ID != client.OrganizationID {
+			return nil, fmt.Errorf("%w: %s", tenant.ErrOrganizationMismatch, slug)
+		}
+	}
+	return tenant.WithOrganization(ctx, client.OrganizationID), nil
+}
+
+func (s *OrganizationService) GetOrganizations(ctx context.Context) (*contract.OrganizationResponse, error) {
+	if _, scoped := tenant.OrganizationID(ctx); scoped {
+		return nil, ErrCrossTenantOnly
+	}
+	organizations, err := s.organizationRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.OrganizationResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    organizations,
+	}, nil
+}
+
+func (s *OrganizationService) CreateOrganization(ctx context.Context, req *contract.CreateOrganizationRequest) (*contract.OrganizationResponse, error) {
+	if _, scoped := tenant.OrganizationID(ctx); scoped {
+		return nil, ErrCrossTenantOnly
+	}
+	if !organizationSlug.MatchString(req.Slug) {
+		return nil, fmt.Errorf("%w: slug %q", ErrInvalidOrganization, req.Slug)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOrganization)
+	}
+
+	organization := &entity.Organization{Slug: req.Slug, Name: req.Name}
+	err := s.organizationRepo.Create(ctx, organization)
+	if isViolation(err, "23505") {
+		return nil, fmt.Errorf("%w: %s", ErrOrganizationExists, req.Slug)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contract.OrganizationResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    organization,
+	}, nil
+}
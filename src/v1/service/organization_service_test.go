@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authn"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+// newTenant creates an organization with an admin role and a user holding
+// it, all created within the organization's scope.
+func newTenant(t *testing.T, repos *testRepos, slug, email string) (context.Context, *entity.Role, *entity.User) {
+	t.Helper()
+	org := &entity.Organization{Slug: slug, Name: slug}
+	if err := repos.orgs.Create(context.Background(), org); err != nil {
+		t.Fatal(err)
+	}
+	ctx := tenant.WithOrganization(context.Background(), org.ID)
+	role := &entity.Role{Name: "admin"}
+	if err := repos.roles.Create(ctx, role); err != nil {
+		t.Fatalf("create role in %s: %v", slug, err)
+	}
+	user := &entity.User{Roles: []entity.Role{*role}, Name: email, Email: email, Password: "secret"}
+	if err := repos.users.Create(ctx, user); err != nil {
+		t.Fatalf("create user in %s: %v", slug, err)
+	}
+	return ctx, role, user
+}
+
+func TestTenantIsolation(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, acmeRole, acmeUser := newTenant(t, repos, "acme", "same@gmail.com")
+	globex, globexRole, globexUser := newTenant(t, repos, "globex", "same@gmail.com")
+
+	// Emails and role names are unique per organization only
+	if acmeUser.OrganizationID == globexUser.OrganizationID || acmeRole.OrganizationID == globexRole.OrganizationID {
+		t.Fatalf("tenants share an organization: %+v %+v", acmeUser, globexUser)
+	}
+	dup := &entity.User{Name: "dup", Email: "same@gmail.com", Password: "secret"}
+	if err := repos.users.Create(acme, dup); !isViolation(err, "23505") {
+		t.Errorf("duplicate email in one organization error = %v, want unique violation", err)
+	}
+
+	users, err := repos.users.GetAll(acme)
+	if err != nil || len(users) != 1 || users[0].ID != acmeUser.ID {
+		t.Errorf("acme users = %+v (%v), want only its own", users, err)
+	}
+	if _, err := repos.users.GetByID(acme, globexUser.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("reading another tenant's user error = %v, want sql.ErrNoRows", err)
+	}
+	if found, err := repos.users.GetByEmail(globex, "same@gmail.com"); err != nil || found.ID != globexUser.ID {
+		t.Errorf("GetByEmail in globex = %+v (%v), want its own user", found, err)
+	}
+	if _, err := repos.roles.GetByID(globex, acmeRole.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("reading another tenant's role error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Roles cannot cross organizations
+	if err := repos.users.AssignRole(acme, acmeUser.ID, globexRole.ID); !errors.Is(err, entity.ErrCrossOrganization) {
+		t.Errorf("assigning another tenant's role error = %v, want ErrCrossOrganization", err)
+	}
+	if err := repos.users.AssignRole(acme, globexUser.ID, acmeRole.ID); !errors.Is(err, entity.ErrCrossOrganization) {
+		t.Errorf("assigning to another tenant's user error = %v, want ErrCrossOrganization", err)
+	}
+	child := &entity.Role{Name: "child", ParentID: &globexRole.ID}
+	if err := repos.roles.Create(acme, child); !errors.Is(err, entity.ErrCrossOrganization) {
+		t.Errorf("parent in another tenant error = %v, want ErrCrossOrganization", err)
+	}
+
+	// Deletes outside the scope do nothing
+	if err := repos.users.Delete(acme, globexUser.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.users.GetByID(globex, globexUser.ID); err != nil {
+		t.Errorf("acme deleted a globex user: %v", err)
+	}
+
+	// The user cache is shared, GetUser must not leak across it
+	svc := NewUserService(repos.users, repos.redis)
+	if err := repos.redis.SetUser(context.Background(), globexUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetUser(acme, globexUser.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("cached user of another tenant error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Spanning every organization must be asked for, an unscoped context
+	// reads nothing
+	all, err := repos.users.GetAll(tenant.All(context.Background()))
+	if err != nil || len(all) != 2 {
+		t.Errorf("users of all organizations = %d (%v), want 2", len(all), err)
+	}
+	if _, err := repos.users.GetAll(context.Background()); !errors.Is(err, tenant.ErrUnscoped) {
+		t.Errorf("unscoped GetAll error = %v, want %v", err, tenant.ErrUnscoped)
+	}
+	if _, err := repos.users.GetByID(context.Background(), globexUser.ID); !errors.Is(err, tenant.ErrUnscoped) {
+		t.Errorf("unscoped GetByID error = %v, want %v", err, tenant.ErrUnscoped)
+	}
+	if err := repos.users.Delete(context.Background(), globexUser.ID); !errors.Is(err, tenant.ErrUnscoped) {
+		t.Errorf("unscoped Delete error = %v, want %v", err, tenant.ErrUnscoped)
+	}
+	if err := repos.roles.Create(context.Background(), &entity.Role{Name: "stray"}); !errors.Is(err, tenant.ErrUnscoped) {
+		t.Errorf("unscoped Create error = %v, want %v", err, tenant.ErrUnscoped)
+	}
+}
+
+func TestAuthServiceLoginOrganization(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	_, _, acmeUser := newTenant(t, repos, "acme", "same@gmail.com")
+	newTenant(t, repos, "globex", "same@gmail.com")
+	svc := NewAuthService(repos.users, repos.orgs, repos.groups, repos.redis, authn.NewLocalAuthenticator(repos.users))
+
+	resp, err := svc.Login(ctx, &LoginRequest{Organization: "acme", Email: "same@gmail.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if userID, _ := repos.redis.GetUserIDByToken(ctx, resp.AccessToken); userID != acmeUser.ID {
+		t.Errorf("token maps to %d, want the acme user %d", userID, acmeUser.ID)
+	}
+
+	// The default organization has no such user
+	if _, err := svc.Login(ctx, &LoginRequest{Email: "same@gmail.com", Password: "secret"}); err == nil {
+		t.Error("logged in to the default organization with another tenant's user")
+	}
+	if _, err := svc.Login(ctx, &LoginRequest{Organization: "nope", Email: "same@gmail.com", Password: "secret"}); !errors.Is(err, ErrUnknownOrganization) {
+		t.Errorf("unknown organization error = %v, want ErrUnknownOrganization", err)
+	}
+}
+
+func TestOrganizationServiceScope(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewOrganizationService(repos.orgs)
+	_, _, member := newTenant(t, repos, "acme", "member@gmail.com")
+	newTenant(t, repos, "globex", "other@gmail.com")
+
+	superRole := repos.createRole(t, entity.SuperAdminRole)
+	super := repos.createUser(t, superRole.ID, "root@gmail.com", "secret")
+	super, _ = repos.users.GetByID(ctx, super.ID)
+
+	tests := []struct {
+		name    string
+		user    *entity.User
+		slug    string
+		want    int64
+		scoped  bool
+		wantErr error
+	}{
+		{"member defaults to own", member, "", member.OrganizationID, true, nil},
+		{"member names own", member, "acme", member.OrganizationID, true, nil},
+		{"member names other", member, "globex", 0, false, tenant.ErrOrganizationMismatch},
+		{"unknown", member, "nope", 0, false, ErrUnknownOrganization},
+		{"super-admin spans all", super, "", 0, false, nil},
+		{"super-admin selects", super, "acme", member.OrganizationID, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped, err := svc.Scope(ctx, tt.user, tt.slug)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Scope error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scope: %v", err)
+			}
+			id, ok := tenant.OrganizationID(scoped)
+			if ok != tt.scoped || id != tt.want {
+				t.Errorf("scope = %d, %t, want %d, %t", id, ok, tt.want, tt.scoped)
+			}
+		})
+	}
+
+	// A super_admin role outside the default organization grants nothing
+	acme, _ := svc.Resolve(ctx, "acme")
+	fake := &entity.User{OrganizationID: acme.ID, Roles: []entity.Role{{Name: entity.SuperAdminRole}}}
+	if _, err := svc.Scope(ctx, fake, "globex"); !errors.Is(err, tenant.ErrOrganizationMismatch) {
+		t.Errorf("tenant super_admin error = %v, want ErrOrganizationMismatch", err)
+	}
+}
+
+func TestOrganizationServiceCreate(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewOrganizationService(repos.orgs)
+
+	if _, err := svc.CreateOrganization(ctx, &contract.CreateOrganizationRequest{Slug: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	if _, err := svc.CreateOrganization(ctx, &contract.CreateOrganizationRequest{Slug: "acme", Name: "Acme"}); !errors.Is(err, ErrOrganizationExists) {
+		t.Errorf("duplicate error = %v, want ErrOrganizationExists", err)
+	}
+	for _, req := range []contract.CreateOrganizationRequest{{Slug: "Acme", Name: "A"}, {Slug: "a b", Name: "A"}, {Slug: "ok"}} {
+		if _, err := svc.CreateOrganization(ctx, &req); !errors.Is(err, ErrInvalidOrganization) {
+			t.Errorf("CreateOrganization(%+v) error = %v, want ErrInvalidOrganization", req, err)
+		}
+	}
+
+	scoped := tenant.WithOrganization(ctx, entity.DefaultOrganizationID)
+	if _, err := svc.CreateOrganization(scoped, &contract.CreateOrganizationRequest{Slug: "globex", Name: "Globex"}); !errors.Is(err, ErrCrossTenantOnly) {
+		t.Errorf("scoped create error = %v, want ErrCrossTenantOnly", err)
+	}
+	if _, err := svc.GetOrganizations(scoped); !errors.Is(err, ErrCrossTenantOnly) {
+		t.Errorf("scoped list error = %v, want ErrCrossTenantOnly", err)
+	}
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"strconv"
 	"test-tablelink/src/entity"
-	"test-tablelink/src/repository"
 	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
 )
 
 type RoleService struct {
-	roleRepo *repository.RoleRepository
+	roleRepo      repository.RoleRepository
+	roleRightRepo repository.RoleRightRepository
 }
 
-func NewRoleService(roleRepo *repository.RoleRepository) *RoleService {
-	return &RoleService{roleRepo: roleRepo}
+func NewRoleService(roleRepo repository.RoleRepository, roleRightRepo repository.RoleRightRepository) *RoleService {
+	return &RoleService{
+		roleRepo:      roleRepo,
+		roleRightRepo: roleRightRepo,
+	}
 }
 
 func (s *RoleService) GetRole(ctx context.Context, id string) (*contract.RoleResponse, error) {
@@ -36,7 +40,9 @@ func (s *RoleService) GetRole(ctx context.Context, id string) (*contract.RoleRes
 
 func (s *RoleService) CreateRole(ctx context.Context, req *contract.CreateRoleRequest) (*contract.RoleResponse, error) {
 	role := &entity.Role{
-		Name: req.Name,
+		Name:      req.Name,
+		ParentID:  req.ParentID,
+		MagicLink: req.MagicLink,
 	}
 
 	err := s.roleRepo.Create(ctx, role)
@@ -52,6 +58,9 @@ func (s *RoleService) CreateRole(ctx context.Context, req *contract.CreateRoleRe
 }
 
 func (s *RoleService) UpdateRole(ctx context.Context, id string, req *contract.UpdateRoleRequest) (*contract.RoleResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
 	roleID, err := strconv.Atoi(id)
 	if err != nil {
 		return nil, err
@@ -63,6 +72,8 @@ func (s *RoleService) UpdateRole(ctx context.Context, id string, req *contract.U
 	}
 
 	role.Name = req.Name
+	role.ParentID = req.ParentID
+	role.MagicLink = req.MagicLink
 
 	err = s.roleRepo.Update(ctx, role)
 	if err != nil {
@@ -77,6 +88,9 @@ func (s *RoleService) UpdateRole(ctx context.Context, id string, req *contract.U
 }
 
 func (s *RoleService) DeleteRole(ctx context.Context, id string) (*contract.RoleResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
 	roleID, err := strconv.Atoi(id)
 	if err != nil {
 		return nil, err
@@ -92,3 +106,85 @@ func (s *RoleService) DeleteRole(ctx context.Context, id string) (*contract.Role
 		Message: "Successfully",
 	}, nil
 }
+
+// GetEffectiveRights merges the role's rights with the ones inherited from
+// its ancestors. The closest role granting an operation is its source.
+func (s *RoleService) GetEffectiveRights(ctx context.Context, id string) (*contract.RoleResponse, error) {
+	roleID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := contract.EffectiveRights{
+		Role:   role,
+		Rights: []contract.EffectiveRight{},
+	}
+	type key struct {
+		section, route, condition string
+		deny                      bool
+	}
+	index := make(map[key]int)
+	seen := make(map[int]bool)
+
+	for current := role; current != nil; {
+		// Cycles are refused on update, this guards against bad data
+		if seen[current.ID] {
+			break
+		}
+		seen[current.ID] = true
+		result.Inheritance = append(result.Inheritance, current.Name)
+
+		rights, err := s.roleRightRepo.GetByRoleID(ctx, int64(current.ID))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			k := key{r.Section, r.Route, r.Condition, r.Deny}
+			i, ok := index[k]
+			if !ok {
+				i = len(result.Rights)
+				index[k] = i
+				result.Rights = append(result.Rights, contract.EffectiveRight{
+					Section:   r.Section,
+					Route:     r.Route,
+					Deny:      r.Deny,
+					Condition: r.Condition,
+					Sources:   map[string]string{},
+				})
+			}
+			merge(&result.Rights[i], r, current.Name)
+		}
+
+		if current.ParentID == nil {
+			break
+		}
+		if current, err = s.roleRepo.GetByID(ctx, *current.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &contract.RoleResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    result,
+	}, nil
+}
+
+// merge adds the operations granted by right that are not granted yet.
+func merge(effective *contract.EffectiveRight, right *entity.RoleRight, source string) {
+	grant := func(granted *bool, allowed bool, op string) {
+		if allowed && !*granted {
+			*granted = true
+			effective.Sources[op] = source
+		}
+	}
+	grant(&effective.Create, right.RCreate, "create")
+	grant(&effective.Read, right.RRead, "read")
+	grant(&effective.Update, right.RUpdate, "update")
+	grant(&effective.Delete, right.RDelete, "delete")
+}
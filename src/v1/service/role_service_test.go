@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestRoleServiceCRUD(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewRoleService(repos.roles, repos.roleRights)
+
+	created, err := svc.CreateRole(ctx, &contract.CreateRoleRequest{Name: "editor"})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	role := created.Data.(*entity.Role)
+	if role.ID == 0 {
+		t.Fatal("CreateRole did not assign an ID")
+	}
+
+	id := strconv.Itoa(role.ID)
+	got, err := svc.GetRole(ctx, id)
+	if err != nil {
+		t.Fatalf("GetRole: %v", err)
+	}
+	if got.Data.(*entity.Role).Name != "editor" {
+		t.Errorf("GetRole name = %q, want editor", got.Data.(*entity.Role).Name)
+	}
+
+	if _, err := svc.UpdateRole(ctx, id, &contract.UpdateRoleRequest{Name: "writer"}); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if r, _ := repos.roles.GetByID(ctx, role.ID); r.Name != "writer" {
+		t.Errorf("updated name = %q, want writer", r.Name)
+	}
+
+	if _, err := svc.DeleteRole(ctx, id); err != nil {
+		t.Fatalf("DeleteRole: %v", err)
+	}
+	if _, err := svc.GetRole(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRole after delete error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestRoleServiceErrors(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewRoleService(repos.roles, repos.roleRights)
+	role := repos.createRole(t, "admin")
+	repos.createUser(t, role.ID, "admin@gmail.com", "secret")
+
+	if _, err := svc.GetRole(ctx, "abc"); err == nil {
+		t.Error("GetRole with a non numeric id should fail")
+	}
+	if _, err := svc.CreateRole(ctx, &contract.CreateRoleRequest{Name: "admin"}); pqCode(err) != "23505" {
+		t.Errorf("duplicate CreateRole error = %v, want unique violation", err)
+	}
+	if _, err := svc.UpdateRole(ctx, "99", &contract.UpdateRoleRequest{Name: "x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateRole(99) error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := svc.DeleteRole(ctx, "1"); pqCode(err) != "23503" {
+		t.Errorf("deleting a role in use error = %v, want foreign key violation", err)
+	}
+}
+
+func TestRoleServiceParentCycle(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewRoleService(repos.roles, repos.roleRights)
+	viewer := repos.createRole(t, "viewer")
+
+	resp, err := svc.CreateRole(ctx, &contract.CreateRoleRequest{Name: "editor", ParentID: &viewer.ID})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	editor := resp.Data.(*entity.Role)
+
+	tests := []struct {
+		name   string
+		role   *entity.Role
+		parent int
+	}{
+		{"self", viewer, viewer.ID},
+		{"through child", viewer, editor.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := tt.parent
+			_, err := svc.UpdateRole(ctx, strconv.Itoa(tt.role.ID), &contract.UpdateRoleRequest{Name: tt.role.Name, ParentID: &parent})
+			if !errors.Is(err, entity.ErrRoleCycle) {
+				t.Errorf("UpdateRole error = %v, want ErrRoleCycle", err)
+			}
+		})
+	}
+
+	missing := 99
+	if _, err := svc.UpdateRole(ctx, strconv.Itoa(editor.ID), &contract.UpdateRoleRequest{Name: "editor", ParentID: &missing}); pqCode(err) != "23503" {
+		t.Errorf("unknown parent error = %v, want foreign key violation", err)
+	}
+}
+
+func TestRoleServiceEffectiveRights(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewRoleService(repos.roles, repos.roleRights)
+
+	viewer := repos.createRole(t, "viewer")
+	editor := &entity.Role{Name: "editor", ParentID: &viewer.ID}
+	repos.roles.Create(ctx, editor)
+	admin := &entity.Role{Name: "admin", ParentID: &editor.ID}
+	repos.roles.Create(ctx, admin)
+
+	rights := []entity.RoleRight{
+		{RoleID: int64(viewer.ID), Section: "be", Route: "/users/user", RRead: true},
+		{RoleID: int64(editor.ID), Section: "be", Route: "/users/user", RRead: true, RUpdate: true},
+		{RoleID: int64(admin.ID), Section: "be", Route: "/users/user/{user_id}", RDelete: true},
+	}
+	for i := range rights {
+		if err := repos.roleRights.Create(ctx, &rights[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := svc.GetEffectiveRights(ctx, strconv.Itoa(admin.ID))
+	if err != nil {
+		t.Fatalf("GetEffectiveRights: %v", err)
+	}
+	result := resp.Data.(contract.EffectiveRights)
+
+	if got := strings.Join(result.Inheritance, ">"); got != "admin>editor>viewer" {
+		t.Errorf("inheritance = %s", got)
+	}
+	if len(result.Rights) != 2 {
+		t.Fatalf("got %d rights, want 2: %+v", len(result.Rights), result.Rights)
+	}
+
+	byRoute := make(map[string]contract.EffectiveRight)
+	for _, r := range result.Rights {
+		byRoute[r.Route] = r
+	}
+	users := byRoute["/users/user"]
+	if !users.Read || !users.Update || users.Create || users.Delete {
+		t.Errorf("/users/user = %+v", users)
+	}
+	if users.Sources["read"] != "editor" || users.Sources["update"] != "editor" {
+		t.Errorf("/users/user sources = %v, want the closest role", users.Sources)
+	}
+	if one := byRoute["/users/user/{user_id}"]; !one.Delete || one.Sources["delete"] != "admin" {
+		t.Errorf("/users/user/{user_id} = %+v", one)
+	}
+
+	// Inherited rights are also what requests are authorized against
+	allowed := func(role *entity.Role) bool {
+		rights, err := repos.roleRights.GetEffective(ctx, []int64{int64(role.ID)}, "be")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return authz.Evaluate(rights, "/users/user", "/users/user", "PUT").Allowed
+	}
+	if !allowed(admin) {
+		t.Error("admin PUT /users/user denied, want inherited from editor")
+	}
+	if allowed(viewer) {
+		t.Error("viewer must not inherit from its children")
+	}
+}
@@ -0,0 +1,870 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/scim"
+)
+
+var (
+	// ErrInvalidSCIMToken is returned for a token request without a name
+	// and when authenticating with a token that is unknown or deleted.
+	ErrInvalidSCIMToken = errors.New("invalid SCIM token")
+	// ErrSCIMSessionRequired is returned when SCIM tokens are managed with
+	// an API token or an OAuth client, which could otherwise give
+	// themselves the right to provision users and roles.
+	ErrSCIMSessionRequired = errors.New("SCIM tokens can only be managed when logged in")
+)
+
+// SCIMService serves SCIM 2.0 provisioning for the identity provider of an
+// organization. SCIM Users are users, userName being their email; SCIM
+// Groups are roles, their members the users holding them. The super-admin
+// role is never exposed. A SCIM client authenticates with a token of its
+// organization that reads "tlsc_<id>_<secret>" and is only good for
+// /scim/v2.
+type SCIMService struct {
+	tokenRepo  repository.SCIMTokenRepository
+	transactor repository.Transactor
+	userRepo   repository.UserRepository
+	roleRepo   repository.RoleRepository
+	redisRepo  repository.RedisRepository
+	now        func() time.Time
+}
+
+func NewSCIMService(
+	tokenRepo repository.SCIMTokenRepository,
+	transactor repository.Transactor,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	redisRepo repository.RedisRepository,
+) *SCIMService {
+	return &SCIMService{
+		tokenRepo:  tokenRepo,
+		transactor: transactor,
+		userRepo:   userRepo,
+		roleRepo:   roleRepo,
+		redisRepo:  redisRepo,
+		now:        time.Now,
+	}
+}
+
+// manager refuses requests made with a scoped API token or an OAuth
+// client, or while impersonating a user.
+func (s *SCIMService) manager(ctx context.Context) error {
+	if _, ok := authz.TokenScopes(ctx); ok {
+		return ErrSCIMSessionRequired
+	}
+	return refuseImpersonation(ctx)
+}
+
+func (s *SCIMService) GetTokens(ctx context.Context) (*contract.SCIMTokenResponse, error) {
+	if err := s.manager(ctx); err != nil {
+		return nil, err
+	}
+	tokens, err := s.tokenRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.SCIMTokenResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    tokens,
+	}, nil
+}
+
+// CreateToken issues a token for the organization of ctx. The token is
+// only part of this response.
+func (s *SCIMService) CreateToken(ctx context.Context, req *contract.CreateSCIMTokenRequest) (*contract.SCIMTokenResponse, error) {
+	if err := s.manager(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidSCIMToken)
+	}
+
+	raw, prefix, err := generatePrefixedToken(entity.SCIMTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+	token := &entity.SCIMToken{
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		TokenHash: hashToken(raw),
+	}
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: scim token created id=%d organization=%d prefix=%s", token.ID, token.OrganizationID, prefix)
+
+	return &contract.SCIMTokenResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    contract.CreatedSCIMToken{Token: raw, SCIMToken: token},
+	}, nil
+}
+
+// DeleteToken revokes a token, sql.ErrNoRows when the organization has no
+// such token.
+func (s *SCIMService) DeleteToken(ctx context.Context, id int64) (*contract.SCIMTokenResponse, error) {
+	if err := s.manager(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.tokenRepo.Delete(ctx, id); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: scim token deleted id=%d", id)
+
+	return &contract.SCIMTokenResponse{
+		Status:  true,
+		Message: "Successfully",
+	}, nil
+}
+
+// Authenticate returns the token, whose organization the SCIM request
+// must be limited to.
+func (s *SCIMService) Authenticate(ctx context.Context, raw string) (*entity.SCIMToken, error) {
+	prefix, ok := publicPrefix(raw, entity.SCIMTokenPrefix)
+	if !ok {
+		return nil, ErrInvalidSCIMToken
+	}
+	token, err := s.tokenRepo.GetByPrefix(ctx, prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidSCIMToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.TokenHash), []byte(hashToken(raw))) != 1 {
+		return nil, ErrInvalidSCIMToken
+	}
+
+	now := s.now()
+	if err := s.tokenRepo.UpdateLastUsed(ctx, token.ID, now); err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+	return token, nil
+}
+
+// The SCIM resource methods below run in the organization of the token.
+// Their own failures are *scim.Error values; a missing resource is
+// sql.ErrNoRows.
+
+func (s *SCIMService) ListUsers(ctx context.Context, q *scim.Query) (*scim.ListResponse, error) {
+	users, err := s.userRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]scim.Resource, 0, len(users))
+	for _, user := range users {
+		if user.HasRole(entity.SuperAdminRole) {
+			continue
+		}
+		resources = append(resources, scimUser(user))
+	}
+	return scim.List(resources, q), nil
+}
+
+func (s *SCIMService) GetUser(ctx context.Context, id string) (*scim.User, error) {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return scimUser(user), nil
+}
+
+// CreateUser creates a user without roles, active unless the resource
+// says otherwise. Without a password they can only log in through an
+// identity provider.
+func (s *SCIMService) CreateUser(ctx context.Context, resource *scim.User) (*scim.User, error) {
+	user := &entity.User{}
+	if err := s.replaceUser(user, resource); err != nil {
+		return nil, err
+	}
+	if user.Password == "" {
+		secret, err := randomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		if user.Password, err = password.Hash(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return userConflict(err, user.Email)
+		}
+		if user.DisabledAt == nil {
+			return nil
+		}
+		// Create does not write disabled_at
+		return s.userRepo.Update(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("audit: scim user created user=%d active=%t", user.ID, user.DisabledAt == nil)
+	return s.GetUser(ctx, strconv.FormatInt(user.ID, 10))
+}
+
+// ReplaceUser replaces the user's attributes. An absent active or
+// password leaves them as they are.
+func (s *SCIMService) ReplaceUser(ctx context.Context, id string, resource *scim.User) (*scim.User, error) {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replaceUser(user, resource); err != nil {
+		return nil, err
+	}
+	return s.saveUser(ctx, user)
+}
+
+// replaceUser copies the stored attributes of resource onto user.
+func (s *SCIMService) replaceUser(user *entity.User, resource *scim.User) error {
+	if strings.TrimSpace(resource.UserName) == "" {
+		return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "userName is required")
+	}
+	user.Email = strings.TrimSpace(resource.UserName)
+	user.Name = resource.Name.Full()
+	if user.Name == "" {
+		user.Name = resource.DisplayName
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+	if resource.Active != nil {
+		s.setActive(user, bool(*resource.Active))
+	}
+	if resource.Password != "" {
+		hashed, err := password.Hash(resource.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = hashed
+	}
+	return nil
+}
+
+// PatchUser applies the operations to userName, name, displayName, active
+// and password. Other attributes are not stored and are ignored.
+func (s *SCIMService) PatchUser(ctx context.Context, id string, req *scim.PatchRequest) (*scim.User, error) {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = applyPatch(req, func(op string, path *scim.Path, value json.RawMessage) error {
+		return s.patchUser(user, op, path, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.saveUser(ctx, user)
+}
+
+func (s *SCIMService) patchUser(user *entity.User, op string, path *scim.Path, value json.RawMessage) error {
+	if op == "remove" {
+		if path.Attr == "username" {
+			return scim.Errorf(http.StatusBadRequest, scim.Mutability, "userName is required")
+		}
+		// the other attributes have nothing to fall back to
+		return nil
+	}
+
+	switch {
+	case path.Attr == "username":
+		var email string
+		if err := decodeValue(value, &email); err != nil || strings.TrimSpace(email) == "" {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "userName must be a non-empty string")
+		}
+		user.Email = strings.TrimSpace(email)
+	case path.Attr == "displayname", path.Attr == "name" && path.Sub == "formatted":
+		var name string
+		if err := decodeValue(value, &name); err != nil {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "%s must be a string", path.Attr)
+		}
+		if name != "" {
+			user.Name = name
+		}
+	case path.Attr == "name" && path.Sub == "":
+		var name scim.Name
+		if err := decodeValue(value, &name); err != nil {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "name must be an object")
+		}
+		if full := name.Full(); full != "" {
+			user.Name = full
+		}
+	case path.Attr == "active":
+		var active scim.Bool
+		if err := decodeValue(value, &active); err != nil {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "active must be a boolean")
+		}
+		s.setActive(user, bool(active))
+	case path.Attr == "password":
+		var secret string
+		if err := decodeValue(value, &secret); err != nil || secret == "" {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "password must be a non-empty string")
+		}
+		hashed, err := password.Hash(secret)
+		if err != nil {
+			return err
+		}
+		user.Password = hashed
+	}
+	return nil
+}
+
+func (s *SCIMService) setActive(user *entity.User, active bool) {
+	switch {
+	case active:
+		user.DisabledAt = nil
+	case user.DisabledAt == nil:
+		now := s.now()
+		user.DisabledAt = &now
+	}
+}
+
+// saveUser writes the user back. A disabled user's sessions stop working
+// on their next request, the session check reads disabled_at.
+func (s *SCIMService) saveUser(ctx context.Context, user *entity.User) (*scim.User, error) {
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, userConflict(err, user.Email)
+	}
+	if err := s.refreshUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: scim user updated user=%d active=%t", user.ID, user.DisabledAt == nil)
+	return s.GetUser(ctx, strconv.FormatInt(user.ID, 10))
+}
+
+func (s *SCIMService) DeleteUser(ctx context.Context, id string) error {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.redisRepo.DeleteUser(ctx, user.ID); err != nil {
+		// Log error but don't fail the request
+	}
+	log.Printf("audit: scim user deleted user=%d", user.ID)
+	return nil
+}
+
+// user returns the user of id. Super-admins are not provisioned through
+// SCIM, like for impersonation they are not found.
+func (s *SCIMService) user(ctx context.Context, id string) (*entity.User, error) {
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.HasRole(entity.SuperAdminRole) {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+// refreshUser updates the cached copy of the user, if any, which sessions
+// are authorized against.
+func (s *SCIMService) refreshUser(ctx context.Context, userID int64) error {
+	if _, err := s.redisRepo.GetUser(ctx, userID); err != nil {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.redisRepo.SetUser(ctx, user)
+}
+
+func userConflict(err error, email string) error {
+	if isViolation(err, "23505") {
+		return scim.Errorf(http.StatusConflict, scim.Uniqueness, "userName %q is taken", email)
+	}
+	return err
+}
+
+func scimUser(user *entity.User) *scim.User {
+	id := strconv.FormatInt(user.ID, 10)
+	active := scim.Bool(user.DisabledAt == nil)
+	resource := &scim.User{
+		Schemas:     []string{scim.UserSchema},
+		ID:          id,
+		UserName:    user.Email,
+		Name:        &scim.Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []scim.MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta:        meta("User", "/Users/"+id, user.CreatedAt, user.UpdatedAt),
+	}
+	for _, role := range user.Roles {
+		if role.Name == entity.SuperAdminRole {
+			continue
+		}
+		roleID := strconv.Itoa(role.ID)
+		resource.Groups = append(resource.Groups, scim.MultiValue{
+			Value:   roleID,
+			Display: role.Name,
+			Ref:     scim.BasePath + "/Groups/" + roleID,
+		})
+	}
+	return resource
+}
+
+func meta(resourceType, location string, created, updated time.Time) *scim.Meta {
+	m := &scim.Meta{ResourceType: resourceType, Location: scim.BasePath + location}
+	if !created.IsZero() {
+		m.Created = &created
+	}
+	if !updated.IsZero() {
+		m.LastModified = &updated
+	}
+	return m
+}
+
+func (s *SCIMService) ListGroups(ctx context.Context, q *scim.Query) (*scim.ListResponse, error) {
+	roles, err := s.roleRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]scim.Resource, 0, len(roles))
+	for _, role := range roles {
+		if role.Name == entity.SuperAdminRole {
+			continue
+		}
+		group := scimGroup(role, members[role.ID])
+		if q.Excludes("members") {
+			group.Members = nil
+		}
+		resources = append(resources, group)
+	}
+	return scim.List(resources, q), nil
+}
+
+func (s *SCIMService) GetGroup(ctx context.Context, id string) (*scim.Group, error) {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scimGroup(role, members[role.ID]), nil
+}
+
+// CreateGroup creates a role without rights and assigns it to the
+// members.
+func (s *SCIMService) CreateGroup(ctx context.Context, resource *scim.Group) (*scim.Group, error) {
+	name, err := groupName(resource.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := memberIDs(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &entity.Role{Name: name}
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.roleRepo.Create(ctx, role); err != nil {
+			return roleConflict(err, name)
+		}
+		return s.setMembers(ctx, role.ID, nil, memberIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("audit: scim group created role=%d name=%q members=%d", role.ID, role.Name, len(memberIDs))
+	return s.afterMembersChanged(ctx, role.ID, memberIDs)
+}
+
+// ReplaceGroup renames the role and replaces its members.
+func (s *SCIMService) ReplaceGroup(ctx context.Context, id string, resource *scim.Group) (*scim.Group, error) {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	name, err := groupName(resource.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := memberIDs(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveGroup(ctx, role, name, memberIDs)
+}
+
+// PatchGroup applies the operations to displayName and members. Members
+// are added, replaced or removed by value, the user ID.
+func (s *SCIMService) PatchGroup(ctx context.Context, id string, req *scim.PatchRequest) (*scim.Group, error) {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.memberIDsOf(ctx, role.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := role.Name
+	members := append([]int64{}, current...)
+	err = applyPatch(req, func(op string, path *scim.Path, value json.RawMessage) error {
+		switch path.Attr {
+		case "displayname":
+			if op == "remove" {
+				return scim.Errorf(http.StatusBadRequest, scim.Mutability, "displayName is required")
+			}
+			var displayName string
+			if err := decodeValue(value, &displayName); err != nil {
+				return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "displayName must be a string")
+			}
+			var err error
+			name, err = groupName(displayName)
+			return err
+		case "members":
+			var err error
+			members, err = patchMembers(members, op, path, value)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.saveGroup(ctx, role, name, members)
+}
+
+// patchMembers applies one operation on members to the member IDs.
+func patchMembers(members []int64, op string, path *scim.Path, value json.RawMessage) ([]int64, error) {
+	var values []scim.MultiValue
+	if len(value) > 0 && string(value) != "null" {
+		if err := decodeValue(value, &values); err != nil {
+			var single scim.MultiValue
+			if err := decodeValue(value, &single); err != nil {
+				return nil, scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "members must be a list of {\"value\": \"<user id>\"}")
+			}
+			values = []scim.MultiValue{single}
+		}
+	}
+	ids, err := memberIDs(values)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "add":
+		for _, id := range ids {
+			if !containsID(members, id) {
+				members = append(members, id)
+			}
+		}
+		return members, nil
+	case "replace":
+		return ids, nil
+	}
+
+	// remove: the members the path filter matches, the listed ones, or
+	// all of them
+	kept := make([]int64, 0, len(members))
+	for _, id := range members {
+		member := scim.MultiValue{Value: strconv.FormatInt(id, 10)}
+		var removed bool
+		switch {
+		case path.Filter != nil:
+			removed = path.Filter.Match(member)
+		case len(values) > 0:
+			removed = containsID(ids, id)
+		default:
+			removed = true
+		}
+		if !removed {
+			kept = append(kept, id)
+		}
+	}
+	return kept, nil
+}
+
+// saveGroup renames the role and brings its members in line with
+// memberIDs, in one transaction.
+func (s *SCIMService) saveGroup(ctx context.Context, role *entity.Role, name string, memberIDs []int64) (*scim.Group, error) {
+	current, err := s.memberIDsOf(ctx, role.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if name != role.Name {
+			role.Name = name
+			if err := s.roleRepo.Update(ctx, role); err != nil {
+				return roleConflict(err, name)
+			}
+		}
+		return s.setMembers(ctx, role.ID, current, memberIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("audit: scim group updated role=%d name=%q members=%d", role.ID, role.Name, len(memberIDs))
+	return s.afterMembersChanged(ctx, role.ID, append(current, memberIDs...))
+}
+
+// setMembers assigns the role to the users of want and takes it from the
+// users of current that are not in want.
+func (s *SCIMService) setMembers(ctx context.Context, roleID int, current, want []int64) error {
+	for _, userID := range want {
+		if containsID(current, userID) {
+			continue
+		}
+		if _, err := s.user(ctx, strconv.FormatInt(userID, 10)); errors.Is(err, sql.ErrNoRows) {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "member %d is not a user", userID)
+		} else if err != nil {
+			return err
+		}
+		if err := s.userRepo.AssignRole(ctx, userID, roleID); err != nil {
+			return err
+		}
+	}
+	for _, userID := range current {
+		if containsID(want, userID) {
+			continue
+		}
+		if err := s.userRepo.UnassignRole(ctx, userID, roleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterMembersChanged refreshes the cached users whose roles may have
+// changed and returns the group.
+func (s *SCIMService) afterMembersChanged(ctx context.Context, roleID int, userIDs []int64) (*scim.Group, error) {
+	for _, userID := range userIDs {
+		if err := s.refreshUser(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetGroup(ctx, strconv.Itoa(roleID))
+}
+
+// DeleteGroup takes the role from its members and deletes it. A role that
+// still has rights, grants, groups or OAuth clients is kept.
+func (s *SCIMService) DeleteGroup(ctx context.Context, id string) error {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return err
+	}
+	current, err := s.memberIDsOf(ctx, role.ID)
+	if err != nil {
+		return err
+	}
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.setMembers(ctx, role.ID, current, nil); err != nil {
+			return err
+		}
+		return s.roleRepo.Delete(ctx, role.ID)
+	})
+	if isViolation(err, "23503") {
+		return scim.Errorf(http.StatusConflict, "", "role %q is still used by role rights, grants, groups or OAuth clients", role.Name)
+	}
+	if err != nil {
+		return err
+	}
+	for _, userID := range current {
+		if err := s.refreshUser(ctx, userID); err != nil {
+			return err
+		}
+	}
+	log.Printf("audit: scim group deleted role=%d name=%q", role.ID, role.Name)
+	return nil
+}
+
+// role returns the role of a group ID, never the super-admin role.
+func (s *SCIMService) role(ctx context.Context, id string) (*entity.Role, error) {
+	roleID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == entity.SuperAdminRole {
+		return nil, sql.ErrNoRows
+	}
+	return role, nil
+}
+
+// members returns the users of the organization by the IDs of the roles
+// they hold.
+func (s *SCIMService) members(ctx context.Context) (map[int][]*entity.User, error) {
+	users, err := s.userRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[int][]*entity.User)
+	for _, user := range users {
+		for _, role := range user.Roles {
+			members[role.ID] = append(members[role.ID], user)
+		}
+	}
+	return members, nil
+}
+
+func (s *SCIMService) memberIDsOf(ctx context.Context, roleID int) ([]int64, error) {
+	members, err := s.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members[roleID]))
+	for _, user := range members[roleID] {
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+func scimGroup(role *entity.Role, members []*entity.User) *scim.Group {
+	id := strconv.Itoa(role.ID)
+	group := &scim.Group{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          id,
+		DisplayName: role.Name,
+		Meta:        meta("Group", "/Groups/"+id, role.CreatedAt, role.UpdatedAt),
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	for _, user := range members {
+		userID := strconv.FormatInt(user.ID, 10)
+		group.Members = append(group.Members, scim.MultiValue{
+			Value:   userID,
+			Display: user.Email,
+			Ref:     scim.BasePath + "/Users/" + userID,
+		})
+	}
+	return group
+}
+
+// groupName checks the displayName of a group, which may not take over
+// the super-admin role.
+func groupName(displayName string) (string, error) {
+	name := strings.TrimSpace(displayName)
+	switch {
+	case name == "":
+		return "", scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "displayName is required")
+	case strings.EqualFold(name, entity.SuperAdminRole):
+		return "", scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "displayName %q is reserved", name)
+	}
+	return name, nil
+}
+
+func roleConflict(err error, name string) error {
+	if isViolation(err, "23505") {
+		return scim.Errorf(http.StatusConflict, scim.Uniqueness, "displayName %q is taken", name)
+	}
+	return err
+}
+
+// memberIDs returns the user IDs of members, without duplicates.
+func memberIDs(members []scim.MultiValue) ([]int64, error) {
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseInt(m.Value, 10, 64)
+		if err != nil {
+			return nil, scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "member %q is not a user id", m.Value)
+		}
+		if !containsID(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPatch calls apply for every operation, with the op in lower case
+// and a parsed path. An operation without a path carries an object whose
+// attributes are applied one by one.
+func applyPatch(req *scim.PatchRequest, apply func(op string, path *scim.Path, value json.RawMessage) error) error {
+	if len(req.Operations) == 0 {
+		return scim.Errorf(http.StatusBadRequest, scim.InvalidSyntax, "no operations")
+	}
+	for _, operation := range req.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidSyntax, "unknown op %q", operation.Op)
+		}
+
+		if operation.Path != "" {
+			path, err := scim.ParsePath(operation.Path)
+			if err != nil {
+				return err
+			}
+			if err := apply(op, path, operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if op == "remove" {
+			return scim.Errorf(http.StatusBadRequest, scim.NoTarget, "remove needs a path")
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return scim.Errorf(http.StatusBadRequest, scim.InvalidValue, "an operation without a path needs an object value")
+		}
+		keys := make([]string, 0, len(attributes))
+		for key := range attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path, err := scim.ParsePath(key)
+			if err != nil {
+				return err
+			}
+			if err := apply(op, path, attributes[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func decodeValue(value json.RawMessage, v interface{}) error {
+	if len(value) == 0 {
+		return errors.New("missing value")
+	}
+	return json.Unmarshal(value, v)
+}
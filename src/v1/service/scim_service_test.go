@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/scim"
+	"test-tablelink/src/v1/tenant"
+)
+
+func newSCIMService(repos *testRepos) *SCIMService {
+	return NewSCIMService(repos.scimTokens, repos.store, repos.users, repos.roles, repos.redis)
+}
+
+// scimStatus returns the HTTP status and scimType of a SCIM error.
+func scimStatus(t *testing.T, err error) (int, string) {
+	t.Helper()
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) {
+		t.Fatalf("err = %v, want a SCIM error", err)
+	}
+	return scimErr.StatusCode(), scimErr.ScimType
+}
+
+func patch(t *testing.T, operations string) *scim.PatchRequest {
+	t.Helper()
+	var req scim.PatchRequest
+	if err := json.Unmarshal([]byte(`{"schemas":["`+scim.PatchOpSchema+`"],"Operations":`+operations+`}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	return &req
+}
+
+func query(t *testing.T, filter string) *scim.Query {
+	t.Helper()
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &scim.Query{Filter: f, StartIndex: 1, Count: scim.MaxResults}
+}
+
+func TestSCIMTokens(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, _, admin := newTenant(t, repos, "acme", "admin@acme.com")
+	globex, _, _ := newTenant(t, repos, "globex", "admin@globex.com")
+	svc := newSCIMService(repos)
+	ctx := context.WithValue(acme, "user", admin)
+
+	if _, err := svc.CreateToken(ctx, &contract.CreateSCIMTokenRequest{Name: " "}); !errors.Is(err, ErrInvalidSCIMToken) {
+		t.Errorf("CreateToken without a name = %v, want ErrInvalidSCIMToken", err)
+	}
+	scoped := authz.WithTokenScopes(ctx, nil)
+	if _, err := svc.CreateToken(scoped, &contract.CreateSCIMTokenRequest{Name: "okta"}); !errors.Is(err, ErrSCIMSessionRequired) {
+		t.Errorf("CreateToken with an API token = %v, want ErrSCIMSessionRequired", err)
+	}
+
+	resp, err := svc.CreateToken(ctx, &contract.CreateSCIMTokenRequest{Name: "okta"})
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	created := resp.Data.(contract.CreatedSCIMToken)
+	stored := created.SCIMToken.(*entity.SCIMToken)
+	if !strings.HasPrefix(created.Token, stored.Prefix+"_") || !strings.HasPrefix(stored.Prefix, entity.SCIMTokenPrefix) {
+		t.Errorf("token %q does not start with its prefix %q", created.Token, stored.Prefix)
+	}
+	if strings.Contains(stored.TokenHash, created.Token) {
+		t.Error("the token is stored in clear")
+	}
+
+	token, err := svc.Authenticate(context.Background(), created.Token)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if id, _ := tenant.OrganizationID(acme); token.OrganizationID != id || token.LastUsedAt == nil {
+		t.Errorf("token = %+v, want acme's, marked used", token)
+	}
+	for _, raw := range []string{"", created.Token + "x", strings.Replace(created.Token, entity.SCIMTokenPrefix, entity.APITokenPrefix, 1), entity.SCIMTokenPrefix + "unknown_secret"} {
+		if _, err := svc.Authenticate(context.Background(), raw); !errors.Is(err, ErrInvalidSCIMToken) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidSCIMToken", raw, err)
+		}
+	}
+
+	// Other organizations neither see nor delete the token
+	if resp, err := svc.GetTokens(globex); err != nil || len(resp.Data.([]*entity.SCIMToken)) != 0 {
+		t.Errorf("globex tokens = %v, %v", resp, err)
+	}
+	if _, err := svc.DeleteToken(globex, stored.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteToken from globex = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := svc.DeleteToken(ctx, stored.ID); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+	if _, err := svc.Authenticate(context.Background(), created.Token); !errors.Is(err, ErrInvalidSCIMToken) {
+		t.Errorf("Authenticate after delete = %v, want ErrInvalidSCIMToken", err)
+	}
+}
+
+func TestSCIMUsers(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, acmeRole, _ := newTenant(t, repos, "acme", "admin@acme.com")
+	globex, _, globexAdmin := newTenant(t, repos, "globex", "admin@globex.com")
+	svc := newSCIMService(repos)
+
+	var resource scim.User
+	json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"externalId": "00u1",
+		"userName": "jane@acme.com",
+		"name": {"givenName": "Jane", "familyName": "Doe"},
+		"emails": [{"value": "jane@acme.com", "primary": true}],
+		"password": "jane-secret",
+		"active": true
+	}`), &resource)
+	user, err := svc.CreateUser(acme, &resource)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.UserName != "jane@acme.com" || user.DisplayName != "Jane Doe" || !bool(*user.Active) || user.Password != "" {
+		t.Errorf("user = %+v", user)
+	}
+	if user.Meta.Location != scim.BasePath+"/Users/"+user.ID {
+		t.Errorf("location = %q", user.Meta.Location)
+	}
+	stored, _ := repos.users.GetByEmail(acme, "jane@acme.com")
+	if !password.Compare(stored.Password, "jane-secret") || stored.Password == "jane-secret" {
+		t.Error("password not stored hashed")
+	}
+
+	if _, err := svc.CreateUser(acme, &resource); err == nil {
+		t.Error("CreateUser accepted a taken userName")
+	} else if status, scimType := scimStatus(t, err); status != http.StatusConflict || scimType != scim.Uniqueness {
+		t.Errorf("duplicate = %d %s", status, scimType)
+	}
+	if _, err := svc.CreateUser(acme, &scim.User{}); err == nil {
+		t.Error("CreateUser accepted a user without userName")
+	}
+
+	// Users are listed and filtered within the organization
+	list, err := svc.ListUsers(acme, query(t, `userName eq "JANE@acme.com"`))
+	if err != nil || list.TotalResults != 1 {
+		t.Fatalf("filtered list = %+v, %v", list, err)
+	}
+	if list, _ := svc.ListUsers(acme, query(t, "")); list.TotalResults != 2 {
+		t.Errorf("acme has %d users, want 2", list.TotalResults)
+	}
+	if _, err := svc.GetUser(acme, "42x"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser with a bad id = %v", err)
+	}
+	if _, err := svc.GetUser(acme, "1"+strings.Repeat("0", 3)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser of a missing user = %v", err)
+	}
+	if _, err := svc.GetUser(globex, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("globex reads acme's user: %v", err)
+	}
+
+	// Okta deactivates with a path-less replace, Azure AD with a string
+	repos.users.AssignRole(acme, stored.ID, acmeRole.ID)
+	repos.redis.SetUser(acme, stored)
+	user, err = svc.PatchUser(acme, user.ID, patch(t, `[{"op": "replace", "value": {"active": false}}]`))
+	if err != nil || bool(*user.Active) {
+		t.Fatalf("deactivate = %+v, %v", user, err)
+	}
+	if _, err := svc.PatchUser(acme, user.ID, patch(t, `[{"op": "Replace", "path": "active", "value": "True"}]`)); err != nil {
+		t.Fatalf("reactivate: %v", err)
+	}
+	user, err = svc.PatchUser(acme, user.ID, patch(t, `[
+		{"op": "replace", "path": "name.formatted", "value": "Jane Roe"},
+		{"op": "replace", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "ops"},
+		{"op": "add", "path": "emails[type eq \"work\"].value", "value": "ignored@acme.com"}
+	]`))
+	if err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+	if user.DisplayName != "Jane Roe" || !bool(*user.Active) || user.UserName != "jane@acme.com" {
+		t.Errorf("patched user = %+v", user)
+	}
+	if len(user.Groups) != 1 || user.Groups[0].Display != "admin" {
+		t.Errorf("groups = %+v, want the admin role", user.Groups)
+	}
+	if cached, _ := repos.redis.GetUser(acme, stored.ID); cached.Name != "Jane Roe" {
+		t.Errorf("cached user = %q, want refreshed", cached.Name)
+	}
+
+	for _, tt := range []struct{ ops, scimType string }{
+		{`[]`, scim.InvalidSyntax},
+		{`[{"op": "move", "path": "active"}]`, scim.InvalidSyntax},
+		{`[{"op": "remove"}]`, scim.NoTarget},
+		{`[{"op": "remove", "path": "userName"}]`, scim.Mutability},
+		{`[{"op": "replace", "path": "active", "value": "maybe"}]`, scim.InvalidValue},
+		{`[{"op": "replace", "path": "members[value eq"}]`, scim.InvalidPath},
+	} {
+		_, err := svc.PatchUser(acme, user.ID, patch(t, tt.ops))
+		if status, scimType := scimStatus(t, err); status != http.StatusBadRequest || scimType != tt.scimType {
+			t.Errorf("PatchUser(%s) = %d %s, want 400 %s", tt.ops, status, scimType, tt.scimType)
+		}
+	}
+
+	// PUT replaces, a taken userName is a conflict
+	resource.UserName = "jane.doe@acme.com"
+	resource.Name = &scim.Name{Formatted: "Jane D."}
+	if user, err = svc.ReplaceUser(acme, user.ID, &resource); err != nil || user.UserName != "jane.doe@acme.com" || user.DisplayName != "Jane D." {
+		t.Errorf("ReplaceUser = %+v, %v", user, err)
+	}
+	resource.UserName = "admin@acme.com"
+	if _, err := svc.ReplaceUser(acme, user.ID, &resource); err == nil {
+		t.Error("ReplaceUser took another user's userName")
+	}
+
+	if err := svc.DeleteUser(globex, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("globex deletes acme's user: %v", err)
+	}
+	if err := svc.DeleteUser(acme, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := svc.GetUser(acme, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleted user = %v", err)
+	}
+	if _, err := repos.users.GetByID(globex, globexAdmin.ID); err != nil {
+		t.Errorf("globex admin gone: %v", err)
+	}
+}
+
+func TestSCIMUserCreatedInactive(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, _, _ := newTenant(t, repos, "acme", "admin@acme.com")
+	svc := newSCIMService(repos)
+
+	inactive := scim.Bool(false)
+	user, err := svc.CreateUser(acme, &scim.User{UserName: "john@acme.com", Active: &inactive})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if bool(*user.Active) || user.DisplayName != "john@acme.com" {
+		t.Errorf("user = %+v, want inactive and named after userName", user)
+	}
+}
+
+func TestSCIMGroups(t *testing.T) {
+	repos := newTestRepos(t)
+	acme, acmeRole, admin := newTenant(t, repos, "acme", "admin@acme.com")
+	globex, _, globexAdmin := newTenant(t, repos, "globex", "admin@globex.com")
+	svc := newSCIMService(repos)
+	jane := &entity.User{Name: "Jane", Email: "jane@acme.com", Password: "secret"}
+	if err := repos.users.Create(acme, jane); err != nil {
+		t.Fatal(err)
+	}
+	repos.redis.SetUser(acme, jane)
+	ids := func(group *scim.Group) string {
+		var values []string
+		for _, m := range group.Members {
+			values = append(values, m.Value)
+		}
+		return strings.Join(values, ",")
+	}
+	janeID, adminID := jane.ID, admin.ID
+
+	// Roles are groups, their holders the members
+	group, err := svc.GetGroup(acme, strconv.Itoa(acmeRole.ID))
+	if err != nil || group.DisplayName != "admin" || ids(group) != strconv.FormatInt(adminID, 10) {
+		t.Fatalf("admin group = %+v, %v", group, err)
+	}
+
+	group, err = svc.CreateGroup(acme, &scim.Group{DisplayName: "engineers", Members: []scim.MultiValue{{Value: strconv.FormatInt(janeID, 10)}}})
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if ids(group) != strconv.FormatInt(janeID, 10) || group.Meta.Location != scim.BasePath+"/Groups/"+group.ID {
+		t.Errorf("group = %+v", group)
+	}
+	if cached, _ := repos.redis.GetUser(acme, janeID); !cached.HasRole("engineers") {
+		t.Error("the cached user did not get the role")
+	}
+
+	for _, tt := range []struct {
+		group    scim.Group
+		status   int
+		scimType string
+	}{
+		{scim.Group{}, http.StatusBadRequest, scim.InvalidValue},
+		{scim.Group{DisplayName: "engineers"}, http.StatusConflict, scim.Uniqueness},
+		{scim.Group{DisplayName: entity.SuperAdminRole}, http.StatusBadRequest, scim.InvalidValue},
+		{scim.Group{DisplayName: "x", Members: []scim.MultiValue{{Value: "jane"}}}, http.StatusBadRequest, scim.InvalidValue},
+		{scim.Group{DisplayName: "x", Members: []scim.MultiValue{{Value: strconv.FormatInt(globexAdmin.ID, 10)}}}, http.StatusBadRequest, scim.InvalidValue},
+	} {
+		_, err := svc.CreateGroup(acme, &tt.group)
+		if status, scimType := scimStatus(t, err); status != tt.status || scimType != tt.scimType {
+			t.Errorf("CreateGroup(%+v) = %d %s, want %d %s", tt.group, status, scimType, tt.status, tt.scimType)
+		}
+	}
+	if _, err := repos.roles.GetByName(acme, "x"); !errors.Is(err, sql.ErrNoRows) {
+		t.Error("a failed CreateGroup left its role behind")
+	}
+
+	// Azure AD adds and removes members, Okta renames with a path-less
+	// replace
+	group, err = svc.PatchGroup(acme, group.ID, patch(t, `[{"op": "add", "path": "members", "value": [{"value": "`+strconv.FormatInt(adminID, 10)+`"}]}]`))
+	if err != nil || ids(group) != strconv.FormatInt(adminID, 10)+","+strconv.FormatInt(janeID, 10) {
+		t.Fatalf("add member = %+v, %v", group, err)
+	}
+	group, err = svc.PatchGroup(acme, group.ID, patch(t, `[
+		{"op": "remove", "path": "members[value eq \"`+strconv.FormatInt(janeID, 10)+`\"]"},
+		{"op": "replace", "value": {"displayName": "developers"}}
+	]`))
+	if err != nil || ids(group) != strconv.FormatInt(adminID, 10) || group.DisplayName != "developers" {
+		t.Fatalf("remove member and rename = %+v, %v", group, err)
+	}
+	if cached, _ := repos.redis.GetUser(acme, janeID); cached.HasRole("engineers") || cached.HasRole("developers") {
+		t.Error("the cached user kept the role")
+	}
+	group, err = svc.PatchGroup(acme, group.ID, patch(t, `[{"op": "remove", "path": "members", "value": [{"value": "`+strconv.FormatInt(adminID, 10)+`"}]}]`))
+	if err != nil || ids(group) != "" {
+		t.Fatalf("remove listed member = %+v, %v", group, err)
+	}
+	group, err = svc.ReplaceGroup(acme, group.ID, &scim.Group{DisplayName: "developers", Members: []scim.MultiValue{{Value: strconv.FormatInt(janeID, 10)}, {Value: strconv.FormatInt(janeID, 10)}}})
+	if err != nil || ids(group) != strconv.FormatInt(janeID, 10) {
+		t.Fatalf("ReplaceGroup = %+v, %v", group, err)
+	}
+	if _, err := svc.PatchGroup(acme, group.ID, patch(t, `[{"op": "remove", "path": "displayName"}]`)); err == nil {
+		t.Error("PatchGroup removed the displayName")
+	}
+	if _, err := svc.PatchGroup(acme, group.ID, patch(t, `[{"op": "replace", "path": "displayName", "value": "admin"}]`)); err == nil {
+		t.Error("PatchGroup took another role's name")
+	}
+
+	list, err := svc.ListGroups(acme, &scim.Query{StartIndex: 1, Count: scim.MaxResults, ExcludedAttributes: []string{"members"}})
+	if err != nil || list.TotalResults != 2 {
+		t.Fatalf("ListGroups = %+v, %v", list, err)
+	}
+	for _, r := range list.Resources.([]scim.Resource) {
+		if len(r.(*scim.Group).Members) != 0 {
+			t.Error("members were not excluded")
+		}
+	}
+	if list, _ := svc.ListGroups(acme, query(t, `displayName eq "developers"`)); list.TotalResults != 1 {
+		t.Errorf("filtered groups = %d, want 1", list.TotalResults)
+	}
+	if _, err := svc.GetGroup(globex, group.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("globex reads acme's group: %v", err)
+	}
+
+	if err := svc.DeleteGroup(acme, group.ID); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	if _, err := repos.roles.GetByName(acme, "developers"); !errors.Is(err, sql.ErrNoRows) {
+		t.Error("the role survived DeleteGroup")
+	}
+	if user, _ := repos.users.GetByID(acme, janeID); user.HasRole("developers") {
+		t.Error("the member kept the deleted role")
+	}
+
+	// A role with rights is kept whole
+	repos.roleRights.Create(acme, &entity.RoleRight{RoleID: int64(acmeRole.ID), Section: "be", Route: "/users", RRead: true})
+	err = svc.DeleteGroup(acme, strconv.Itoa(acmeRole.ID))
+	if status, _ := scimStatus(t, err); status != http.StatusConflict {
+		t.Errorf("DeleteGroup of a role with rights = %d, want 409", status)
+	}
+	if user, _ := repos.users.GetByID(acme, adminID); !user.HasRole("admin") {
+		t.Error("a failed DeleteGroup removed members")
+	}
+}
+
+func TestSCIMHidesSuperAdmin(t *testing.T) {
+	repos := newTestRepos(t)
+	ctx := tenant.WithOrganization(context.Background(), entity.DefaultOrganizationID)
+	superAdmin := repos.createRole(t, entity.SuperAdminRole)
+	root := repos.createUser(t, superAdmin.ID, "root@gmail.com", "secret")
+	svc := newSCIMService(repos)
+
+	if _, err := svc.GetGroup(ctx, strconv.Itoa(superAdmin.ID)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetGroup(super admin) = %v, want sql.ErrNoRows", err)
+	}
+	if list, _ := svc.ListGroups(ctx, query(t, "")); list.TotalResults != 0 {
+		t.Errorf("ListGroups = %d groups, want none", list.TotalResults)
+	}
+	rootID := strconv.FormatInt(root.ID, 10)
+	if _, err := svc.GetUser(ctx, rootID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser(super admin) = %v, want sql.ErrNoRows", err)
+	}
+	if list, _ := svc.ListUsers(ctx, query(t, "")); list.TotalResults != 0 {
+		t.Errorf("ListUsers = %d users, want none", list.TotalResults)
+	}
+	if _, err := svc.PatchUser(ctx, rootID, patch(t, `[{"op": "replace", "path": "active", "value": false}]`)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("PatchUser(super admin) = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := svc.ReplaceUser(ctx, rootID, &scim.User{UserName: "root@gmail.com"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ReplaceUser(super admin) = %v, want sql.ErrNoRows", err)
+	}
+	if err := svc.DeleteUser(ctx, rootID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteUser(super admin) = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := repos.users.GetByID(ctx, root.ID); err != nil {
+		t.Errorf("super admin: %v, want them kept", err)
+	}
+	if _, err := svc.PatchGroup(ctx, strconv.Itoa(superAdmin.ID), patch(t, `[{"op": "add", "path": "members", "value": [{"value": "1"}]}]`)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("PatchGroup(super admin) = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrInvalidSection is returned for a section name that is not 1 to 50
+	// lower case letters, digits, "-" or "_".
+	ErrInvalidSection = errors.New("invalid section name")
+	// ErrSectionExists is returned when creating a section twice.
+	ErrSectionExists = errors.New("section already exists")
+	// ErrSectionInUse is returned when deleting the section of the
+	// current request or one rights are granted in.
+	ErrSectionInUse = errors.New("section is in use")
+)
+
+var sectionName = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+type SectionService struct {
+	sectionRepo repository.SectionRepository
+}
+
+func NewSectionService(sectionRepo repository.SectionRepository) *SectionService {
+	return &SectionService{sectionRepo: sectionRepo}
+}
+
+// Exists reports whether name is a registered section.
+func (s *SectionService) Exists(ctx context.Context, name string) (bool, error) {
+	if !sectionName.MatchString(name) {
+		return false, nil
+	}
+	_, err := s.sectionRepo.GetByName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SectionService) GetSections(ctx context.Context) (*contract.SectionResponse, error) {
+	sections, err := s.sectionRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contract.SectionResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    sections,
+	}, nil
+}
+
+func (s *SectionService) CreateSection(ctx context.Context, req *contract.CreateSectionRequest) (*contract.SectionResponse, error) {
+	if !sectionName.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSection, req.Name)
+	}
+	section := &entity.Section{Name: req.Name, Description: req.Description}
+	err := s.sectionRepo.Create(ctx, section)
+	if isViolation(err, "23505") {
+		return nil, fmt.Errorf("%w: %s", ErrSectionExists, req.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contract.SectionResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    section,
+	}, nil
+}
+
+// DeleteSection removes a section without rights. current is the section
+// of the request, which cannot delete itself.
+func (s *SectionService) DeleteSection(ctx context.Context, name, current string) (*contract.SectionResponse, error) {
+	if name == current {
+		return nil, fmt.Errorf("%w: %s is the section of this request", ErrSectionInUse, name)
+	}
+	if _, err := s.sectionRepo.GetByName(ctx, name); err != nil {
+		return nil, err
+	}
+	err := s.sectionRepo.Delete(ctx, name)
+	if isViolation(err, "23503") {
+		return nil, fmt.Errorf("%w: rights are granted in %s", ErrSectionInUse, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contract.SectionResponse{
+		Status:  true,
+		Message: "Successfully",
+	}, nil
+}
+
+// isViolation reports whether err is a constraint violation with the given
+// Postgres error code, e.g. 23505 for unique and 23503 for foreign keys.
+func isViolation(err error, code string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && string(pqErr.Code) == code
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/repository/memory"
+	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/tenant"
+)
+
+func TestSectionService(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	svc := NewSectionService(memory.NewSectionRepository(repos.store))
+
+	if _, err := svc.CreateSection(ctx, &contract.CreateSectionRequest{Name: "mobile", Description: "apps"}); err != nil {
+		t.Fatalf("CreateSection: %v", err)
+	}
+	if _, err := svc.CreateSection(ctx, &contract.CreateSectionRequest{Name: "mobile"}); !errors.Is(err, ErrSectionExists) {
+		t.Errorf("duplicate error = %v, want ErrSectionExists", err)
+	}
+	for _, name := range []string{"", "Mobile", "fe app", "x/y"} {
+		if _, err := svc.CreateSection(ctx, &contract.CreateSectionRequest{Name: name}); !errors.Is(err, ErrInvalidSection) {
+			t.Errorf("CreateSection(%q) error = %v, want ErrInvalidSection", name, err)
+		}
+	}
+
+	for name, want := range map[string]bool{"be": true, "mobile": true, "fe": false, "": false} {
+		if got, err := svc.Exists(ctx, name); err != nil || got != want {
+			t.Errorf("Exists(%q) = %t, %v, want %t", name, got, err, want)
+		}
+	}
+
+	role := repos.createRole(t, "app")
+	if err := repos.roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(role.ID), Section: "mobile", Route: "/users/user", RRead: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.roleRights.Create(ctx, &entity.RoleRight{RoleID: int64(role.ID), Section: "partner", Route: "/users/user", RRead: true}); err == nil {
+		t.Error("granted a right in an unregistered section")
+	}
+
+	if _, err := svc.DeleteSection(ctx, "mobile", "be"); !errors.Is(err, ErrSectionInUse) {
+		t.Errorf("delete with rights error = %v, want ErrSectionInUse", err)
+	}
+	if _, err := svc.DeleteSection(ctx, "be", "be"); !errors.Is(err, ErrSectionInUse) {
+		t.Errorf("delete own section error = %v, want ErrSectionInUse", err)
+	}
+	if _, err := svc.DeleteSection(ctx, "fe", "be"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete unknown error = %v, want sql.ErrNoRows", err)
+	}
+}
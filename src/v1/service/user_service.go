@@ -2,19 +2,23 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 
 	"test-tablelink/src/entity"
-	"test-tablelink/src/repository"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/authz"
 	"test-tablelink/src/v1/contract"
+	"test-tablelink/src/v1/repository"
+	"test-tablelink/src/v1/tenant"
 )
 
 type UserService struct {
-	userRepo  *repository.UserRepository
-	redisRepo *repository.RedisRepository
+	userRepo  repository.UserRepository
+	redisRepo repository.RedisRepository
 }
 
-func NewUserService(userRepo *repository.UserRepository, redisRepo *repository.RedisRepository) *UserService {
+func NewUserService(userRepo repository.UserRepository, redisRepo repository.RedisRepository) *UserService {
 	return &UserService{
 		userRepo:  userRepo,
 		redisRepo: redisRepo,
@@ -22,10 +26,16 @@ func NewUserService(userRepo *repository.UserRepository, redisRepo *repository.R
 }
 
 type CreateUserRequest struct {
-	RoleID   int64  `json:"role_id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	// RoleID is the single role form of RoleIDs
+	RoleID   int64   `json:"role_id,omitempty"`
+	RoleIDs  []int64 `json:"role_ids"`
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Password string  `json:"password"`
+}
+
+type AssignRoleRequest struct {
+	RoleID int `json:"role_id"`
 }
 
 type UpdateUserRequest struct {
@@ -51,10 +61,35 @@ func (s *UserService) GetAllUsers(ctx context.Context) (*UserResponse, error) {
 	}, nil
 }
 
+// Me returns the logged in user and, while an admin acts as them, the
+// impersonation.
+func (s *UserService) Me(ctx context.Context) (*contract.UserResponse, error) {
+	user, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	me := contract.Me{User: user}
+	if impersonation, ok := authz.Impersonation(ctx); ok {
+		me.Impersonation = impersonation
+	}
+	return &contract.UserResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    me,
+	}, nil
+}
+
 func (s *UserService) GetUser(ctx context.Context, id int64) (*contract.UserResponse, error) {
 	// Try to get from Redis first
 	user, err := s.redisRepo.GetUser(ctx, id)
+	if err == nil && !tenant.Contains(ctx, user.OrganizationID) {
+		// The cache is shared by all organizations
+		return nil, sql.ErrNoRows
+	}
 	if err == nil {
+		if err := authz.Require(ctx, user); err != nil {
+			return nil, err
+		}
 		return &contract.UserResponse{
 			Status:  true,
 			Message: "Successfully",
@@ -67,6 +102,9 @@ func (s *UserService) GetUser(ctx context.Context, id int64) (*contract.UserResp
 	if err != nil {
 		return nil, err
 	}
+	if err := authz.Require(ctx, user); err != nil {
+		return nil, err
+	}
 
 	// Cache the user in Redis
 	if err := s.redisRepo.SetUser(ctx, user); err != nil {
@@ -81,14 +119,31 @@ func (s *UserService) GetUser(ctx context.Context, id int64) (*contract.UserResp
 }
 
 func (s *UserService) CreateUser(ctx context.Context, req *CreateUserRequest) (*UserResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	hashed, err := password.Hash(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs := req.RoleIDs
+	if req.RoleID != 0 {
+		roleIDs = append([]int64{req.RoleID}, roleIDs...)
+	}
+	roles := make([]entity.Role, 0, len(roleIDs))
+	for _, id := range roleIDs {
+		roles = append(roles, entity.Role{ID: int(id)})
+	}
+
 	user := &entity.User{
-		RoleID:   req.RoleID,
+		Roles:    roles,
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: req.Password,
+		Password: hashed,
 	}
 
-	err := s.userRepo.Create(ctx, user)
+	err = s.userRepo.Create(ctx, user)
 	if err != nil {
 		return nil, err
 	}
@@ -106,15 +161,31 @@ func (s *UserService) CreateUser(ctx context.Context, req *CreateUserRequest) (*
 
 func (s *UserService) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*UserResponse, error) {
 	// Get user from context (set by auth middleware)
-	user, ok := ctx.Value("user").(*entity.User)
+	current, ok := ctx.Value("user").(*entity.User)
 	if !ok {
 		return nil, errors.New("user not found in context")
 	}
 
+	return s.UpdateUserByID(ctx, current.ID, req)
+}
+
+// UpdateUserByID updates any user, subject to the conditions of the
+// caller's rights on the target.
+func (s *UserService) UpdateUserByID(ctx context.Context, id int64, req *UpdateUserRequest) (*UserResponse, error) {
+	// The context user comes from the Redis cache, which does not carry the
+	// password, so reload the full row before writing it back
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.Require(ctx, user); err != nil {
+		return nil, err
+	}
+
 	// Update user name
 	user.Name = req.Name
 
-	err := s.userRepo.Update(ctx, user)
+	err = s.userRepo.Update(ctx, user)
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +201,74 @@ func (s *UserService) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*
 	}, nil
 }
 
+func (s *UserService) AssignRole(ctx context.Context, userID int64, req *AssignRoleRequest) (*UserResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.AssignRole(ctx, userID, req.RoleID); err != nil {
+		return nil, err
+	}
+	return s.refreshRoles(ctx, userID)
+}
+
+func (s *UserService) UnassignRole(ctx context.Context, userID int64, roleID int) (*UserResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UnassignRole(ctx, userID, roleID); err != nil {
+		return nil, err
+	}
+	return s.refreshRoles(ctx, userID)
+}
+
+// authorize settles a conditional permission against the target user. The
+// user is only loaded when the request carries a pending check.
+func (s *UserService) authorize(ctx context.Context, userID int64) error {
+	if !authz.Pending(ctx) {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return authz.Require(ctx, user)
+}
+
+// refreshRoles reloads the user after a role change and updates the cached
+// copy, which is what sessions are authorized against.
+func (s *UserService) refreshRoles(ctx context.Context, userID int64) (*UserResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.redisRepo.GetUser(ctx, userID); err == nil {
+		if err := s.redisRepo.SetUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return &UserResponse{
+		Status:  true,
+		Message: "Successfully",
+		Data:    user,
+	}, nil
+}
+
 func (s *UserService) DeleteUser(ctx context.Context, userID int64) (*UserResponse, error) {
+	if err := refuseImpersonation(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, userID); err != nil {
+		return nil, err
+	}
+
 	err := s.userRepo.Delete(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -147,12 +285,15 @@ func (s *UserService) DeleteUser(ctx context.Context, userID int64) (*UserRespon
 	}, nil
 }
 
-func (s *UserService) Login(ctx context.Context, email, password string) (*contract.UserResponse, error) {
-	// Get user by email and password
-	user, err := s.userRepo.GetByEmailAndPassword(ctx, email, password)
+func (s *UserService) Login(ctx context.Context, email, pass string) (*contract.UserResponse, error) {
+	// Get user by email and check the password
+	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
+	if !password.Compare(user.Password, pass) {
+		return nil, errors.New("invalid email or password")
+	}
 
 	// Cache the user in Redis
 	if err := s.redisRepo.SetUser(ctx, user); err != nil {
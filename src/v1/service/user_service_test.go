@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"test-tablelink/src/entity"
+	"test-tablelink/src/password"
+	"test-tablelink/src/v1/authz"
+	"test-tablelink/src/v1/tenant"
+
+	"github.com/lib/pq"
+	goRedis "github.com/redis/go-redis/v9"
+)
+
+func pqCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
+
+func TestUserServiceGetAllUsers(t *testing.T) {
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "admin")
+	repos.createUser(t, role.ID, "a@gmail.com", "secret")
+	repos.createUser(t, role.ID, "b@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+
+	resp, err := svc.GetAllUsers(tenant.All(context.Background()))
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	users := resp.Data.([]*entity.User)
+	if len(users) != 2 {
+		t.Fatalf("got %d users, want 2", len(users))
+	}
+	for _, u := range users {
+		if u.Password != "" {
+			t.Errorf("user %d leaks its password", u.ID)
+		}
+		if !u.HasRole("admin") {
+			t.Errorf("user %d roles = %+v, want admin", u.ID, u.Roles)
+		}
+	}
+}
+
+func TestUserServiceGetUser(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "admin")
+	user := repos.createUser(t, role.ID, "a@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+
+	resp, err := svc.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got := resp.Data.(*entity.User); got.Email != user.Email {
+		t.Errorf("GetUser email = %q, want %q", got.Email, user.Email)
+	}
+	if _, err := repos.redis.GetUser(ctx, user.ID); err != nil {
+		t.Errorf("user was not cached on a miss: %v", err)
+	}
+
+	if _, err := svc.GetUser(ctx, 999); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser(999) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestUserServiceCreateUser(t *testing.T) {
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	repos.createUser(t, role.ID, "taken@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+
+	tests := []struct {
+		name     string
+		req      CreateUserRequest
+		wantCode string
+	}{
+		{"ok", CreateUserRequest{RoleID: int64(role.ID), Name: "New", Email: "new@gmail.com", Password: "secret"}, ""},
+		{"duplicate email", CreateUserRequest{RoleID: int64(role.ID), Name: "Dup", Email: "taken@gmail.com", Password: "secret"}, "23505"},
+		{"unknown role", CreateUserRequest{RoleID: 42, Name: "Lost", Email: "lost@gmail.com", Password: "secret"}, "23503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateUser(tenant.All(context.Background()), &tt.req)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("CreateUser: %v", err)
+				}
+				stored, _ := repos.users.GetByEmail(tenant.All(context.Background()), tt.req.Email)
+				if !password.Compare(stored.Password, tt.req.Password) || stored.Password == tt.req.Password {
+					t.Errorf("password was not stored hashed")
+				}
+				return
+			}
+			if code := pqCode(err); code != tt.wantCode {
+				t.Fatalf("CreateUser error = %v, want pq code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUserServiceUpdateUser(t *testing.T) {
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "a@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+
+	if _, err := svc.UpdateUser(tenant.All(context.Background()), &UpdateUserRequest{Name: "x"}); err == nil {
+		t.Fatal("UpdateUser without a context user should fail")
+	}
+
+	// The middleware puts the cached user, without password, in the context
+	if err := repos.redis.SetUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	cached, _ := repos.redis.GetUser(context.Background(), user.ID)
+	ctx := context.WithValue(tenant.All(context.Background()), "user", cached)
+
+	if _, err := svc.UpdateUser(ctx, &UpdateUserRequest{Name: "Renamed"}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	stored, _ := repos.users.GetByID(ctx, user.ID)
+	if stored.Name != "Renamed" {
+		t.Errorf("name = %q, want Renamed", stored.Name)
+	}
+	if stored.Password != "secret" {
+		t.Errorf("password = %q, update must not clear it", stored.Password)
+	}
+	if c, _ := repos.redis.GetUser(ctx, user.ID); c.Name != "Renamed" {
+		t.Errorf("cached name = %q, want Renamed", c.Name)
+	}
+}
+
+func TestUserServiceDeleteUser(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	role := repos.createRole(t, "user")
+	user := repos.createUser(t, role.ID, "a@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+	repos.redis.SetUser(ctx, user)
+
+	if _, err := svc.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := repos.users.GetByID(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("user still stored: %v", err)
+	}
+	if _, err := repos.redis.GetUser(ctx, user.ID); !errors.Is(err, goRedis.Nil) {
+		t.Errorf("user still cached: %v", err)
+	}
+}
+
+func TestUserServiceCreateUserWithRoles(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	support := repos.createRole(t, "support")
+	billing := repos.createRole(t, "billing")
+	svc := NewUserService(repos.users, repos.redis)
+
+	req := &CreateUserRequest{RoleIDs: []int64{int64(support.ID), int64(billing.ID)}, Name: "S", Email: "s@gmail.com", Password: "secret"}
+	if _, err := svc.CreateUser(ctx, req); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	user, _ := repos.users.GetByEmail(ctx, "s@gmail.com")
+	if !user.HasRole("support") || !user.HasRole("billing") {
+		t.Errorf("roles = %+v, want support and billing", user.Roles)
+	}
+}
+
+func TestUserServiceAssignRole(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	support := repos.createRole(t, "support")
+	billing := repos.createRole(t, "billing")
+	user := repos.createUser(t, support.ID, "s@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+	repos.redis.SetUser(ctx, user)
+
+	resp, err := svc.AssignRole(ctx, user.ID, &AssignRoleRequest{RoleID: billing.ID})
+	if err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	if got := resp.Data.(*entity.User); !got.HasRole("support") || !got.HasRole("billing") {
+		t.Errorf("roles after assign = %+v", got.Roles)
+	}
+	if cached, _ := repos.redis.GetUser(ctx, user.ID); !cached.HasRole("billing") {
+		t.Error("cached user was not refreshed")
+	}
+
+	// Assigning twice is a no-op
+	if _, err := svc.AssignRole(ctx, user.ID, &AssignRoleRequest{RoleID: billing.ID}); err != nil {
+		t.Fatalf("second AssignRole: %v", err)
+	}
+	if _, err := svc.AssignRole(ctx, user.ID, &AssignRoleRequest{RoleID: 99}); pqCode(err) != "23503" {
+		t.Errorf("assigning an unknown role error = %v, want foreign key violation", err)
+	}
+
+	resp, err = svc.UnassignRole(ctx, user.ID, support.ID)
+	if err != nil {
+		t.Fatalf("UnassignRole: %v", err)
+	}
+	if got := resp.Data.(*entity.User); got.HasRole("support") || len(got.Roles) != 1 {
+		t.Errorf("roles after unassign = %+v", got.Roles)
+	}
+}
+
+func TestUserServiceRefusesImpersonation(t *testing.T) {
+	ctx := tenant.All(context.Background())
+	repos := newTestRepos(t)
+	admin := repos.createRole(t, "admin")
+	jane := repos.createUser(t, admin.ID, "jane@gmail.com", "secret")
+	bob := repos.createUser(t, admin.ID, "bob@gmail.com", "secret")
+	svc := NewUserService(repos.users, repos.redis)
+	asBob := authz.WithImpersonation(context.WithValue(ctx, "user", bob), &entity.Impersonation{ImpersonatorID: jane.ID, UserID: bob.ID})
+
+	calls := map[string]func() error{
+		"CreateUser": func() error {
+			_, err := svc.CreateUser(asBob, &CreateUserRequest{Name: "eve", Email: "eve@gmail.com", Password: "secret", RoleID: int64(admin.ID)})
+			return err
+		},
+		"AssignRole": func() error {
+			_, err := svc.AssignRole(asBob, jane.ID, &AssignRoleRequest{RoleID: admin.ID})
+			return err
+		},
+		"UnassignRole": func() error {
+			_, err := svc.UnassignRole(asBob, jane.ID, admin.ID)
+			return err
+		},
+		"DeleteUser": func() error {
+			_, err := svc.DeleteUser(asBob, jane.ID)
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, ErrImpersonating) {
+			t.Errorf("%s while impersonating error = %v, want %v", name, err, ErrImpersonating)
+		}
+	}
+	if user, err := repos.users.GetByID(ctx, jane.ID); err != nil || !user.HasRole("admin") {
+		t.Errorf("jane after the refused calls = %+v, %v", user, err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package tenant carries the organization a request operates in. The auth
+// middleware scopes every authenticated request to the user's
+// organization, and the repositories filter users, roles, rights and
+// grants by that scope. Crossing organizations must be asked for with
+// All: that is how super-admins operate across tenants, how credentials
+// are looked up before the organization is known and how the seeder,
+// tablelinkctl and background jobs run. A context with neither is refused
+// with ErrUnscoped, so a forgotten scope never reads every tenant.
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"test-tablelink/src/entity"
+)
+
+// Header selects an organization by slug: at login, and for super-admins
+// on any request.
+const Header = "X-Organization"
+
+// ErrOrganizationMismatch is returned when a request names an organization
+// other than the user's own.
+var ErrOrganizationMismatch = errors.New("user does not belong to the organization")
+
+// ErrUnscoped is returned for a context that is neither limited to an
+// organization nor marked with All.
+var ErrUnscoped = errors.New("context is not scoped to an organization")
+
+type scopeKey struct{}
+
+// allOrganizations is the scope of a context marked with All.
+type allOrganizations struct{}
+
+// WithOrganization limits ctx to one organization.
+func WithOrganization(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, scopeKey{}, id)
+}
+
+// All lets ctx operate across every organization. It replaces the
+// organization ctx was limited to, if any.
+func All(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, allOrganizations{})
+}
+
+// OrganizationID returns the organization ctx is limited to, and false
+// when it is not limited to one.
+func OrganizationID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(scopeKey{}).(int64)
+	return id, ok
+}
+
+// Check returns ErrUnscoped unless ctx is limited to an organization or
+// marked with All.
+func Check(ctx context.Context) error {
+	switch ctx.Value(scopeKey{}).(type) {
+	case int64, allOrganizations:
+		return nil
+	}
+	return ErrUnscoped
+}
+
+// For returns the organization a new row created under ctx belongs to: the
+// scope of ctx, else id, else the default organization.
+func For(ctx context.Context, id int64) (int64, error) {
+	if scoped, ok := OrganizationID(ctx); ok {
+		return scoped, nil
+	}
+	if err := Check(ctx); err != nil {
+		return 0, err
+	}
+	if id != 0 {
+		return id, nil
+	}
+	return entity.DefaultOrganizationID, nil
+}
+
+// Contains reports whether a row of organization id is visible under ctx,
+// never when ctx is unscoped.
+func Contains(ctx context.Context, id int64) bool {
+	if scoped, ok := OrganizationID(ctx); ok {
+		return scoped == id
+	}
+	return Check(ctx) == nil
+}